@@ -0,0 +1,323 @@
+// Package api provides a stable interface for the programmatic PHP code linting.
+//
+// A typical usage looks like this:
+//
+//	l := api.New(nil)
+//	if err := l.Index(ctx, []string{"vendor/"}); err != nil {
+//		return err
+//	}
+//	reports, err := l.Lint(ctx, []string{"src/"})
+//
+// Unlike the cmd package, it never exits the process or panics:
+// all errors are returned to the caller.
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/VKCOM/noverify/src/cmd/stubs"
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+// Options describes the linter settings.
+type Options struct {
+	// StubsDir is a path to the phpstorm-stubs directory.
+	// If empty, the embedded stubs are used.
+	StubsDir string
+
+	// Checks is a list of the reported checks.
+	// If nil, all checks that are enabled by default are reported,
+	// as well as all Rules matches.
+	Checks []string
+
+	// ExcludeChecks is a list of checks that are never reported.
+	ExcludeChecks []string
+
+	// Rules is a set of dynamic rules to run, can be nil.
+	// Its prefilter index is built by New.
+	Rules *rules.Set
+
+	// MaxConcurrency is a max number of files that are processed
+	// in parallel. If zero, runtime.NumCPU() is used.
+	MaxConcurrency int
+
+	// PHPExtensions is a list of PHP files extensions, without a dot.
+	// If nil, "php", "inc", "php5" and "phtml" are used.
+	PHPExtensions []string
+}
+
+// Report is a single linter diagnostic.
+type Report struct {
+	CheckName string `json:"check_name"`
+
+	// Level is one of the linter.Level* constants.
+	Level int `json:"level"`
+
+	// Severity is a level name, e.g. "ERROR" or "WARNING".
+	Severity string `json:"severity"`
+
+	// Critical is true for all reports with a level other than
+	// linter.LevelDoNotReject.
+	Critical bool `json:"critical"`
+
+	Message  string `json:"message"`
+	Filename string `json:"filename"`
+
+	// Line is 1-based, StartChar and EndChar are 0-based byte
+	// offsets inside the line.
+	Line      int `json:"line"`
+	StartChar int `json:"start_char"`
+	EndChar   int `json:"end_char"`
+
+	// Context is the contents of the report line.
+	Context string `json:"context"`
+}
+
+// String returns a one-line report description.
+func (r *Report) String() string {
+	return fmt.Sprintf("%s %s: %s at %s:%d", r.Severity, r.CheckName, r.Message, r.Filename, r.Line)
+}
+
+// Linter analyzes PHP files.
+//
+// The code base is processed in two phases: indexing, that collects
+// all the symbols definitions, and linting that produces the reports.
+// The indexing is finished by the first Lint or LintSource call,
+// Index can't be called after that.
+//
+// Linter methods should not be called concurrently.
+type Linter struct {
+	opts   Options
+	linter *linter.Linter
+
+	enabled  map[string]bool
+	excluded map[string]bool
+
+	stubsLoaded bool
+}
+
+var defaultPHPExtensions = []string{"php", "inc", "php5", "phtml"}
+
+// New returns a new linter with the given options.
+// If opts is nil, the default options are used.
+func New(opts *Options) *Linter {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	config := linter.NewConfig()
+	config.StubsDir = opts.StubsDir
+	if opts.Rules != nil {
+		config.Rules = opts.Rules
+		for _, set := range []*rules.ScopedSet{config.Rules.Any, config.Rules.Root, config.Rules.Local} {
+			set.BuildIndex()
+		}
+	}
+	if opts.MaxConcurrency > 0 {
+		config.MaxConcurrency = opts.MaxConcurrency
+	}
+	config.PHPExtensions = opts.PHPExtensions
+	if config.PHPExtensions == nil {
+		config.PHPExtensions = defaultPHPExtensions
+	}
+
+	l := &Linter{
+		opts:     *opts,
+		linter:   linter.NewLinter(config),
+		excluded: stringsToSet(opts.ExcludeChecks),
+	}
+	if opts.Checks != nil {
+		l.enabled = stringsToSet(opts.Checks)
+	} else {
+		l.enabled = defaultChecks(config.Rules)
+	}
+
+	return l
+}
+
+// Linter returns the underlying linter.
+// It can be used to access the collected meta info.
+func (l *Linter) Linter() *linter.Linter { return l.linter }
+
+// Index collects the symbols definitions from the PHP files.
+// Directories are traversed recursively.
+//
+// All files that are referenced by the linted code should be indexed.
+func (l *Linter) Index(ctx context.Context, paths []string) error {
+	if l.linter.MetaInfo().IsIndexingComplete() {
+		return errors.New("Index is called after Lint")
+	}
+	if err := l.loadStubs(ctx); err != nil {
+		return err
+	}
+	read, walkErr := l.readFilenames(paths)
+	if _, err := l.linter.ParseFilenamesContext(ctx, read); err != nil {
+		return err
+	}
+	return *walkErr
+}
+
+// Lint returns the reports for the PHP files sorted by the filename and line.
+// Directories are traversed recursively.
+//
+// If the indexing is not finished yet, files are indexed before the linting.
+func (l *Linter) Lint(ctx context.Context, paths []string) ([]Report, error) {
+	if !l.linter.MetaInfo().IsIndexingComplete() {
+		if err := l.Index(ctx, paths); err != nil {
+			return nil, err
+		}
+		l.linter.MetaInfo().SetIndexingComplete(true)
+	}
+
+	read, walkErr := l.readFilenames(paths)
+	reports, err := l.linter.ParseFilenamesContext(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	if *walkErr != nil {
+		return nil, *walkErr
+	}
+	return l.convertReports(reports), nil
+}
+
+// LintSource returns the reports for the src PHP code sorted by line.
+// The name is used as a filename in the reports.
+//
+// If the indexing is not finished yet, src is indexed before the linting.
+// Otherwise, the symbols that are defined inside src are not known to the linter.
+func (l *Linter) LintSource(ctx context.Context, name string, src []byte) ([]Report, error) {
+	read := func(ch chan linter.FileInfo) {
+		ch <- linter.FileInfo{Filename: name, Contents: src}
+	}
+
+	if !l.linter.MetaInfo().IsIndexingComplete() {
+		if err := l.loadStubs(ctx); err != nil {
+			return nil, err
+		}
+		if _, err := l.linter.ParseFilenamesContext(ctx, read); err != nil {
+			return nil, err
+		}
+		l.linter.MetaInfo().SetIndexingComplete(true)
+	}
+
+	reports, err := l.linter.ParseFilenamesContext(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	return l.convertReports(reports), nil
+}
+
+// readFilenames returns a callback that reads the PHP files from paths.
+// The returned error pointer is set after the callback is finished.
+func (l *Linter) readFilenames(paths []string) (linter.ReadCallback, *error) {
+	walkErr := new(error)
+	read := func(ch chan linter.FileInfo) {
+		*walkErr = l.linter.WalkFilenames(paths, nil, func(filename string) {
+			ch <- linter.FileInfo{Filename: filename}
+		})
+	}
+	return read, walkErr
+}
+
+func (l *Linter) loadStubs(ctx context.Context) error {
+	if l.stubsLoaded {
+		return nil
+	}
+
+	var read linter.ReadCallback
+	var walkErr *error
+	if l.opts.StubsDir != "" {
+		read, walkErr = l.readFilenames([]string{l.opts.StubsDir})
+	} else {
+		walkErr = new(error)
+		read = func(ch chan linter.FileInfo) {
+			for _, filename := range stubs.AssetNames() {
+				data, err := stubs.Asset(filename)
+				if err != nil {
+					*walkErr = fmt.Errorf("read embedded %q file: %v", filename, err)
+					return
+				}
+				ch <- linter.FileInfo{Filename: filename, Contents: data}
+			}
+		}
+	}
+
+	if _, err := l.linter.ParseFilenamesContext(ctx, read); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("load stubs: %v", err)
+	}
+	if *walkErr != nil {
+		return fmt.Errorf("load stubs: %v", *walkErr)
+	}
+	l.linter.MetaInfo().InitStubs()
+	l.stubsLoaded = true
+	return nil
+}
+
+func (l *Linter) convertReports(reports []*linter.Report) []Report {
+	res := make([]Report, 0, len(reports))
+	for _, r := range reports {
+		if r.IsDisabledByUser() {
+			continue
+		}
+		if !l.enabled[r.CheckName()] || l.excluded[r.CheckName()] {
+			continue
+		}
+		res = append(res, Report{
+			CheckName: r.CheckName(),
+			Level:     r.Level(),
+			Severity:  r.Severity(),
+			Critical:  r.IsCritical(),
+			Message:   r.Message(),
+			Filename:  r.GetFilename(),
+			Line:      r.Line(),
+			StartChar: r.StartChar(),
+			EndChar:   r.EndChar(),
+			Context:   r.Context(),
+		})
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Filename != res[j].Filename {
+			return res[i].Filename < res[j].Filename
+		}
+		return res[i].Line < res[j].Line
+	})
+	return res
+}
+
+// defaultChecks returns the checks that are enabled by default
+// and the names of all rset rules.
+func defaultChecks(rset *rules.Set) map[string]bool {
+	set := make(map[string]bool)
+	for _, info := range linter.GetDeclaredChecks() {
+		if info.Default {
+			set[info.Name] = true
+		}
+	}
+	for _, scoped := range []*rules.ScopedSet{rset.Any, rset.Root, rset.Local} {
+		if scoped == nil {
+			continue
+		}
+		for _, list := range &scoped.RulesByKind {
+			for _, rule := range list {
+				set[rule.Name] = true
+			}
+		}
+	}
+	return set
+}
+
+func stringsToSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
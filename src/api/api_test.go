@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+func newTestLinter(t *testing.T, opts *Options) *Linter {
+	stubsDir, err := ioutil.TempDir("", "noverify-api-stubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(stubsDir) })
+	if opts == nil {
+		opts = &Options{}
+	}
+	opts.StubsDir = stubsDir
+	return New(opts)
+}
+
+func TestLintSource(t *testing.T) {
+	l := newTestLinter(t, nil)
+	reports, err := l.LintSource(context.Background(), "test.php", []byte(`<?php
+function f($x) { return $x; }
+function g() {
+  $_ = f(1);
+  $_ = f();
+  $_ = undefined_func();
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Report{
+		{
+			CheckName: "argCount",
+			Level:     2,
+			Severity:  "WARNING",
+			Critical:  true,
+			Message:   "Too few arguments for f",
+			Filename:  "test.php",
+			Line:      5,
+			StartChar: 7,
+			EndChar:   8,
+			Context:   "  $_ = f();",
+		},
+		{
+			CheckName: "undefined",
+			Level:     1,
+			Severity:  "ERROR",
+			Critical:  true,
+			Message:   "Call to undefined function undefined_func",
+			Filename:  "test.php",
+			Line:      6,
+			StartChar: 7,
+			EndChar:   21,
+			Context:   "  $_ = undefined_func();",
+		},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("reports mismatch:\nhave: %+v\nwant: %+v", reports, want)
+	}
+	for i := range want {
+		if reports[i] != want[i] {
+			t.Errorf("report %d mismatch:\nhave: %+v\nwant: %+v", i, reports[i], want[i])
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noverify-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"lib/a.php": `<?php
+function a($x) { return $x; }`,
+		"src/b.php": `<?php
+function b() { return a(); }`,
+	}
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	l := newTestLinter(t, nil)
+	if err := l.Index(ctx, []string{filepath.Join(dir, "lib")}); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := l.Lint(ctx, []string{filepath.Join(dir, "src")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].CheckName != "argCount" || reports[0].Line != 2 {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+
+	if err := l.Index(ctx, []string{dir}); err == nil {
+		t.Errorf("expected an error for Index after Lint")
+	}
+}
+
+func TestLintChecks(t *testing.T) {
+	src := []byte(`<?php
+function f() {
+  g();
+  $x = 1;
+}
+`)
+
+	l := newTestLinter(t, &Options{ExcludeChecks: []string{"undefined"}})
+	reports, err := l.LintSource(context.Background(), "test.php", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].CheckName != "unused" {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+
+	l = newTestLinter(t, &Options{Checks: []string{"undefined"}})
+	reports, err = l.LintSource(context.Background(), "test.php", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].CheckName != "undefined" {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+}
+
+func TestLintErrors(t *testing.T) {
+	l := newTestLinter(t, nil)
+	if _, err := l.Lint(context.Background(), []string{"/non/existing/path.php"}); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = newTestLinter(t, nil)
+	if _, err := l.LintSource(ctx, "test.php", []byte(`<?php echo 1;`)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestLintEmptyRules(t *testing.T) {
+	// Rules sets without the scoped sets, like the linter.NewConfig default.
+	l := newTestLinter(t, &Options{Rules: &rules.Set{}})
+	reports, err := l.LintSource(context.Background(), "test.php", []byte(`<?php
+function f() { g(); }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].CheckName != "undefined" {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+}
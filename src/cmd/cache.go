@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+func cacheMain(args []string) (int, error) {
+	var cacheDir string
+
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage of noverify cache:\n")
+		fmt.Fprintf(out, "  $ noverify cache [flags] stats|prune|clear\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Actions:\n")
+		fmt.Fprintf(out, "  stats  \tPrint the number and size of the cached entries\n")
+		fmt.Fprintf(out, "  prune  \tRemove entries of the changed and removed files\n")
+		fmt.Fprintf(out, "  clear  \tRemove all cached entries\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Directory for linter cache")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0, nil
+		}
+		return 2, nil
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2, nil
+	}
+	if cacheDir == "" {
+		return 0, fmt.Errorf("cache dir is not specified")
+	}
+
+	switch action := fs.Arg(0); action {
+	case "stats":
+		stats, err := linter.GetCacheStats(cacheDir)
+		if err != nil {
+			return 0, err
+		}
+		printCacheStats(stats)
+	case "prune":
+		stats, err := linter.PruneCache(cacheDir)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Printf("Removed %d stale index entries, %d stale reports and %d legacy files\n",
+			stats.IndexStale, stats.ReportStale, stats.LegacyFiles)
+	case "clear":
+		if err := linter.ClearCache(cacheDir); err != nil {
+			return 0, err
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown action %q\n", action)
+		fs.Usage()
+		return 2, nil
+	}
+
+	return 0, nil
+}
+
+func printCacheStats(stats linter.CacheStats) {
+	if stats.IndexVersion != 0 {
+		fmt.Printf("Index:   %d entries (%d stale), %d bytes, version %d\n",
+			stats.IndexEntries, stats.IndexStale, stats.IndexSize, stats.IndexVersion)
+	} else if stats.IndexSize != 0 {
+		fmt.Printf("Index:   %d bytes, incompatible version or corrupted\n", stats.IndexSize)
+	} else {
+		fmt.Printf("Index:   empty\n")
+	}
+	fmt.Printf("Reports: %d entries (%d stale), %d bytes\n",
+		stats.ReportEntries, stats.ReportStale, stats.ReportSize)
+	if stats.LegacyFiles != 0 {
+		fmt.Printf("Legacy:  %d files, %d bytes (use prune to remove them)\n",
+			stats.LegacyFiles, stats.LegacySize)
+	}
+}
@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/cmd/embeddedrules"
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+// checkDoc is a catalogue entry for a declared check
+// or for a group of the dynamic rules that share the same name.
+type checkDoc struct {
+	Name    string    `json:"name"`
+	Default bool      `json:"default"`
+	Comment string    `json:"comment,omitempty"`
+	Before  string    `json:"before,omitempty"`
+	After   string    `json:"after,omitempty"`
+	Rules   []ruleDoc `json:"rules,omitempty"`
+}
+
+type ruleDoc struct {
+	Severity string           `json:"severity"`
+	Scope    string           `json:"scope"`
+	Path     string           `json:"path,omitempty"`
+	Source   string           `json:"source"`
+	Message  string           `json:"message"`
+	Examples []ruleExampleDoc `json:"examples,omitempty"`
+
+	filename string
+	line     int
+}
+
+type ruleExampleDoc struct {
+	Code  string `json:"code"`
+	Match bool   `json:"match"`
+}
+
+var ruleSeverityNames = map[int]string{
+	linter.LevelError:       "error",
+	linter.LevelWarning:     "warning",
+	linter.LevelInformation: "info",
+	linter.LevelDoNotReject: "maybe",
+}
+
+func checksMain(args []string) (int, error) {
+	var format string
+	var rulesFiles string
+
+	fs := flag.NewFlagSet("checks", flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage of noverify checks:\n")
+		fmt.Fprintf(out, "  $ noverify checks [flags]\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Prints the documentation for all declared checks and dynamic rules.\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&format, "format", "markdown", "Output format: markdown, json or html")
+	fs.StringVar(&rulesFiles, "rules", "", "Comma-separated list of rules files and directories to document along with the embedded rules")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0, nil
+		}
+		return 2, nil
+	}
+
+	var printDocs func(w io.Writer, docs []*checkDoc) error
+	switch format {
+	case "markdown":
+		printDocs = printChecksMarkdown
+	case "json":
+		printDocs = printChecksJSON
+	case "html":
+		printDocs = printChecksHTML
+	default:
+		return 0, fmt.Errorf("unknown format %q, expected markdown, json or html", format)
+	}
+
+	var paths []string
+	if rulesFiles != "" {
+		paths = strings.Split(rulesFiles, ",")
+	}
+	docs, err := collectCheckDocs(paths)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := printDocs(os.Stdout, docs); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// collectCheckDocs merges the declared checks with the embedded rules
+// and the rules from the given files and directories. Result is sorted by the check names.
+func collectCheckDocs(rulesPaths []string) ([]*checkDoc, error) {
+	docsByName := make(map[string]*checkDoc)
+	for _, info := range linter.GetDeclaredChecks() {
+		docsByName[info.Name] = &checkDoc{
+			Name:    info.Name,
+			Default: info.Default,
+			Comment: info.Comment,
+			Before:  info.Before,
+			After:   info.After,
+		}
+	}
+
+	addRules := func(filename string, data []byte) ([]string, error) {
+		rset, err := rules.NewParser().Parse(filename, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		addRuleDocs(docsByName, rset)
+		return rset.Includes, nil
+	}
+	for _, filename := range embeddedrules.AssetNames() {
+		data, err := embeddedrules.Asset(filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := addRules(filename, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := walkRulesFiles(rulesPaths, addRules); err != nil {
+		return nil, err
+	}
+
+	docs := make([]*checkDoc, 0, len(docsByName))
+	for _, doc := range docsByName {
+		sort.SliceStable(doc.Rules, func(i, j int) bool {
+			if doc.Rules[i].filename != doc.Rules[j].filename {
+				return doc.Rules[i].filename < doc.Rules[j].filename
+			}
+			return doc.Rules[i].line < doc.Rules[j].line
+		})
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Name < docs[j].Name
+	})
+	return docs, nil
+}
+
+func addRuleDocs(docsByName map[string]*checkDoc, rset *rules.Set) {
+
+	scopes := []struct {
+		name string
+		set  *rules.ScopedSet
+	}{
+		{"any", rset.Any},
+		{"root", rset.Root},
+		{"local", rset.Local},
+	}
+	for _, scope := range scopes {
+		for _, list := range scope.set.RulesByKind {
+			for _, rule := range list {
+				doc := docsByName[rule.Name]
+				if doc == nil {
+					// Rules are enabled by default, see declareRuleNames.
+					doc = &checkDoc{Name: rule.Name, Default: true}
+					docsByName[rule.Name] = doc
+				}
+				rdoc := ruleDoc{
+					Severity: ruleSeverityNames[rule.Level],
+					Scope:    scope.name,
+					Path:     rule.Path,
+					Source:   fmt.Sprintf("%s:%d", rule.Filename, rule.Line),
+					Message:  rule.Message,
+					filename: rule.Filename,
+					line:     rule.Line,
+				}
+				for _, test := range rule.Tests {
+					rdoc.Examples = append(rdoc.Examples, ruleExampleDoc{Code: test.Code, Match: test.Match})
+				}
+				doc.Rules = append(doc.Rules, rdoc)
+			}
+		}
+	}
+}
+
+func printChecksJSON(w io.Writer, docs []*checkDoc) error {
+	type checkList struct {
+		Checks []*checkDoc `json:"checks"`
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(checkList{Checks: docs})
+}
+
+func printChecksMarkdown(w io.Writer, docs []*checkDoc) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("# NoVerify checks\n")
+	for _, doc := range docs {
+		fmt.Fprintf(&buf, "\n## %s\n\n", doc.Name)
+		if doc.Comment != "" {
+			fmt.Fprintf(&buf, "%s\n\n", doc.Comment)
+		}
+		if doc.Default {
+			buf.WriteString("Enabled by default.\n")
+		} else {
+			buf.WriteString("Disabled by default, use `-allow-checks` to enable it.\n")
+		}
+		if doc.Before != "" {
+			fmt.Fprintf(&buf, "\nReported code:\n\n```php\n%s\n```\n", doc.Before)
+		}
+		if doc.After != "" {
+			fmt.Fprintf(&buf, "\nFixed code:\n\n```php\n%s\n```\n", doc.After)
+		}
+		if len(doc.Rules) == 0 {
+			continue
+		}
+
+		buf.WriteString("\n| Severity | Scope | Path | Source | Message |\n")
+		buf.WriteString("|---|---|---|---|---|\n")
+		for _, r := range doc.Rules {
+			fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s |\n",
+				r.Severity, r.Scope, markdownCell(r.Path), markdownCell(r.Source), markdownCell(r.Message))
+		}
+		for _, r := range doc.Rules {
+			if len(r.Examples) == 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, "\nExamples for %s:\n\n", r.Source)
+			for _, ex := range r.Examples {
+				verb := "matches"
+				if !ex.Match {
+					verb = "doesn't match"
+				}
+				fmt.Fprintf(&buf, "* %s %s\n", verb, markdownCode(ex.Code))
+			}
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// markdownCell escapes s for a markdown table cell.
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// markdownCode formats s as an inline code span.
+func markdownCode(s string) string {
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+var checksHTMLTemplate = template.Must(template.New("checks").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>NoVerify checks</title>
+</head>
+<body>
+<h1>NoVerify checks</h1>
+{{range .}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+{{if .Comment}}<p>{{.Comment}}</p>{{end}}
+<p>{{if .Default}}Enabled by default.{{else}}Disabled by default, use <code>-allow-checks</code> to enable it.{{end}}</p>
+{{if .Before}}<p>Reported code:</p>
+<pre><code>{{.Before}}</code></pre>{{end}}
+{{if .After}}<p>Fixed code:</p>
+<pre><code>{{.After}}</code></pre>{{end}}
+{{if .Rules}}<table>
+<tr><th>Severity</th><th>Scope</th><th>Path</th><th>Source</th><th>Message</th><th>Examples</th></tr>
+{{range .Rules}}<tr>
+<td>{{.Severity}}</td><td>{{.Scope}}</td><td>{{.Path}}</td><td>{{.Source}}</td><td>{{.Message}}</td>
+<td>{{range .Examples}}{{if .Match}}matches{{else}}doesn't match{{end}} <code>{{.Code}}</code><br>{{end}}</td>
+</tr>
+{{end}}</table>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func printChecksHTML(w io.Writer, docs []*checkDoc) error {
+	return checksHTMLTemplate.Execute(w, docs)
+}
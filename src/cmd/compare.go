@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+var (
+	compareFrom string
+	compareTo   string
+)
+
+// compareSubMain parses the usual linter flags along with the
+// revisions to compare and runs mainNoExit in the compare mode.
+func compareSubMain(args []string) (int, error) {
+	bindFlags()
+	flag.StringVar(&compareFrom, "from", "", "Old revision (e.g. previous release tag)")
+	flag.StringVar(&compareTo, "to", "", "New revision (e.g. release candidate branch)")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage of noverify compare:\n")
+		fmt.Fprintf(out, "  $ noverify compare -from=v1.0 -to=v1.1 [flags]\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Lints all files in both revisions and prints new, fixed and persisting reports.\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+	if disableCache {
+		linterConfig.CacheDir = ""
+	}
+
+	if compareFrom == "" || compareTo == "" {
+		return 0, fmt.Errorf("both -from and -to revisions must be specified")
+	}
+	return mainNoExit()
+}
+
+// compareMain lints the -from and -to revisions and prints the reports comparison.
+func compareMain(l *linter.Linter) (int, error) {
+	git.UseExec = gitExec
+
+	repo := gitRepo
+	if repo == "" {
+		gitDir, _, err := git.FindRepository(".")
+		if err != nil {
+			return 0, fmt.Errorf("Could not find git repository, specify it with -git: %v", err)
+		}
+		repo = gitDir
+	}
+
+	oldReports := compareLintRevision(l, repo, compareFrom)
+
+	// The stubs are kept by Reset.
+	l.MetaInfo().Reset()
+	newReports := compareLintRevision(l, repo, compareTo)
+
+	renames, err := git.Renames(repo, compareFrom, compareTo)
+	if err != nil {
+		log.Printf("Could not detect renamed files: %v", err)
+	}
+
+	res := linter.CompareReports(oldReports, newReports, renames)
+	if err := printComparison(outputFp, &res); err != nil {
+		return 0, err
+	}
+
+	criticalReports := 0
+	for _, r := range res.New {
+		if isCritical(r) {
+			criticalReports++
+		}
+	}
+	if criticalReports > 0 {
+		log.Printf("Found %d new critical reports", criticalReports)
+		return 2, nil
+	}
+	return 0, nil
+}
+
+// compareLintRevision indexes all files of the revision and returns the enabled reports.
+func compareLintRevision(l *linter.Linter, repo, rev string) []*linter.Report {
+	start := time.Now()
+	l.ParseFilenames(l.ReadFilesFromGit(repo, rev, nil))
+	parseIndexOnlyFiles(l)
+	l.MetaInfo().SetIndexingComplete(true)
+	log.Printf("Indexed %s in %s", rev, time.Since(start))
+
+	start = time.Now()
+	reports := l.ParseFilenames(l.ReadFilesFromGit(repo, rev, l.Config().ExcludeRegex))
+	log.Printf("Parsed %s in %s (%d reports)", rev, time.Since(start), len(reports))
+
+	filtered := reports[:0]
+	for _, r := range reports {
+		if !isEnabled(r) || (r.IsDisabledByUser() && canBeDisabled(r.GetFilename())) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered
+}
+
+func printComparison(w io.Writer, res *linter.ReportsComparison) error {
+	counts := res.CountByCheck()
+
+	if outputJSON {
+		type comparison struct {
+			New        []*linter.Report
+			Fixed      []*linter.Report
+			Persisting []*linter.Report
+			Checks     []linter.CheckCounts
+		}
+		return json.NewEncoder(w).Encode(&comparison{
+			New:        res.New,
+			Fixed:      res.Fixed,
+			Persisting: res.Persisting,
+			Checks:     counts,
+		})
+	}
+
+	sections := []struct {
+		title   string
+		reports []*linter.Report
+	}{
+		{"New", res.New},
+		{"Fixed", res.Fixed},
+		{"Persisting", res.Persisting},
+	}
+	for _, s := range sections {
+		fmt.Fprintf(w, "%s reports (%d):\n", s.title, len(s.reports))
+		for _, r := range s.reports {
+			fmt.Fprintf(w, "%s\n", r.String())
+		}
+		fmt.Fprintln(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Check\tNew\tFixed\tPersisting\t\n")
+	var total linter.CheckCounts
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", c.CheckName, c.New, c.Fixed, c.Persisting)
+		total.New += c.New
+		total.Fixed += c.Fixed
+		total.Persisting += c.Persisting
+	}
+	fmt.Fprintf(tw, "Total\t%d\t%d\t%d\t\n", total.New, total.Fixed, total.Persisting)
+	return tw.Flush()
+}
@@ -1,5 +1,7 @@
 package cmd
 
+import "github.com/VKCOM/noverify/src/linter"
+
 // MainConfig describes optional main function config.
 // All zero field values have some defined behavior.
 type MainConfig struct {
@@ -8,4 +10,11 @@ type MainConfig struct {
 	//
 	// If nil, behaves as a no-op function.
 	AfterFlagParse func()
+
+	// LinterConfig is a config of the linter that is used to analyze the files.
+	// The linter flags are bound to its fields, so they can be examined
+	// and changed in AfterFlagParse.
+	//
+	// If nil, linter.NewConfig() is used.
+	LinterConfig *linter.Config
 }
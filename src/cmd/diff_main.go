@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// diffFileMain lints the files changed by the -diff-file patch.
+//
+// The patch is expected to be already applied to the -diff-root tree.
+// Only reports on the added and changed lines are printed.
+func diffFileMain(l *linter.Linter) (int, error) {
+	f, err := os.Open(diffFile)
+	if err != nil {
+		return 0, fmt.Errorf("Could not open diff file: %v", err)
+	}
+	changes, err := git.ParseDiff(f)
+	f.Close()
+	if err != nil {
+		return 0, fmt.Errorf("Could not parse diff file: %v", err)
+	}
+
+	root, err := filepath.Abs(diffRoot)
+	if err != nil {
+		return 0, err
+	}
+
+	analysisFiles := flag.Args()
+	if len(analysisFiles) == 0 {
+		analysisFiles = []string{root}
+	}
+	linterConfig.AnalysisFiles = analysisFiles
+
+	start := time.Now()
+	l.ParseFilenames(l.ReadFilenames(analysisFiles, nil))
+	parseIndexOnlyFiles(l)
+	l.MetaInfo().SetIndexingComplete(true)
+	log.Printf("Indexing complete in %s", time.Since(start))
+
+	start = time.Now()
+	reports := l.ParseFilenames(l.ReadChangesFromWorkTree(root, changes))
+	log.Printf("Parsed changed files in %s", time.Since(start))
+
+	setWorkTreeOwnership(root)
+	criticalReports := analyzeReports(linter.ChangedLinesReports(root, changes, reports))
+
+	if criticalReports > 0 {
+		log.Printf("Found %d critical issues, please fix them.", criticalReports)
+		return 2, nil
+	}
+	log.Printf("No critical issues found. Your code is perfect.")
+	return 0, nil
+}
@@ -18,6 +18,10 @@ const allNonMaybe = "<all-non-maybe>"
 var (
 	outputFp io.Writer = os.Stderr
 
+	// linterConfig is a config of the linter used by the main command.
+	// The linter flags are bound to its fields, see MainConfig.LinterConfig.
+	linterConfig = linter.NewConfig()
+
 	disableCache bool
 
 	gitRepo string
@@ -30,10 +34,16 @@ var (
 	gitPushArg                 string
 	gitAuthorsWhitelist        string
 	gitWorkTree                string
+	gitStaged                  bool
 	gitSkipFetch               bool
 	gitDisableCompensateMaster bool
 	gitFullDiff                bool
 	gitIncludeUntracked        bool
+	gitDependents              bool
+	gitExec                    bool
+
+	diffFile string
+	diffRoot string
 
 	phpExtensionsArg string
 
@@ -45,6 +55,7 @@ var (
 	reportsCriticalSet      = map[string]bool{}
 
 	allowChecks       string
+	allowChecksSet    bool // Whether -allow-checks is given explicitly
 	allowDisable      string
 	allowDisableRegex *regexp.Regexp
 
@@ -57,15 +68,30 @@ var (
 
 	rulesList string
 
+	rulesProfile     bool
+	rulesProfileJSON string
+
 	output     string
 	outputJSON bool
 
+	reportOwners   bool
+	codeOwnersFile string
+
 	version bool
 
 	cpuProfile string
 	memProfile string
 )
 
+// defaultCacheDir returns the default -cache-dir value.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "noverify-cache")
+}
+
 func bindFlags() {
 	var enabledByDefault []string
 	declaredChecks := linter.GetDeclaredChecks()
@@ -75,13 +101,6 @@ func bindFlags() {
 		}
 	}
 
-	defaultCacheDir, err := os.UserCacheDir()
-	if err != nil {
-		defaultCacheDir = ""
-	} else {
-		defaultCacheDir = filepath.Join(defaultCacheDir, "noverify-cache")
-	}
-
 	flag.Usage = func() {
 		out := flag.CommandLine.Output()
 		fmt.Fprintf(out, "Usage of noverify:\n")
@@ -90,6 +109,8 @@ func bindFlags() {
 		fmt.Fprintf(out, "Flags:\n")
 		flag.PrintDefaults()
 		fmt.Fprintln(out)
+		printSubCommands(out)
+		fmt.Fprintln(out)
 		fmt.Fprintf(out, "Diagnostics (checks):\n")
 		for _, info := range declaredChecks {
 			extra := " (disabled by default)"
@@ -107,7 +128,11 @@ func bindFlags() {
 		"Comma-separated list of check names that are considered critical (all non-maybe checks by default)")
 
 	flag.StringVar(&rulesList, "rules", "",
-		"Comma-separated list of rules files")
+		"Comma-separated list of rules files and directories (scanned recursively for *.php files)")
+	flag.BoolVar(&rulesProfile, "rules-profile", false,
+		"Print per-rule execution statistics after the run")
+	flag.StringVar(&rulesProfileJSON, "rules-profile-json", "",
+		"Write per-rule execution statistics as JSON to `file`")
 
 	flag.StringVar(&gitRepo, "git", "", "Path to git repository to analyze")
 	flag.StringVar(&gitCommitFrom, "git-commit-from", "", "Analyze changes between commits <git-commit-from> and <git-commit-to>")
@@ -116,10 +141,16 @@ func bindFlags() {
 	flag.StringVar(&gitPushArg, "git-push-arg", "", "In {pre,post}-receive hooks a whole line from stdin can be passed")
 	flag.StringVar(&gitAuthorsWhitelist, "git-author-whitelist", "", "Whitelist (comma-separated) for commit authors, if needed")
 	flag.StringVar(&gitWorkTree, "git-work-tree", "", "Work tree. If specified, local changes will also be examined.")
+	flag.BoolVar(&gitStaged, "git-staged", false, "Analyze only the changes staged for commit compared to HEAD (e.g. in pre-commit hook)")
 	flag.BoolVar(&gitSkipFetch, "git-skip-fetch", false, "Do not fetch ORIGIN_MASTER (use this option if you already fetch to ORIGIN_MASTER before that)")
 	flag.BoolVar(&gitDisableCompensateMaster, "git-disable-compensate-master", false, "Do not try to compensate for changes in ORIGIN_MASTER after branch point")
 	flag.BoolVar(&gitFullDiff, "git-full-diff", false, "Compute full diff: analyze all files, not just changed ones")
 	flag.BoolVar(&gitIncludeUntracked, "git-include-untracked", true, "Include untracked (new, uncommitted files) into analysis")
+	flag.BoolVar(&gitDependents, "git-dependents", true, "Also analyze unchanged files that depend on the changed classes, functions and constants")
+	flag.BoolVar(&gitExec, "git-exec", false, "Run git commands for diff, log, merge-base and blame instead of reading the repository objects directly")
+
+	flag.StringVar(&diffFile, "diff-file", "", "Analyze only added and changed lines from the unified diff file (e.g. patch.diff), git repository is not required")
+	flag.StringVar(&diffRoot, "diff-root", ".", "Directory the -diff-file paths are relative to")
 
 	flag.StringVar(&reportsExclude, "exclude", "", "Exclude regexp for filenames in reports list")
 	flag.StringVar(&reportsExcludeChecks, "exclude-checks", "", "Comma-separated list of check names to be excluded")
@@ -136,17 +167,21 @@ func bindFlags() {
 
 	flag.StringVar(&output, "output", "", "Output reports to a specified file instead of stderr")
 	flag.BoolVar(&outputJSON, "output-json", false, "Format output as JSON")
-
-	flag.BoolVar(&linter.CheckAutoGenerated, `check-auto-generated`, false, "whether to lint auto-generated PHP file")
-	flag.BoolVar(&linter.Debug, "debug", false, "Enable debug output")
-	flag.DurationVar(&linter.DebugParseDuration, "debug-parse-duration", 0, "Print files that took longer than the specified time to analyse")
-	flag.IntVar(&linter.MaxFileSize, "max-sum-filesize", 20*1024*1024, "max total file size to be parsed concurrently in bytes (limits max memory consumption)")
-	flag.IntVar(&linter.MaxConcurrency, "cores", runtime.NumCPU(), "max cores")
-	flag.BoolVar(&linter.LangServer, "lang-server", false, "Run language server for VS Code")
-	flag.StringVar(&linter.DefaultEncoding, "encoding", "UTF-8", "Default encoding. Only UTF-8 and windows-1251 are supported")
-	flag.StringVar(&linter.StubsDir, "stubs-dir", "", "phpstorm-stubs directory")
-	flag.StringVar(&linter.CacheDir, "cache-dir", defaultCacheDir, "Directory for linter cache (greatly improves indexing speed)")
+	flag.BoolVar(&reportOwners, "report-owners", false, "Annotate reports with the commit, author and date of their lines from git blame and the file owners from CODEOWNERS, print the number of reports per author and per owner")
+	flag.StringVar(&codeOwnersFile, "codeowners", "", "CODEOWNERS file for -report-owners, looked for in the work tree root, .github/ and docs/ by default")
+
+	flag.BoolVar(&linterConfig.CheckAutoGenerated, `check-auto-generated`, false, "whether to lint auto-generated PHP file")
+	flag.BoolVar(&linterConfig.Debug, "debug", false, "Enable debug output")
+	flag.DurationVar(&linterConfig.DebugParseDuration, "debug-parse-duration", 0, "Print files that took longer than the specified time to analyse")
+	flag.IntVar(&linterConfig.MaxFileSize, "max-sum-filesize", 20*1024*1024, "max total file size to be parsed concurrently in bytes (limits max memory consumption)")
+	flag.IntVar(&linterConfig.MaxConcurrency, "cores", runtime.NumCPU(), "max cores")
+	flag.BoolVar(&linterConfig.LangServer, "lang-server", false, "Run language server for VS Code")
+	flag.StringVar(&linterConfig.DefaultEncoding, "encoding", "UTF-8", "Default encoding. Only UTF-8 and windows-1251 are supported")
+	flag.StringVar(&linterConfig.StubsDir, "stubs-dir", "", "phpstorm-stubs directory")
+	flag.StringVar(&linterConfig.CacheDir, "cache-dir", defaultCacheDir(), "Directory for linter cache (greatly improves indexing speed)")
 	flag.BoolVar(&disableCache, "disable-cache", false, "If set, cache is not used and cache-dir is ignored")
+	flag.BoolVar(&linterConfig.ReportCache, "report-cache", false,
+		"Cache reports in cache-dir and don't re-analyze files that didn't change along with their dependencies")
 
 	flag.StringVar(&unusedVarPattern, "unused-var-regex", `^_$`,
 		"Variables that match such regexp are marked as discarded; not reported as unused, but should not be used as values")
@@ -11,7 +11,7 @@ import (
 	"github.com/VKCOM/noverify/src/meta"
 )
 
-func gitParseUntracked() []*linter.Report {
+func gitParseUntracked(l *linter.Linter) []*linter.Report {
 	if !gitIncludeUntracked {
 		return nil
 	}
@@ -21,20 +21,92 @@ func gitParseUntracked() []*linter.Report {
 		log.Fatalf("get untracked files: %v", err)
 	}
 
-	return linter.ParseFilenames(linter.ReadFilenames(filenames, nil))
+	return l.ParseFilenames(l.ReadFilenames(filenames, nil))
 }
 
-func parseIndexOnlyFiles() {
+func parseIndexOnlyFiles(l *linter.Linter) {
 	if indexOnlyFiles == "" {
 		return
 	}
 	filenames := strings.Split(indexOnlyFiles, ",")
-	linter.ParseFilenames(linter.ReadFilenames(filenames, nil))
+	l.ParseFilenames(l.ReadFilenames(filenames, nil))
+}
+
+// gitDependentFiles returns the unchanged files that use the classes, functions
+// and constants changed between the old and new versions of the changed files.
+// Such files can get new reports even though their code is not changed.
+//
+// It must be called after the old version is indexed, but before the indexing is complete.
+// readNew must read the new versions of the changed files.
+func gitDependentFiles(l *linter.Linter, changes []git.Change, readNew linter.ReadCallback) []string {
+	if !gitDependents || len(changes) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	changed := make(map[string]bool, len(changes))
+	var oldMeta []meta.PerFile
+	l.MetaInfo().Lock()
+	for _, c := range changes {
+		if c.Type != git.Added {
+			changed[c.OldName] = true
+			oldMeta = append(oldMeta, l.MetaInfo().GetMetaForFile(c.OldName))
+		}
+		if c.Type != git.Deleted {
+			changed[c.NewName] = true
+		}
+	}
+	l.MetaInfo().Unlock()
+
+	var newMeta []meta.PerFile
+	ch := make(chan linter.FileInfo)
+	go func() {
+		readNew(ch)
+		close(ch)
+	}()
+	for f := range ch {
+		m, err := l.ParseFileMeta(f.Filename, f.Contents)
+		if err != nil {
+			log.Printf("Could not parse %s: %v", f.Filename, err)
+		}
+		newMeta = append(newMeta, m)
+	}
+
+	var dependents []string
+	for _, filename := range l.DependentFiles(linter.ChangedSymbols(oldMeta, newMeta)) {
+		if !changed[filename] {
+			dependents = append(dependents, filename)
+		}
+	}
+	log.Printf("Found %d dependent files in %s", len(dependents), time.Since(start))
+	return dependents
+}
+
+// gitParseDependents returns reports for the dependent files in the specified commit.
+func gitParseDependents(l *linter.Linter, commit string, dependents []string) []*linter.Report {
+	if len(dependents) == 0 {
+		return nil
+	}
+	return l.ParseFilenames(l.ReadSelectedFilesFromGit(gitRepo, commit, dependents))
+}
+
+// gitDeleteOldFilesMeta removes the meta info of the deleted and renamed files,
+// so their declarations are not visible when the new files versions are analyzed.
+func gitDeleteOldFilesMeta(l *linter.Linter, changes []git.Change) {
+	l.MetaInfo().Lock()
+	defer l.MetaInfo().Unlock()
+
+	for _, c := range changes {
+		if c.Type == git.Deleted || (c.Type == git.Changed && c.OldName != c.NewName) {
+			l.MetaInfo().DeleteMetaForFileNonLocked(c.OldName)
+		}
+	}
 }
 
 // Not the best name, and not the best function signature.
 // Refactor this function whenever you get the idea how to separate logic better.
-func gitRepoComputeReportsFromCommits(logArgs, diffArgs []string) (oldReports, reports []*linter.Report, changes []git.Change, changeLog []git.Commit, ok bool) {
+func gitRepoComputeReportsFromCommits(l *linter.Linter, logArgs, diffArgs []string) (oldReports, reports []*linter.Report, changes []git.Change, changeLog []git.Commit, ok bool) {
 	// TODO(quasilyte): hard to replace fatalf with error return here. Use panicf for now.
 
 	start := time.Now()
@@ -53,59 +125,64 @@ func gitRepoComputeReportsFromCommits(logArgs, diffArgs []string) (oldReports, r
 	}
 
 	if gitFullDiff {
-		meta.ResetInfo()
-		linter.InitStubs()
+		l.MetaInfo().Reset()
+		l.InitStubs()
 
 		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
-		parseIndexOnlyFiles()
+		l.ParseFilenames(l.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
+		parseIndexOnlyFiles(l)
 		log.Printf("Indexed old commit in %s", time.Since(start))
 
-		meta.SetIndexingComplete(true)
+		l.MetaInfo().SetIndexingComplete(true)
 
 		start = time.Now()
-		oldReports = linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, linter.ExcludeRegex))
+		oldReports = l.ParseFilenames(l.ReadFilesFromGit(gitRepo, gitCommitFrom, l.Config().ExcludeRegex))
 		log.Printf("Parsed old commit for %s (%d reports)", time.Since(start), len(oldReports))
 
-		meta.ResetInfo()
-		linter.InitStubs()
+		l.MetaInfo().Reset()
+		l.InitStubs()
 
 		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
+		l.ParseFilenames(l.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
 		log.Printf("Indexed new commit in %s", time.Since(start))
 
-		meta.SetIndexingComplete(true)
+		l.MetaInfo().SetIndexingComplete(true)
 
 		start = time.Now()
-		reports = linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, linter.ExcludeRegex))
+		reports = l.ParseFilenames(l.ReadFilesFromGit(gitRepo, gitCommitTo, l.Config().ExcludeRegex))
 		log.Printf("Parsed new commit in %s (%d reports)", time.Since(start), len(reports))
 	} else {
 		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
-		parseIndexOnlyFiles()
+		l.ParseFilenames(l.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
+		parseIndexOnlyFiles(l)
 		log.Printf("Indexing complete in %s", time.Since(start))
 
-		meta.SetIndexingComplete(true)
+		dependents := gitDependentFiles(l, changes, l.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
+
+		l.MetaInfo().SetIndexingComplete(true)
 
 		start = time.Now()
-		oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
+		oldReports = l.ParseFilenames(l.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
+		oldReports = append(oldReports, gitParseDependents(l, gitCommitFrom, dependents)...)
 		log.Printf("Parsed old files versions for %s", time.Since(start))
 
 		start = time.Now()
-		meta.SetIndexingComplete(false)
-		linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
-		meta.SetIndexingComplete(true)
+		l.MetaInfo().SetIndexingComplete(false)
+		gitDeleteOldFilesMeta(l, changes)
+		l.ParseFilenames(l.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
+		l.MetaInfo().SetIndexingComplete(true)
 		log.Printf("Indexed files versions for %s", time.Since(start))
 
 		start = time.Now()
-		reports = linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
+		reports = l.ParseFilenames(l.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
+		reports = append(reports, gitParseDependents(l, gitCommitTo, dependents)...)
 		log.Printf("Parsed new file versions in %s", time.Since(start))
 	}
 
 	return oldReports, reports, changes, changeLog, true
 }
 
-func gitRepoComputeReportsFromLocalChanges() (oldReports, reports []*linter.Report, changes []git.Change, ok bool) {
+func gitRepoComputeReportsFromLocalChanges(l *linter.Linter) (oldReports, reports []*linter.Report, changes []git.Change, ok bool) {
 	// TODO(quasilyte): hard to replace fatalf with error return here. Use panicf for now.
 
 	if gitWorkTree == "" {
@@ -125,32 +202,104 @@ func gitRepoComputeReportsFromLocalChanges() (oldReports, reports []*linter.Repo
 	log.Printf("You have changes in your work tree, showing diff between %s and work tree", gitCommitFrom)
 
 	start := time.Now()
-	linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
-	parseIndexOnlyFiles()
+	l.ParseFilenames(l.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
+	parseIndexOnlyFiles(l)
 	log.Printf("Indexing complete in %s", time.Since(start))
 
-	meta.SetIndexingComplete(true)
+	dependents := gitDependentFiles(l, changes, l.ReadChangesFromWorkTree(gitWorkTree, changes))
+
+	l.MetaInfo().SetIndexingComplete(true)
 
 	start = time.Now()
-	oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
+	oldReports = l.ParseFilenames(l.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
+	oldReports = append(oldReports, gitParseDependents(l, gitCommitFrom, dependents)...)
 	log.Printf("Parsed old files versions for %s", time.Since(start))
 
 	start = time.Now()
-	meta.SetIndexingComplete(false)
-	linter.ParseFilenames(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
-	gitParseUntracked()
-	meta.SetIndexingComplete(true)
+	l.MetaInfo().SetIndexingComplete(false)
+	gitDeleteOldFilesMeta(l, changes)
+	l.ParseFilenames(l.ReadChangesFromWorkTree(gitWorkTree, changes))
+	gitParseUntracked(l)
+	l.MetaInfo().SetIndexingComplete(true)
 	log.Printf("Indexed new files versions for %s", time.Since(start))
 
 	start = time.Now()
-	reports = linter.ParseFilenames(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
-	reports = append(reports, gitParseUntracked()...)
+	reports = l.ParseFilenames(l.ReadChangesFromWorkTree(gitWorkTree, changes))
+	reports = append(reports, gitParseUntracked(l)...)
+	// Dependent files are not changed, so their work tree versions are the same.
+	reports = append(reports, gitParseDependents(l, gitCommitFrom, dependents)...)
 	log.Printf("Parsed new file versions in %s", time.Since(start))
 
 	return oldReports, reports, changes, true
 }
 
-func gitMain() (int, error) {
+// gitRepoComputeReportsFromStaged analyzes the changes staged in the index.
+// The staged versions of the files are read from the index,
+// so the unstaged changes of the same files are not analyzed.
+func gitRepoComputeReportsFromStaged(l *linter.Linter) (oldReports, reports []*linter.Report, changes []git.Change, ok bool, err error) {
+	const head = "HEAD"
+
+	changes, err = git.DiffStaged(gitRepo, head)
+	if err != nil {
+		return nil, nil, nil, false, fmt.Errorf("could not compute staged changes: %v", err)
+	}
+
+	if len(changes) == 0 {
+		log.Printf("No staged changes")
+		return nil, nil, nil, false, nil
+	}
+
+	hasCommits, err := git.HasCommits(gitRepo)
+	if err != nil {
+		return nil, nil, nil, false, fmt.Errorf("could not resolve %s: %v", head, err)
+	}
+	if !hasCommits {
+		// Before the first commit there are no old versions to compare with,
+		// all staged files are added, so all their lines are new.
+		start := time.Now()
+		l.ParseFilenames(l.ReadStagedFilesFromGit(gitRepo, changes))
+		parseIndexOnlyFiles(l)
+		l.MetaInfo().SetIndexingComplete(true)
+		log.Printf("Indexed staged files versions for %s", time.Since(start))
+
+		start = time.Now()
+		reports = l.ParseFilenames(l.ReadStagedFilesFromGit(gitRepo, changes))
+		log.Printf("Parsed staged file versions in %s", time.Since(start))
+
+		return nil, reports, changes, true, nil
+	}
+
+	start := time.Now()
+	l.ParseFilenames(l.ReadFilesFromGit(gitRepo, head, nil))
+	parseIndexOnlyFiles(l)
+	log.Printf("Indexing complete in %s", time.Since(start))
+
+	dependents := gitDependentFiles(l, changes, l.ReadStagedFilesFromGit(gitRepo, changes))
+
+	l.MetaInfo().SetIndexingComplete(true)
+
+	start = time.Now()
+	oldReports = l.ParseFilenames(l.ReadOldFilesFromGit(gitRepo, head, changes))
+	oldReports = append(oldReports, gitParseDependents(l, head, dependents)...)
+	log.Printf("Parsed old files versions for %s", time.Since(start))
+
+	start = time.Now()
+	l.MetaInfo().SetIndexingComplete(false)
+	gitDeleteOldFilesMeta(l, changes)
+	l.ParseFilenames(l.ReadStagedFilesFromGit(gitRepo, changes))
+	l.MetaInfo().SetIndexingComplete(true)
+	log.Printf("Indexed staged files versions for %s", time.Since(start))
+
+	start = time.Now()
+	reports = l.ParseFilenames(l.ReadStagedFilesFromGit(gitRepo, changes))
+	// Dependent files are not changed, so their staged versions are the same.
+	reports = append(reports, gitParseDependents(l, head, dependents)...)
+	log.Printf("Parsed staged file versions in %s", time.Since(start))
+
+	return oldReports, reports, changes, true, nil
+}
+
+func gitMain(l *linter.Linter) (int, error) {
 	var (
 		oldReports, reports []*linter.Report
 		diffArgs            []string
@@ -159,20 +308,47 @@ func gitMain() (int, error) {
 		ok                  bool
 	)
 
+	git.UseExec = gitExec
+
+	if gitStaged {
+		// There are no commits to log and blame, and nothing to fetch.
+		var err error
+		oldReports, reports, changes, ok, err = gitRepoComputeReportsFromStaged(l)
+		if err != nil || !ok {
+			return 0, err
+		}
+		// Staged files are blamed as they are in the work tree,
+		// hooks are run from its root.
+		workTree := gitWorkTree
+		if workTree == "" {
+			workTree = "."
+		}
+		ownershipConfig = linter.OwnershipConfig{GitDir: gitRepo, WorkTree: workTree}
+		return gitReportsDiff(nil, changes, nil, oldReports, reports)
+	}
+
 	// prepareGitArgs also populates global variables like fromCommit
 	logArgs, diffArgs, err := prepareGitArgs()
 	if err != nil {
 		return 0, err
 	}
 
-	oldReports, reports, changes, ok = gitRepoComputeReportsFromLocalChanges()
-	if !ok {
-		oldReports, reports, changes, changeLog, ok = gitRepoComputeReportsFromCommits(logArgs, diffArgs)
+	oldReports, reports, changes, ok = gitRepoComputeReportsFromLocalChanges(l)
+	if ok {
+		ownershipConfig = linter.OwnershipConfig{GitDir: gitRepo, WorkTree: gitWorkTree}
+	} else {
+		oldReports, reports, changes, changeLog, ok = gitRepoComputeReportsFromCommits(l, logArgs, diffArgs)
 		if !ok {
 			return 0, nil
 		}
+		ownershipConfig = linter.OwnershipConfig{GitDir: gitRepo, Rev: gitCommitTo}
 	}
 
+	return gitReportsDiff(diffArgs, changes, changeLog, oldReports, reports)
+}
+
+// gitReportsDiff prints the reports that are new compared to oldReports.
+func gitReportsDiff(diffArgs []string, changes []git.Change, changeLog []git.Commit, oldReports, reports []*linter.Report) (int, error) {
 	start := time.Now()
 	diff, err := linter.DiffReports(gitRepo, diffArgs, changes, changeLog, oldReports, reports, 8)
 	if err != nil {
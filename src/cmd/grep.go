@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+// grepFilterRegexp matches a filter argument like `$x:Foo` or `x~^get`.
+var grepFilterRegexp = regexp.MustCompile(`^\$?([a-zA-Z_]\w*)(!~|~|!=|=|:)(.*)$`)
+
+// grepTypeNameRegexp matches names inside the type filter expressions.
+var grepTypeNameRegexp = regexp.MustCompile(`\\?[a-zA-Z_][\w\\]*`)
+
+// grepTypeKeywords are type names that are not class names.
+var grepTypeKeywords = map[string]bool{
+	"int": true, "integer": true, "float": true, "double": true,
+	"string": true, "bool": true, "boolean": true, "array": true,
+	"mixed": true, "null": true, "object": true, "callable": true,
+	"iterable": true, "void": true, "true": true, "false": true,
+	"resource": true, "self": true, "static": true, "parent": true,
+}
+
+type grepArguments struct {
+	pattern string
+	filters []string
+	paths   []string
+
+	outputJSON bool
+	index      bool
+}
+
+func grepMain(args []string) (int, error) {
+	var grepArgs grepArguments
+
+	fs := flag.NewFlagSet("grep", flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage of noverify grep:\n")
+		fmt.Fprintf(out, "  $ noverify grep [flags] pattern [filters...] paths...\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Filters:\n")
+		fmt.Fprintf(out, "  $x:type     \t$x has a given type, like @type in rules (class names are fully qualified)\n")
+		fmt.Fprintf(out, "  $x~regexp   \t$x source text matches regexp, like @matches in rules\n")
+		fmt.Fprintf(out, "  $x!~regexp  \t$x source text doesn't match regexp, like @not-matches in rules\n")
+		fmt.Fprintf(out, "  $x=v1,v2    \t$x value or name is one of the list, like @value in rules\n")
+		fmt.Fprintf(out, "  $x!=v1,v2   \t$x value or name is not in the list, like @not-value in rules\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&grepArgs.outputJSON, "json", false, "Format output as JSON, including the captured sub-matches")
+	fs.BoolVar(&grepArgs.index, "index", true, "Index the files before the search (required for type filters)")
+	conf := linter.NewConfig()
+	fs.StringVar(&conf.StubsDir, "stubs-dir", "", "phpstorm-stubs directory")
+	fs.StringVar(&phpExtensionsArg, "php-extensions", "php,inc,php5,phtml,inc", "List of PHP extensions to be recognized")
+	fs.IntVar(&conf.MaxConcurrency, "cores", runtime.NumCPU(), "max cores")
+	fs.IntVar(&conf.MaxFileSize, "max-sum-filesize", 20*1024*1024, "max total file size to be parsed concurrently in bytes (limits max memory consumption)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0, nil
+		}
+		return 2, nil
+	}
+
+	if err := parseGrepArgs(&grepArgs, fs.Args()); err != nil {
+		return 0, err
+	}
+
+	rset, err := compileGrepRule(grepArgs.pattern, grepArgs.filters)
+	if err != nil {
+		return 0, err
+	}
+
+	conf.PHPExtensions = strings.Split(phpExtensionsArg, ",")
+	l := linter.NewLinter(conf)
+
+	if grepArgs.index {
+		// Stubs only make the type info more precise,
+		// so the search can continue without them.
+		if err := initStubs(l); err != nil {
+			log.Printf("Init stubs: %v", err)
+		}
+		l.ParseFilenames(l.ReadFilenames(grepArgs.paths, nil))
+	}
+	l.MetaInfo().SetIndexingComplete(true)
+
+	var mu sync.Mutex
+	var matches []*linter.RuleMatch
+	conf.Rules = rset
+	conf.RuleMatchHook = func(m *linter.RuleMatch) {
+		mu.Lock()
+		matches = append(matches, m)
+		mu.Unlock()
+	}
+	l.ParseFilenames(l.ReadFilenames(grepArgs.paths, nil))
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Filename != matches[j].Filename {
+			return matches[i].Filename < matches[j].Filename
+		}
+		return matches[i].Line < matches[j].Line
+	})
+
+	if err := printGrepMatches(os.Stdout, grepArgs.outputJSON, matches); err != nil {
+		return 0, err
+	}
+
+	if len(matches) == 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func parseGrepArgs(grepArgs *grepArguments, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("pattern is not specified")
+	}
+	grepArgs.pattern = args[0]
+	args = args[1:]
+
+	for len(args) != 0 && grepFilterRegexp.MatchString(args[0]) {
+		grepArgs.filters = append(grepArgs.filters, args[0])
+		args = args[1:]
+	}
+	if len(args) != 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no paths to search in")
+	}
+	grepArgs.paths = args
+
+	return nil
+}
+
+// compileGrepRule creates a rules set with a single rule that
+// matches the pattern and applies the filters.
+//
+// Filters are translated to the rule attributes,
+// so they're validated and executed the same way as in the rule files.
+func compileGrepRule(pattern string, filters []string) (*rules.Set, error) {
+	var buf strings.Builder
+	buf.WriteString("<?php\n")
+	buf.WriteString("/**\n")
+	buf.WriteString(" * @maybe $$\n")
+	buf.WriteString(" * @name grep\n")
+	for _, f := range filters {
+		if strings.Contains(f, "\n") || strings.Contains(f, "*/") {
+			return nil, fmt.Errorf("%s: filter can't contain newlines and */", f)
+		}
+		m := grepFilterRegexp.FindStringSubmatch(f)
+		name, op, arg := m[1], m[2], m[3]
+		switch op {
+		case ":":
+			fmt.Fprintf(&buf, " * @type %s $%s\n", qualifyGrepType(arg), name)
+		case "~":
+			fmt.Fprintf(&buf, " * @matches $%s %s\n", name, arg)
+		case "!~":
+			fmt.Fprintf(&buf, " * @not-matches $%s %s\n", name, arg)
+		case "=":
+			fmt.Fprintf(&buf, " * @value $%s %s\n", name, arg)
+		case "!=":
+			fmt.Fprintf(&buf, " * @not-value $%s %s\n", name, arg)
+		default:
+			return nil, fmt.Errorf("%s: %s filter is not supported", f, op)
+		}
+	}
+	buf.WriteString(" */\n")
+	buf.WriteString(pattern)
+	if !strings.HasSuffix(pattern, ";") && !strings.HasSuffix(pattern, "}") {
+		buf.WriteString(";")
+	}
+	buf.WriteString("\n")
+
+	rset, err := rules.NewParser().Parse("<pattern>", strings.NewReader(buf.String()))
+	if err != nil {
+		return nil, err
+	}
+	return rset, nil
+}
+
+// qualifyGrepType makes class names inside the type expression fully qualified,
+// so `$x:Foo` filter can be used instead of `$x:\Foo`.
+func qualifyGrepType(typ string) string {
+	return grepTypeNameRegexp.ReplaceAllStringFunc(typ, func(name string) string {
+		if strings.HasPrefix(name, `\`) || grepTypeKeywords[strings.ToLower(name)] {
+			return name
+		}
+		return `\` + name
+	})
+}
+
+func printGrepMatches(w io.Writer, outputJSON bool, matches []*linter.RuleMatch) error {
+	if outputJSON {
+		type jsonCapture struct {
+			Name string `json:"name"`
+			Text string `json:"text"`
+		}
+		type jsonMatch struct {
+			Filename string        `json:"filename"`
+			Line     int           `json:"line"`
+			Text     string        `json:"text"`
+			Captures []jsonCapture `json:"captures"`
+		}
+		type matchList struct {
+			Matches []jsonMatch `json:"matches"`
+		}
+		list := matchList{Matches: make([]jsonMatch, 0, len(matches))}
+		for _, m := range matches {
+			jm := jsonMatch{
+				Filename: m.Filename,
+				Line:     m.Line,
+				Text:     m.Text,
+				Captures: make([]jsonCapture, 0, len(m.Captures)),
+			}
+			for _, c := range m.Captures {
+				jm.Captures = append(jm.Captures, jsonCapture{Name: c.Name, Text: c.Text})
+			}
+			list.Matches = append(list.Matches, jm)
+		}
+		return json.NewEncoder(w).Encode(list)
+	}
+
+	for _, m := range matches {
+		// Print only the first line of the multi-line matches.
+		text := m.Text
+		if i := strings.IndexByte(text, '\n'); i != -1 {
+			text = text[:i] + " ..."
+		}
+		fmt.Fprintf(w, "%s:%d: %s\n", m.Filename, m.Line, text)
+	}
+	log.Printf("Found %d matches", len(matches))
+	return nil
+}
@@ -2,10 +2,10 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/md5"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof" // it is ok for actually main package
@@ -13,6 +13,7 @@ import (
 	"regexp"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strings"
 	"sync/atomic"
 
@@ -21,7 +22,6 @@ import (
 	"github.com/VKCOM/noverify/src/langsrv"
 	"github.com/VKCOM/noverify/src/lintdebug"
 	"github.com/VKCOM/noverify/src/linter"
-	"github.com/VKCOM/noverify/src/meta"
 	"github.com/VKCOM/noverify/src/rules"
 	"github.com/client9/misspell"
 )
@@ -57,12 +57,12 @@ func isEnabled(r *linter.Report) bool {
 		return false
 	}
 
-	if linter.ExcludeRegex == nil {
+	if linterConfig.ExcludeRegex == nil {
 		return true
 	}
 
 	// Disabled by a file comment.
-	return !linter.ExcludeRegex.MatchString(r.GetFilename())
+	return !linterConfig.ExcludeRegex.MatchString(r.GetFilename())
 }
 
 // canBeDisabled returns whether or not '@linter disable' can be used for the specified file
@@ -83,10 +83,23 @@ func Main(cfg *MainConfig) {
 		cfg = &MainConfig{}
 	}
 
+	if len(os.Args) > 1 {
+		if sub := findSubCommand(os.Args[1]); sub != nil {
+			status, err := sub.main(os.Args[2:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			os.Exit(status)
+		}
+	}
+
+	if cfg.LinterConfig != nil {
+		linterConfig = cfg.LinterConfig
+	}
 	bindFlags()
 	flag.Parse()
 	if disableCache {
-		linter.CacheDir = ""
+		linterConfig.CacheDir = ""
 	}
 	if cfg.AfterFlagParse != nil {
 		cfg.AfterFlagParse()
@@ -100,23 +113,24 @@ func Main(cfg *MainConfig) {
 }
 
 func loadMisspellDicts(dicts []string) error {
-	linter.TypoFixer = &misspell.Replacer{}
+	typoFixer := &misspell.Replacer{}
 
 	for _, d := range dicts {
 		d = strings.TrimSpace(d)
 		switch {
 		case d == "Eng":
-			linter.TypoFixer.AddRuleList(misspell.DictMain)
+			typoFixer.AddRuleList(misspell.DictMain)
 		case d == "Eng/US":
-			linter.TypoFixer.AddRuleList(misspell.DictAmerican)
+			typoFixer.AddRuleList(misspell.DictAmerican)
 		case d == "Eng/UK" || d == "Eng/GB":
-			linter.TypoFixer.AddRuleList(misspell.DictBritish)
+			typoFixer.AddRuleList(misspell.DictBritish)
 		default:
 			return fmt.Errorf("unsupported %s misspell-list entry", d)
 		}
 	}
 
-	linter.TypoFixer.Compile()
+	typoFixer.Compile()
+	linterConfig.TypoFixer = typoFixer
 	return nil
 }
 
@@ -167,7 +181,7 @@ func mainNoExit() (int, error) {
 		return 0, fmt.Errorf("compile unused-var-regex: %v", err)
 	}
 
-	linter.PHPExtensions = strings.Split(phpExtensionsArg, ",")
+	linterConfig.PHPExtensions = strings.Split(phpExtensionsArg, ",")
 	if err := compileRegexes(); err != nil {
 		return 0, err
 	}
@@ -181,12 +195,12 @@ func mainNoExit() (int, error) {
 
 	buildCheckMappings()
 
-	lintdebug.Register(func(msg string) { linter.DebugMessage("%s", msg) })
-	go linter.MemoryLimiterThread()
+	l := linter.NewLinter(linterConfig)
+	lintdebug.Register(func(msg string) { l.DebugMessage("%s", msg) })
 
-	if linter.LangServer {
+	if linterConfig.LangServer {
 		langsrv.RegisterDebug()
-		langsrv.Start()
+		langsrv.Start(l)
 		return 0, nil
 	}
 
@@ -200,23 +214,41 @@ func mainNoExit() (int, error) {
 
 	log.Printf("Started")
 
-	if err := initStubs(); err != nil {
+	if err := initStubs(l); err != nil {
 		return 0, fmt.Errorf("Init stubs: %v", err)
 	}
 
 	if err := initRules(); err != nil {
 		return 0, fmt.Errorf("Init rules: %v", err)
 	}
+	linterConfig.ReportCacheSalt = reportCacheSalt()
+
+	if rulesProfile || rulesProfileJSON != "" {
+		linterConfig.RulesProfile = true
+		defer func() {
+			if err := writeRulesProfile(l.GetRulesProfile()); err != nil {
+				log.Printf("write rules profile: %v", err)
+			}
+		}()
+	}
+
+	if compareFrom != "" {
+		return compareMain(l)
+	}
 
 	if gitRepo != "" {
-		return gitMain()
+		return gitMain(l)
+	}
+
+	if diffFile != "" {
+		return diffFileMain(l)
 	}
 
-	linter.AnalysisFiles = flag.Args()
+	linterConfig.AnalysisFiles = flag.Args()
 
 	log.Printf("Indexing %+v", flag.Args())
-	linter.ParseFilenames(linter.ReadFilenames(flag.Args(), nil))
-	meta.SetIndexingComplete(true)
+	l.ParseFilenames(l.ReadFilenames(flag.Args(), nil))
+	l.MetaInfo().SetIndexingComplete(true)
 	log.Printf("Linting")
 
 	filenames := flag.Args()
@@ -224,7 +256,10 @@ func mainNoExit() (int, error) {
 		filenames = strings.Split(fullAnalysisFiles, ",")
 	}
 
-	reports := linter.ParseFilenames(linter.ReadFilenames(filenames, linter.ExcludeRegex))
+	reports := l.ParseFilenames(l.ReadFilenames(filenames, linterConfig.ExcludeRegex))
+	if len(filenames) != 0 {
+		setWorkTreeOwnership(filenames[0])
+	}
 	criticalReports := analyzeReports(reports)
 
 	if criticalReports > 0 {
@@ -238,7 +273,7 @@ func compileRegexes() error {
 	var err error
 
 	if reportsExclude != "" {
-		linter.ExcludeRegex, err = regexp.Compile(reportsExclude)
+		linterConfig.ExcludeRegex, err = regexp.Compile(reportsExclude)
 		if err != nil {
 			return fmt.Errorf("Incorrect exclude regex: %v", err)
 		}
@@ -263,6 +298,12 @@ func buildCheckMappings() {
 		return set
 	}
 
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "allow-checks" {
+			allowChecksSet = true
+		}
+	})
+
 	reportsExcludeChecksSet = stringToSet(reportsExcludeChecks)
 	reportsIncludeChecksSet = stringToSet(allowChecks)
 	if reportsCritical != allNonMaybe {
@@ -294,14 +335,23 @@ func analyzeReports(diff []*linter.Report) (criticalReports int) {
 		}
 	}
 
+	annotateOwnership(filtered)
+	var summary *linter.OwnershipSummary
+	if reportOwners {
+		s := linter.SummarizeOwnership(filtered)
+		summary = &s
+	}
+
 	if outputJSON {
 		type reportList struct {
 			Reports []*linter.Report
 			Errors  []string
+			Summary *linter.OwnershipSummary `json:",omitempty"`
 		}
 		list := &reportList{
 			Reports: filtered,
 			Errors:  linterErrors,
+			Summary: summary,
 		}
 		d := json.NewEncoder(outputFp)
 		if err := d.Encode(list); err != nil {
@@ -318,6 +368,12 @@ func analyzeReports(diff []*linter.Report) (criticalReports int) {
 			} else {
 				fmt.Fprintf(outputFp, "%s\n", r.String())
 			}
+			if o := r.Ownership(); o != nil && o.Commit != "" {
+				fmt.Fprintf(outputFp, "    by %s <%s> in %.12s on %s\n", o.Author, o.Email, o.Commit, o.Date.Format("2006-01-02"))
+			}
+		}
+		if summary != nil {
+			printOwnershipSummary(outputFp, *summary)
 		}
 	}
 
@@ -332,7 +388,7 @@ func setDiscardVarPredicate() error {
 	case "^_.*$":
 		// Leading underscore plus anything after it.
 		// Recognize as quite common pattern.
-		linter.IsDiscardVar = func(s string) bool {
+		linterConfig.IsDiscardVar = func(s string) bool {
 			return strings.HasPrefix(s, "_")
 		}
 	default:
@@ -340,18 +396,20 @@ func setDiscardVarPredicate() error {
 		if err != nil {
 			return err
 		}
-		linter.IsDiscardVar = re.MatchString
+		linterConfig.IsDiscardVar = re.MatchString
 	}
 
 	return nil
 }
 
-func loadRulesFile(p *rules.Parser, filter func(r rules.Rule) bool, filename string, data []byte) error {
+// loadRulesFile parses the rules from data and adds the rules accepted by filter to dst.
+// It returns the @include paths of the file.
+func loadRulesFile(dst *rules.Set, p *rules.Parser, filter func(r rules.Rule) bool, filename string, data []byte) ([]string, error) {
 	appendRules := func(dst, src *rules.ScopedSet) {
 		for i, list := range src.RulesByKind {
 			for _, r := range list {
 				if !filter(r) {
-					break
+					continue
 				}
 				dst.RulesByKind[i] = append(dst.RulesByKind[i], r)
 			}
@@ -360,32 +418,46 @@ func loadRulesFile(p *rules.Parser, filter func(r rules.Rule) bool, filename str
 
 	rset, err := p.Parse(filename, bytes.NewReader(data))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	fmt.Fprintf(rulesDigest, "%s\n%x\n", filename, md5.Sum(data))
+
+	if err := declareRuleNames(rset); err != nil {
+		return nil, err
 	}
 
 	for _, name := range rset.AlwaysAllowed {
 		reportsIncludeChecksSet[name] = true
 	}
-	for _, name := range rset.AlwaysCritical {
-		reportsCriticalSet[name] = true
+	if len(reportsCriticalSet) != 0 {
+		// With the default -critical, unnamed rules are
+		// critical depending on their level, like any other check.
+		for _, name := range rset.AlwaysCritical {
+			reportsCriticalSet[name] = true
+		}
 	}
 
-	appendRules(linter.Rules.Any, rset.Any)
-	appendRules(linter.Rules.Root, rset.Root)
-	appendRules(linter.Rules.Local, rset.Local)
+	appendRules(dst.Any, rset.Any)
+	appendRules(dst.Root, rset.Root)
+	appendRules(dst.Local, rset.Local)
 
-	return nil
+	return rset.Includes, nil
 }
 
-func InitEmbeddedRules(p *rules.Parser, filter func(r rules.Rule) bool) error {
+// InitEmbeddedRules adds the embedded rules accepted by filter to dst.
+func InitEmbeddedRules(dst *rules.Set, p *rules.Parser, filter func(r rules.Rule) bool) error {
 	for _, filename := range embeddedrules.AssetNames() {
 		data, err := embeddedrules.Asset(filename)
 		if err != nil {
 			return err
 		}
-		if err := loadRulesFile(p, filter, filename, data); err != nil {
+		includes, err := loadRulesFile(dst, p, filter, filename, data)
+		if err != nil {
 			return err
 		}
+		if len(includes) != 0 {
+			return fmt.Errorf("%s: embedded rules can't use @include", filename)
+		}
 	}
 	return nil
 }
@@ -395,41 +467,77 @@ func initRules() error {
 		return isEnabledByFlags(r.Name)
 	}
 
-	linter.Rules = rules.NewSet()
+	rset := rules.NewSet()
+	ruleNameSources = make(map[string]string)
+	rulesDigest = md5.New()
 	p := rules.NewParser()
 
-	if err := InitEmbeddedRules(p, ruleFilter); err != nil {
+	if err := InitEmbeddedRules(rset, p, ruleFilter); err != nil {
 		return err
 	}
 
 	if rulesList != "" {
-		for _, filename := range strings.Split(rulesList, ",") {
-			data, err := ioutil.ReadFile(filename)
-			if err != nil {
-				return err
-			}
-			loadRulesFile(p, ruleFilter, filename, data)
+		err := walkRulesFiles(strings.Split(rulesList, ","), func(filename string, data []byte) ([]string, error) {
+			return loadRulesFile(rset, p, ruleFilter, filename, data)
+		})
+		if err != nil {
+			return err
 		}
 	}
 
+	rset.Any.BuildIndex()
+	rset.Root.BuildIndex()
+	rset.Local.BuildIndex()
+	linterConfig.Rules = rset
+
 	return nil
 }
 
-func initStubs() error {
-	if linter.StubsDir != "" {
-		linter.InitStubs()
+// reportCacheSalt describes the settings that affect the reports
+// so the reports cached with the different settings are not reused.
+func reportCacheSalt() string {
+	var enabled []string
+	for name := range reportsIncludeChecksSet {
+		if isEnabledByFlags(name) {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "checks: %s\n", strings.Join(enabled, ","))
+	fmt.Fprintf(&buf, "rules: %x\n", rulesDigest.Sum(nil))
+	fmt.Fprintf(&buf, "misspell: %s\n", misspellList)
+	fmt.Fprintf(&buf, "unused-var-regex: %s\n", unusedVarPattern)
+	fmt.Fprintf(&buf, "check-auto-generated: %v\n", linterConfig.CheckAutoGenerated)
+	fmt.Fprintf(&buf, "encoding: %s\n", linterConfig.DefaultEncoding)
+
+	// Any linter rebuild can change the reports.
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			fmt.Fprintf(&buf, "executable: %s %d %d\n", exe, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	return buf.String()
+}
+
+func initStubs(l *linter.Linter) error {
+	if l.Config().StubsDir != "" {
+		l.InitStubs()
 		return nil
 	}
 
 	// Try to use embedded stubs (from stubs/phpstorm_stubs.go).
-	if err := loadEmbeddedStubs(); err != nil {
+	if err := loadEmbeddedStubs(l); err != nil {
 		return fmt.Errorf("failed to load embedded stubs: %v", err)
 	}
 
 	return nil
 }
 
-func LoadEmbeddedStubs(filenames []string) error {
+// LoadEmbeddedStubs parses the embedded phpstorm-stubs files into the linter meta info.
+func LoadEmbeddedStubs(l *linter.Linter, filenames []string) error {
 	var errorsCount int64
 
 	readStubs := func(ch chan linter.FileInfo) {
@@ -447,8 +555,8 @@ func LoadEmbeddedStubs(filenames []string) error {
 		}
 	}
 
-	linter.ParseFilenames(readStubs)
-	meta.Info.InitStubs()
+	l.ParseFilenames(readStubs)
+	l.MetaInfo().InitStubs()
 
 	// Using atomic here for consistency.
 	if atomic.LoadInt64(&errorsCount) != 0 {
@@ -458,10 +566,10 @@ func LoadEmbeddedStubs(filenames []string) error {
 	return nil
 }
 
-func loadEmbeddedStubs() error {
+func loadEmbeddedStubs(l *linter.Linter) error {
 	filenames := stubs.AssetNames()
 	if len(filenames) == 0 {
 		return fmt.Errorf("empty file list")
 	}
-	return LoadEmbeddedStubs(filenames)
+	return LoadEmbeddedStubs(l, filenames)
 }
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// ownershipConfig describes where the reports of the current mode are blamed.
+// It's set by the mode before analyzeReports is called.
+var ownershipConfig linter.OwnershipConfig
+
+// setWorkTreeOwnership makes the reports to be blamed in the work
+// tree of the repository that contains the file or directory.
+func setWorkTreeOwnership(filename string) {
+	if !reportOwners {
+		return
+	}
+	dir := filename
+	if st, err := os.Stat(filename); err == nil && !st.IsDir() {
+		dir = filepath.Dir(filename)
+	}
+	gitDir, workTree, err := git.FindRepository(dir)
+	if err != nil {
+		log.Printf("Could not find git repository to blame reports: %v", err)
+		return
+	}
+	ownershipConfig = linter.OwnershipConfig{GitDir: gitDir, WorkTree: workTree}
+}
+
+// annotateOwnership sets the Ownership of the reports if -report-owners is set.
+func annotateOwnership(reports []*linter.Report) {
+	cfg := ownershipConfig
+	if !reportOwners || cfg.GitDir == "" {
+		return
+	}
+
+	filename := codeOwnersFile
+	if filename == "" {
+		root := cfg.WorkTree
+		if root == "" {
+			root = filepath.Dir(cfg.GitDir)
+		}
+		filename, _ = git.FindCodeOwners(root)
+	}
+	if filename != "" {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Printf("Could not read CODEOWNERS: %v", err)
+		} else {
+			cfg.CodeOwners = git.ParseCodeOwners(data)
+		}
+	}
+
+	start := time.Now()
+	linter.AnnotateOwnership(cfg, reports, 8)
+	log.Printf("Blamed reports in %s", time.Since(start))
+}
+
+// printOwnershipSummary prints the number of reports per author and per owner.
+func printOwnershipSummary(w io.Writer, summary linter.OwnershipSummary) {
+	fmt.Fprintf(w, "Reports by author:\n")
+	for _, a := range summary.Authors {
+		fmt.Fprintf(w, "%8d  %s <%s>\n", a.Reports, a.Author, a.Email)
+	}
+	fmt.Fprintf(w, "Reports by owner:\n")
+	for _, o := range summary.Owners {
+		owner := o.Owner
+		if owner == "" {
+			owner = "(no owners)"
+		}
+		fmt.Fprintf(w, "%8d  %s\n", o.Reports, owner)
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+// ruleNameSources maps the named rules to their first definition location.
+// Rules with the same name can be defined several times in one file,
+// but not in the different files.
+var ruleNameSources = map[string]string{}
+
+// rulesDigest accumulates the names and contents hashes of the loaded rule files.
+var rulesDigest = md5.New()
+
+// declareRuleNames checks the named rules of rset for the conflicts with
+// the already loaded rule files and enables them unless -allow-checks is given.
+//
+// Named rules are checks, so they can be enabled, excluded and made critical
+// by name just like the checks that are implemented in Go.
+func declareRuleNames(rset *rules.Set) error {
+	unnamed := make(map[string]bool, len(rset.AlwaysAllowed))
+	for _, name := range rset.AlwaysAllowed {
+		unnamed[name] = true
+	}
+
+	for _, scope := range []*rules.ScopedSet{rset.Any, rset.Root, rset.Local} {
+		for _, list := range scope.RulesByKind {
+			for _, r := range list {
+				if unnamed[r.Name] {
+					continue
+				}
+				source := fmt.Sprintf("%s:%d", r.Filename, r.Line)
+				prev, ok := ruleNameSources[r.Name]
+				if !ok {
+					ruleNameSources[r.Name] = source
+				} else if !strings.HasPrefix(prev, r.Filename+":") {
+					return fmt.Errorf("%s: rule name %s is already used at %s", source, r.Name, prev)
+				}
+				if !allowChecksSet {
+					reportsIncludeChecksSet[r.Name] = true
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkRulesFiles calls load for every rule file from paths.
+//
+// Directories are scanned recursively for the *.php files.
+// The files that are returned by load as the file @include list
+// are loaded after it, relative paths are resolved against the including file directory.
+// Every file is loaded once, even if it's listed or included several times.
+func walkRulesFiles(paths []string, load func(filename string, data []byte) (includes []string, err error)) error {
+	loaded := make(map[string]bool)
+
+	var loadFile func(filename string) error
+	loadFile = func(filename string) error {
+		filename = filepath.Clean(filename)
+		if loaded[filename] {
+			return nil
+		}
+		loaded[filename] = true
+
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		includes, err := load(filename, data)
+		if err != nil {
+			return err
+		}
+		for _, include := range includes {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(filename), include)
+			}
+			if err := loadFile(include); err != nil {
+				return fmt.Errorf("%s: @include: %v", filename, err)
+			}
+		}
+		return nil
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := loadFile(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// filepath.Walk visits the files in lexical order,
+		// so the rules order doesn't depend on the file system.
+		err = filepath.Walk(path, func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(filename) != ".php" {
+				return nil
+			}
+			return loadFile(filename)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// writeRulesProfile prints the rules statistics for -rules-profile
+// and writes them to the -rules-profile-json file.
+func writeRulesProfile(profile []linter.RuleProfile) error {
+	if rulesProfile {
+		printRulesProfile(os.Stderr, profile)
+	}
+
+	if rulesProfileJSON != "" {
+		data, err := json.MarshalIndent(profile, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(rulesProfileJSON, data, 0666)
+	}
+
+	return nil
+}
+
+func printRulesProfile(w io.Writer, profile []linter.RuleProfile) {
+	var total time.Duration
+	for _, p := range profile {
+		total += p.Time
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "rule\tlocation\tattempts\tmatches\trejected\ttime\ttime %%\n")
+	for _, p := range profile {
+		percent := 0.0
+		if total != 0 {
+			percent = float64(p.Time) * 100 / float64(total)
+		}
+		fmt.Fprintf(tw, "%s\t%s:%d\t%d\t%d\t%d\t%s\t%.1f\n",
+			p.Name, p.Filename, p.Line, p.Attempts, p.Matches, p.Rejected, p.Time.Round(time.Microsecond), percent)
+	}
+	tw.Flush()
+}
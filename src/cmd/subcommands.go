@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// subCommand is a noverify mode that is selected by the first command-line argument,
+// like `noverify grep ...`.
+type subCommand struct {
+	name        string
+	description string
+
+	// main is called with the arguments that follow the sub-command name.
+	// It follows the mainNoExit conventions.
+	main func(args []string) (int, error)
+}
+
+var subCommands []*subCommand
+
+func init() {
+	subCommands = []*subCommand{
+		{
+			name:        "grep",
+			description: "Search for a structural pattern in PHP files",
+			main:        grepMain,
+		},
+		{
+			name:        "test-rules",
+			description: "Run @test-match and @test-nomatch snippets from the rule files",
+			main:        testRulesMain,
+		},
+		{
+			name:        "checks",
+			description: "Print the documentation for all checks and dynamic rules",
+			main:        checksMain,
+		},
+		{
+			name:        "compare",
+			description: "Print new, fixed and persisting reports between two git revisions",
+			main:        compareSubMain,
+		},
+		{
+			name:        "cache",
+			description: "Print statistics, prune or clear the linter cache",
+			main:        cacheMain,
+		},
+	}
+}
+
+// findSubCommand returns a sub-command for the first command-line argument.
+//
+// Existing files and directories are never treated as sub-commands,
+// so `noverify grep` still analyzes the ./grep project directory.
+func findSubCommand(name string) *subCommand {
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	for _, sub := range subCommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func printSubCommands(out io.Writer) {
+	fmt.Fprintf(out, "Sub-commands (not used if a file with the same name exists):\n")
+	for _, sub := range subCommands {
+		fmt.Fprintf(out, "  %s\n", sub.name)
+		fmt.Fprintf(out, "    \t%s\n", sub.description)
+	}
+}
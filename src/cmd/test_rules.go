@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+// ruleTestFuncRegexp matches the characters that can't be used in the function names.
+var ruleTestFuncRegexp = regexp.MustCompile(`\W`)
+
+// ruleTestCase is a single @test-match or @test-nomatch snippet
+// bound to the rule it belongs to.
+type ruleTestCase struct {
+	rule     *rules.Rule
+	test     rules.RuleTest
+	filename string
+
+	// code is the snippet turned into a PHP file contents.
+	code []byte
+
+	// set contains only the tested rule.
+	set *rules.Set
+}
+
+func testRulesMain(args []string) (int, error) {
+	fs := flag.NewFlagSet("test-rules", flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage of noverify test-rules:\n")
+		fmt.Fprintf(out, "  $ noverify test-rules [flags] rules.php...\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Runs @test-match and @test-nomatch snippets of every rule.\n")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	conf := linter.NewConfig()
+	fs.StringVar(&conf.StubsDir, "stubs-dir", "", "phpstorm-stubs directory")
+	fs.IntVar(&conf.MaxFileSize, "max-sum-filesize", 20*1024*1024, "max total file size to be parsed concurrently in bytes (limits max memory consumption)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0, nil
+		}
+		return 2, nil
+	}
+	if fs.NArg() == 0 {
+		return 0, fmt.Errorf("no rule files given")
+	}
+
+	l := linter.NewLinter(conf)
+
+	// Stubs are only needed for the type filters,
+	// so the tests can continue without them.
+	if err := initStubs(l); err != nil {
+		log.Printf("Init stubs: %v", err)
+	}
+
+	failed, total, err := RunRuleTests(l, os.Stdout, fs.Args())
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("%d/%d rule tests passed", total-failed, total)
+	if failed != 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// RunRuleTests runs @test-match and @test-nomatch snippets from the rule files
+// with the l linter and prints the failed ones to w.
+// It returns the number of the failed and all test cases.
+func RunRuleTests(l *linter.Linter, w io.Writer, filenames []string) (failed, total int, err error) {
+	var cases []*ruleTestCase
+	for _, filename := range filenames {
+		fileCases, err := loadRuleTestCases(filename)
+		if err != nil {
+			return 0, 0, err
+		}
+		cases = append(cases, fileCases...)
+	}
+
+	failed, err = runRuleTestCases(l, w, cases)
+	return failed, len(cases), err
+}
+
+// loadRuleTestCases parses a rules file and collects the test snippets of its rules.
+func loadRuleTestCases(filename string) ([]*ruleTestCase, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rset, err := rules.NewParser().Parse(filename, f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	var cases []*ruleTestCase
+	scopes := []struct {
+		src   *rules.ScopedSet
+		dst   func(*rules.Set) *rules.ScopedSet
+		local bool
+	}{
+		{rset.Any, func(s *rules.Set) *rules.ScopedSet { return s.Any }, false},
+		{rset.Root, func(s *rules.Set) *rules.ScopedSet { return s.Root }, false},
+		{rset.Local, func(s *rules.Set) *rules.ScopedSet { return s.Local }, true},
+	}
+	for _, scope := range scopes {
+		for kind, list := range scope.src.RulesByKind {
+			for i := range list {
+				rule := &list[i]
+				for j, test := range rule.Tests {
+					set := rules.NewSet()
+					dst := scope.dst(set)
+					dst.RulesByKind[kind] = []rules.Rule{*rule}
+
+					// The snippet file name should pass the @path filter.
+					testFilename := fmt.Sprintf("%s_test%d.php", strings.Replace(rule.Name, "/", "_", -1), j)
+					if rule.Path != "" {
+						testFilename = rule.Path + "/" + testFilename
+					}
+
+					// Local rules only match inside the functions,
+					// so their snippets become a function body.
+					funcName := ""
+					if scope.local {
+						funcName = "test_" + ruleTestFuncRegexp.ReplaceAllString(strings.TrimSuffix(testFilename, ".php"), "_")
+					}
+
+					cases = append(cases, &ruleTestCase{
+						rule:     rule,
+						test:     test,
+						filename: testFilename,
+						code:     ruleTestCode(test, funcName),
+						set:      set,
+					})
+				}
+			}
+		}
+	}
+
+	return cases, nil
+}
+
+// runRuleTestCases checks every test case and prints the failed ones to w.
+// It returns the number of the failed test cases.
+func runRuleTestCases(l *linter.Linter, w io.Writer, cases []*ruleTestCase) (int, error) {
+	// All snippets are indexed together, like the files of one project.
+	for _, c := range cases {
+		_, root, err := l.ParseContents(c.filename, c.code, nil)
+		if err != nil {
+			return 0, err
+		}
+		root.UpdateMetaInfo()
+	}
+	l.MetaInfo().SetIndexingComplete(true)
+
+	defer func(rset *rules.Set) { l.Config().Rules = rset }(l.Config().Rules)
+
+	failed := 0
+	for _, c := range cases {
+		l.Config().Rules = c.set
+		_, root, err := l.ParseContents(c.filename, c.code, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		var matches []*linter.Report
+		for _, r := range root.GetReports() {
+			if r.CheckName() == c.rule.Name && !r.IsDisabledByUser() {
+				matches = append(matches, r)
+			}
+		}
+
+		if c.test.Match == (len(matches) != 0) {
+			continue
+		}
+		failed++
+		printRuleTestFailure(w, c, matches)
+	}
+
+	return failed, nil
+}
+
+func printRuleTestFailure(w io.Writer, c *ruleTestCase, matches []*linter.Report) {
+	attr := "@test-nomatch"
+	if c.test.Match {
+		attr = "@test-match"
+	}
+	fmt.Fprintf(w, "%s: %s failed\n", c.rule.Name, attr)
+	fmt.Fprintf(w, "    %s\n", c.test.Code)
+	if c.test.Match {
+		fmt.Fprintf(w, "  - want: match\n")
+		fmt.Fprintf(w, "  + have: no matches\n")
+		return
+	}
+	fmt.Fprintf(w, "  - want: no matches\n")
+	for _, r := range matches {
+		fmt.Fprintf(w, "  + have: %s\n", strings.Replace(r.String(), "\n", "\n          ", -1))
+	}
+}
+
+// ruleTestCode turns a test snippet into a PHP file contents.
+// If funcName is not empty, the snippet is wrapped into a function with that name.
+func ruleTestCode(test rules.RuleTest, funcName string) []byte {
+	code := test.Code
+	if !strings.HasSuffix(code, ";") && !strings.HasSuffix(code, "}") {
+		code += ";"
+	}
+	if funcName != "" {
+		code = "function " + funcName + "() {\n" + code + "\n}"
+	}
+	return []byte("<?php\n" + code + "\n")
+}
@@ -1,9 +1,14 @@
 package git
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os/exec"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // BlameResult is the result of git blame operation
@@ -13,6 +18,33 @@ type BlameResult struct {
 
 // Blame returns lines that have changed in commit range specified by refSpec with respected commits and line numbers
 func Blame(gitDir string, refspec []string, filename string) (BlameResult, error) {
+	return BlameRanges(gitDir, refspec, filename, nil)
+}
+
+// BlameRanges is like Blame, but only the lines inside ranges are blamed.
+// If ranges is nil, all lines are blamed.
+func BlameRanges(gitDir string, refspec []string, filename string, ranges []LineRange) (BlameResult, error) {
+	if !UseExec {
+		res, err := nativeBlame(gitDir, refspec, filename, ranges)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not blame %s without git command, falling back to git blame: %v", filename, err)
+	}
+
+	res, err := execBlame(gitDir, refspec, filename)
+	if err != nil || ranges == nil {
+		return res, err
+	}
+	for line := range res.Lines {
+		if !LineRangesIntersect(LineRange{From: line, To: line}, ranges) {
+			delete(res.Lines, line)
+		}
+	}
+	return res, nil
+}
+
+func execBlame(gitDir string, refspec []string, filename string) (BlameResult, error) {
 	args := make([]string, 0, 6+len(refspec))
 	args = append(args, "--git-dir="+gitDir, "--no-pager", "blame", "--abbrev=40")
 	args = append(args, refspec...)
@@ -57,3 +89,384 @@ func Blame(gitDir string, refspec []string, filename string) (BlameResult, error
 
 	return res, nil
 }
+
+// LineAuthor is the commit that last changed a file line.
+type LineAuthor struct {
+	Commit string
+	Author string    // Author name
+	Email  string    // Author email
+	Date   time.Time // Author date
+}
+
+// BlameAuthors returns the commits that last changed the file lines, with their authors.
+// Unlike Blame, the lines of the root commits are included.
+//
+// If rev is empty, the file in the workTreeDir is blamed with git command and
+// the uncommitted lines are attributed to the Zero commit. Otherwise the file in
+// the rev is blamed without running git, unless UseExec is set.
+// If ranges is nil, all lines are blamed.
+func BlameAuthors(gitDir, workTreeDir, rev, filename string, ranges []LineRange) (map[int]LineAuthor, error) {
+	if !UseExec && rev != "" {
+		res, err := nativeBlameAuthors(gitDir, rev, filename, ranges)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not blame %s without git command, falling back to git blame: %v", filename, err)
+	}
+
+	return execBlameAuthors(gitDir, workTreeDir, rev, filename, ranges)
+}
+
+func nativeBlameAuthors(gitDir, rev, filename string, ranges []LineRange) (map[int]LineAuthor, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	h, err := r.resolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := r.blame(revisionRange{include: []hash{h}}, filename, ranges, true)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int]LineAuthor, len(lines))
+	for line, c := range lines {
+		res[line] = LineAuthor{
+			Commit: c.hash.String(),
+			Author: c.author,
+			Email:  c.email,
+			Date:   time.Unix(c.date, 0).UTC(),
+		}
+	}
+	return res, nil
+}
+
+// execBlameAuthors parses "git blame --porcelain" output:
+//
+//	<sha1> SP <orig line> SP <final line> [SP <lines in group>]
+//	author <name>
+//	author-mail <<email>>
+//	author-time <timestamp>
+//	...
+//	TAB <line contents>
+//
+// The commit headers are printed only for the first line of the commit.
+func execBlameAuthors(gitDir, workTreeDir, rev, filename string, ranges []LineRange) (map[int]LineAuthor, error) {
+	args := []string{"--git-dir=" + gitDir}
+	if workTreeDir != "" {
+		args = append(args, "--work-tree="+workTreeDir)
+	}
+	args = append(args, "--no-pager", "blame", "--porcelain", "--root")
+	for _, r := range ranges {
+		args = append(args, fmt.Sprintf("-L%d,%d", r.From, r.To))
+	}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--", filename)
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = workTreeDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git blame %s: %v", filename, err)
+	}
+
+	res := make(map[int]LineAuthor)
+	commits := make(map[string]*LineAuthor)
+	var cur *LineAuthor
+	var final int
+	for _, ln := range strings.Split(string(out), "\n") {
+		switch {
+		case ln == "":
+		case cur == nil:
+			fields := strings.Fields(ln)
+			if len(fields) < 3 || len(fields[0]) != CommitHashLen {
+				return nil, fmt.Errorf("Bad blame line: %s", ln)
+			}
+			final, err = strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("Bad blame line: %s", ln)
+			}
+			cur = commits[fields[0]]
+			if cur == nil {
+				cur = &LineAuthor{Commit: fields[0]}
+				commits[fields[0]] = cur
+			}
+		case ln[0] == '\t':
+			res[final] = *cur
+			cur = nil
+		default:
+			key, value := ln, ""
+			if i := strings.IndexByte(ln, ' '); i >= 0 {
+				key, value = ln[:i], ln[i+1:]
+			}
+			switch key {
+			case "author":
+				cur.Author = value
+			case "author-mail":
+				cur.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+			case "author-time":
+				t, _ := strconv.ParseInt(value, 10, 64)
+				cur.Date = time.Unix(t, 0).UTC()
+			}
+		}
+	}
+	return res, nil
+}
+
+// blameLine is a line of the blamed file that is not attributed yet.
+type blameLine struct {
+	final int // 1-based line number in the blamed file version
+	line  int // 0-based line number in the current commit file version
+}
+
+// nativeBlame follows the "git blame" algorithm: lines are passed from
+// commits to their parents while they are not changed, commits get the
+// blame for the lines they changed. Lines that are passed to commits
+// outside the refspec range, as well as the lines of the root commits,
+// are boundary ones and are not included in the result.
+func nativeBlame(gitDir string, refspec []string, filename string, ranges []LineRange) (BlameResult, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return BlameResult{}, err
+	}
+	rr, err := r.parseRefspec(refspec)
+	if err != nil {
+		return BlameResult{}, err
+	}
+	if len(rr.include) != 1 {
+		return BlameResult{}, fmt.Errorf("can't blame %q: exactly one final commit is required", refspec)
+	}
+
+	lines, err := r.blame(rr, filename, ranges, false)
+	if err != nil {
+		return BlameResult{}, err
+	}
+	res := BlameResult{Lines: make(map[int]string, len(lines))}
+	for line, c := range lines {
+		res.Lines[line] = c.hash.String()
+	}
+	return res, nil
+}
+
+// blame returns the commits that get the blame for the file lines in the
+// single included commit of rr. Lines of the root commits are blamed
+// only if root is true.
+func (r *Repository) blame(rr revisionRange, filename string, ranges []LineRange, root bool) (map[int]*commitInfo, error) {
+	final := rr.include[0]
+
+	commits, err := r.revList(rr)
+	if err != nil {
+		return nil, err
+	}
+	inRange := make(map[hash]*commitInfo, len(commits))
+	children := make(map[hash]int, len(commits))
+	for _, c := range commits {
+		inRange[c.hash] = c
+	}
+	for _, c := range commits {
+		for _, p := range c.parents {
+			if _, ok := inRange[p]; ok {
+				children[p]++
+			}
+		}
+	}
+
+	res := make(map[int]*commitInfo)
+	if _, ok := inRange[final]; !ok {
+		return res, nil
+	}
+
+	filename = path.Clean(strings.TrimPrefix(filename, "./"))
+	data, err := r.fileContents(final, filename)
+	if err != nil {
+		return nil, err
+	}
+	numLines := len(splitLines(data))
+
+	var lines []blameLine
+	for i := 0; i < numLines; i++ {
+		if ranges == nil || LineRangesIntersect(LineRange{From: i + 1, To: i + 1}, ranges) {
+			lines = append(lines, blameLine{final: i + 1, line: i})
+		}
+	}
+	pending := map[hash]map[string][]blameLine{final: {filename: lines}}
+
+	// Commits are processed in the topological order,
+	// so all lines are passed to a commit before it's processed.
+	queue := []*commitInfo{inRange[final]}
+	for len(queue) != 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		files := pending[c.hash]
+		delete(pending, c.hash)
+		for path, lines := range files {
+			remaining, err := r.passBlame(c, path, lines, func(parent hash, path string, lines []blameLine) {
+				if _, ok := inRange[parent]; !ok {
+					return
+				}
+				if pending[parent] == nil {
+					pending[parent] = make(map[string][]blameLine)
+				}
+				pending[parent][path] = append(pending[parent][path], lines...)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(c.parents) == 0 && !root {
+				continue // Root commits are boundary
+			}
+			for _, ln := range remaining {
+				res[ln.final] = c
+			}
+		}
+
+		for _, p := range c.parents {
+			if _, ok := inRange[p]; !ok {
+				continue
+			}
+			children[p]--
+			if children[p] == 0 {
+				queue = append(queue, inRange[p])
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// passBlame passes the lines of the commit file that are not changed
+// by the commit to its parents and returns the lines that are changed.
+func (r *Repository) passBlame(c *commitInfo, filename string, lines []blameLine, pass func(parent hash, path string, lines []blameLine)) ([]blameLine, error) {
+	entry, ok, err := r.fileAt(c.tree, filename)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no %s in %s", filename, c.hash)
+	}
+
+	type parentFile struct {
+		commit hash
+		path   string
+		entry  treeEntry
+	}
+	var parents []parentFile
+	for _, p := range c.parents {
+		pc, err := r.commit(p)
+		if err != nil {
+			return nil, err
+		}
+		path, e, ok, err := r.findParentFile(pc.tree, c.tree, filename)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		// The whole file is passed to the parent with the same contents.
+		if e.hash == entry.hash {
+			pass(p, path, lines)
+			return nil, nil
+		}
+		parents = append(parents, parentFile{commit: p, path: path, entry: e})
+	}
+	if len(parents) == 0 {
+		return lines, nil
+	}
+
+	obj, err := r.readObject(entry.hash)
+	if err != nil {
+		return nil, err
+	}
+	data := obj.Contents
+
+	for _, p := range parents {
+		if len(lines) == 0 {
+			break
+		}
+		parentObj, err := r.readObject(p.entry.hash)
+		if err != nil {
+			return nil, err
+		}
+		mapping := unchangedLines(diffLines(parentObj.Contents, data), len(splitLines(data)))
+
+		var passed, kept []blameLine
+		for _, ln := range lines {
+			if ln.line < len(mapping) && mapping[ln.line] >= 0 {
+				passed = append(passed, blameLine{final: ln.final, line: mapping[ln.line]})
+			} else {
+				kept = append(kept, ln)
+			}
+		}
+		if len(passed) != 0 {
+			pass(p.commit, p.path, passed)
+		}
+		lines = kept
+	}
+	return lines, nil
+}
+
+// findParentFile returns the path and entry of the file in the parent tree,
+// following the renames.
+func (r *Repository) findParentFile(parentTree, tree hash, filename string) (string, treeEntry, bool, error) {
+	e, ok, err := r.fileAt(parentTree, filename)
+	if err != nil || ok {
+		return filename, e, ok, err
+	}
+
+	pairs, err := r.changedFiles(parentTree, tree, "")
+	if err != nil {
+		return "", treeEntry{}, false, err
+	}
+
+	// Exact renames are dropped by detectRenames, look for them first.
+	var newEntry *treeEntry
+	for _, p := range pairs {
+		if p.newPath == filename {
+			newEntry = p.new
+		}
+	}
+	if newEntry == nil {
+		return "", treeEntry{}, false, nil
+	}
+	for _, p := range pairs {
+		if p.new == nil && p.old.hash == newEntry.hash {
+			return p.oldPath, *p.old, true, nil
+		}
+	}
+
+	if pairs, err = r.detectRenames(pairs); err != nil {
+		return "", treeEntry{}, false, err
+	}
+	for _, p := range pairs {
+		if p.newPath == filename && p.old != nil {
+			return p.oldPath, *p.old, true, nil
+		}
+	}
+	return "", treeEntry{}, false, nil
+}
+
+// fileContents returns the contents of the file in the commit.
+func (r *Repository) fileContents(commit hash, filename string) ([]byte, error) {
+	c, err := r.commit(commit)
+	if err != nil {
+		return nil, err
+	}
+	e, ok, err := r.fileAt(c.tree, filename)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("no such path " + filename + " in " + commit.String())
+	}
+	obj, err := r.readObject(e.hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Contents, nil
+}
@@ -0,0 +1,121 @@
+package git
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CodeOwnersLocations are the paths where CODEOWNERS file is looked for,
+// relative to the work tree root, in the order of priority.
+var CodeOwnersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners is a parsed CODEOWNERS file.
+//
+// Patterns follow the gitignore rules, except for the negation and
+// escaping, and "dir/*" patterns don't match the nested directories.
+// The last matching pattern defines the owners.
+type CodeOwners struct {
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	segments []string // Pattern split by "/", "**" matches any number of segments
+	dirOnly  bool     // Pattern ends with "/" and matches only directories contents
+	subtree  bool     // Pattern can match a directory and all files inside it
+	owners   []string
+}
+
+// FindCodeOwners returns the path of the CODEOWNERS file in the work tree.
+// It returns false if there is no such file.
+func FindCodeOwners(workTree string) (string, bool) {
+	for _, loc := range CodeOwnersLocations {
+		filename := filepath.Join(workTree, filepath.FromSlash(loc))
+		if st, err := os.Stat(filename); err == nil && !st.IsDir() {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+// ParseCodeOwners parses the CODEOWNERS file contents.
+// Lines are "pattern owner...", where owners are @user, @org/team or emails.
+func ParseCodeOwners(data []byte) *CodeOwners {
+	c := &CodeOwners{}
+	for _, ln := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(ln, '#'); i >= 0 {
+			ln = ln[:i]
+		}
+		fields := strings.Fields(ln)
+		if len(fields) == 0 {
+			continue
+		}
+
+		pattern := fields[0]
+		// Pattern without owners makes the files unowned.
+		var rule codeOwnersRule
+		if len(fields) > 1 {
+			rule.owners = fields[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		// Patterns without slashes (except for the trailing one) match at any depth.
+		if !strings.Contains(pattern, "/") {
+			rule.segments = append(rule.segments, "**")
+		}
+		rule.segments = append(rule.segments, strings.Split(strings.TrimPrefix(pattern, "/"), "/")...)
+		// Like in GitHub, "docs/*" only matches the files directly inside docs,
+		// while "docs/" and "docs" match the whole directory.
+		last := rule.segments[len(rule.segments)-1]
+		rule.subtree = rule.dirOnly || !strings.ContainsAny(last, "*?[")
+		c.rules = append(c.rules, rule)
+	}
+	return c
+}
+
+// Owners returns the owners of the slash-separated filename relative to
+// the work tree root, or nil if the file is not owned.
+func (c *CodeOwners) Owners(filename string) []string {
+	parts := strings.Split(strings.TrimPrefix(path.Clean(filename), "/"), "/")
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		r := &c.rules[i]
+		// Pattern that matches a directory matches all files inside it.
+		from, to := len(parts), len(parts)
+		if r.subtree {
+			from = 1
+		}
+		if r.dirOnly {
+			to--
+		}
+		for n := from; n <= to; n++ {
+			if matchSegments(r.segments, parts[:n]) {
+				return r.owners
+			}
+		}
+	}
+	return nil
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
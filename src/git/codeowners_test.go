@@ -0,0 +1,50 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCodeOwners(t *testing.T) {
+	owners := ParseCodeOwners([]byte(`
+# Default owners
+*                 @org/core
+*.js              @org/frontend # Inline comment
+/build/           @org/infra
+docs/             @org/docs
+apps/**/tests     @org/qa
+/src/legacy.php   @alice bob@example.com
+/src/vendor/
+assets/*          @org/design
+`))
+
+	tests := []struct {
+		filename string
+		want     []string
+	}{
+		{"main.php", []string{"@org/core"}},
+		{"web/app.js", []string{"@org/frontend"}},
+		{"build/a.php", []string{"@org/infra"}},
+		{"sub/build/a.php", []string{"@org/core"}},
+		{"build", []string{"@org/core"}},
+		{"docs/a.md", []string{"@org/docs"}},
+		{"sub/docs/a.js", []string{"@org/docs"}},
+		{"apps/tests/a.php", []string{"@org/qa"}},
+		{"apps/x/y/tests/z/a.php", []string{"@org/qa"}},
+		{"src/legacy.php", []string{"@alice", "bob@example.com"}},
+		{"./src/legacy.php", []string{"@alice", "bob@example.com"}},
+		{"src/vendor/lib.php", nil},
+		{"assets/logo.png", []string{"@org/design"}},
+		{"assets/icons/x.png", []string{"@org/core"}},
+		{"assets/icons/x.js", []string{"@org/frontend"}},
+		{"docs/sub/file.php", []string{"@org/docs"}},
+	}
+
+	for _, test := range tests {
+		have := owners.Owners(test.filename)
+		if diff := cmp.Diff(have, test.want); diff != "" {
+			t.Errorf("Owners(%q) mismatch (-have +want):\n%s", test.filename, diff)
+		}
+	}
+}
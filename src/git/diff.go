@@ -112,7 +112,21 @@ func LineRangesIntersect(elem LineRange, list []LineRange) bool {
 // Diff computes diff given the refspec (e.g. {"php7_more_fixes", "^php7_testing", "^master"}) and returns
 // changed lines in the final version.
 // Set workTreeDir to "" if you compute changes only between branches without working copy.
+//
+// Changes between commits are computed without running git, unless UseExec is set.
 func Diff(gitDir, workTreeDir string, refspec []string) ([]Change, error) {
+	if !UseExec && workTreeDir == "" {
+		res, err := nativeDiff(gitDir, refspec)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not compute diff without git command, falling back to git diff: %v", err)
+	}
+
+	return execDiff(gitDir, workTreeDir, refspec)
+}
+
+func execDiff(gitDir, workTreeDir string, refspec []string) ([]Change, error) {
 	args := make([]string, 0, 6+len(refspec))
 	args = append(args, "--git-dir="+gitDir, "--no-pager")
 	if workTreeDir != "" {
@@ -169,6 +183,18 @@ func Fetch(gitDir, from, to string) error {
 
 // Log computes log in refspec
 func Log(gitDir string, refspec []string) (res []Commit, err error) {
+	if !UseExec {
+		res, err := nativeLog(gitDir, refspec)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not compute log without git command, falling back to git log: %v", err)
+	}
+
+	return execLog(gitDir, refspec)
+}
+
+func execLog(gitDir string, refspec []string) (res []Commit, err error) {
 	args := make([]string, 0, 6+len(refspec))
 	args = append(args, "--git-dir="+gitDir, "--no-pager", "log", "--oneline", "--format=%H/%an/%s")
 	args = append(args, refspec...)
@@ -197,9 +223,18 @@ func Log(gitDir string, refspec []string) (res []Commit, err error) {
 	return res, nil
 }
 
+// ParseDiff parses the unified diff, e.g. the output of "git diff" or
+// a patch file, and returns changed lines in the new files versions.
+//
+// Only added and deleted lines are treated as changed, context lines are not.
+func ParseDiff(r io.Reader) ([]Change, error) {
+	return parseDiff(bufio.NewReader(r))
+}
+
 func parseDiff(rd *bufio.Reader) ([]Change, error) {
 	var res []Change
 	var cur Change
+	var h hunk
 
 	cur.Valid = true
 
@@ -212,8 +247,17 @@ ParsingLoop:
 		case err != nil:
 			return nil, err
 		case skip:
+			h.abort()
+			continue
+		}
+
+		if h.active() && h.parseLine(ln) {
+			if h.done() {
+				h.finish(&cur)
+			}
 			continue
 		}
+		h.abort()
 
 		switch {
 		case bytes.HasPrefix(ln, diffOldPrefix):
@@ -238,6 +282,7 @@ ParsingLoop:
 			if err := cur.parsePatchHeader(trimmed[0:suffixIdx]); err != nil {
 				return nil, err
 			}
+			h.start(trimmed[0:suffixIdx], len(cur.LineRanges)-1)
 		case bytes.HasPrefix(ln, patchHeaderPrefix3) && bytes.Contains(ln, patchHeaderSuffix3):
 			trimmed := bytes.TrimPrefix(ln, patchHeaderPrefix3)
 			suffixIdx := bytes.Index(trimmed, patchHeaderSuffix3)
@@ -257,6 +302,168 @@ ParsingLoop:
 	return res, nil
 }
 
+// hunk tracks the body of a two-way diff hunk.
+//
+// Hunks with context lines are split into several ranges, one per
+// each block of the added and deleted lines, as if the diff was
+// computed with -U0. If the body can't be parsed, the ranges from
+// the hunk header are used as is.
+type hunk struct {
+	// index is the hunk header ranges index inside Change ranges.
+	index int
+
+	oldLeft, newLeft int // Number of the body lines left
+	oldPos, newPos   int // Next line numbers
+
+	hasContext bool
+
+	// Current block of changes.
+	inBlock            bool
+	blockOld, blockNew int // Block start line numbers
+	oldLen, newLen     int
+
+	oldRanges, newRanges []LineRange
+}
+
+// @@ -20433,288 +20433,10 @@
+func (h *hunk) start(header []byte, index int) {
+	*h = hunk{index: index}
+
+	fields := bytes.Fields(header)
+	if len(fields) != 2 || fields[0][0] != '-' || fields[1][0] != '+' {
+		return
+	}
+	var ok bool
+	if h.oldPos, h.oldLeft, ok = parseHunkRange(fields[0][1:]); !ok {
+		return
+	}
+	if h.newPos, h.newLeft, ok = parseHunkRange(fields[1][1:]); !ok {
+		h.oldLeft = 0
+		return
+	}
+}
+
+func (h *hunk) active() bool {
+	return h.oldLeft > 0 || h.newLeft > 0
+}
+
+func (h *hunk) done() bool {
+	return h.oldLeft == 0 && h.newLeft == 0
+}
+
+func (h *hunk) abort() {
+	h.oldLeft = 0
+	h.newLeft = 0
+}
+
+// parseLine consumes one hunk body line.
+// It returns false if ln is not a body line.
+func (h *hunk) parseLine(ln []byte) bool {
+	if len(ln) == 0 {
+		// Some tools strip the trailing space of the empty context lines.
+		ln = []byte(" ")
+	}
+
+	switch ln[0] {
+	case '\\': // \ No newline at end of file
+		return true
+	case ' ':
+		if h.oldLeft == 0 || h.newLeft == 0 {
+			return false
+		}
+		h.endBlock()
+		h.hasContext = true
+		h.oldLeft--
+		h.newLeft--
+		h.oldPos++
+		h.newPos++
+	case '-':
+		if h.oldLeft == 0 {
+			return false
+		}
+		h.startBlock()
+		h.oldLeft--
+		h.oldPos++
+		h.oldLen++
+	case '+':
+		if h.newLeft == 0 {
+			return false
+		}
+		h.startBlock()
+		h.newLeft--
+		h.newPos++
+		h.newLen++
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (h *hunk) startBlock() {
+	if h.inBlock {
+		return
+	}
+	h.inBlock = true
+	h.blockOld = h.oldPos
+	h.blockNew = h.newPos
+	h.oldLen = 0
+	h.newLen = 0
+}
+
+func (h *hunk) endBlock() {
+	if !h.inBlock {
+		return
+	}
+	h.inBlock = false
+	h.oldRanges = append(h.oldRanges, blockLineRange(h.blockOld, h.oldLen))
+	h.newRanges = append(h.newRanges, blockLineRange(h.blockNew, h.newLen))
+}
+
+// finish replaces the hunk header ranges of c with the ranges of the blocks.
+func (h *hunk) finish(c *Change) {
+	h.endBlock()
+	if !h.hasContext || len(h.newRanges) == 0 {
+		return
+	}
+
+	c.LineRanges = append(c.LineRanges[:h.index], h.newRanges...)
+	c.OldLineRanges = append(c.OldLineRanges[:h.index], h.oldRanges...)
+}
+
+// blockLineRange returns the range like the one parseLineRange
+// returns for the "start,length" range of the -U0 diff.
+func blockLineRange(start, length int) LineRange {
+	if length == 0 {
+		// The empty range points to the line before the change.
+		return LineRange{From: start - 1, To: start - 1, HaveRange: true}
+	}
+	return LineRange{From: start, To: start + length - 1, HaveRange: length != 1, Range: length - 1}
+}
+
+// parseHunkRange parses "start[,length]" hunk header range.
+// The returned pos is the number of the first hunk line.
+func parseHunkRange(r []byte) (pos, length int, ok bool) {
+	length = 1
+	if commaIdx := bytes.IndexByte(r, ','); commaIdx >= 0 {
+		n, err := strconv.Atoi(string(r[commaIdx+1:]))
+		if err != nil {
+			return 0, 0, false
+		}
+		length = n
+		r = r[:commaIdx]
+	}
+	start, err := strconv.Atoi(string(r))
+	if err != nil {
+		return 0, 0, false
+	}
+	if length == 0 {
+		// Empty ranges point to the line before the hunk.
+		start++
+	}
+	return start, length, true
+}
+
 // --- a/oldfile
 // --- /dev/null
 func (c *Change) parseOld(ln []byte) {
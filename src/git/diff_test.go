@@ -0,0 +1,112 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []Change
+	}{
+		{
+			name: "zero context",
+			diff: `diff --git a/a.php b/a.php
+--- a/a.php
++++ b/a.php
+@@ -3 +3 @@ function f() {
+-  return 1;
++  return 2;
+@@ -10,2 +9,0 @@ function g() {
+-  echo 1;
+-  echo 2;
+@@ -20,0 +19,2 @@ function h() {
++  echo 3;
++  echo 4;
+`,
+			want: []Change{{
+				Type:    Changed,
+				OldName: "a.php",
+				NewName: "a.php",
+				OldLineRanges: []LineRange{
+					{From: 3, To: 3},
+					{From: 10, To: 11, HaveRange: true, Range: 1},
+					{From: 20, To: 20, HaveRange: true},
+				},
+				LineRanges: []LineRange{
+					{From: 3, To: 3},
+					{From: 9, To: 9, HaveRange: true},
+					{From: 19, To: 20, HaveRange: true, Range: 1},
+				},
+				Valid: true,
+			}},
+		},
+
+		{
+			name: "with context",
+			diff: `--- a/a.php
++++ b/a.php
+@@ -1,8 +1,8 @@
+ <?php
+ function f() {
+-  return 1;
++  return 2;
+ }
+-
+--- removed line that looks like a header
+ function g() {
++  echo 1;
++  echo 2;
+ }
+\ No newline at end of file
+--- /dev/null
++++ b/new.php
+@@ -0,0 +1,2 @@
++<?php
++echo 1;
+`,
+			want: []Change{
+				{
+					Type:    Changed,
+					OldName: "a.php",
+					NewName: "a.php",
+					OldLineRanges: []LineRange{
+						{From: 3, To: 3},
+						{From: 5, To: 6, HaveRange: true, Range: 1},
+						{From: 7, To: 7, HaveRange: true},
+					},
+					LineRanges: []LineRange{
+						{From: 3, To: 3},
+						{From: 4, To: 4, HaveRange: true},
+						{From: 6, To: 7, HaveRange: true, Range: 1},
+					},
+					Valid: true,
+				},
+				{
+					Type:          Added,
+					OldName:       "/dev/null",
+					NewName:       "new.php",
+					OldLineRanges: []LineRange{{From: 0, To: 0, HaveRange: true}},
+					LineRanges:    []LineRange{{From: 1, To: 2, HaveRange: true, Range: 1}},
+					Valid:         true,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			have, err := ParseDiff(strings.NewReader(test.diff))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(have, test.want); diff != "" {
+				t.Errorf("changes mismatch (-have +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package git
+
+import (
+	"bytes"
+)
+
+// diffBlock is a block of the changed lines.
+// Line numbers are 0-based, empty blocks point to the next line.
+type diffBlock struct {
+	oldStart, oldLen int
+	newStart, newLen int
+}
+
+// lineRanges returns the block ranges like "git diff -U0" hunk headers describe them.
+func (b diffBlock) lineRanges() (old, new LineRange) {
+	return blockLineRange(b.oldStart+1, b.oldLen), blockLineRange(b.newStart+1, b.newLen)
+}
+
+// splitLines splits data into lines, keeping the line terminators,
+// so the last line without a newline differs from the same line with it.
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) != 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, data)
+			break
+		}
+		lines = append(lines, data[:i+1])
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns the blocks of lines that differ between the old and new contents.
+// The blocks are the same as "git diff" with the default settings finds.
+func diffLines(old, new []byte) []diffBlock {
+	old, new = trimCommonTail(old, new)
+	oldLines, newLines := splitLines(old), splitLines(new)
+	a, b := internLines(oldLines, newLines)
+
+	fileA := &diffFile{lines: oldLines, ids: a, changed: make([]bool, len(a))}
+	fileB := &diffFile{lines: newLines, ids: b, changed: make([]bool, len(b))}
+	xdiff(fileA, fileB)
+
+	return blocksFromChanged(fileA.changed, fileB.changed)
+}
+
+// trimCommonTail removes the equal 1KB blocks from the end of the files,
+// leaving the last line complete. Like git does, it's done before
+// splitting the files into lines, so the files that differ only at
+// the beginning are compared faster.
+func trimCommonTail(a, b []byte) ([]byte, []byte) {
+	const blk = 1024
+
+	smaller := len(a)
+	if len(b) < smaller {
+		smaller = len(b)
+	}
+	trimmed := 0
+	for trimmed+blk <= smaller && bytes.Equal(a[len(a)-trimmed-blk:len(a)-trimmed], b[len(b)-trimmed-blk:len(b)-trimmed]) {
+		trimmed += blk
+	}
+
+	tail := a[len(a)-trimmed:]
+	recovered := 0
+	for recovered < trimmed {
+		recovered++
+		if tail[recovered-1] == '\n' {
+			break
+		}
+	}
+	return a[:len(a)-trimmed+recovered], b[:len(b)-trimmed+recovered]
+}
+
+// internLines replaces lines with the numbers that are equal for the equal lines.
+func internLines(old, new [][]byte) (a, b []int) {
+	ids := make(map[string]int, len(old))
+	intern := func(lines [][]byte) []int {
+		res := make([]int, len(lines))
+		for i, ln := range lines {
+			id, ok := ids[string(ln)]
+			if !ok {
+				id = len(ids)
+				ids[string(ln)] = id
+			}
+			res[i] = id
+		}
+		return res
+	}
+	return intern(old), intern(new)
+}
+
+// blocksFromChanged groups the changed lines marks into blocks.
+func blocksFromChanged(changedA, changedB []bool) []diffBlock {
+	var blocks []diffBlock
+	i, j := 0, 0
+	for i < len(changedA) || j < len(changedB) {
+		if i < len(changedA) && j < len(changedB) && !changedA[i] && !changedB[j] {
+			i++
+			j++
+			continue
+		}
+		blk := diffBlock{oldStart: i, newStart: j}
+		for i < len(changedA) && changedA[i] {
+			i++
+		}
+		for j < len(changedB) && changedB[j] {
+			j++
+		}
+		blk.oldLen = i - blk.oldStart
+		blk.newLen = j - blk.newStart
+		if blk.oldLen == 0 && blk.newLen == 0 {
+			// Unbalanced marks, should not happen.
+			blk.oldLen = len(changedA) - i
+			blk.newLen = len(changedB) - j
+			i, j = len(changedA), len(changedB)
+		}
+		blocks = append(blocks, blk)
+	}
+	return blocks
+}
+
+// unchangedLines returns a mapping from the new lines to the old
+// lines for the lines that are not changed by the blocks.
+// Missing (changed) lines are set to -1.
+func unchangedLines(blocks []diffBlock, newCount int) []int {
+	res := make([]int, newCount)
+	oldLine, newLine := 0, 0
+	fill := func(newEnd int) {
+		for ; newLine < newEnd; newLine++ {
+			res[newLine] = oldLine
+			oldLine++
+		}
+	}
+	for _, blk := range blocks {
+		fill(blk.newStart)
+		for i := 0; i < blk.newLen; i++ {
+			res[newLine] = -1
+			newLine++
+		}
+		oldLine += blk.oldLen
+	}
+	fill(newCount)
+	return res
+}
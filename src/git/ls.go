@@ -23,3 +23,20 @@ func UntrackedFiles(gitDir string) ([]string, error) {
 	filenames := strings.Split(strings.TrimSpace(string(out)), "\n")
 	return filenames, nil
 }
+
+// FindRepository returns the absolute paths of the git directory
+// and the work tree of the repository that contains dir.
+func FindRepository(dir string) (gitDir, workTree string, err error) {
+	cmd := exec.Command("git", "rev-parse", "--absolute-git-dir", "--show-toplevel")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", "", fmt.Errorf("%v: %v", err, strings.TrimSpace(string(out)))
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("%s is not inside a work tree", dir)
+	}
+	return lines[0], lines[1], nil
+}
@@ -9,6 +9,19 @@ import (
 
 // MergeBase computes merge base between commits one and two
 func MergeBase(gitDir string, one, two string) (res string, err error) {
+	if !UseExec {
+		res, err := nativeMergeBase(gitDir, one, two)
+		if err == nil {
+			log.Printf("merge base between %s and %s is %s", one, two, res)
+			return res, nil
+		}
+		log.Printf("Could not compute merge base without git command, falling back to git merge-base: %v", err)
+	}
+
+	return execMergeBase(gitDir, one, two)
+}
+
+func execMergeBase(gitDir string, one, two string) (res string, err error) {
 	cmd := exec.Command("git", "--git-dir="+gitDir, "merge-base", one, two)
 	defer cmd.Wait()
 
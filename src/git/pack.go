@@ -0,0 +1,345 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Packed object types.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypeNames = map[int]string{
+	packCommit: "commit",
+	packTree:   "tree",
+	packBlob:   "blob",
+	packTag:    "tag",
+}
+
+// packFile is a packfile with its version 2 index.
+// See Documentation/technical/pack-format.txt in the git sources.
+type packFile struct {
+	f *os.File
+
+	fanout  [256]uint32
+	names   []byte // Sorted object names, 20 bytes each
+	offsets []byte // 4 bytes each
+	large   []byte // 8 bytes each
+
+	mu        sync.Mutex
+	cache     map[int64]*Object // Delta bases cache
+	cacheSize int
+}
+
+// maxPackCacheSize is a max total size of the cached delta bases per pack.
+const maxPackCacheSize = 32 << 20
+
+func openPack(idxPath string) (*packFile, error) {
+	idx, err := ioutil.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(idx) < 8+256*4 || !bytes.HasPrefix(idx, []byte("\377tOc")) {
+		return nil, fmt.Errorf("%s: unsupported pack index format", idxPath)
+	}
+	if v := binary.BigEndian.Uint32(idx[4:]); v != 2 {
+		return nil, fmt.Errorf("%s: unsupported pack index version %d", idxPath, v)
+	}
+
+	p := &packFile{cache: make(map[int64]*Object)}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(idx) < pos+n*(hashLen+4+4) {
+		return nil, fmt.Errorf("%s: truncated pack index", idxPath)
+	}
+	p.names = idx[pos : pos+n*hashLen]
+	pos += n * hashLen
+	pos += n * 4 // CRC32 values
+	p.offsets = idx[pos : pos+n*4]
+	pos += n * 4
+	p.large = idx[pos:]
+
+	f, err := os.Open(strings.TrimSuffix(idxPath, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	p.f = f
+	return p, nil
+}
+
+func (p *packFile) numObjects() int {
+	return int(p.fanout[255])
+}
+
+func (p *packFile) name(i int) []byte {
+	return p.names[i*hashLen : (i+1)*hashLen]
+}
+
+// find returns the offset of the object h inside the pack.
+func (p *packFile) find(h hash) (int64, bool) {
+	lo := 0
+	if h[0] > 0 {
+		lo = int(p.fanout[h[0]-1])
+	}
+	hi := int(p.fanout[h[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.name(lo+i), h[:]) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.name(i), h[:]) {
+		return 0, false
+	}
+	return p.offset(i), true
+}
+
+func (p *packFile) offset(i int) int64 {
+	off := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if off&0x80000000 == 0 {
+		return int64(off)
+	}
+	i = int(off &^ 0x80000000)
+	if len(p.large) < (i+1)*8 {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(p.large[i*8:]))
+}
+
+// findPrefix appends the names of the objects that start with the hex prefix.
+func (p *packFile) findPrefix(prefix string, res map[hash]struct{}) {
+	first, ok := parseHexByte(prefix)
+	if !ok {
+		return
+	}
+	lo := 0
+	if first > 0 {
+		lo = int(p.fanout[first-1])
+	}
+	hi := int(p.fanout[first])
+	for i := lo; i < hi; i++ {
+		var h hash
+		copy(h[:], p.name(i))
+		if strings.HasPrefix(h.String(), prefix) {
+			res[h] = struct{}{}
+		}
+	}
+}
+
+// read returns the object stored at the offset, with all deltas applied.
+// The base objects of the REF_DELTA objects are read from r.
+func (p *packFile) read(r *Repository, offset int64) (*Object, error) {
+	p.mu.Lock()
+	obj, ok := p.cache[offset]
+	p.mu.Unlock()
+	if ok {
+		return obj, nil
+	}
+
+	var hdr [32]byte
+	n, err := p.f.ReadAt(hdr[:], offset)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	buf := hdr[:n]
+
+	// Type and size header.
+	pos := 0
+	if len(buf) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	c := buf[pos]
+	pos++
+	typ := int(c>>4) & 7
+	size := int(c & 15)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if pos >= len(buf) {
+			return nil, errors.New("bad packed object header")
+		}
+		c = buf[pos]
+		pos++
+		size |= int(c&0x7f) << shift
+		shift += 7
+	}
+
+	var base *Object
+	switch typ {
+	case packOfsDelta:
+		if pos >= len(buf) {
+			return nil, errors.New("bad delta offset")
+		}
+		c = buf[pos]
+		pos++
+		baseOff := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if pos >= len(buf) {
+				return nil, errors.New("bad delta offset")
+			}
+			c = buf[pos]
+			pos++
+			baseOff = ((baseOff + 1) << 7) | int64(c&0x7f)
+		}
+		base, err = p.read(r, offset-baseOff)
+		if err != nil {
+			return nil, err
+		}
+	case packRefDelta:
+		if pos+hashLen > len(buf) {
+			return nil, errors.New("bad delta base")
+		}
+		var h hash
+		copy(h[:], buf[pos:pos+hashLen])
+		pos += hashLen
+		base, err = r.readObject(h)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if _, ok := packTypeNames[typ]; !ok {
+			return nil, fmt.Errorf("unknown packed object type %d", typ)
+		}
+	}
+
+	data, err := inflate(io.NewSectionReader(p.f, offset+int64(pos), 1<<62), size)
+	if err != nil {
+		return nil, err
+	}
+
+	if base == nil {
+		obj = &Object{Type: packTypeNames[typ], Contents: data}
+	} else {
+		data, err = applyDelta(base.Contents, data)
+		if err != nil {
+			return nil, err
+		}
+		obj = &Object{Type: base.Type, Contents: data}
+	}
+
+	// Only the trees and commits are cached because they are
+	// often used as delta bases and they are read many times.
+	if obj.Type == "tree" || obj.Type == "commit" {
+		p.mu.Lock()
+		if p.cacheSize+len(obj.Contents) > maxPackCacheSize {
+			p.cache = make(map[int64]*Object)
+			p.cacheSize = 0
+		}
+		p.cache[offset] = obj
+		p.cacheSize += len(obj.Contents)
+		p.mu.Unlock()
+	}
+
+	return obj, nil
+}
+
+// inflate reads size bytes of the zlib-compressed data.
+func inflate(rd io.Reader, size int) ([]byte, error) {
+	zr, err := zlib.NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applyDelta applies the git delta to the base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errBadDelta := errors.New("bad delta")
+
+	readSize := func() (int, bool) {
+		size := 0
+		shift := uint(0)
+		for {
+			if len(delta) == 0 {
+				return 0, false
+			}
+			c := delta[0]
+			delta = delta[1:]
+			size |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return size, true
+			}
+		}
+	}
+
+	baseSize, ok := readSize()
+	if !ok || baseSize != len(base) {
+		return nil, errBadDelta
+	}
+	resSize, ok := readSize()
+	if !ok {
+		return nil, errBadDelta
+	}
+
+	res := make([]byte, 0, resSize)
+	for len(delta) != 0 {
+		c := delta[0]
+		delta = delta[1:]
+
+		if c&0x80 == 0 {
+			// Insert the next c bytes.
+			n := int(c)
+			if n == 0 || n > len(delta) {
+				return nil, errBadDelta
+			}
+			res = append(res, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+
+		// Copy from the base.
+		var off, size int
+		for i := uint(0); i < 4; i++ {
+			if c&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errBadDelta
+				}
+				off |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := uint(0); i < 3; i++ {
+			if c&(0x10<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errBadDelta
+				}
+				size |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if off+size > len(base) {
+			return nil, errBadDelta
+		}
+		res = append(res, base[off:off+size]...)
+	}
+
+	if len(res) != resSize {
+		return nil, errBadDelta
+	}
+	return res, nil
+}
@@ -0,0 +1,698 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UseExec forces Diff, Log, MergeBase and Blame to run git commands
+// instead of reading the repository objects directly, see Repository.
+var UseExec bool
+
+const hashLen = CommitHashLen / 2
+
+// hash is a raw SHA1 object name.
+type hash [hashLen]byte
+
+func (h hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func parseHash(s string) (h hash, ok bool) {
+	if len(s) != CommitHashLen {
+		return h, false
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return h, err == nil
+}
+
+func parseHexByte(s string) (byte, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	b, err := hex.DecodeString(s[:2])
+	if err != nil {
+		return 0, false
+	}
+	return b[0], true
+}
+
+// errNotFound is returned for the missing objects and refs.
+var errNotFound = errors.New("not found")
+
+// Repository reads git objects directly from the packfiles and loose objects,
+// without running git commands.
+//
+// Only SHA1 repositories are supported.
+// Repository methods can be called concurrently.
+type Repository struct {
+	gitDir    string // HEAD and other pseudo refs
+	commonDir string // refs, packed-refs and objects
+
+	objectDirs []string // Main objects dir and alternates
+
+	// Commits that have no parents in the shallow clones.
+	shallow map[hash]bool
+
+	mu      sync.Mutex
+	packs   []*packFile
+	packSet map[string]bool // Opened .idx files
+
+	commits sync.Map // hash => *commitInfo
+	trees   sync.Map // hash => []treeEntry
+}
+
+var repositories = struct {
+	sync.Mutex
+	m map[string]*Repository
+}{m: make(map[string]*Repository)}
+
+// openCached returns the repository for the gitDir, opening it only once.
+func openCached(gitDir string) (*Repository, error) {
+	repositories.Lock()
+	defer repositories.Unlock()
+
+	if r, ok := repositories.m[gitDir]; ok {
+		return r, nil
+	}
+	r, err := OpenRepository(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	repositories.m[gitDir] = r
+	return r, nil
+}
+
+// OpenRepository opens the repository with the .git directory gitDir.
+func OpenRepository(gitDir string) (*Repository, error) {
+	// Linked work trees and submodules have a ".git" file
+	// with "gitdir: <path>" instead of a directory.
+	if st, err := os.Stat(gitDir); err == nil && !st.IsDir() {
+		data, err := ioutil.ReadFile(gitDir)
+		if err != nil {
+			return nil, err
+		}
+		dir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(gitDir), dir)
+		}
+		gitDir = dir
+	}
+
+	r := &Repository{
+		gitDir:    gitDir,
+		commonDir: gitDir,
+		packSet:   make(map[string]bool),
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		dir := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(gitDir, dir)
+		}
+		r.commonDir = dir
+	}
+
+	if config, err := ioutil.ReadFile(filepath.Join(r.commonDir, "config")); err == nil {
+		if bytes.Contains(bytes.ToLower(config), []byte("objectformat")) {
+			return nil, errors.New("only SHA1 repositories are supported")
+		}
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(r.commonDir, "shallow")); err == nil {
+		r.shallow = make(map[hash]bool)
+		for _, ln := range strings.Fields(string(data)) {
+			if h, ok := parseHash(ln); ok {
+				r.shallow[h] = true
+			}
+		}
+	}
+
+	objectsDir := filepath.Join(r.commonDir, "objects")
+	if _, err := os.Stat(objectsDir); err != nil {
+		return nil, err
+	}
+	r.objectDirs = append(r.objectDirs, objectsDir)
+	r.objectDirs = append(r.objectDirs, readAlternates(objectsDir, 0)...)
+
+	if err := r.loadPacks(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func readAlternates(objectsDir string, depth int) []string {
+	// git limits the alternates nesting by 5 too.
+	if depth > 5 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(objectsDir, "info", "alternates"))
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, dir := range strings.Split(string(data), "\n") {
+		dir = strings.TrimSpace(dir)
+		if dir == "" || strings.HasPrefix(dir, "#") {
+			continue
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(objectsDir, dir)
+		}
+		res = append(res, dir)
+		res = append(res, readAlternates(dir, depth+1)...)
+	}
+	return res
+}
+
+// loadPacks opens all packs that were not opened before.
+func (r *Repository) loadPacks() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, dir := range r.objectDirs {
+		idxFiles, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+		if err != nil {
+			return err
+		}
+		for _, idxPath := range idxFiles {
+			if r.packSet[idxPath] {
+				continue
+			}
+			p, err := openPack(idxPath)
+			if err != nil {
+				return err
+			}
+			r.packs = append(r.packs, p)
+			r.packSet[idxPath] = true
+		}
+	}
+	return nil
+}
+
+func (r *Repository) getPacks() []*packFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.packs
+}
+
+// Get returns the object with its type and contents.
+// It's a drop-in replacement for ObjectCatter.Get.
+func (r *Repository) Get(sha1 string) (*Object, error) {
+	h, err := r.resolve(sha1)
+	if err != nil {
+		return nil, err
+	}
+	return r.readObject(h)
+}
+
+func (r *Repository) readObject(h hash) (*Object, error) {
+	obj, err := r.findObject(h)
+	if err == errNotFound {
+		// The repository could be repacked or fetched into.
+		if err := r.loadPacks(); err != nil {
+			return nil, err
+		}
+		obj, err = r.findObject(h)
+	}
+	if err == errNotFound {
+		return nil, fmt.Errorf("object %s not found", h)
+	}
+	return obj, err
+}
+
+func (r *Repository) findObject(h hash) (*Object, error) {
+	for _, p := range r.getPacks() {
+		if off, ok := p.find(h); ok {
+			return p.read(r, off)
+		}
+	}
+
+	s := h.String()
+	for _, dir := range r.objectDirs {
+		obj, err := readLooseObject(filepath.Join(dir, s[:2], s[2:]))
+		if os.IsNotExist(err) {
+			continue
+		}
+		return obj, err
+	}
+
+	return nil, errNotFound
+}
+
+// readLooseObject reads zlib-compressed "<type> SP <size> NUL <contents>" file.
+func readLooseObject(filename string) (*Object, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return nil, fmt.Errorf("%s: bad object header", filename)
+	}
+	hdr := strings.Fields(string(data[:nul]))
+	if len(hdr) != 2 {
+		return nil, fmt.Errorf("%s: bad object header", filename)
+	}
+	size, err := strconv.Atoi(hdr[1])
+	if err != nil || size != len(data)-nul-1 {
+		return nil, fmt.Errorf("%s: bad object size", filename)
+	}
+
+	return &Object{Type: hdr[0], Contents: data[nul+1:]}, nil
+}
+
+// findPrefix returns the names of objects that start with the hex prefix.
+func (r *Repository) findPrefix(prefix string) map[hash]struct{} {
+	res := make(map[hash]struct{})
+	for _, p := range r.getPacks() {
+		p.findPrefix(prefix, res)
+	}
+	for _, dir := range r.objectDirs {
+		files, err := ioutil.ReadDir(filepath.Join(dir, prefix[:2]))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			name := prefix[:2] + f.Name()
+			if h, ok := parseHash(name); ok && strings.HasPrefix(name, prefix) {
+				res[h] = struct{}{}
+			}
+		}
+	}
+	return res
+}
+
+// readRef returns the object name of the ref, following the symbolic refs.
+func (r *Repository) readRef(name string, depth int) (hash, error) {
+	if depth > 5 {
+		return hash{}, fmt.Errorf("too deep symbolic ref %s", name)
+	}
+
+	dir := r.commonDir
+	if !strings.HasPrefix(name, "refs/") {
+		// HEAD, ORIG_HEAD, FETCH_HEAD and other pseudo refs.
+		dir = r.gitDir
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err == nil {
+		s := strings.TrimSpace(string(data))
+		if strings.HasPrefix(s, "ref:") {
+			return r.readRef(strings.TrimSpace(strings.TrimPrefix(s, "ref:")), depth+1)
+		}
+		// FETCH_HEAD has several columns.
+		if len(s) > CommitHashLen {
+			s = s[:CommitHashLen]
+		}
+		if h, ok := parseHash(s); ok {
+			return h, nil
+		}
+		return hash{}, fmt.Errorf("bad ref %s", name)
+	}
+
+	packed, err := ioutil.ReadFile(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return hash{}, errNotFound
+	}
+	for _, ln := range strings.Split(string(packed), "\n") {
+		if len(ln) < CommitHashLen+2 || ln[0] == '#' || ln[0] == '^' {
+			continue
+		}
+		if ln[CommitHashLen+1:] != name {
+			continue
+		}
+		if h, ok := parseHash(ln[:CommitHashLen]); ok {
+			return h, nil
+		}
+	}
+	return hash{}, errNotFound
+}
+
+// resolveName resolves a revision name without the ~ and ^ suffixes.
+// See gitrevisions(7).
+func (r *Repository) resolveName(name string) (hash, error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+	if h, ok := parseHash(name); ok {
+		return h, nil
+	}
+
+	for _, ref := range []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	} {
+		h, err := r.readRef(ref, 0)
+		if err == nil {
+			return h, nil
+		}
+		if err != errNotFound {
+			return hash{}, err
+		}
+	}
+
+	if len(name) >= 4 && len(name) < CommitHashLen {
+		if _, err := hex.DecodeString(name[:len(name)&^1]); err == nil {
+			found := r.findPrefix(strings.ToLower(name))
+			if len(found) == 0 {
+				// The repository could be repacked.
+				if err := r.loadPacks(); err != nil {
+					return hash{}, err
+				}
+				found = r.findPrefix(strings.ToLower(name))
+			}
+			if len(found) > 1 {
+				return hash{}, fmt.Errorf("ambiguous revision %s", name)
+			}
+			for h := range found {
+				return h, nil
+			}
+		}
+	}
+
+	return hash{}, fmt.Errorf("unknown revision %s", name)
+}
+
+// resolve returns the object name of the revision.
+// Revision can be a ref or object name with the ~<n>, ^<n> and ^{} suffixes.
+func (r *Repository) resolve(rev string) (hash, error) {
+	i := strings.IndexAny(rev, "~^")
+	if i < 0 {
+		return r.resolveName(rev)
+	}
+
+	h, err := r.resolveName(rev[:i])
+	if err != nil {
+		return hash{}, err
+	}
+
+	for rest := rev[i:]; rest != ""; {
+		op := rest[0]
+		rest = rest[1:]
+
+		if op == '^' && strings.HasPrefix(rest, "{") {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return hash{}, fmt.Errorf("bad revision %s", rev)
+			}
+			switch rest[1:end] {
+			case "", "commit":
+				if h, err = r.peelToCommit(h); err != nil {
+					return hash{}, err
+				}
+			default:
+				return hash{}, fmt.Errorf("unsupported revision %s", rev)
+			}
+			rest = rest[end+1:]
+			continue
+		}
+
+		numLen := 0
+		for numLen < len(rest) && rest[numLen] >= '0' && rest[numLen] <= '9' {
+			numLen++
+		}
+		n := 1
+		if numLen != 0 {
+			n, _ = strconv.Atoi(rest[:numLen])
+			rest = rest[numLen:]
+		}
+
+		if op == '~' {
+			for ; n > 0; n-- {
+				if h, err = r.nthParent(h, 1); err != nil {
+					return hash{}, err
+				}
+			}
+		} else if n != 0 {
+			if h, err = r.nthParent(h, n); err != nil {
+				return hash{}, err
+			}
+		}
+	}
+
+	return h, nil
+}
+
+func (r *Repository) nthParent(h hash, n int) (hash, error) {
+	h, err := r.peelToCommit(h)
+	if err != nil {
+		return hash{}, err
+	}
+	c, err := r.commit(h)
+	if err != nil {
+		return hash{}, err
+	}
+	if n > len(c.parents) {
+		return hash{}, fmt.Errorf("commit %s has no parent %d", h, n)
+	}
+	return c.parents[n-1], nil
+}
+
+// peelToCommit follows the annotated tags until the commit is reached.
+func (r *Repository) peelToCommit(h hash) (hash, error) {
+	for i := 0; i < 10; i++ {
+		obj, err := r.readObject(h)
+		if err != nil {
+			return hash{}, err
+		}
+		switch obj.Type {
+		case "commit":
+			return h, nil
+		case "tag":
+			// object <hash>
+			ln := obj.Contents
+			if i := bytes.IndexByte(ln, '\n'); i >= 0 {
+				ln = ln[:i]
+			}
+			target, ok := parseHash(string(bytes.TrimPrefix(ln, []byte("object "))))
+			if !ok {
+				return hash{}, fmt.Errorf("bad tag %s", h)
+			}
+			h = target
+		default:
+			return hash{}, fmt.Errorf("%s is a %s, not a commit", h, obj.Type)
+		}
+	}
+	return hash{}, fmt.Errorf("too deep tags chain for %s", h)
+}
+
+// resolveCommit returns the commit the revision points to.
+func (r *Repository) resolveCommit(rev string) (hash, error) {
+	h, err := r.resolve(rev)
+	if err != nil {
+		return hash{}, err
+	}
+	return r.peelToCommit(h)
+}
+
+// commitInfo is a parsed commit object.
+type commitInfo struct {
+	hash    hash
+	tree    hash
+	parents []hash
+	author  string // Author name
+	email   string // Author email
+	date    int64  // Author timestamp
+	time    int64  // Committer timestamp
+	subject string // Like %s format of the git log
+}
+
+func (r *Repository) commit(h hash) (*commitInfo, error) {
+	if c, ok := r.commits.Load(h); ok {
+		return c.(*commitInfo), nil
+	}
+
+	obj, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type != "commit" {
+		return nil, fmt.Errorf("%s is a %s, not a commit", h, obj.Type)
+	}
+
+	c := &commitInfo{hash: h}
+	data := obj.Contents
+	for len(data) != 0 {
+		var ln []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			ln, data = data[:i], data[i+1:]
+		} else {
+			ln, data = data, nil
+		}
+		if len(ln) == 0 {
+			break // Message follows
+		}
+
+		switch {
+		case bytes.HasPrefix(ln, []byte("tree ")):
+			c.tree, _ = parseHash(string(ln[len("tree "):]))
+		case bytes.HasPrefix(ln, []byte("parent ")):
+			p, ok := parseHash(string(ln[len("parent "):]))
+			if !ok {
+				return nil, fmt.Errorf("bad commit %s parent", h)
+			}
+			c.parents = append(c.parents, p)
+		case bytes.HasPrefix(ln, []byte("author ")):
+			// author Name <email> 1234567890 +0300
+			ident := string(ln[len("author "):])
+			if i := strings.LastIndex(ident, "> "); i >= 0 {
+				fields := strings.Fields(ident[i+2:])
+				if len(fields) != 0 {
+					c.date, _ = strconv.ParseInt(fields[0], 10, 64)
+				}
+				ident = ident[:i]
+			}
+			if i := strings.Index(ident, " <"); i >= 0 {
+				c.email = strings.TrimSuffix(ident[i+2:], ">")
+				ident = ident[:i]
+			}
+			c.author = ident
+		case bytes.HasPrefix(ln, []byte("committer ")):
+			// committer Name <email> 1234567890 +0300
+			fields := bytes.Fields(ln)
+			if len(fields) >= 2 {
+				c.time, _ = strconv.ParseInt(string(fields[len(fields)-2]), 10, 64)
+			}
+		}
+	}
+	c.subject = commitSubject(data)
+	if r.shallow[h] {
+		c.parents = nil
+	}
+
+	r.commits.Store(h, c)
+	return c, nil
+}
+
+// commitSubject returns the first paragraph of the message joined into one line.
+func commitSubject(msg []byte) string {
+	var parts []string
+	for _, ln := range strings.Split(string(msg), "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" {
+			if len(parts) != 0 {
+				break
+			}
+			continue
+		}
+		parts = append(parts, ln)
+	}
+	return strings.Join(parts, " ")
+}
+
+// treeEntry is a parsed tree object entry.
+type treeEntry struct {
+	mode uint32
+	name string
+	hash hash
+}
+
+const (
+	modeTree    = 0040000
+	modeSymlink = 0120000
+	modeGitlink = 0160000
+)
+
+func (e treeEntry) isTree() bool    { return e.mode == modeTree }
+func (e treeEntry) isGitlink() bool { return e.mode == modeGitlink }
+
+// tree returns the tree entries, in the tree order.
+func (r *Repository) tree(h hash) ([]treeEntry, error) {
+	if entries, ok := r.trees.Load(h); ok {
+		return entries.([]treeEntry), nil
+	}
+
+	obj, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type != "tree" {
+		return nil, fmt.Errorf("%s is a %s, not a tree", h, obj.Type)
+	}
+
+	var entries []treeEntry
+	data := obj.Contents
+	for len(data) != 0 {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			return nil, fmt.Errorf("bad tree %s", h)
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad tree %s: %v", h, err)
+		}
+		data = data[sp+1:]
+
+		nul := bytes.IndexByte(data, 0)
+		if nul < 0 || len(data) < nul+1+hashLen {
+			return nil, fmt.Errorf("bad tree %s", h)
+		}
+		e := treeEntry{mode: uint32(mode), name: string(data[:nul])}
+		copy(e.hash[:], data[nul+1:])
+		data = data[nul+1+hashLen:]
+
+		entries = append(entries, e)
+	}
+
+	r.trees.Store(h, entries)
+	return entries, nil
+}
+
+// fileAt returns the blob entry of the slash-separated path in the tree.
+func (r *Repository) fileAt(tree hash, path string) (treeEntry, bool, error) {
+	parts := strings.Split(path, "/")
+	for i, name := range parts {
+		entries, err := r.tree(tree)
+		if err != nil {
+			return treeEntry{}, false, err
+		}
+
+		var found *treeEntry
+		for j := range entries {
+			if entries[j].name == name {
+				found = &entries[j]
+				break
+			}
+		}
+		if found == nil {
+			return treeEntry{}, false, nil
+		}
+
+		last := i == len(parts)-1
+		switch {
+		case last && !found.isTree() && !found.isGitlink():
+			return *found, true, nil
+		case !last && found.isTree():
+			tree = found.hash
+		default:
+			return treeEntry{}, false, nil
+		}
+	}
+	return treeEntry{}, false, nil
+}
@@ -0,0 +1,440 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testRepo struct {
+	t    *testing.T
+	dir  string
+	time int
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "noverify-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRepo{t: t, dir: dir, time: 1500000000}
+	r.git("init", "-q")
+	return r
+}
+
+func (r *testRepo) gitDir() string { return filepath.Join(r.dir, ".git") }
+
+func (r *testRepo) cleanup() { os.RemoveAll(r.dir) }
+
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	date := fmt.Sprintf("%d +0000", r.time)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Author", "GIT_AUTHOR_EMAIL=author@example.com", "GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=Committer", "GIT_COMMITTER_EMAIL=committer@example.com", "GIT_COMMITTER_DATE="+date,
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+r.dir,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (r *testRepo) write(filename, contents string) {
+	r.t.Helper()
+	path := filepath.Join(r.dir, filename)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) commit(msg string) string {
+	r.t.Helper()
+	r.time += 60
+	r.git("add", "-A")
+	r.git("commit", "-q", "--allow-empty", "-m", msg)
+	return r.git("rev-parse", "HEAD")
+}
+
+func numberedLines(from, to int, prefix string) string {
+	var sb strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&sb, "%s line %d\n", prefix, i)
+	}
+	return sb.String()
+}
+
+// fillTestRepo creates a history with a branch, a merge and a rename.
+func fillTestRepo(r *testRepo) {
+	r.write("a.php", "<?php\n"+numberedLines(1, 20, "a"))
+	r.write("dir/b.php", "<?php\n"+numberedLines(1, 10, "b"))
+	r.write("bin.dat", "\x00\x01\x02")
+	r.write("empty.php", "")
+	r.commit("Initial commit")
+
+	r.write("a.php", "<?php\n"+numberedLines(1, 5, "a")+"changed\n"+numberedLines(7, 20, "a")+"appended\n")
+	r.write("c.php", "<?php\necho 'c';\n")
+	r.commit("Second commit\n\nWith a body.")
+	r.git("branch", "feature")
+
+	r.write("dir/b.php", "<?php\n"+numberedLines(1, 3, "b")+numberedLines(6, 10, "b"))
+	r.git("mv", "c.php", "dir/c.php")
+	r.commit("Master commit")
+
+	r.git("checkout", "-q", "feature")
+	r.write("a.php", "<?php\nprepended\n"+numberedLines(1, 5, "a")+"changed\n"+numberedLines(7, 20, "a")+"appended\n")
+	r.write("dir/new.php", "<?php\n"+numberedLines(1, 3, "new"))
+	r.git("rm", "-q", "empty.php")
+	r.commit("Feature commit")
+
+	r.git("checkout", "-q", "master")
+	r.git("merge", "-q", "--no-ff", "-m", "Merge feature", "feature")
+
+	r.write("a.php", "<?php\nprepended\n"+numberedLines(1, 5, "a")+"changed again\n"+numberedLines(7, 18, "a")+"appended")
+	r.write("dir/moved.php", "<?php\n"+numberedLines(1, 3, "b")+numberedLines(6, 9, "b")+"b line 10 modified\n")
+	r.git("rm", "-q", "dir/b.php")
+	r.write("bin.dat", "\x00\x01\x02\x03")
+	r.commit("Last commit")
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].NewName != changes[j].NewName {
+			return changes[i].NewName < changes[j].NewName
+		}
+		return changes[i].OldName < changes[j].OldName
+	})
+}
+
+func testNativeGit(t *testing.T, r *testRepo) {
+	gitDir := r.gitDir()
+
+	// Each subtest opens the repository again, so the packs are rescanned.
+	repositories.Lock()
+	repositories.m = make(map[string]*Repository)
+	repositories.Unlock()
+
+	refspecs := [][]string{
+		{"HEAD~1..HEAD"},
+		{"HEAD~3..HEAD"},
+		{"master~1..feature"},
+		{"feature..master"},
+		{"HEAD~1^2..HEAD"},
+		{"HEAD"},
+	}
+
+	for _, refspec := range refspecs {
+		t.Run("log "+refspec[0], func(t *testing.T) {
+			want, err := execLog(gitDir, refspec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := nativeLog(gitDir, refspec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(have, want); diff != "" {
+				t.Errorf("log mismatch (-native +exec):\n%s", diff)
+			}
+		})
+
+		if refspec[0] == "HEAD" {
+			continue
+		}
+
+		t.Run("diff "+refspec[0], func(t *testing.T) {
+			want, err := execDiff(gitDir, "", refspec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := nativeDiff(gitDir, refspec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sortChanges(want)
+			sortChanges(have)
+			if diff := cmp.Diff(have, want); diff != "" {
+				t.Errorf("diff mismatch (-native +exec):\n%s", diff)
+			}
+		})
+
+		for _, filename := range []string{"a.php", "dir/moved.php", "dir/new.php"} {
+			t.Run("blame "+refspec[0]+" "+filename, func(t *testing.T) {
+				want, err := execBlame(gitDir, refspec, filename)
+				if err != nil {
+					t.Skipf("no %s in %s", filename, refspec)
+				}
+				have, err := nativeBlame(gitDir, refspec, filename, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(have, want); diff != "" {
+					t.Errorf("blame mismatch (-native +exec):\n%s", diff)
+				}
+			})
+		}
+	}
+
+	for _, pair := range [][2]string{{"master", "feature"}, {"HEAD~2", "HEAD~1^2"}, {"HEAD", "HEAD"}} {
+		t.Run("merge-base "+pair[0]+" "+pair[1], func(t *testing.T) {
+			want, err := execMergeBase(gitDir, pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := nativeMergeBase(gitDir, pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != want {
+				t.Errorf("merge base mismatch: native %s, exec %s", have, want)
+			}
+		})
+	}
+}
+
+func TestNativeGit(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.cleanup()
+	fillTestRepo(r)
+
+	t.Run("loose", func(t *testing.T) {
+		testNativeGit(t, r)
+	})
+
+	// Packed objects are stored as deltas.
+	r.git("repack", "-q", "-a", "-d", "-f", "--depth=10")
+	r.git("pack-refs", "--all")
+
+	t.Run("packed", func(t *testing.T) {
+		testNativeGit(t, r)
+	})
+}
+
+func TestBlameRanges(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.cleanup()
+	fillTestRepo(r)
+
+	ranges := []LineRange{{From: 2, To: 3}, {From: 8, To: 8}}
+	have, err := BlameRanges(r.gitDir(), []string{"HEAD~3..HEAD"}, "a.php", ranges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := r.git("rev-parse", "HEAD")
+	feature := r.git("rev-parse", "feature")
+	want := BlameResult{Lines: map[int]string{2: feature, 8: head}}
+	if diff := cmp.Diff(have, want); diff != "" {
+		t.Errorf("blame mismatch (-have +want):\n%s", diff)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.cleanup()
+	fillTestRepo(r)
+	r.git("tag", "-a", "-m", "Tag", "v1", "HEAD~1")
+
+	repo, err := OpenRepository(r.gitDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := r.git("rev-parse", "HEAD")
+	for _, rev := range []string{"HEAD", "master", "refs/heads/master", "feature~1", "HEAD~1^2", "HEAD~1^1", "v1^{}", "v1~1", head[:10], "HEAD^0"} {
+		want := r.git("rev-parse", rev+"^{commit}")
+		have, err := repo.resolveCommit(rev)
+		if err != nil {
+			t.Errorf("%s: %v", rev, err)
+			continue
+		}
+		if have.String() != want {
+			t.Errorf("%s: resolved to %s, want %s", rev, have, want)
+		}
+	}
+
+	if _, err := repo.resolveCommit("unknown"); err == nil {
+		t.Errorf("unknown revision is resolved")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     []diffBlock
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", nil},
+		{"", "a\n", []diffBlock{{newLen: 1}}},
+		{"a\nb\nc\n", "a\nx\nc\n", []diffBlock{{oldStart: 1, oldLen: 1, newStart: 1, newLen: 1}}},
+		{"a\nb\nc\n", "a\nc\n", []diffBlock{{oldStart: 1, oldLen: 1, newStart: 1}}},
+		{"a\nb", "a\nb\n", []diffBlock{{oldStart: 1, oldLen: 1, newStart: 1, newLen: 1}}},
+		// Ambiguous insertions are placed where git places them.
+		{"a\n}\nb\n", "a\n}\nx\n}\nb\n", []diffBlock{{oldStart: 2, newStart: 2, newLen: 2}}},
+		{
+			"1\n2\n3\n4\n5\n6\n",
+			"0\n1\n3\n4\nx\n6\n7\n",
+			[]diffBlock{
+				{oldStart: 0, newStart: 0, newLen: 1},
+				{oldStart: 1, oldLen: 1, newStart: 2},
+				{oldStart: 4, oldLen: 1, newStart: 4, newLen: 1},
+				{oldStart: 6, newStart: 6, newLen: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		have := diffLines([]byte(test.old), []byte(test.new))
+		if diff := cmp.Diff(have, test.want, cmp.AllowUnexported(diffBlock{})); diff != "" {
+			t.Errorf("diffLines(%q, %q) mismatch (-have +want):\n%s", test.old, test.new, diff)
+		}
+	}
+}
+
+func TestDiffStaged(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.cleanup()
+
+	checkHasCommits := func(want bool) {
+		if have, err := execHasCommits(r.gitDir()); err != nil || have != want {
+			t.Errorf("execHasCommits: have %v (%v), want %v", have, err, want)
+		}
+		if have, err := nativeHasCommits(r.gitDir()); err != nil || have != want {
+			t.Errorf("nativeHasCommits: have %v (%v), want %v", have, err, want)
+		}
+	}
+
+	check := func(name string) {
+		t.Run(name, func(t *testing.T) {
+			want, err := execDiffStaged(r.gitDir(), "HEAD")
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := nativeDiffStaged(r.gitDir(), "HEAD")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sortChanges(want)
+			sortChanges(have)
+			if diff := cmp.Diff(have, want); diff != "" {
+				t.Errorf("staged diff mismatch (-native +exec):\n%s", diff)
+			}
+		})
+	}
+
+	r.write("a.php", "<?php\n"+numberedLines(1, 20, "a"))
+	r.git("add", "a.php")
+	check("unborn")
+	checkHasCommits(false)
+
+	fillTestRepo(r)
+	check("clean")
+	checkHasCommits(true)
+
+	// Only the first change is staged, the work tree is not compared.
+	r.write("dir/new.php", "<?php\nstaged\n"+numberedLines(1, 3, "new"))
+	r.git("add", "dir/new.php")
+	r.write("dir/new.php", "<?php\nstaged\n"+numberedLines(1, 2, "new")+"not staged\n")
+	r.write("dir/staged.php", "<?php\n"+numberedLines(1, 5, "s"))
+	r.git("add", "dir/staged.php")
+	r.write("untracked.php", "<?php\n")
+	r.git("mv", "dir/moved.php", "moved.php")
+	r.git("rm", "-q", "--cached", "dir/c.php")
+	check("staged")
+
+	have, err := DiffStaged(r.gitDir(), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortChanges(have)
+	var names []string
+	for _, c := range have {
+		names = append(names, c.OldName+" => "+c.NewName)
+	}
+	want := []string{"dir/c.php => /dev/null", "dir/new.php => dir/new.php", "/dev/null => dir/staged.php"}
+	if diff := cmp.Diff(names, want); diff != "" {
+		t.Errorf("staged files mismatch (-have +want):\n%s", diff)
+	}
+	if len(have) > 1 && !cmp.Equal(have[1].LineRanges, []LineRange{{From: 2, To: 2}}) {
+		t.Errorf("dir/new.php line ranges: %v", have[1].LineRanges)
+	}
+}
+
+func TestBlameAuthors(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.cleanup()
+	fillTestRepo(r)
+
+	for _, filename := range []string{"a.php", "dir/moved.php", "dir/new.php"} {
+		want, err := execBlameAuthors(r.gitDir(), "", "HEAD", filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := nativeBlameAuthors(r.gitDir(), "HEAD", filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(have, want); diff != "" {
+			t.Errorf("%s: blame mismatch (-native +exec):\n%s", filename, diff)
+		}
+	}
+
+	// The first line is from the root commit, the last one is not committed.
+	r.write("dir/new.php", "<?php\n"+numberedLines(1, 3, "new")+"uncommitted\n")
+	have, err := BlameAuthors(r.gitDir(), r.dir, "", "dir/new.php", []LineRange{{From: 1, To: 1}, {From: 5, To: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feature := r.git("rev-parse", "feature")
+	want := map[int]LineAuthor{
+		1: {Commit: feature, Author: "Author", Email: "author@example.com", Date: time.Unix(1500000240, 0).UTC()},
+		5: {Commit: Zero, Author: "Not Committed Yet", Email: "not.committed.yet", Date: have[5].Date},
+	}
+	if diff := cmp.Diff(have, want); diff != "" {
+		t.Errorf("work tree blame mismatch (-have +want):\n%s", diff)
+	}
+}
+
+func TestRenames(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.cleanup()
+	fillTestRepo(r)
+
+	for _, pair := range [][2]string{{"HEAD~3", "HEAD"}, {"HEAD~1", "HEAD"}, {"HEAD~1^2", "HEAD"}} {
+		want, err := execRenames(r.gitDir(), pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := nativeRenames(r.gitDir(), pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(have, want); diff != "" {
+			t.Errorf("%s..%s: renames mismatch (-native +exec):\n%s", pair[0], pair[1], diff)
+		}
+	}
+
+	have, err := Renames(r.gitDir(), "HEAD~3", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"c.php": "dir/c.php", "dir/b.php": "dir/moved.php"}
+	if diff := cmp.Diff(have, want); diff != "" {
+		t.Errorf("renames mismatch (-have +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,396 @@
+package git
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+// Commit walk flags.
+const (
+	flagUninteresting = 1 << iota
+	flagSeen
+	flagParent1
+	flagParent2
+	flagStale
+	flagResult
+)
+
+// walkQueue is a priority queue of commits ordered by the committer
+// date, newest first. Commits with the same date are popped in
+// the insertion order.
+type walkQueue struct {
+	items []*commitInfo
+	order []int
+	next  int
+}
+
+func (q *walkQueue) Len() int { return len(q.items) }
+
+func (q *walkQueue) Less(i, j int) bool {
+	if q.items[i].time != q.items[j].time {
+		return q.items[i].time > q.items[j].time
+	}
+	return q.order[i] < q.order[j]
+}
+
+func (q *walkQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.order[i], q.order[j] = q.order[j], q.order[i]
+}
+
+func (q *walkQueue) Push(x interface{}) {
+	q.items = append(q.items, x.(*commitInfo))
+	q.order = append(q.order, q.next)
+	q.next++
+}
+
+func (q *walkQueue) Pop() interface{} {
+	n := len(q.items) - 1
+	c := q.items[n]
+	q.items = q.items[:n]
+	q.order = q.order[:n]
+	return c
+}
+
+func (q *walkQueue) push(c *commitInfo) { heap.Push(q, c) }
+func (q *walkQueue) pop() *commitInfo   { return heap.Pop(q).(*commitInfo) }
+
+// revisionRange is a parsed "git rev-list" refspec.
+type revisionRange struct {
+	include []hash
+	exclude []hash
+}
+
+// parseRefspec parses the refspec like {"A..B"} or {"B", "^A"}.
+// The symmetric difference "A...B" is not supported.
+func (r *Repository) parseRefspec(refspec []string) (revisionRange, error) {
+	var rr revisionRange
+	add := func(rev string, exclude bool) error {
+		h, err := r.resolveCommit(rev)
+		if err != nil {
+			return err
+		}
+		if exclude {
+			rr.exclude = append(rr.exclude, h)
+		} else {
+			rr.include = append(rr.include, h)
+		}
+		return nil
+	}
+
+	for _, spec := range refspec {
+		switch {
+		case strings.Contains(spec, "..."):
+			return rr, fmt.Errorf("unsupported refspec %q", spec)
+		case strings.Contains(spec, ".."):
+			parts := strings.SplitN(spec, "..", 2)
+			if err := add(orHead(parts[0]), true); err != nil {
+				return rr, err
+			}
+			if err := add(orHead(parts[1]), false); err != nil {
+				return rr, err
+			}
+		case strings.HasPrefix(spec, "^"):
+			if err := add(spec[1:], true); err != nil {
+				return rr, err
+			}
+		case strings.HasPrefix(spec, "-"):
+			return rr, fmt.Errorf("unsupported option %q", spec)
+		default:
+			if err := add(spec, false); err != nil {
+				return rr, err
+			}
+		}
+	}
+	return rr, nil
+}
+
+// revList returns the commits that are reachable from the included
+// commits and are not reachable from the excluded ones, in the
+// "git log" order.
+func (r *Repository) revList(rr revisionRange) ([]*commitInfo, error) {
+	flags := make(map[hash]int)
+	var q walkQueue
+
+	push := func(h hash, f int) error {
+		old, seen := flags[h]
+		flags[h] = old | f | flagSeen
+		if seen {
+			return nil
+		}
+		c, err := r.commit(h)
+		if err != nil {
+			return err
+		}
+		q.push(c)
+		return nil
+	}
+	for _, h := range rr.exclude {
+		if err := push(h, flagUninteresting); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range rr.include {
+		if err := push(h, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// markUninteresting propagates the flag to the already seen
+	// ancestors, so they are not listed even if they were popped.
+	var markUninteresting func(h hash) error
+	markUninteresting = func(h hash) error {
+		for {
+			f, seen := flags[h]
+			if seen && f&flagUninteresting != 0 {
+				return nil
+			}
+			flags[h] = f | flagUninteresting | flagSeen
+			if !seen {
+				c, err := r.commit(h)
+				if err != nil {
+					return err
+				}
+				q.push(c)
+				return nil
+			}
+			c, err := r.commit(h)
+			if err != nil {
+				return err
+			}
+			if len(c.parents) == 0 {
+				return nil
+			}
+			for _, p := range c.parents[1:] {
+				if err := markUninteresting(p); err != nil {
+					return err
+				}
+			}
+			h = c.parents[0]
+		}
+	}
+
+	// Like the limit_list() in git: stop when only the uninteresting
+	// commits are left in the queue, with some slop for the clock skew.
+	const maxSlop = 5
+	slop := maxSlop
+	var list []*commitInfo
+	for q.Len() != 0 {
+		c := q.pop()
+		uninteresting := flags[c.hash]&flagUninteresting != 0
+		for _, p := range c.parents {
+			if uninteresting {
+				if err := markUninteresting(p); err != nil {
+					return nil, err
+				}
+			} else if err := push(p, 0); err != nil {
+				return nil, err
+			}
+		}
+		if !uninteresting {
+			list = append(list, c)
+			slop = maxSlop
+			continue
+		}
+		if everybodyUninteresting(&q, flags) {
+			slop--
+			if slop == 0 {
+				break
+			}
+		}
+	}
+
+	res := list[:0]
+	for _, c := range list {
+		if flags[c.hash]&flagUninteresting == 0 {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func everybodyUninteresting(q *walkQueue, flags map[hash]int) bool {
+	for _, c := range q.items {
+		if flags[c.hash]&flagUninteresting == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// nativeLog is the Log implementation that reads the objects directly.
+func nativeLog(gitDir string, refspec []string) ([]Commit, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := r.parseRefspec(refspec)
+	if err != nil {
+		return nil, err
+	}
+	if len(rr.include) == 0 {
+		return nil, fmt.Errorf("no commits to log in %q", refspec)
+	}
+	list, err := r.revList(rr)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Commit
+	for _, c := range list {
+		res = append(res, Commit{Hash: c.hash.String(), Author: c.author, Message: c.subject})
+	}
+	return res, nil
+}
+
+// nativeMergeBase returns the best common ancestor of the commits,
+// the same as "git merge-base" prints.
+func nativeMergeBase(gitDir string, one, two string) (string, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return "", err
+	}
+	a, err := r.resolveCommit(one)
+	if err != nil {
+		return "", err
+	}
+	b, err := r.resolveCommit(two)
+	if err != nil {
+		return "", err
+	}
+
+	bases, err := r.mergeBases(a, b)
+	if err != nil {
+		return "", err
+	}
+	if len(bases) == 0 {
+		return "", fmt.Errorf("no merge base between %s and %s", one, two)
+	}
+	return bases[0].String(), nil
+}
+
+// mergeBases implements the paint_down_to_common() algorithm of git.
+func (r *Repository) mergeBases(a, b hash) ([]hash, error) {
+	flags := make(map[hash]int)
+	var q walkQueue
+
+	// Unlike revList, commits are queued again when their flags change.
+	push := func(h hash, f int) error {
+		flags[h] |= f
+		c, err := r.commit(h)
+		if err != nil {
+			return err
+		}
+		q.push(c)
+		return nil
+	}
+	if err := push(a, flagParent1); err != nil {
+		return nil, err
+	}
+	if err := push(b, flagParent2); err != nil {
+		return nil, err
+	}
+
+	var result []hash
+	for q.Len() != 0 && !allStale(&q, flags) {
+		c := q.pop()
+		f := flags[c.hash] & (flagParent1 | flagParent2 | flagStale)
+		if f == flagParent1|flagParent2 {
+			if flags[c.hash]&flagResult == 0 {
+				flags[c.hash] |= flagResult
+				result = append(result, c.hash)
+			}
+			f |= flagStale
+		}
+		for _, p := range c.parents {
+			if flags[p]&f == f {
+				continue
+			}
+			if err := push(p, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Bases that were reached from other bases later are their ancestors.
+	res := result[:0]
+	for _, h := range result {
+		if flags[h]&flagStale == 0 {
+			res = append(res, h)
+		}
+	}
+	return r.removeRedundant(res)
+}
+
+func allStale(q *walkQueue, flags map[hash]int) bool {
+	for _, c := range q.items {
+		if flags[c.hash]&flagStale == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// removeRedundant removes the bases that are ancestors of other bases.
+func (r *Repository) removeRedundant(bases []hash) ([]hash, error) {
+	if len(bases) < 2 {
+		return bases, nil
+	}
+
+	var res []hash
+	for i, h := range bases {
+		redundant := false
+		for j, other := range bases {
+			if i == j {
+				continue
+			}
+			ok, err := r.isAncestor(h, other)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			res = append(res, h)
+		}
+	}
+	return res, nil
+}
+
+// isAncestor reports whether a is reachable from b.
+func (r *Repository) isAncestor(a, b hash) (bool, error) {
+	target, err := r.commit(a)
+	if err != nil {
+		return false, err
+	}
+
+	seen := map[hash]bool{b: true}
+	stack := []hash{b}
+	for len(stack) != 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if h == a {
+			return true, nil
+		}
+		c, err := r.commit(h)
+		if err != nil {
+			return false, err
+		}
+		// Commits older than a can't have it as an ancestor,
+		// unless the clocks are skewed.
+		if c.time < target.time-86400 {
+			continue
+		}
+		for _, p := range c.parents {
+			if !seen[p] {
+				seen[p] = true
+				stack = append(stack, p)
+			}
+		}
+	}
+	return false, nil
+}
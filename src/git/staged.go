@@ -0,0 +1,234 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strconv"
+)
+
+// StagedFile is a file entry of the git index.
+type StagedFile struct {
+	Name string
+	Mode uint32
+	Hash string
+}
+
+// StagedFiles returns the files staged in the index obtained with git ls-files command,
+// sorted by name. The GIT_INDEX_FILE environment variable is respected, so the
+// temporary index of "git commit <paths>" is read in the pre-commit hook.
+func StagedFiles(gitDir string) ([]StagedFile, error) {
+	out, err := exec.Command("git", "--git-dir="+gitDir, "ls-files", "--stage", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %v", err)
+	}
+
+	var res []StagedFile
+	for _, ln := range bytes.Split(out, []byte{0}) {
+		if len(ln) == 0 {
+			continue
+		}
+
+		// <mode> SP <object> SP <stage> TAB <file>
+		tab := bytes.IndexByte(ln, '\t')
+		if tab < 0 {
+			return nil, fmt.Errorf("bad ls-files line: %q", ln)
+		}
+		fields := bytes.Fields(ln[:tab])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("bad ls-files line: %q", ln)
+		}
+		name := string(ln[tab+1:])
+		if string(fields[2]) != "0" {
+			return nil, fmt.Errorf("%s is not merged", name)
+		}
+		mode, err := strconv.ParseUint(string(fields[0]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad ls-files line: %q: %v", ln, err)
+		}
+		res = append(res, StagedFile{Name: name, Mode: uint32(mode), Hash: string(fields[1])})
+	}
+	return res, nil
+}
+
+// DiffStaged computes the changes staged in the index relative to the commit,
+// the same as "git diff -U0 --cached <commit>" does. If commit is "HEAD"
+// and there are no commits yet, all staged files are added.
+//
+// Only the index is listed with git, unless UseExec is set.
+func DiffStaged(gitDir, commit string) ([]Change, error) {
+	if !UseExec {
+		res, err := nativeDiffStaged(gitDir, commit)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not compute staged diff without git command, falling back to git diff: %v", err)
+	}
+
+	return execDiffStaged(gitDir, commit)
+}
+
+// HasCommits reports whether HEAD points to a commit.
+// It's false in a new repository before the first commit.
+func HasCommits(gitDir string) (bool, error) {
+	if !UseExec {
+		res, err := nativeHasCommits(gitDir)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not resolve HEAD without git command, falling back to git rev-parse: %v", err)
+	}
+
+	return execHasCommits(gitDir)
+}
+
+func execHasCommits(gitDir string) (bool, error) {
+	err := exec.Command("git", "--git-dir="+gitDir, "rev-parse", "--quiet", "--verify", "HEAD^{commit}").Run()
+	if err == nil {
+		return true, nil
+	}
+	// With --quiet, the exit code 1 means that HEAD is not valid.
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("git rev-parse: %v", err)
+}
+
+func nativeHasCommits(gitDir string) (bool, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return false, err
+	}
+	if r.isUnborn() {
+		return false, nil
+	}
+	if _, err := r.commitTree("HEAD"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func execDiffStaged(gitDir, commit string) ([]Change, error) {
+	refspec := []string{"--cached"}
+	// Without the commit, the changes are computed against HEAD
+	// or against the empty tree before the first commit.
+	if commit != "HEAD" {
+		refspec = append(refspec, commit)
+	}
+	return execDiff(gitDir, "", refspec)
+}
+
+func nativeDiffStaged(gitDir, commit string) ([]Change, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldFiles map[string]*treeEntry
+	tree, err := r.commitTree(commit)
+	switch {
+	case err == nil:
+		oldFiles = make(map[string]*treeEntry)
+		if err := r.listFiles(tree, "", oldFiles); err != nil {
+			return nil, err
+		}
+	case commit == "HEAD" && r.isUnborn():
+	default:
+		return nil, err
+	}
+
+	staged, err := StagedFiles(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	newFiles := make(map[string]*treeEntry, len(staged))
+	for _, f := range staged {
+		h, ok := parseHash(f.Hash)
+		if !ok {
+			return nil, fmt.Errorf("bad object name %q of %s", f.Hash, f.Name)
+		}
+		newFiles[f.Name] = &treeEntry{mode: f.Mode, name: f.Name, hash: h}
+	}
+
+	pairs := changedEntries(oldFiles, newFiles)
+	if pairs, err = r.detectRenames(pairs); err != nil {
+		return nil, err
+	}
+
+	var res []Change
+	for _, p := range pairs {
+		c, ok, err := r.diffFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// isUnborn reports whether HEAD points to a branch without commits.
+func (r *Repository) isUnborn() bool {
+	_, err := r.readRef("HEAD", 0)
+	return err == errNotFound
+}
+
+// listFiles adds the non-tree entries of the tree to the files by their full paths.
+func (r *Repository) listFiles(tree hash, prefix string, files map[string]*treeEntry) error {
+	entries, err := r.tree(tree)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		e := &entries[i]
+		if e.isTree() {
+			if err := r.listFiles(e.hash, prefix+e.name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[prefix+e.name] = e
+	}
+	return nil
+}
+
+// changedEntries returns the files that differ between the
+// path => entry maps, sorted by path.
+func changedEntries(oldFiles, newFiles map[string]*treeEntry) []filePair {
+	var paths []string
+	for path, old := range oldFiles {
+		if e := newFiles[path]; e == nil || e.hash != old.hash || e.mode != old.mode {
+			paths = append(paths, path)
+		}
+	}
+	for path := range newFiles {
+		if oldFiles[path] == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var res []filePair
+	for _, path := range paths {
+		oldFile, newFile := oldFiles[path], newFiles[path]
+		switch {
+		case oldFile != nil && newFile != nil && fileKind(oldFile.mode) != fileKind(newFile.mode):
+			// Type changes are shown as a deletion and an addition.
+			res = append(res, filePair{oldPath: path, old: oldFile})
+			res = append(res, filePair{newPath: path, new: newFile})
+		default:
+			p := filePair{old: oldFile, new: newFile}
+			if oldFile != nil {
+				p.oldPath = path
+			}
+			if newFile != nil {
+				p.newPath = path
+			}
+			res = append(res, p)
+		}
+	}
+	return res
+}
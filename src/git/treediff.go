@@ -0,0 +1,497 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+const (
+	// binaryCheckLen is the size of the file prefix that is checked for NUL bytes,
+	// the same as git uses.
+	binaryCheckLen = 8000
+
+	// renameLimit limits the number of the added and deleted files
+	// that are compared to detect the renames.
+	renameLimit = 100
+
+	// renameMinScore is the min similarity percent of the renamed files.
+	renameMinScore = 50
+)
+
+// filePair is a file that differs between the two trees.
+// One of the entries is empty for the added or deleted files.
+type filePair struct {
+	oldPath, newPath string
+	old, new         *treeEntry
+}
+
+// nativeDiff computes the same changes as "git diff -U0 <refspec>" does,
+// for the refspec that consists of two commits, e.g. {"A..B"} or {"A", "B"}.
+func nativeDiff(gitDir string, refspec []string) ([]Change, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var from, to string
+	switch {
+	case len(refspec) == 1 && strings.Contains(refspec[0], ".."):
+		if strings.Contains(refspec[0], "...") {
+			return nil, fmt.Errorf("unsupported refspec %q", refspec[0])
+		}
+		parts := strings.SplitN(refspec[0], "..", 2)
+		from, to = orHead(parts[0]), orHead(parts[1])
+	case len(refspec) == 2:
+		from, to = refspec[0], refspec[1]
+	default:
+		return nil, fmt.Errorf("unsupported refspec %q", refspec)
+	}
+
+	fromTree, err := r.commitTree(from)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := r.commitTree(to)
+	if err != nil {
+		return nil, err
+	}
+	return r.diffTrees(fromTree, toTree)
+}
+
+// Renames returns the files renamed between the commits, old name => new name,
+// including the renames without changes that Diff doesn't return.
+//
+// Renames are detected without running git, unless UseExec is set.
+func Renames(gitDir, from, to string) (map[string]string, error) {
+	if !UseExec {
+		res, err := nativeRenames(gitDir, from, to)
+		if err == nil {
+			return res, nil
+		}
+		log.Printf("Could not detect renames without git command, falling back to git diff: %v", err)
+	}
+
+	return execRenames(gitDir, from, to)
+}
+
+func nativeRenames(gitDir, from, to string) (map[string]string, error) {
+	r, err := openCached(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	fromTree, err := r.commitTree(from)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := r.commitTree(to)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := r.changedFiles(fromTree, toTree, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Exact renames are dropped by detectRenames, match them the same way first.
+	res := make(map[string]string)
+	deleted := make(map[hash][]string)
+	for _, p := range pairs {
+		if p.new == nil && p.old.mode != modeGitlink {
+			deleted[p.old.hash] = append(deleted[p.old.hash], p.oldPath)
+		}
+	}
+	for _, p := range pairs {
+		if p.old != nil || p.new.mode == modeGitlink {
+			continue
+		}
+		if list := deleted[p.new.hash]; len(list) != 0 {
+			deleted[p.new.hash] = list[1:]
+			res[list[0]] = p.newPath
+		}
+	}
+
+	if pairs, err = r.detectRenames(pairs); err != nil {
+		return nil, err
+	}
+	for _, p := range pairs {
+		if p.old != nil && p.new != nil && p.oldPath != p.newPath {
+			res[p.oldPath] = p.newPath
+		}
+	}
+	return res, nil
+}
+
+// execRenames parses "git diff --name-status -z" output, where the renames are
+// "R<score> NUL <old name> NUL <new name> NUL" and other changes have one name.
+func execRenames(gitDir, from, to string) (map[string]string, error) {
+	out, err := exec.Command("git", "--git-dir="+gitDir, "--no-pager", "diff", "--name-status", "-z", "-M", from, to, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff --name-status: %v", err)
+	}
+
+	res := make(map[string]string)
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(fields); {
+		status := fields[i]
+		switch {
+		case strings.HasPrefix(status, "R") && i+2 < len(fields):
+			res[fields[i+1]] = fields[i+2]
+			i += 3
+		case strings.HasPrefix(status, "C"):
+			i += 3
+		default:
+			i += 2
+		}
+	}
+	return res, nil
+}
+
+func orHead(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+	return rev
+}
+
+// commitTree returns the root tree of the commit the revision points to.
+func (r *Repository) commitTree(rev string) (hash, error) {
+	h, err := r.resolveCommit(rev)
+	if err != nil {
+		return hash{}, err
+	}
+	c, err := r.commit(h)
+	if err != nil {
+		return hash{}, err
+	}
+	return c.tree, nil
+}
+
+// diffTrees returns the changed lines of the text files that
+// differ between the trees, with the renames detected.
+func (r *Repository) diffTrees(from, to hash) ([]Change, error) {
+	pairs, err := r.changedFiles(from, to, "")
+	if err != nil {
+		return nil, err
+	}
+	if pairs, err = r.detectRenames(pairs); err != nil {
+		return nil, err
+	}
+
+	var res []Change
+	for _, p := range pairs {
+		c, ok, err := r.diffFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// changedFiles returns the files that differ between the trees
+// in the git tree order. Both tree hashes can be empty.
+func (r *Repository) changedFiles(from, to hash, prefix string) ([]filePair, error) {
+	if from == to {
+		return nil, nil
+	}
+
+	var oldEntries, newEntries []treeEntry
+	var err error
+	if from != (hash{}) {
+		if oldEntries, err = r.tree(from); err != nil {
+			return nil, err
+		}
+	}
+	if to != (hash{}) {
+		if newEntries, err = r.tree(to); err != nil {
+			return nil, err
+		}
+	}
+
+	type sides struct{ old, new *treeEntry }
+	byName := make(map[string]*sides)
+	var names []string
+	add := func(entries []treeEntry, isNew bool) {
+		for i := range entries {
+			e := &entries[i]
+			s, ok := byName[e.name]
+			if !ok {
+				s = &sides{}
+				byName[e.name] = s
+				names = append(names, e.name)
+			}
+			if isNew {
+				s.new = e
+			} else {
+				s.old = e
+			}
+		}
+	}
+	add(oldEntries, false)
+	add(newEntries, true)
+	sort.Strings(names)
+
+	var res []filePair
+	for _, name := range names {
+		s := byName[name]
+		if s.old != nil && s.new != nil && s.old.hash == s.new.hash && s.old.mode == s.new.mode {
+			continue
+		}
+		path := prefix + name
+
+		// Subtrees are compared recursively, a tree replaced
+		// by a file is a deletion of all its files and vice versa.
+		var oldTree, newTree hash
+		oldFile, newFile := s.old, s.new
+		if oldFile != nil && oldFile.isTree() {
+			oldTree, oldFile = oldFile.hash, nil
+		}
+		if newFile != nil && newFile.isTree() {
+			newTree, newFile = newFile.hash, nil
+		}
+		if oldTree != (hash{}) || newTree != (hash{}) {
+			sub, err := r.changedFiles(oldTree, newTree, path+"/")
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, sub...)
+		}
+
+		switch {
+		case oldFile == nil && newFile == nil:
+		case oldFile != nil && newFile != nil && fileKind(oldFile.mode) != fileKind(newFile.mode):
+			// Type changes are shown as a deletion and an addition.
+			res = append(res, filePair{oldPath: path, old: oldFile})
+			res = append(res, filePair{newPath: path, new: newFile})
+		default:
+			p := filePair{old: oldFile, new: newFile}
+			if oldFile != nil {
+				p.oldPath = path
+			}
+			if newFile != nil {
+				p.newPath = path
+			}
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func fileKind(mode uint32) uint32 {
+	return mode & 0170000
+}
+
+// detectRenames joins the deleted and added files pairs that are similar.
+// Exact renames are dropped as "git diff" shows no hunks for them.
+func (r *Repository) detectRenames(pairs []filePair) ([]filePair, error) {
+	var deleted, added []int
+	for i, p := range pairs {
+		switch {
+		case p.new == nil && p.old.mode != modeGitlink:
+			deleted = append(deleted, i)
+		case p.old == nil && p.new.mode != modeGitlink:
+			added = append(added, i)
+		}
+	}
+	if len(deleted) == 0 || len(added) == 0 {
+		return pairs, nil
+	}
+
+	drop := make(map[int]bool)
+
+	// Exact renames.
+	byHash := make(map[hash][]int)
+	for _, i := range deleted {
+		byHash[pairs[i].old.hash] = append(byHash[pairs[i].old.hash], i)
+	}
+	for _, j := range added {
+		h := pairs[j].new.hash
+		if list := byHash[h]; len(list) != 0 {
+			byHash[h] = list[1:]
+			drop[list[0]] = true
+			drop[j] = true
+		}
+	}
+
+	deleted = filterIndexes(deleted, drop)
+	added = filterIndexes(added, drop)
+	if len(deleted) != 0 && len(added) != 0 && len(deleted) <= renameLimit && len(added) <= renameLimit {
+		if err := r.detectInexactRenames(pairs, deleted, added, drop); err != nil {
+			return nil, err
+		}
+	}
+
+	res := pairs[:0]
+	for i, p := range pairs {
+		if !drop[i] {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// detectInexactRenames replaces the added files with the renames
+// from the most similar deleted files and drops these deleted files.
+func (r *Repository) detectInexactRenames(pairs []filePair, deleted, added []int, drop map[int]bool) error {
+	type candidate struct {
+		del, add int
+		score    int
+	}
+
+	sigs := make(map[int]lineSignature)
+	signature := func(i int, e *treeEntry) (lineSignature, error) {
+		if sig, ok := sigs[i]; ok {
+			return sig, nil
+		}
+		obj, err := r.readObject(e.hash)
+		if err != nil {
+			return lineSignature{}, err
+		}
+		sig := newLineSignature(obj.Contents)
+		sigs[i] = sig
+		return sig, nil
+	}
+
+	var candidates []candidate
+	for _, i := range deleted {
+		oldSig, err := signature(i, pairs[i].old)
+		if err != nil {
+			return err
+		}
+		for _, j := range added {
+			newSig, err := signature(j, pairs[j].new)
+			if err != nil {
+				return err
+			}
+			if score := similarity(oldSig, newSig); score >= renameMinScore {
+				candidates = append(candidates, candidate{del: i, add: j, score: score})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	used := make(map[int]bool)
+	for _, c := range candidates {
+		if used[c.del] || used[c.add] {
+			continue
+		}
+		used[c.del] = true
+		used[c.add] = true
+		drop[c.del] = true
+		pairs[c.add].old = pairs[c.del].old
+		pairs[c.add].oldPath = pairs[c.del].oldPath
+	}
+	return nil
+}
+
+func filterIndexes(list []int, drop map[int]bool) []int {
+	res := list[:0]
+	for _, i := range list {
+		if !drop[i] {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// lineSignature is a multiset of the file lines with their sizes.
+type lineSignature struct {
+	lines map[string]int // Line => count
+	size  int
+}
+
+func newLineSignature(data []byte) lineSignature {
+	sig := lineSignature{lines: make(map[string]int), size: len(data)}
+	for _, ln := range splitLines(data) {
+		sig.lines[string(ln)]++
+	}
+	return sig
+}
+
+// similarity returns the percent of the bytes that are shared between the files,
+// relative to the largest file size, like the git rename score.
+func similarity(a, b lineSignature) int {
+	if a.size == 0 || b.size == 0 {
+		return 0
+	}
+	max := a.size
+	if b.size > max {
+		max = b.size
+	}
+	common := 0
+	for ln, n := range a.lines {
+		if m := b.lines[ln]; m < n {
+			common += m * len(ln)
+		} else {
+			common += n * len(ln)
+		}
+	}
+	return common * 100 / max
+}
+
+// diffFiles returns the changed lines of the pair files.
+// Binary files and files without changed lines are skipped.
+func (r *Repository) diffFiles(p filePair) (Change, bool, error) {
+	oldData, err := r.entryContents(p.old)
+	if err != nil {
+		return Change{}, false, err
+	}
+	newData, err := r.entryContents(p.new)
+	if err != nil {
+		return Change{}, false, err
+	}
+	if isBinary(oldData) || isBinary(newData) {
+		return Change{}, false, nil
+	}
+
+	blocks := diffLines(oldData, newData)
+	if len(blocks) == 0 {
+		return Change{}, false, nil
+	}
+
+	c := Change{Type: Changed, OldName: p.oldPath, NewName: p.newPath, Valid: true}
+	switch {
+	case p.old == nil:
+		c.Type = Added
+		c.OldName = "/dev/null"
+	case p.new == nil:
+		c.Type = Deleted
+		c.NewName = "/dev/null"
+	}
+	for _, blk := range blocks {
+		oldRange, newRange := blk.lineRanges()
+		c.OldLineRanges = append(c.OldLineRanges, oldRange)
+		c.LineRanges = append(c.LineRanges, newRange)
+	}
+	return c, true, nil
+}
+
+// entryContents returns the file contents as git diff shows it.
+func (r *Repository) entryContents(e *treeEntry) ([]byte, error) {
+	switch {
+	case e == nil:
+		return nil, nil
+	case e.isGitlink():
+		return []byte("Subproject commit " + e.hash.String() + "\n"), nil
+	}
+	obj, err := r.readObject(e.hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Contents, nil
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > binaryCheckLen {
+		data = data[:binaryCheckLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
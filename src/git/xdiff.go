@@ -0,0 +1,720 @@
+package git
+
+// This file ports the Myers diff implementation of the git xdiff library
+// (xdiff/xprepare.c and xdiff/xdiffi.c), including its heuristics and
+// the indent heuristic that is enabled by default, so the changes are
+// found at the same places as "git diff" finds them.
+
+// xdiff constants, named after the XDL_* ones.
+const (
+	xdlMaxCostMin   = 256
+	xdlHeurMinCost  = 256
+	xdlSnakeCnt     = 20
+	xdlKHeur        = 4
+	xdlMaxEqLimit   = 1024
+	xdlSimScanWin   = 100
+	xdlKPDisRun     = 4
+	xdlLineMax      = int(^uint(0) >> 1)
+	discardNoMatch  = 0
+	discardMatch    = 1
+	discardMultiple = 2
+)
+
+// xdiff marks the changed lines of both files.
+func xdiff(a, b *diffFile) {
+	ra, rb := prepareDiff(a, b)
+
+	ndiags := len(ra.ids) + len(rb.ids) + 3
+	kvdf := make([]int, ndiags+1)
+	kvdb := make([]int, ndiags+1)
+	env := &xdiffEnv{
+		kvdf:    kvdf,
+		kvdb:    kvdb,
+		kvOff:   len(rb.ids) + 1,
+		mxcost:  bogoSqrt(ndiags),
+		a:       ra,
+		b:       rb,
+		changed: [2][]bool{a.changed, b.changed},
+	}
+	if env.mxcost < xdlMaxCostMin {
+		env.mxcost = xdlMaxCostMin
+	}
+	env.recsCmp(0, len(ra.ids), 0, len(rb.ids), false)
+
+	compactChanges(a, b)
+	compactChanges(b, a)
+}
+
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// reducedFile is a file without the lines that were marked as changed
+// by prepareDiff, the lines that are compared by the diff algorithm.
+type reducedFile struct {
+	ids   []int
+	index []int // Index of the line in the original file
+}
+
+// prepareDiff trims the common prefix and suffix and marks the lines
+// that have no matches in the other file as changed. Lines with too many
+// matches are marked as changed too if they are surrounded by the lines
+// without matches. See xdl_optimize_ctxs().
+func prepareDiff(a, b *diffFile) (ra, rb *reducedFile) {
+	count := func(ids []int) map[int]int {
+		m := make(map[int]int, len(ids))
+		for _, id := range ids {
+			m[id]++
+		}
+		return m
+	}
+	countA, countB := count(a.ids), count(b.ids)
+
+	start := 0
+	for start < len(a.ids) && start < len(b.ids) && a.ids[start] == b.ids[start] {
+		start++
+	}
+	trimmed := 0
+	for trimmed < len(a.ids)-start && trimmed < len(b.ids)-start &&
+		a.ids[len(a.ids)-1-trimmed] == b.ids[len(b.ids)-1-trimmed] {
+		trimmed++
+	}
+
+	reduce := func(f *diffFile, otherCount map[int]int) *reducedFile {
+		end := len(f.ids) - trimmed - 1
+
+		mlim := bogoSqrt(len(f.ids))
+		if mlim > xdlMaxEqLimit {
+			mlim = xdlMaxEqLimit
+		}
+		dis := make([]byte, len(f.ids))
+		for i := start; i <= end; i++ {
+			switch nm := otherCount[f.ids[i]]; {
+			case nm == 0:
+				dis[i] = discardNoMatch
+			case nm >= mlim:
+				dis[i] = discardMultiple
+			default:
+				dis[i] = discardMatch
+			}
+		}
+
+		r := &reducedFile{}
+		for i := start; i <= end; i++ {
+			if dis[i] == discardMatch || (dis[i] == discardMultiple && !cleanMultiMatch(dis, i, start, end)) {
+				r.ids = append(r.ids, f.ids[i])
+				r.index = append(r.index, i)
+			} else {
+				f.changed[i] = true
+			}
+		}
+		return r
+	}
+
+	return reduce(a, countB), reduce(b, countA)
+}
+
+// cleanMultiMatch reports whether the line i with multiple matches should be
+// discarded because it's in the middle of a run of lines without matches.
+func cleanMultiMatch(dis []byte, i, s, e int) bool {
+	if i-s > xdlSimScanWin {
+		s = i - xdlSimScanWin
+	}
+	if e-i > xdlSimScanWin {
+		e = i + xdlSimScanWin
+	}
+
+	noMatch0, multi0 := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == discardNoMatch {
+			noMatch0++
+		} else if dis[i-r] == discardMultiple {
+			multi0++
+		} else {
+			break
+		}
+	}
+	if noMatch0 == 0 {
+		return false
+	}
+
+	noMatch1, multi1 := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == discardNoMatch {
+			noMatch1++
+		} else if dis[i+r] == discardMultiple {
+			multi1++
+		} else {
+			break
+		}
+	}
+	if noMatch1 == 0 {
+		return false
+	}
+
+	noMatch := noMatch0 + noMatch1
+	multi := multi0 + multi1
+	return multi*xdlKPDisRun < multi+noMatch
+}
+
+type xdiffEnv struct {
+	kvdf, kvdb []int // Forward and backward diagonals, indexed by k+kvOff
+	kvOff      int
+	mxcost     int
+
+	a, b    *reducedFile
+	changed [2][]bool
+}
+
+// recsCmp marks the changes between the lines a[off1:lim1] and b[off2:lim2].
+// See xdl_recs_cmp().
+func (env *xdiffEnv) recsCmp(off1, lim1, off2, lim2 int, needMin bool) {
+	ha1, ha2 := env.a.ids, env.b.ids
+
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			env.changed[1][env.b.index[off2]] = true
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			env.changed[0][env.a.index[off1]] = true
+		}
+	default:
+		spl := env.split(off1, lim1, off2, lim2, needMin)
+		env.recsCmp(off1, spl.i1, off2, spl.i2, spl.minLo)
+		env.recsCmp(spl.i1, lim1, spl.i2, lim2, spl.minHi)
+	}
+}
+
+type diffSplit struct {
+	i1, i2       int
+	minLo, minHi bool
+}
+
+// split finds the middle snake of the shortest edit script, or a good
+// enough split point if the edit cost is too high. See xdl_split().
+func (env *xdiffEnv) split(off1, lim1, off2, lim2 int, needMin bool) diffSplit {
+	ha1, ha2 := env.a.ids, env.b.ids
+	kvdf := func(d int) *int { return &env.kvdf[d+env.kvOff] }
+	kvdb := func(d int) *int { return &env.kvdb[d+env.kvOff] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		// Extend the forward diagonals domain by one.
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kvdf(d - 1) >= *kvdf(d + 1) {
+				i1 = *kvdf(d - 1) + 1
+			} else {
+				i1 = *kvdf(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > xdlSnakeCnt {
+				gotSnake = true
+			}
+			*kvdf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kvdb(d) <= i1 {
+				return diffSplit{i1: i1, i2: i2, minLo: true, minHi: true}
+			}
+		}
+
+		// Extend the backward diagonals domain by one.
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = xdlLineMax
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = xdlLineMax
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kvdb(d - 1) < *kvdb(d + 1) {
+				i1 = *kvdb(d - 1)
+			} else {
+				i1 = *kvdb(d + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > xdlSnakeCnt {
+				gotSnake = true
+			}
+			*kvdb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kvdf(d) {
+				return diffSplit{i1: i1, i2: i2, minLo: true, minHi: true}
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// If the edit cost is high and there is a good snake,
+		// split at the furthest reaching "interesting" diagonal.
+		if gotSnake && ec > xdlHeurMinCost {
+			best := 0
+			var spl diffSplit
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+
+				if v > xdlKHeur*ec && v > best &&
+					off1+xdlSnakeCnt <= i1 && i1 < lim1 &&
+					off2+xdlSnakeCnt <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == xdlSnakeCnt {
+							best = v
+							spl = diffSplit{i1: i1, i2: i2}
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				spl.minLo = true
+				return spl
+			}
+
+			best = 0
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+
+				if v > xdlKHeur*ec && v > best &&
+					off1 < i1 && i1 <= lim1-xdlSnakeCnt &&
+					off2 < i2 && i2 <= lim2-xdlSnakeCnt {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == xdlSnakeCnt-1 {
+							best = v
+							spl = diffSplit{i1: i1, i2: i2}
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				spl.minHi = true
+				return spl
+			}
+		}
+
+		// Enough is enough, split at the furthest reaching path.
+		if ec >= env.mxcost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := *kvdf(d)
+				if i1 > lim1 {
+					i1 = lim1
+				}
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1 = lim2 + d
+					i2 = lim2
+				}
+				if fbest < i1+i2 {
+					fbest = i1 + i2
+					fbest1 = i1
+				}
+			}
+
+			bbest, bbest1 := xdlLineMax, xdlLineMax
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := *kvdb(d)
+				if i1 < off1 {
+					i1 = off1
+				}
+				i2 := i1 - d
+				if i2 < off2 {
+					i1 = off2 + d
+					i2 = off2
+				}
+				if i1+i2 < bbest {
+					bbest = i1 + i2
+					bbest1 = i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return diffSplit{i1: fbest1, i2: fbest - fbest1, minLo: true}
+			}
+			return diffSplit{i1: bbest1, i2: bbest - bbest1, minHi: true}
+		}
+	}
+}
+
+// diffFile is one side of the diff.
+type diffFile struct {
+	lines   [][]byte
+	ids     []int // Interned lines
+	changed []bool
+}
+
+// diffGroup is a range of the changed lines [start, end).
+// Groups in two files are kept in sync: the same number of
+// unchanged lines precedes them.
+type diffGroup struct {
+	start, end int
+}
+
+func (f *diffFile) firstGroup() diffGroup {
+	g := diffGroup{}
+	for g.end < len(f.ids) && f.changed[g.end] {
+		g.end++
+	}
+	return g
+}
+
+func (f *diffFile) nextGroup(g *diffGroup) bool {
+	if g.end == len(f.ids) {
+		return false
+	}
+	g.start = g.end + 1
+	g.end = g.start
+	for g.end < len(f.ids) && f.changed[g.end] {
+		g.end++
+	}
+	return true
+}
+
+func (f *diffFile) previousGroup(g *diffGroup) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	g.start = g.end
+	for g.start > 0 && f.changed[g.start-1] {
+		g.start--
+	}
+	return true
+}
+
+// slideDown moves the group down by one line, joining it
+// with the next group if they become adjacent.
+func (f *diffFile) slideDown(g *diffGroup) bool {
+	if g.end >= len(f.ids) || f.ids[g.start] != f.ids[g.end] {
+		return false
+	}
+	f.changed[g.start] = false
+	f.changed[g.end] = true
+	g.start++
+	g.end++
+	for g.end < len(f.ids) && f.changed[g.end] {
+		g.end++
+	}
+	return true
+}
+
+// slideUp moves the group up by one line, joining it
+// with the previous group if they become adjacent.
+func (f *diffFile) slideUp(g *diffGroup) bool {
+	if g.start == 0 || f.ids[g.start-1] != f.ids[g.end-1] {
+		return false
+	}
+	g.start--
+	g.end--
+	f.changed[g.start] = true
+	f.changed[g.end] = false
+	for g.start > 0 && f.changed[g.start-1] {
+		g.start--
+	}
+	return true
+}
+
+// compactChanges moves the groups of f changes to the best positions
+// among the equivalent ones, using o as the other side of the diff.
+func compactChanges(f, o *diffFile) {
+	g := f.firstGroup()
+	og := o.firstGroup()
+
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd, endMatchingOther int
+
+			// Slide the group up and down as far as possible,
+			// joining the adjacent groups, until it stops growing.
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+
+				for f.slideUp(&g) {
+					o.previousGroup(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+
+				for f.slideDown(&g) {
+					o.nextGroup(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// No shifting is possible.
+			case endMatchingOther != -1:
+				// Align the group with the changes in the other file.
+				for og.end == og.start {
+					f.slideUp(&g)
+					o.previousGroup(&og)
+				}
+			default:
+				best := bestIndentShift(f, g, groupSize, earliestEnd)
+				for g.end > best {
+					f.slideUp(&g)
+					o.previousGroup(&og)
+				}
+			}
+		}
+
+		if !f.nextGroup(&g) {
+			break
+		}
+		o.nextGroup(&og)
+	}
+}
+
+// Indent heuristic constants, see xdiff/xdiffi.c in the git sources.
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+	indentHeuristicMaxSliding       = 100
+)
+
+// bestIndentShift returns the group end that splits the
+// lines at the most natural places according to their indentation.
+func bestIndentShift(f *diffFile, g diffGroup, groupSize, earliestEnd int) int {
+	shift := earliestEnd
+	if g.end-groupSize-1 > shift {
+		shift = g.end - groupSize - 1
+	}
+	if g.end-indentHeuristicMaxSliding > shift {
+		shift = g.end - indentHeuristicMaxSliding
+	}
+
+	best := -1
+	var bestScore splitScore
+	for ; shift <= g.end; shift++ {
+		var score splitScore
+		score.add(f.measureSplit(shift))
+		score.add(f.measureSplit(shift - groupSize))
+		if best == -1 || score.cmp(bestScore) <= 0 {
+			bestScore = score
+			best = shift
+		}
+	}
+	return best
+}
+
+// lineIndent returns the line indentation width, or -1 for the blank lines.
+func lineIndent(ln []byte) int {
+	indent := 0
+	for _, c := range ln {
+		switch c {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		case '\n', '\r', '\f', '\v':
+		default:
+			return indent
+		}
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// splitMeasurement describes the lines around the split position.
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+func (f *diffFile) measureSplit(split int) splitMeasurement {
+	var m splitMeasurement
+	if split >= len(f.lines) {
+		m.endOfFile = true
+		m.indent = -1
+	} else {
+		m.indent = lineIndent(f.lines[split])
+	}
+
+	m.preIndent = -1
+	for i := split - 1; i >= 0; i-- {
+		m.preIndent = lineIndent(f.lines[i])
+		if m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for i := split + 1; i < len(f.lines); i++ {
+		m.postIndent = lineIndent(f.lines[i])
+		if m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+
+	return m
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1 || m.preIndent == -1 || indent == m.preIndent:
+		// No adjustments.
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+func (s splitScore) cmp(other splitScore) int {
+	cmpIndents := 0
+	switch {
+	case s.effectiveIndent > other.effectiveIndent:
+		cmpIndents = 1
+	case s.effectiveIndent < other.effectiveIndent:
+		cmpIndents = -1
+	}
+	return indentWeight*cmpIndents + (s.penalty - other.penalty)
+}
@@ -61,13 +61,13 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		switch nm := n.Function.(type) {
 		case *name.Name:
 			nameStr = meta.NameToString(nm)
-			fun, ok = meta.Info.GetFunction(d.st.Namespace + `\` + nameStr)
+			fun, ok = lint.MetaInfo().GetFunction(d.st.Namespace + `\` + nameStr)
 			if !ok && d.st.Namespace != "" {
-				fun, ok = meta.Info.GetFunction(`\` + nameStr)
+				fun, ok = lint.MetaInfo().GetFunction(`\` + nameStr)
 			}
 		case *name.FullyQualified:
 			nameStr = meta.FullyQualifiedToString(nm)
-			fun, ok = meta.Info.GetFunction(nameStr)
+			fun, ok = lint.MetaInfo().GetFunction(nameStr)
 		}
 
 		if ok {
@@ -102,7 +102,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		m, ok := solver.FindMethod(className, id.Value)
+		m, ok := solver.FindMethod(lint.MetaInfo(), className, id.Value)
 		if ok {
 			d.result = append(d.result, vscode.Location{
 				URI: "file://" + m.Info.Pos.Filename,
@@ -138,7 +138,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		types := safeExprType(foundScope, &d.st, n.Variable)
 
 		types.Iterate(func(t string) {
-			m, ok := solver.FindMethod(t, id.Value)
+			m, ok := solver.FindMethod(lint.MetaInfo(), t, id.Value)
 			if !ok {
 				lintdebug.Send("Could not find method for %s::%s", t, id.Value)
 				return
@@ -178,7 +178,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		types := safeExprType(foundScope, &d.st, n.Variable)
 
 		types.Iterate(func(t string) {
-			p, ok := solver.FindProperty(t, id.Value)
+			p, ok := solver.FindProperty(lint.MetaInfo(), t, id.Value)
 			if !ok {
 				lintdebug.Send("Could not find property for %s->%s", t, id.Value)
 				return
@@ -226,7 +226,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return false
 		}
 
-		if c, _, ok := solver.FindConstant(className, constName.Value); ok {
+		if c, _, ok := solver.FindConstant(lint.MetaInfo(), className, constName.Value); ok {
 			d.result = append(d.result, vscode.Location{
 				URI: "file://" + c.Pos.Filename,
 				Range: vscode.Range{
@@ -248,7 +248,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		c, ok := meta.Info.GetClassOrTrait(className)
+		c, ok := lint.MetaInfo().GetClassOrTrait(className)
 
 		if !ok {
 			return true
@@ -272,7 +272,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		c, ok := meta.Info.GetClassOrTrait(className)
+		c, ok := lint.MetaInfo().GetClassOrTrait(className)
 
 		if !ok {
 			return true
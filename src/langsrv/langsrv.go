@@ -53,6 +53,9 @@ func (methodCall) IMessage() {}
 var (
 	respMutex sync.Mutex
 	connWr    io.Writer
+
+	// lint is the linter instance used by the server, see Start.
+	lint *linter.Linter
 )
 
 // RegisterDebug starts listening for debug events
@@ -152,11 +155,11 @@ func handleInitialize(req *baseRequest) error {
 	lintdebug.Send("Root dir: %s", params.RootPath)
 
 	go func() {
-		linter.AnalysisFiles = []string{params.RootPath}
+		lint.Config().AnalysisFiles = []string{params.RootPath}
 
-		linter.ParseFilenames(linter.ReadFilenames(linter.AnalysisFiles, linter.ExcludeRegex))
+		lint.ParseFilenames(lint.ReadFilenames(lint.Config().AnalysisFiles, lint.Config().ExcludeRegex))
 
-		meta.SetIndexingComplete(true)
+		lint.MetaInfo().SetIndexingComplete(true)
 
 		// fully analyze all opened files
 		// other files are not analyzed fully at all
@@ -268,14 +271,14 @@ func handleTextDocumentSymbol(req *baseRequest) error {
 
 	// TODO: make it actually safe
 
-	meta.OnIndexingComplete(func() {
+	lint.MetaInfo().OnIndexingComplete(func() {
 		uri := params.TextDocument.URI
 
 		var result []vscode.SymbolInformation
 
 		if strings.HasPrefix(uri, "file://") {
 			filename := strings.TrimPrefix(uri, "file://")
-			res := meta.Info.GetMetaForFile(filename)
+			res := lint.MetaInfo().GetMetaForFile(filename)
 
 			for _, classInfo := range res.Classes.H {
 				result = append(result, vscode.SymbolInformation{
@@ -433,7 +436,7 @@ func resolveTypesSafe(curStaticClass string, m meta.TypesMap, visitedMap map[str
 		}
 	}()
 
-	res = solver.ResolveTypes(curStaticClass, m, visitedMap)
+	res = solver.ResolveTypes(lint.MetaInfo(), curStaticClass, m, visitedMap)
 	return
 }
 
@@ -537,13 +540,13 @@ func getHoverForFunctionCall(n *expr.FunctionCall, sc *meta.Scope, cs *meta.Clas
 	switch nm := n.Function.(type) {
 	case *name.Name:
 		nameStr = meta.NameToString(nm)
-		fun, ok = meta.Info.GetFunction(cs.Namespace + `\` + nameStr)
+		fun, ok = lint.MetaInfo().GetFunction(cs.Namespace + `\` + nameStr)
 		if !ok && cs.Namespace != "" {
-			fun, ok = meta.Info.GetFunction(`\` + nameStr)
+			fun, ok = lint.MetaInfo().GetFunction(`\` + nameStr)
 		}
 	case *name.FullyQualified:
 		nameStr = meta.FullyQualifiedToString(nm)
-		fun, ok = meta.Info.GetFunction(nameStr)
+		fun, ok = lint.MetaInfo().GetFunction(nameStr)
 	}
 
 	return linter.FlagsToString(fun.ExitFlags)
@@ -559,7 +562,7 @@ func getHoverForMethodCall(n *expr.MethodCall, sc *meta.Scope, cs *meta.ClassPar
 
 	var fun meta.FuncInfo
 	types.Find(func(t string) bool {
-		_, ok := solver.FindMethod(t, id.Value)
+		_, ok := solver.FindMethod(lint.MetaInfo(), t, id.Value)
 		return ok
 	})
 
@@ -577,7 +580,7 @@ func getHoverForStaticCall(n *expr.StaticCall, sc *meta.Scope, cs *meta.ClassPar
 		return ""
 	}
 
-	m, ok := solver.FindMethod(className, id.Value)
+	m, ok := solver.FindMethod(lint.MetaInfo(), className, id.Value)
 	if !ok {
 		return ""
 	}
@@ -679,7 +682,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 		go func() {
 			funcStr := `\` + chStr
 
-			funcs = meta.Info.FindFunctions(funcStr)
+			funcs = lint.MetaInfo().FindFunctions(funcStr)
 			sort.Strings(funcs)
 
 			wg.Done()
@@ -690,7 +693,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 			go func() {
 				funcStr := compl.st.Namespace + `\` + chStr
 
-				funcsNs = meta.Info.FindFunctions(funcStr)
+				funcsNs = lint.MetaInfo().FindFunctions(funcStr)
 				sort.Strings(funcsNs)
 
 				wg.Done()
@@ -701,7 +704,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 		go func() {
 			constStr := `\` + chStr
 
-			constants = meta.Info.FindConstants(constStr)
+			constants = lint.MetaInfo().FindConstants(constStr)
 			sort.Strings(constants)
 
 			wg.Done()
@@ -712,7 +715,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 			go func() {
 				constStr := compl.st.Namespace + `\` + chStr
 
-				constantsNs = meta.Info.FindConstants(constStr)
+				constantsNs = lint.MetaInfo().FindConstants(constStr)
 				sort.Strings(constantsNs)
 
 				wg.Done()
@@ -766,7 +769,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 
 func getMethods(className string) (res []string) {
 	for {
-		class, ok := meta.Info.GetClass(className)
+		class, ok := lint.MetaInfo().GetClass(className)
 		if !ok {
 			return res
 		}
@@ -784,7 +787,7 @@ func getMethods(className string) (res []string) {
 
 func getInstanceProperties(className string) (res []string) {
 	for {
-		class, ok := meta.Info.GetClass(className)
+		class, ok := lint.MetaInfo().GetClass(className)
 		if !ok {
 			return res
 		}
@@ -878,11 +881,13 @@ func handleChangeWatchedFiles(req *baseRequest) error {
 }
 
 // Start starts Microsoft LSP server with stdin/stdout I/O.
-func Start() {
+// The server uses l to analyze the files.
+func Start(l *linter.Linter) {
 	rd := bufio.NewReader(os.Stdin)
 	connWr = os.Stdout
+	lint = l
 
-	linter.InitStubs()
+	lint.InitStubs()
 
 	for {
 		ln, err := rd.ReadString('\n')
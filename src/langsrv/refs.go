@@ -35,21 +35,21 @@ func getFunction(st *meta.ClassParseState, n *expr.FunctionCall) (fun meta.FuncI
 		nameStr = meta.NameToString(nm)
 		tryStr := st.Namespace + `\` + nameStr
 
-		fun, ok = meta.Info.GetFunction(tryStr)
+		fun, ok = lint.MetaInfo().GetFunction(tryStr)
 		if ok {
 			return fun, tryStr, true
 		}
 
 		if !ok && st.Namespace != "" {
 			tryStr := `\` + nameStr
-			fun, ok = meta.Info.GetFunction(`\` + nameStr)
+			fun, ok = lint.MetaInfo().GetFunction(`\` + nameStr)
 			if ok {
 				return fun, tryStr, true
 			}
 		}
 	case *name.FullyQualified:
 		nameStr = meta.FullyQualifiedToString(nm)
-		fun, ok = meta.Info.GetFunction(nameStr)
+		fun, ok = lint.MetaInfo().GetFunction(nameStr)
 	}
 
 	return fun, nameStr, ok
@@ -92,7 +92,7 @@ func (d *referencesWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		m, ok := solver.FindMethod(className, id.Value)
+		m, ok := solver.FindMethod(lint.MetaInfo(), className, id.Value)
 		if ok {
 			realClassName := m.ImplName()
 			d.result = findStaticMethodReferences(realClassName, id.Value)
@@ -195,7 +195,7 @@ func refPosition(filename string, pos *position.Position) vscode.Location {
 type parseFn func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location
 
 func findReferences(substr string, parse parseFn) []vscode.Location {
-	cb := linter.ReadFilenames(linter.AnalysisFiles, nil)
+	cb := lint.ReadFilenames(lint.Config().AnalysisFiles, nil)
 	ch := make(chan linter.FileInfo)
 	go func() {
 		cb(ch)
@@ -212,14 +212,14 @@ func findReferences(substr string, parse parseFn) []vscode.Location {
 
 	openMapCopy := copyOpenMap()
 
-	for i := 0; i < linter.MaxConcurrency; i++ {
+	for i := 0; i < lint.Config().MaxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
 			for fi := range ch {
 				contents, err := readFile(openMapCopy, fi.Filename)
 				if err == nil && bytes.Contains(contents, substrBytes) {
 					func() {
-						waiter := linter.BeforeParse(len(contents), fi.Filename)
+						waiter := lint.BeforeParse(len(contents), fi.Filename)
 						defer waiter.Finish()
 
 						parser := php7.NewParser(contents)
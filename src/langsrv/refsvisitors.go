@@ -70,7 +70,7 @@ func findMethodReferences(className string, methodName string) []vscode.Location
 	return findReferences(methodName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
 		var found []vscode.Location
 
-		rootWalker := linter.NewWalkerForReferencesSearcher(
+		rootWalker := lint.NewWalkerForReferencesSearcher(
 			filename,
 			func(ctx *linter.BlockContext) linter.BlockChecker {
 				return &blockMethodCallVisitor{
@@ -96,7 +96,7 @@ func findPropertyReferences(className string, propName string) []vscode.Location
 	return findReferences(propName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
 		var found []vscode.Location
 
-		rootWalker := linter.NewWalkerForReferencesSearcher(
+		rootWalker := lint.NewWalkerForReferencesSearcher(
 			filename,
 			func(ctx *linter.BlockContext) linter.BlockChecker {
 				return &blockPropertyVisitor{
@@ -183,7 +183,7 @@ func (d *staticMethodCallVisitor) EnterNode(w walker.Walkable) bool {
 		if !ok {
 			return true
 		}
-		m, ok := solver.FindMethod(className, id.Value)
+		m, ok := solver.FindMethod(lint.MetaInfo(), className, id.Value)
 		realClassName := m.ImplName()
 
 		if ok && realClassName == d.className && id.Value == d.methodName {
@@ -273,7 +273,7 @@ func (d *classConstVisitor) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		_, implClassName, ok := solver.FindConstant(className, constName.Value)
+		_, implClassName, ok := solver.FindConstant(lint.MetaInfo(), className, constName.Value)
 
 		if ok && constName.Value == d.constName && implClassName == d.className {
 			if pos := n.GetPosition(); pos != nil {
@@ -319,7 +319,7 @@ func (d *blockMethodCallVisitor) BeforeEnterNode(w walker.Walkable) {
 		exprType := solver.ExprType(d.ctx.Scope(), d.ctx.ClassParseState(), n.Variable)
 
 		exprType.Iterate(func(typ string) {
-			m, ok := solver.FindMethod(typ, methodName)
+			m, ok := solver.FindMethod(lint.MetaInfo(), typ, methodName)
 			realClassName := m.ImplName()
 
 			if ok && realClassName == d.className {
@@ -370,7 +370,7 @@ func (d *blockPropertyVisitor) handlePropertyFetch(n *expr.PropertyFetch) {
 
 	exprType := solver.ExprType(d.ctx.Scope(), d.ctx.ClassParseState(), n.Variable)
 	exprType.Iterate(func(className string) {
-		p, ok := solver.FindProperty(className, id.Value)
+		p, ok := solver.FindProperty(lint.MetaInfo(), className, id.Value)
 		realClassName := p.ImplName()
 
 		if ok && realClassName == d.className {
@@ -34,13 +34,13 @@ func openFile(filename, contents string) {
 	changingMutex.Lock()
 	defer changingMutex.Unlock()
 
-	if meta.IsIndexingComplete() {
+	if lint.MetaInfo().IsIndexingComplete() {
 		changeFileNonLocked(filename, contents)
 		return
 	}
 
 	// just parse file, do not fully analyze it as indexing is not yet done
-	rootNode, _, err := linter.ParseContents(filename, []byte(contents), nil)
+	rootNode, _, err := lint.ParseContents(filename, []byte(contents), nil)
 	if err != nil {
 		log.Printf("Could not parse %s: %s", filename, err.Error())
 		lintdebug.Send("Could not parse %s: %s", filename, err.Error())
@@ -61,23 +61,25 @@ func changeFile(filename, contents string) {
 }
 
 func changeFileNonLocked(filename, contents string) {
-	if !meta.IsIndexingComplete() {
+	if !lint.MetaInfo().IsIndexingComplete() {
 		return
 	}
 
 	// parse file, update index for it, and then generate diagnostics based on new index
-	meta.SetIndexingComplete(false)
+	lint.MetaInfo().SetIndexingComplete(false)
 
-	rootNode, w, err := linter.ParseContents(filename, []byte(contents), nil)
+	rootNode, w, err := lint.ParseContents(filename, []byte(contents), nil)
 	if err != nil {
 		log.Printf("Could not parse %s: %s", filename, err.Error())
 		lintdebug.Send("Could not parse %s: %s", filename, err.Error())
 		return
 	}
 
+	oldMeta := getMetaForFiles([]string{filename})
 	w.UpdateMetaInfo()
+	changed := linter.ChangedSymbols(oldMeta, getMetaForFiles([]string{filename}))
 
-	meta.SetIndexingComplete(true)
+	lint.MetaInfo().SetIndexingComplete(true)
 
 	newWalker := linter.NewWalkerForLangServer(w)
 
@@ -91,6 +93,42 @@ func changeFileNonLocked(filename, contents string) {
 	openMapMutex.Unlock()
 
 	flushReports(filename, newWalker)
+
+	relintDependents(changed, map[string]bool{filename: true})
+}
+
+// relintDependents updates diagnostics of the opened files
+// that depend on the changed symbols, except the skipped ones.
+// changingMutex must be held
+func relintDependents(changed []string, skip map[string]bool) {
+	if len(changed) == 0 {
+		return
+	}
+
+	for _, filename := range lint.DependentFiles(changed) {
+		if skip[filename] {
+			continue
+		}
+
+		openMapMutex.Lock()
+		f, ok := openMap[filename]
+		openMapMutex.Unlock()
+
+		if ok {
+			changeFileNonLocked(filename, f.contents)
+		}
+	}
+}
+
+func getMetaForFiles(filenames []string) []meta.PerFile {
+	lint.MetaInfo().Lock()
+	defer lint.MetaInfo().Unlock()
+
+	res := make([]meta.PerFile, 0, len(filenames))
+	for _, filename := range filenames {
+		res = append(res, lint.MetaInfo().GetMetaForFile(filename))
+	}
+	return res
 }
 
 // parse creations and changes of files concurrently
@@ -110,11 +148,11 @@ func concurrentParseChanges(changes []vscode.FileEvent) {
 
 	var wg sync.WaitGroup
 
-	for i := 0; i < linter.MaxConcurrency; i++ {
+	for i := 0; i < lint.Config().MaxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
 			for filename := range filenamesCh {
-				err := linter.IndexFile(filename, nil)
+				err := lint.IndexFile(filename, nil)
 				if err != nil {
 					lintdebug.Send("Could not parse %s: %s", filename, err.Error())
 				}
@@ -123,6 +161,10 @@ func concurrentParseChanges(changes []vscode.FileEvent) {
 		}()
 	}
 	wg.Wait()
+
+	if err := lint.FlushIndexCache(); err != nil {
+		lintdebug.Send("Could not write index cache: %s", err.Error())
+	}
 }
 
 func externalChanges(changes []vscode.FileEvent) {
@@ -131,21 +173,31 @@ func externalChanges(changes []vscode.FileEvent) {
 	start := time.Now()
 	lintdebug.Send("Started processing external changes %+v", changes)
 
-	meta.SetIndexingComplete(false)
+	lint.MetaInfo().SetIndexingComplete(false)
+
+	filenames := make([]string, 0, len(changes))
+	changedFiles := make(map[string]bool, len(changes))
+	for _, ev := range changes {
+		filename := strings.TrimPrefix(ev.URI, "file://")
+		filenames = append(filenames, filename)
+		changedFiles[filename] = true
+	}
+	oldMeta := getMetaForFiles(filenames)
 
-	meta.Info.Lock()
+	lint.MetaInfo().Lock()
 	for _, ev := range changes {
 		switch ev.Type {
 		case vscode.Deleted:
-			meta.Info.DeleteMetaForFileNonLocked(strings.TrimPrefix(ev.URI, "file://"))
+			lint.MetaInfo().DeleteMetaForFileNonLocked(strings.TrimPrefix(ev.URI, "file://"))
 		}
 	}
-	meta.Info.Unlock()
+	lint.MetaInfo().Unlock()
 
 	concurrentParseChanges(changes)
+	changed := linter.ChangedSymbols(oldMeta, getMetaForFiles(filenames))
 
 	changingMutex.Unlock()
-	meta.SetIndexingComplete(true)
+	lint.MetaInfo().SetIndexingComplete(true)
 
 	// update currently opened files if needed
 	for _, ev := range changes {
@@ -170,12 +222,17 @@ func externalChanges(changes []vscode.FileEvent) {
 		}
 	}
 
+	// update opened files that depend on the changed ones
+	changingMutex.Lock()
+	relintDependents(changed, changedFiles)
+	changingMutex.Unlock()
+
 	lintdebug.Send("Finished processing %d external changes in %s", len(changes), time.Since(start))
 }
 
 // getFileContents reads specified file and returns UTF-8 encoded bytes.
 func getFileContents(filename string) ([]byte, error) {
-	r, err := linter.SrcInput.NewReader(filename)
+	r, err := lint.Config().SrcInput.NewReader(filename)
 	if err != nil {
 		return nil, fmt.Errorf("open input: %v", err)
 	}
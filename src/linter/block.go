@@ -76,6 +76,17 @@ type BlockWalker struct {
 	// that do not call parent constructors.
 	callsParentConstructor bool
 
+	// throwSources are places that can throw an exception.
+	// caught is a stack of exception classes caught by the enclosing try statements.
+	throwSources []meta.ThrowSource
+	caught       []string
+
+	// catchVar is a variable of the innermost catch clause that is being walked.
+	// rethrows are indexes of the throwSources that throw the catchVar,
+	// they are completed after the try block is walked, see completeRethrows.
+	catchVar string
+	rethrows []int
+
 	// shared state between all blocks
 	unusedVars   map[string][]node.Node
 	nonLocalVars map[string]struct{} // static, global and other vars that have complex control flow
@@ -126,8 +137,19 @@ func (b *BlockWalker) reportDeadCode(n node.Node) {
 	b.r.Report(n, LevelInformation, "deadCode", "Unreachable code")
 }
 
+// constValue returns a statically known value of the expression.
+//
+// Constants defined outside of the current file are only
+// resolved after the indexing is complete.
+func (b *BlockWalker) constValue(e node.Node) meta.ConstValue {
+	if !b.r.info.IsIndexingComplete() {
+		return solver.ExprValueLocal(b.r.ctx.st, nil, e)
+	}
+	return solver.ExprValue(b.r.ctx.st, e)
+}
+
 func (b *BlockWalker) checkRedundantCastArray(e node.Node) {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return
 	}
 	typ := solver.ExprType(b.ctx.sc, b.r.ctx.st, e)
@@ -137,7 +159,7 @@ func (b *BlockWalker) checkRedundantCastArray(e node.Node) {
 }
 
 func (b *BlockWalker) checkRedundantCast(e node.Node, dstType string) {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return
 	}
 	typ := solver.ExprType(b.ctx.sc, b.r.ctx.st, e)
@@ -236,6 +258,8 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 		}
 	}
 
+	b.trackThrowSource(n)
+
 	switch s := w.(type) {
 	case *stmt.Expression:
 		b.handleStmtExpression(s)
@@ -427,6 +451,9 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 		res = b.handleVariable(s)
 	case *expr.ArrayDimFetch:
 		b.checkArrayDimFetch(s)
+		b.checkArrayKeyExists(s)
+	case *binary.Coalesce:
+		res = b.handleCoalesce(s.Left, s.Right)
 	case *stmt.Function:
 		res = b.handleFunction(s)
 	case *stmt.Class:
@@ -482,20 +509,27 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 		c.AfterEnterNode(w)
 	}
 
-	if meta.IsIndexingComplete() && b.r.anyRset != nil {
-		// Note: no need to check localRset for nil.
+	if b.r.info.IsIndexingComplete() && b.r.anyRset != nil {
 		kind := rules.CategorizeNode(n)
 		if kind != rules.KindNone {
-			b.r.runRules(n, b.ctx.sc, b.r.anyRset.RulesByKind[kind])
-			if !b.rootLevel {
-				b.r.runRules(n, b.ctx.sc, b.r.localRset.RulesByKind[kind])
-			}
+			b.runRules(n, kind)
+		}
+		for _, list := range stmtBlocks(n) {
+			b.runRules(list, rules.KindStmtList)
 		}
 	}
 
 	return res
 }
 
+func (b *BlockWalker) runRules(n node.Node, kind rules.RuleKind) {
+	// Note: no need to check localRset for nil.
+	b.r.runRules(n, b.ctx.sc, b.r.anyRset, kind)
+	if !b.rootLevel {
+		b.r.runRules(n, b.ctx.sc, b.r.localRset, kind)
+	}
+}
+
 func (b *BlockWalker) handleFunction(fun *stmt.Function) bool {
 	if b.ignoreFunctionBodies {
 		return false
@@ -705,16 +739,24 @@ func (b *BlockWalker) handleTry(s *stmt.Try) bool {
 
 	// Assume that no code in try{} block has executed because exceptions can be thrown from anywhere.
 	// So we handle catches and finally blocks first.
+	rethrows := make([][]int, 0, len(s.Catches))
 	for _, c := range s.Catches {
 		b.r.checkKeywordCase(c, "catch")
+		cc := c.(*stmt.Catch)
+		oldCatchVar, oldRethrows := b.catchVar, b.rethrows
+		b.catchVar, b.rethrows = "", nil
+		if cc.Variable != nil {
+			b.catchVar = cc.Variable.Name
+		}
 		ctx := b.withNewContext(func() {
 			b.r.addScope(c, b.ctx.sc)
-			cc := c.(*stmt.Catch)
 			for _, s := range cc.Stmts {
 				b.addStatement(s)
 			}
 			b.handleCatch(cc)
 		})
+		rethrows = append(rethrows, b.rethrows)
+		b.catchVar, b.rethrows = oldCatchVar, oldRethrows
 		contexts = append(contexts, ctx)
 	}
 
@@ -745,6 +787,10 @@ func (b *BlockWalker) handleTry(s *stmt.Try) bool {
 		b.ctx.containsExitFlags |= ctx.containsExitFlags
 	}
 
+	numSources := len(b.throwSources)
+	numCaught := len(b.caught)
+	b.caught = append(b.caught, b.catchTypes(s.Catches)...)
+	skipCaught := len(b.caught)
 	ctx := b.withNewContext(func() {
 		for _, s := range s.Stmts {
 			b.addStatement(s)
@@ -752,6 +798,9 @@ func (b *BlockWalker) handleTry(s *stmt.Try) bool {
 			b.r.addScope(s, b.ctx.sc)
 		}
 	})
+	b.caught = b.caught[:numCaught]
+	b.completeRethrows(s, rethrows, b.throwSources[numSources:], skipCaught)
+	b.checkCatchReachable(s, b.throwSources[numSources:], skipCaught)
 
 	ctx.sc.Iterate(func(varName string, typ meta.TypesMap, flags meta.VarFlags) {
 		if !othersExit {
@@ -813,7 +862,7 @@ func (b *BlockWalker) handleIssetDimFetch(e *expr.ArrayDimFetch) {
 }
 
 func (b *BlockWalker) checkArrayDimFetch(s *expr.ArrayDimFetch) {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return
 	}
 
@@ -833,7 +882,7 @@ func (b *BlockWalker) checkArrayDimFetch(s *expr.ArrayDimFetch) {
 
 			maybeHaveClasses = true
 
-			if !haveArrayAccess && solver.Implements(t, `\ArrayAccess`) {
+			if !haveArrayAccess && solver.Implements(b.r.info, t, `\ArrayAccess`) {
 				haveArrayAccess = true
 			}
 		}
@@ -844,6 +893,52 @@ func (b *BlockWalker) checkArrayDimFetch(s *expr.ArrayDimFetch) {
 	}
 }
 
+// checkArrayKeyExists reports reads of the keys that are missing from the
+// known array shape. Only arrays that are known to be shapes are checked,
+// the keys guarded by isset, !empty or array_key_exists are skipped.
+func (b *BlockWalker) checkArrayKeyExists(s *expr.ArrayDimFetch) {
+	if !b.r.info.IsIndexingComplete() {
+		return
+	}
+
+	key, _, ok := solver.ShapeKey(s.Dim)
+	if !ok {
+		return
+	}
+
+	if b.ctx.keyIsGuarded(s.Variable, key) {
+		return
+	}
+
+	typ := solver.ExprType(b.ctx.sc, b.r.ctx.st, s.Variable)
+	if typ.IsEmpty() {
+		return
+	}
+
+	keyFound := typ.Find(func(t string) bool {
+		if !meta.IsInlineShape(t) {
+			// Not a known shape, so any key could be defined.
+			return true
+		}
+		_, ok := meta.FindInlineShapeProp(t, key)
+		return ok
+	})
+	if !keyFound {
+		b.r.Report(s.Dim, LevelWarning, "undefinedArrayKey", "Key '%s' is not defined in %s", key, typ)
+	}
+}
+
+func (b *BlockWalker) handleCoalesce(left, right node.Node) bool {
+	// Like in isset(), the left operand may refer to undefined keys.
+	if dim, ok := left.(*expr.ArrayDimFetch); ok {
+		b.handleIssetDimFetch(dim)
+	} else {
+		left.Walk(b)
+	}
+	right.Walk(b)
+	return false
+}
+
 func (b *BlockWalker) enoughArgs(args []node.Node, fn meta.FuncInfo) bool {
 	if len(args) < fn.MinParamsCnt {
 		// If the last argument is ...$arg, then assume it is an array with
@@ -904,7 +999,7 @@ func (b *BlockWalker) handleCallArgs(n node.Node, args []node.Node, fn meta.Func
 func (b *BlockWalker) handleFunctionCall(e *expr.FunctionCall) bool {
 	call := resolveFunctionCall(b.ctx.sc, b.r.ctx.st, b.ctx.customTypes, e)
 
-	if meta.IsIndexingComplete() {
+	if b.r.info.IsIndexingComplete() {
 		if !call.canAnalyze {
 			return true
 		}
@@ -930,18 +1025,25 @@ func (b *BlockWalker) handleFunctionCall(e *expr.FunctionCall) bool {
 	switch call.fqName {
 	case `\preg_match`, `\preg_match_all`, `\preg_replace`, `\preg_split`:
 		argNode := e.ArgumentList.Arguments[0]
-		s, ok := argNode.(*node.Argument).Expr.(*scalar.String)
-		if !ok {
-			break
-		}
-		pat, ok := newRegexpPattern(s)
-		if !ok {
-			break
-		}
-		simplified := b.r.reSimplifier.simplifyRegexp(pat)
-		if simplified != "" {
-			b.r.Report(argNode, LevelDoNotReject, "regexpSimplify", "May re-write %s as '%s'",
-				s.Value, simplified)
+		var pat regexpPattern
+		if s, ok := argNode.(*node.Argument).Expr.(*scalar.String); ok {
+			pat, ok = newRegexpPattern(s)
+			if !ok {
+				break
+			}
+			simplified := b.r.reSimplifier.simplifyRegexp(pat)
+			if simplified != "" {
+				b.r.Report(argNode, LevelDoNotReject, "regexpSimplify", "May re-write %s as '%s'",
+					s.Value, simplified)
+			}
+		} else {
+			// Patterns like `self::PATTERN` can't be re-written in place,
+			// but they still can be checked.
+			v := b.constValue(argNode.(*node.Argument).Expr)
+			if v.Kind != meta.ConstString {
+				break
+			}
+			pat = regexpPattern{value: v.Str, quotes: '\''}
 		}
 		issues, err := b.r.reVet.CheckRegexp(pat)
 		if err != nil {
@@ -1015,7 +1117,7 @@ func (b *BlockWalker) canAccess(className string, accessLevel meta.AccessLevel)
 				return true
 			}
 
-			class, ok := meta.Info.GetClass(parent)
+			class, ok := b.r.info.GetClass(parent)
 			if !ok {
 				return false
 			}
@@ -1032,7 +1134,7 @@ func (b *BlockWalker) canAccess(className string, accessLevel meta.AccessLevel)
 }
 
 func (b *BlockWalker) handleMethodCall(e *expr.MethodCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1055,11 +1157,11 @@ func (b *BlockWalker) handleMethodCall(e *expr.MethodCall) bool {
 	exprType := b.exprType(e.Variable)
 
 	exprType.Find(func(typ string) bool {
-		m, ok := solver.FindMethod(typ, methodName)
+		m, ok := solver.FindMethod(b.r.info, typ, methodName)
 		fn = m.Info
 		foundMethod = ok
 		className = m.ClassName
-		magic = haveMagicMethod(typ, `__call`)
+		magic = haveMagicMethod(b.r.info, typ, `__call`)
 		return foundMethod || magic
 	})
 
@@ -1101,7 +1203,7 @@ func (b *BlockWalker) handleMethodCall(e *expr.MethodCall) bool {
 }
 
 func (b *BlockWalker) handleStaticCall(e *expr.StaticCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1125,13 +1227,13 @@ func (b *BlockWalker) handleStaticCall(e *expr.StaticCall) bool {
 		return true
 	}
 
-	m, ok := solver.FindMethod(className, methodName)
+	m, ok := solver.FindMethod(b.r.info, className, methodName)
 	fn := m.Info
 
 	e.Class.Walk(b)
 	e.Call.Walk(b)
 
-	magic := haveMagicMethod(className, `__callStatic`)
+	magic := haveMagicMethod(b.r.info, className, `__callStatic`)
 	if !ok && !magic && !b.r.ctx.st.IsTrait {
 		b.r.Report(e.Call, LevelError, "undefined", "Call to undefined method %s::%s()", className, methodName)
 	} else {
@@ -1169,7 +1271,7 @@ func (b *BlockWalker) handlePropertyFetch(e *expr.PropertyFetch) bool {
 	e.Variable.Walk(b)
 	e.Property.Walk(b)
 
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return false
 	}
 
@@ -1185,11 +1287,11 @@ func (b *BlockWalker) handlePropertyFetch(e *expr.PropertyFetch) bool {
 
 	typ := b.exprType(e.Variable)
 	typ.Find(func(typ string) bool {
-		p, ok := solver.FindProperty(typ, id.Value)
+		p, ok := solver.FindProperty(b.r.info, typ, id.Value)
 		info = p.Info
 		className = p.ClassName
 		found = ok
-		magic = haveMagicMethod(typ, `__get`)
+		magic = haveMagicMethod(b.r.info, typ, `__get`)
 		return found || magic
 	})
 
@@ -1207,7 +1309,7 @@ func (b *BlockWalker) handlePropertyFetch(e *expr.PropertyFetch) bool {
 func (b *BlockWalker) handleStaticPropertyFetch(e *expr.StaticPropertyFetch) bool {
 	e.Class.Walk(b)
 
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return false
 	}
 
@@ -1223,7 +1325,7 @@ func (b *BlockWalker) handleStaticPropertyFetch(e *expr.StaticPropertyFetch) boo
 		return false
 	}
 
-	p, ok := solver.FindProperty(className, "$"+sv.Name)
+	p, ok := solver.FindProperty(b.r.info, className, "$"+sv.Name)
 	if !ok && !b.r.ctx.st.IsTrait {
 		b.r.Report(e.Property, LevelError, "undefined", "Property %s::$%s does not exist", className, sv.Name)
 	}
@@ -1261,21 +1363,11 @@ func (b *BlockWalker) handleArrayItems(arr node.Node, items []*expr.ArrayItem) b
 
 		haveKeys = true
 
-		var key string
-		var constKey bool
-
-		switch k := item.Key.(type) {
-		case *scalar.String:
-			key = unquote(k.Value)
-			constKey = true
-		case *scalar.Lnumber:
-			key = k.Value
-			constKey = true
-		}
-
-		if !constKey {
+		keyValue, ok := b.constValue(item.Key).ArrayKey()
+		if !ok {
 			continue
 		}
+		key, _ := keyValue.ToString()
 
 		if _, ok := keys[key]; ok {
 			b.r.Report(item.Key, LevelWarning, "dupArrayKeys", "Duplicate array key '%s'", key)
@@ -1292,7 +1384,7 @@ func (b *BlockWalker) handleArrayItems(arr node.Node, items []*expr.ArrayItem) b
 }
 
 func (b *BlockWalker) handleClassConstFetch(e *expr.ClassConstFetch) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1306,7 +1398,7 @@ func (b *BlockWalker) handleClassConstFetch(e *expr.ClassConstFetch) bool {
 		return false
 	}
 
-	info, implClass, ok := solver.FindConstant(className, constName.Value)
+	info, implClass, ok := solver.FindConstant(b.r.info, className, constName.Value)
 
 	e.Class.Walk(b)
 
@@ -1322,7 +1414,7 @@ func (b *BlockWalker) handleClassConstFetch(e *expr.ClassConstFetch) bool {
 }
 
 func (b *BlockWalker) handleConstFetch(e *expr.ConstFetch) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1352,7 +1444,7 @@ func (b *BlockWalker) handleNew(e *expr.New) bool {
 		return false
 	}
 
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1373,7 +1465,7 @@ func (b *BlockWalker) handleNew(e *expr.New) bool {
 		return true
 	}
 
-	class, ok := meta.Info.GetClass(className)
+	class, ok := b.r.info.GetClass(className)
 	if !ok {
 		b.r.reportUndefinedType(e.Class, className)
 	} else {
@@ -1388,7 +1480,7 @@ func (b *BlockWalker) handleNew(e *expr.New) bool {
 	}
 
 	// Check implicitly invoked constructor method arguments count.
-	m, ok := solver.FindMethod(className, "__construct")
+	m, ok := solver.FindMethod(b.r.info, className, "__construct")
 	if !ok {
 		return true
 	}
@@ -1632,6 +1724,11 @@ func (a *andWalker) EnterNode(w walker.Walkable) (res bool) {
 			if ok {
 				a.b.ctx.addCustomFunction(unquote(lit.Value))
 			}
+		case len(args) == 2 && meta.NameEquals(nm, `array_key_exists`):
+			key, _, ok := solver.ShapeKey(args[0].(*node.Argument).Expr)
+			if ok {
+				a.b.ctx.addGuardedKey(args[1].(*node.Argument).Expr, key)
+			}
 		}
 
 	case *binary.BooleanAnd:
@@ -1639,6 +1736,9 @@ func (a *andWalker) EnterNode(w walker.Walkable) (res bool) {
 
 	case *expr.Isset:
 		for _, v := range n.Variables {
+			if dim, ok := v.(*expr.ArrayDimFetch); ok {
+				a.addGuardedKey(dim)
+			}
 			varNode := findVarNode(v)
 			if varNode == nil {
 				continue
@@ -1686,6 +1786,9 @@ func (a *andWalker) EnterNode(w walker.Walkable) (res bool) {
 		if !ok {
 			break
 		}
+		if dim, ok := empty.Expr.(*expr.ArrayDimFetch); ok {
+			a.addGuardedKey(dim)
+		}
 		v, ok := empty.Expr.(*node.SimpleVar)
 		if !ok {
 			break
@@ -1703,6 +1806,14 @@ func (a *andWalker) EnterNode(w walker.Walkable) (res bool) {
 
 func (a *andWalker) LeaveNode(w walker.Walkable) {}
 
+// addGuardedKey makes the key of the dim fetch defined,
+// since isset($a['k']) or !empty($a['k']) implies that $a['k'] exists.
+func (a *andWalker) addGuardedKey(dim *expr.ArrayDimFetch) {
+	if key, _, ok := solver.ShapeKey(dim.Dim); ok {
+		a.b.ctx.addGuardedKey(dim.Variable, key)
+	}
+}
+
 func (b *BlockWalker) handleVariable(v node.Node) bool {
 	switch v := v.(type) {
 	case *node.Var:
@@ -1758,6 +1869,7 @@ func (b *BlockWalker) handleIf(s *stmt.If) bool {
 	var varsToDelete []node.Node
 	customMethods := len(b.ctx.customMethods)
 	customFunctions := len(b.ctx.customFunctions)
+	guardedKeys := len(b.ctx.guardedKeys)
 	// Remove all isset'ed variables after we're finished with this if statement.
 	defer func() {
 		for _, v := range varsToDelete {
@@ -1765,6 +1877,7 @@ func (b *BlockWalker) handleIf(s *stmt.If) bool {
 		}
 		b.ctx.customMethods = b.ctx.customMethods[:customMethods]
 		b.ctx.customFunctions = b.ctx.customFunctions[:customFunctions]
+		b.ctx.guardedKeys = b.ctx.guardedKeys[:guardedKeys]
 	}()
 	nodeSet := astutil.NewNodeSet()
 	walkCond := func(cond node.Node) {
@@ -1901,6 +2014,7 @@ func (b *BlockWalker) handleSwitch(s *stmt.Switch) bool {
 	breakFlags := FlagBreak | FlagContinue
 
 	b.r.nodeSet.Reset()
+	var values []meta.ConstValue
 	for i, c := range s.CaseList.Cases {
 		c, ok := c.(*stmt.Case)
 		if !ok {
@@ -1911,7 +2025,18 @@ func (b *BlockWalker) handleSwitch(s *stmt.Switch) bool {
 		}
 		if !b.r.nodeSet.Add(c.Cond) {
 			b.r.Report(c.Cond, LevelWarning, "dupCond", "duplicated switch case #%d", i+1)
+			continue
+		}
+		// Cases like `self::A` and `1` are duplicated if `A` is 1.
+		v := b.constValue(c.Cond)
+		if !v.IsScalar() {
+			continue
 		}
+		if containsConstValue(values, v) {
+			b.r.Report(c.Cond, LevelWarning, "dupCond", "duplicated switch case #%d", i+1)
+			continue
+		}
+		values = append(values, v)
 	}
 
 	for idx, c := range s.CaseList.Cases {
@@ -2024,6 +2149,11 @@ func (b *BlockWalker) handleDimFetchLValue(e *expr.ArrayDimFetch, reason string,
 
 	switch v := e.Variable.(type) {
 	case *node.Var, *node.SimpleVar:
+		if shapeTyp, ok := b.shapeWithKey(v, e.Dim, typ); ok {
+			b.replaceVar(v, shapeTyp, reason, meta.VarAlwaysDefined)
+			b.handleVariable(v)
+			break
+		}
 		arrTyp := meta.NewEmptyTypesMap(typ.Len())
 		typ.Iterate(func(t string) {
 			arrTyp = arrTyp.AppendString(meta.WrapArrayOf(t))
@@ -2042,6 +2172,47 @@ func (b *BlockWalker) handleDimFetchLValue(e *expr.ArrayDimFetch, reason string,
 	}
 }
 
+// shapeWithKey returns a v variable type after `v[dim] = <typ>` assignment
+// if that variable is known to hold an array shape (or an empty array).
+//
+// This makes sequences like `$a = []; $a['k'] = 1;` inferred as shapes.
+func (b *BlockWalker) shapeWithKey(v, dim node.Node, typ meta.TypesMap) (meta.TypesMap, bool) {
+	key, isString, ok := solver.ShapeKey(dim)
+	if !ok {
+		return meta.TypesMap{}, false
+	}
+	sv, ok := v.(*node.SimpleVar)
+	if !ok {
+		return meta.TypesMap{}, false
+	}
+	varTyp, ok := b.ctx.sc.GetVarNameType(sv.Name)
+	if !ok || varTyp.IsEmpty() {
+		return meta.TypesMap{}, false
+	}
+
+	isShape := !varTyp.Find(func(t string) bool {
+		return t != "empty_array" && !meta.IsInlineShape(t)
+	})
+	if !isShape {
+		return meta.TypesMap{}, false
+	}
+	// Arrays with int keys are lists until they get a string key.
+	if varTyp.Is("empty_array") && !isString {
+		return meta.TypesMap{}, false
+	}
+
+	res := meta.NewEmptyTypesMap(varTyp.Len())
+	varTyp.Iterate(func(t string) {
+		var props []meta.ShapeProp
+		if t != "empty_array" {
+			props = meta.InlineShapeProps(t)
+		}
+		props = solver.SetShapeProp(props, key, typ)
+		res = res.AppendString(meta.NewInlineShape(props))
+	})
+	return res, true
+}
+
 // some day, perhaps, there will be some difference between handleAssignReference and handleAssign
 func (b *BlockWalker) handleAssignReference(a *assign.Reference) bool {
 	switch v := a.Variable.(type) {
@@ -2120,7 +2291,7 @@ func (b *BlockWalker) handleBitwiseOp(n, left, right node.Node) {
 }
 
 func (b *BlockWalker) handleStmtExpression(s *stmt.Expression) {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return
 	}
 
@@ -2139,7 +2310,7 @@ func (b *BlockWalker) handleStmtExpression(s *stmt.Expression) {
 		report = true
 	default:
 		typ := b.exprType(s.Expr)
-		if !typ.Is("void") {
+		if !typ.Is("void") && !typ.Is("never") {
 			report = b.sideEffectFree(s.Expr)
 		}
 	}
@@ -2230,13 +2401,13 @@ func (b *BlockWalker) handleAssign(a *assign.Assign) bool {
 }
 
 func (b *BlockWalker) flushUnused() {
-	if !meta.IsIndexingComplete() {
+	if !b.r.info.IsIndexingComplete() {
 		return
 	}
 
 	visitedMap := make(map[node.Node]struct{})
 	for name, nodes := range b.unusedVars {
-		if IsDiscardVar(name) {
+		if b.r.linter.config.IsDiscardVar(name) {
 			// blank identifier is a way to tell linter (and PHPStorm) that result is explicitly unused
 			continue
 		}
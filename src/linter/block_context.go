@@ -12,6 +12,11 @@ type customMethod struct {
 	name string
 }
 
+type guardedKey struct {
+	arr node.Node
+	key string
+}
+
 // blockContext is a state that is used to hold inner blocks info.
 //
 // When BlockWalker enters another block, new context is created.
@@ -35,6 +40,10 @@ type blockContext struct {
 
 	customMethods   []customMethod
 	customFunctions []string
+
+	// guardedKeys are the array keys checked by isset, !empty
+	// or array_key_exists, they are treated as defined.
+	guardedKeys []guardedKey
 }
 
 func (ctx *blockContext) addCustomFunction(functionName string) {
@@ -66,6 +75,22 @@ func (ctx *blockContext) customMethodExists(obj node.Node, methodName string) bo
 	return false
 }
 
+func (ctx *blockContext) addGuardedKey(arr node.Node, key string) {
+	ctx.guardedKeys = append(ctx.guardedKeys, guardedKey{
+		arr: arr,
+		key: key,
+	})
+}
+
+func (ctx *blockContext) keyIsGuarded(arr node.Node, key string) bool {
+	for _, k := range ctx.guardedKeys {
+		if k.key == key && astutil.NodeEqual(k.arr, arr) {
+			return true
+		}
+	}
+	return false
+}
+
 // copyBlockContext returns a copy of the context.
 //
 // The copy does not inherit some properties, like deadCodeReported.
@@ -75,6 +100,7 @@ func copyBlockContext(ctx *blockContext) *blockContext {
 		customTypes:     append([]solver.CustomType{}, ctx.customTypes...),
 		customMethods:   append([]customMethod{}, ctx.customMethods...),
 		customFunctions: append([]string{}, ctx.customFunctions...),
+		guardedKeys:     append([]guardedKey{}, ctx.guardedKeys...),
 		innermostLoop:   ctx.innermostLoop,
 		insideLoop:      ctx.insideLoop,
 	}
@@ -2,14 +2,13 @@ package linter
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/md5"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"runtime"
 	"sync/atomic"
 	"time"
 
@@ -37,14 +36,19 @@ import (
 //          changed meta.scopeVar bool fields representation
 //     38 - replaced TypesMap.immutable:bool with flags:uint8.
 //          added mapPrecise flag to mark precise type maps.
-const cacheVersion = 38
-
-var (
-	errWrongVersion = errors.New("Wrong cache version")
-
-	initFileReadTime  int64
-	initCacheReadTime int64
-)
+//     39 - infer array shapes for array literals with constant keys
+//     40 - support psalm/phpstan phpdoc tags and pseudo types
+//     41 - added Value field to meta.ConstantInfo
+//     42 - added PureDeps field to meta.FuncInfo
+//     43 - added Throws and ThrowSources fields to meta.FuncInfo, Throws to meta.PhpDocInfo
+//     44 - added Refs to the file meta
+//     45 - never and no-return types are not mapped to void
+//     46 - constant values keep references to other constants
+//     47 - functions with static variables are not pure
+//     48 - added Rethrown field to meta.ThrowSource
+const cacheVersion = 48
+
+var errWrongVersion = errors.New("Wrong cache version")
 
 type fileMeta struct {
 	Scope             *meta.Scope
@@ -53,14 +57,17 @@ type fileMeta struct {
 	Functions         meta.FunctionsMap
 	Constants         meta.ConstantsMap
 	FunctionOverrides meta.FunctionsOverrideMap
+
+	// Refs are the names of the symbols the file references or defines, see collectFileRefs.
+	Refs []string
 }
 
 // IndexFile parses the file and fills in the meta info. Can use cache.
-func IndexFile(filename string, contents []byte) error {
-	if CacheDir == "" {
-		_, w, err := ParseContents(filename, contents, nil)
+func (l *Linter) IndexFile(filename string, contents []byte) error {
+	if l.config.CacheDir == "" {
+		_, w, err := l.ParseContents(filename, contents, nil)
 		if w != nil {
-			updateMetaInfo(filename, &w.meta)
+			l.updateMetaInfo(filename, &w.meta)
 		}
 		return err
 	}
@@ -77,98 +84,60 @@ func IndexFile(filename string, contents []byte) error {
 		if _, err := io.Copy(h, fp); err != nil {
 			return err
 		}
-		atomic.AddInt64(&initFileReadTime, int64(time.Since(start)))
+		atomic.AddInt64(&l.initFileReadTime, int64(time.Since(start)))
 	} else {
 		h.Write(contents)
 	}
 
-	contentsHash := fmt.Sprintf("%x", h.Sum(nil))
-
-	cacheFilenamePart := filename
-
-	// windows user supplied full path to directory to be analyzed,
-	// but windows paths does not support ":" in the middle
-	if len(filename) > 2 && filename[0] >= 'A' && filename[0] <= 'Z' && filename[1] == ':' {
-		cacheFilenamePart = filename[0:1] + "_" + filename[2:]
-	}
-
-	cacheFile := filepath.Join(CacheDir, cacheFilenamePart+"."+contentsHash)
+	var contentsHash [md5.Size]byte
+	copy(contentsHash[:], h.Sum(nil))
 
 	start := time.Now()
-	fp, err := os.Open(cacheFile)
-	if err != nil {
-		_, w, err := ParseContents(filename, contents, nil)
-		if err != nil {
-			return err
+	if data, release, ok := l.indexCacheGet(filename, contentsHash); ok {
+		err := l.restoreMetaFromCache(filename, bytes.NewReader(data))
+		release()
+		if err == nil {
+			atomic.AddInt64(&l.initCacheReadTime, int64(time.Since(start)))
+			return nil
 		}
-
-		return createMetaCacheFile(filename, cacheFile, w)
-	}
-	defer fp.Close()
-
-	if err := restoreMetaFromCache(filename, fp); err != nil {
 		// do not really care about why exactly reading from cache failed
-		os.Remove(cacheFile)
-
-		_, w, err := ParseContents(filename, contents, nil)
-		if err != nil {
-			return err
-		}
-
-		return createMetaCacheFile(filename, cacheFile, w)
+		l.indexCacheDelete(filename, contentsHash)
 	}
 
-	atomic.AddInt64(&initCacheReadTime, int64(time.Since(start)))
-	return nil
-}
+	_, w, err := l.ParseContents(filename, contents, nil)
+	if err != nil {
+		return err
+	}
 
-func writeMetaCache(w *bufio.Writer, root *RootWalker) error {
-	if err := writeMetaCacheHeader(w, root); err != nil {
+	var buf bytes.Buffer
+	wr := bufio.NewWriter(&buf)
+	if err := writeMetaCache(wr, w); err != nil {
 		return err
 	}
-	enc := gob.NewEncoder(w)
-	if err := enc.Encode(&root.meta); err != nil {
+	if err := wr.Flush(); err != nil {
 		return err
 	}
-	if err := customCachersEncode(w, root); err != nil {
+	if err := l.indexCachePut(filename, contentsHash, buf.Bytes()); err != nil {
 		return err
 	}
+
+	// if using cache, this is the only proper place to update meta info:
+	// after all cache meta info was successfully written to disk
+	l.updateMetaInfo(filename, &w.meta)
 	return nil
 }
 
-func createMetaCacheFile(filename, cacheFile string, root *RootWalker) error {
-	tmpPath := cacheFile + ".tmp"
-	os.MkdirAll(filepath.Dir(tmpPath), 0777)
-
-	// TODO: some kind of file-based locking
-	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	if err != nil {
-		return err
-	}
-	defer fp.Close()
-	defer os.Remove(tmpPath)
-
-	wr := bufio.NewWriter(fp)
-	if err := writeMetaCache(wr, root); err != nil {
+func writeMetaCache(w *bufio.Writer, root *RootWalker) error {
+	if err := writeMetaCacheHeader(w, root); err != nil {
 		return err
 	}
-	if err := wr.Flush(); err != nil {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(&root.meta); err != nil {
 		return err
 	}
-
-	// Windows clearly does not want to allow to rename unclosed files
-	if runtime.GOOS == "windows" {
-		fp.Close()
-		os.Remove(cacheFile)
-	}
-
-	if err := os.Rename(tmpPath, cacheFile); err != nil {
+	if err := customCachersEncode(w, root); err != nil {
 		return err
 	}
-
-	// if using cache, this is the only proper place to update meta info:
-	// after all cache meta info was successfully written to disk
-	updateMetaInfo(filename, &root.meta)
 	return nil
 }
 
@@ -188,36 +157,38 @@ func readMetaCache(r io.Reader, filename string, dst *fileMeta) error {
 	return nil
 }
 
-func restoreMetaFromCache(filename string, rd io.Reader) error {
+func (l *Linter) restoreMetaFromCache(filename string, rd io.Reader) error {
 	var m fileMeta
 	if err := readMetaCache(rd, filename, &m); err != nil {
 		return err
 	}
 
-	updateMetaInfo(filename, &m)
+	l.updateMetaInfo(filename, &m)
 	return nil
 }
 
-func updateMetaInfo(filename string, m *fileMeta) {
-	if meta.IsIndexingComplete() {
+func (l *Linter) updateMetaInfo(filename string, m *fileMeta) {
+	if l.info.IsIndexingComplete() {
 		panic("Trying to update meta info when not indexing")
 	}
 
-	meta.Info.Lock()
-	defer meta.Info.Unlock()
+	l.info.Lock()
+	defer l.info.Unlock()
 
-	meta.Info.DeleteMetaForFileNonLocked(filename)
+	l.info.DeleteMetaForFileNonLocked(filename)
 
-	meta.Info.AddFilenameNonLocked(filename)
-	meta.Info.AddClassesNonLocked(filename, m.Classes)
-	meta.Info.AddTraitsNonLocked(filename, m.Traits)
-	meta.Info.AddFunctionsNonLocked(filename, m.Functions)
-	meta.Info.AddConstantsNonLocked(filename, m.Constants)
-	meta.Info.AddFunctionsOverridesNonLocked(filename, m.FunctionOverrides)
+	l.info.AddFilenameNonLocked(filename)
+	l.info.AddClassesNonLocked(filename, m.Classes)
+	l.info.AddTraitsNonLocked(filename, m.Traits)
+	l.info.AddFunctionsNonLocked(filename, m.Functions)
+	l.info.AddConstantsNonLocked(filename, m.Constants)
+	l.info.AddFunctionsOverridesNonLocked(filename, m.FunctionOverrides)
 
 	if m.Scope != nil {
-		meta.Info.AddToGlobalScopeNonLocked(filename, m.Scope)
+		l.info.AddToGlobalScopeNonLocked(filename, m.Scope)
 	}
+
+	l.setFileRefs(filename, m.Refs)
 }
 
 func writeMetaCacheHeader(wr *bufio.Writer, root *RootWalker) error {
@@ -0,0 +1,248 @@
+package linter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CacheStats describes the cache directory contents.
+type CacheStats struct {
+	// IndexVersion is a cacheVersion of the index pack, 0 if there is no valid pack.
+	IndexVersion int
+	IndexEntries int
+	IndexSize    int64
+
+	// IndexStale is a number of the index entries of the files
+	// that were removed or changed since they were indexed.
+	IndexStale int
+
+	ReportEntries int
+	ReportSize    int64
+	ReportStale   int
+
+	// LegacyFiles are the per-file index cache files written by the older linter versions.
+	LegacyFiles int
+	LegacySize  int64
+}
+
+// legacyCacheFileRegexp matches the per-file index cache files.
+var legacyCacheFileRegexp = regexp.MustCompile(`\.[0-9a-f]{32}(\.tmp)?$`)
+
+type cacheScan struct {
+	stats CacheStats
+
+	packExists  bool
+	packInvalid bool
+	packLive    []indexPackRecord
+
+	staleReports []string
+	legacyFiles  []string
+	dirs         []string
+
+	sourceHashes map[string]string
+}
+
+// GetCacheStats returns the cache directory statistics.
+//
+// The entries are considered stale if their source files are not found
+// or have a different contents hash.
+func GetCacheStats(dir string) (CacheStats, error) {
+	scan, err := scanCache(dir)
+	if err != nil {
+		return CacheStats{}, err
+	}
+	return scan.stats, nil
+}
+
+// PruneCache removes the stale entries and legacy files from the cache directory.
+// It returns the cache statistics collected before the pruning.
+func PruneCache(dir string) (CacheStats, error) {
+	if _, err := os.Stat(dir); err == nil {
+		unlock, err := lockIndexPack(dir)
+		if err != nil {
+			return CacheStats{}, err
+		}
+		defer unlock()
+	}
+
+	scan, err := scanCache(dir)
+	if err != nil {
+		return CacheStats{}, err
+	}
+
+	packFile := filepath.Join(dir, IndexCacheFilename)
+	switch {
+	case scan.packInvalid:
+		if err := os.Remove(packFile); err != nil {
+			return scan.stats, err
+		}
+	case scan.stats.IndexStale != 0:
+		w, err := createIndexPack(dir)
+		if err != nil {
+			return scan.stats, err
+		}
+		for _, r := range scan.packLive {
+			if err := w.add(r.filename, r.hash, r.data); err != nil {
+				w.abort()
+				return scan.stats, err
+			}
+		}
+		if err := w.commit(packFile); err != nil {
+			return scan.stats, err
+		}
+	}
+
+	for _, list := range [][]string{scan.staleReports, scan.legacyFiles} {
+		for _, filename := range list {
+			if err := os.Remove(filename); err != nil {
+				return scan.stats, err
+			}
+		}
+	}
+	removeEmptyDirs(scan.dirs)
+
+	return scan.stats, nil
+}
+
+// ClearCache removes the index pack, cached reports and legacy files from the cache directory.
+func ClearCache(dir string) error {
+	scan, err := scanCache(dir)
+	if err != nil {
+		return err
+	}
+
+	if scan.packExists {
+		if err := os.Remove(filepath.Join(dir, IndexCacheFilename)); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(dir, reportCacheDirname)); err != nil {
+		return err
+	}
+	for _, filename := range scan.legacyFiles {
+		if err := os.Remove(filename); err != nil {
+			return err
+		}
+	}
+	removeEmptyDirs(scan.dirs)
+
+	return nil
+}
+
+func scanCache(dir string) (*cacheScan, error) {
+	scan := &cacheScan{sourceHashes: make(map[string]string)}
+
+	if err := scan.scanPack(filepath.Join(dir, IndexCacheFilename)); err != nil {
+		return nil, err
+	}
+
+	reportsDir := filepath.Join(dir, reportCacheDirname)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && path != reportsDir {
+				scan.dirs = append(scan.dirs, path)
+			}
+			return nil
+		}
+		if strings.HasPrefix(path, reportsDir+string(filepath.Separator)) {
+			return scan.scanReport(path, info)
+		}
+		if legacyCacheFileRegexp.MatchString(path) {
+			scan.legacyFiles = append(scan.legacyFiles, path)
+			scan.stats.LegacyFiles++
+			scan.stats.LegacySize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scan, nil
+}
+
+func (scan *cacheScan) scanPack(packFile string) error {
+	data, err := ioutil.ReadFile(packFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scan.packExists = true
+	scan.stats.IndexSize = int64(len(data))
+
+	version, records, err := decodeIndexPack(data)
+	if err != nil || version != cacheVersion {
+		scan.packInvalid = true
+		return nil
+	}
+
+	scan.stats.IndexVersion = int(version)
+	scan.stats.IndexEntries = len(records)
+	for _, r := range records {
+		if scan.sourceHash(r.filename) == hex.EncodeToString(r.hash[:]) {
+			scan.packLive = append(scan.packLive, r)
+		} else {
+			scan.stats.IndexStale++
+		}
+	}
+	return nil
+}
+
+func (scan *cacheScan) scanReport(path string, info os.FileInfo) error {
+	scan.stats.ReportEntries++
+	scan.stats.ReportSize += info.Size()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var entry reportCacheEntry
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+	stale := err != nil || entry.Version != reportCacheVersion ||
+		scan.sourceHash(entry.Filename) != strings.TrimPrefix(filepath.Ext(path), ".")
+	if stale {
+		scan.staleReports = append(scan.staleReports, path)
+		scan.stats.ReportStale++
+	}
+	return nil
+}
+
+// sourceHash returns the contents hash of the source file
+// or an empty string if it can't be read.
+func (scan *cacheScan) sourceHash(filename string) string {
+	if h, ok := scan.sourceHashes[filename]; ok {
+		return h
+	}
+	var h string
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		sum := md5.Sum(data)
+		h = hex.EncodeToString(sum[:])
+	}
+	scan.sourceHashes[filename] = h
+	return h
+}
+
+// removeEmptyDirs removes the directories that became empty, nested ones first.
+func removeEmptyDirs(dirs []string) {
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		// Non-empty directories are not removed.
+		os.Remove(dir)
+	}
+}
@@ -16,7 +16,7 @@ import (
 )
 
 func TestCache(t *testing.T) {
-	go MemoryLimiterThread()
+	l := NewLinter(nil)
 
 	// If this test is failing, you haven't broken anything (unless the decoding is failing),
 	// but meta cache probably needs to be invalidated.
@@ -90,7 +90,7 @@ main();
 `
 
 	runTest := func(iteration int) {
-		_, root, err := ParseContents("cachetest.php", []byte(code), nil)
+		_, root, err := l.ParseContents("cachetest.php", []byte(code), nil)
 		if err != nil {
 			t.Fatalf("parse error: %v", err)
 		}
@@ -111,7 +111,7 @@ main();
 		//
 		// If cache encoding changes, there is a very high chance that
 		// encoded data lengh will change as well.
-		wantLen := 4031
+		wantLen := 5096
 		haveLen := buf.Len()
 		if haveLen != wantLen {
 			t.Errorf("cache len mismatch:\nhave: %d\nwant: %d", haveLen, wantLen)
@@ -120,7 +120,7 @@ main();
 		// 2. Check cache "strings" hash.
 		//
 		// It catches new fields in cached types, field renames and encoding of additional named attributes.
-		wantStrings := "0cf356617cd2000854fcb3e8aab4ff06ea8f775a61562f043716ead6083074d1140f4b57d2ce05037ea24117273252a03184ea7f0de788759a6921a8869c8b76"
+		wantStrings := "6cc2b56dcfdc4987ca618a68f594f10cd0f4059c848e524b0d74f76610971224e53924bc71941746379c81b4e80d77cf63ef45b6c00c281d4775523ada8c4dd6"
 		haveStrings := collectCacheStrings(buf.String())
 		if haveStrings != wantStrings {
 			t.Errorf("cache strings mismatch:\nhave: %q\nwant: %q", haveStrings, wantStrings)
@@ -0,0 +1,119 @@
+package linter
+
+import (
+	"sort"
+	"strings"
+)
+
+// ReportsComparison is the result of CompareReports.
+type ReportsComparison struct {
+	New        []*Report // Reports that are only in the new list
+	Fixed      []*Report // Reports that are only in the old list
+	Persisting []*Report // Reports of the new list that are also in the old list
+}
+
+// CheckCounts is the number of the compared reports of a check.
+type CheckCounts struct {
+	CheckName  string `json:"check_name"`
+	New        int    `json:"new"`
+	Fixed      int    `json:"fixed"`
+	Persisting int    `json:"persisting"`
+}
+
+// reportKey identifies a report regardless of its line number.
+type reportKey struct {
+	filename  string
+	checkName string
+	context   string
+}
+
+// CompareReports matches the reports of two versions of the code by their
+// filename, check name and context line without the surrounding whitespace,
+// so reports are matched even if the code around them is edited.
+// renames maps the old versions filenames to the new ones.
+//
+// If there are several equal reports, they are matched in the line order,
+// so the last ones are new or fixed.
+func CompareReports(oldList, newList []*Report, renames map[string]string) ReportsComparison {
+	oldByKey := make(map[reportKey][]*Report)
+	for _, r := range sortedByLine(oldList) {
+		k := r.compareKey()
+		if newName, ok := renames[k.filename]; ok {
+			k.filename = newName
+		}
+		oldByKey[k] = append(oldByKey[k], r)
+	}
+
+	var res ReportsComparison
+	for _, r := range sortedByLine(newList) {
+		k := r.compareKey()
+		if old := oldByKey[k]; len(old) != 0 {
+			oldByKey[k] = old[1:]
+			res.Persisting = append(res.Persisting, r)
+		} else {
+			res.New = append(res.New, r)
+		}
+	}
+	for _, old := range oldByKey {
+		res.Fixed = append(res.Fixed, old...)
+	}
+	res.Fixed = sortedByLine(res.Fixed)
+	return res
+}
+
+func (r *Report) compareKey() reportKey {
+	return reportKey{
+		filename:  r.filename,
+		checkName: r.checkName,
+		context:   strings.TrimSpace(r.startLn),
+	}
+}
+
+// sortedByLine returns a copy of the list sorted by filename and position.
+func sortedByLine(list []*Report) []*Report {
+	res := make([]*Report, len(list))
+	copy(res, list)
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.filename != b.filename {
+			return a.filename < b.filename
+		}
+		if a.startLine != b.startLine {
+			return a.startLine < b.startLine
+		}
+		return a.startChar < b.startChar
+	})
+	return res
+}
+
+// CountByCheck returns the number of new, fixed and persisting reports per check,
+// sorted by the check name.
+func (c *ReportsComparison) CountByCheck() []CheckCounts {
+	counts := make(map[string]*CheckCounts)
+	get := func(r *Report) *CheckCounts {
+		cc, ok := counts[r.checkName]
+		if !ok {
+			cc = &CheckCounts{CheckName: r.checkName}
+			counts[r.checkName] = cc
+		}
+		return cc
+	}
+	for _, r := range c.New {
+		get(r).New++
+	}
+	for _, r := range c.Fixed {
+		get(r).Fixed++
+	}
+	for _, r := range c.Persisting {
+		get(r).Persisting++
+	}
+
+	res := make([]CheckCounts, 0, len(counts))
+	for _, cc := range counts {
+		res = append(res, *cc)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CheckName < res[j].CheckName
+	})
+	return res
+}
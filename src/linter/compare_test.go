@@ -0,0 +1,50 @@
+package linter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareReports(t *testing.T) {
+	report := func(filename string, line int, checkName, context string) *Report {
+		return &Report{filename: filename, startLine: line, checkName: checkName, startLn: context}
+	}
+
+	oldList := []*Report{
+		report("a.php", 10, "undefined", "  echo $x;"),
+		report("a.php", 20, "undefined", "echo $y;"),
+		report("a.php", 30, "unused", "$z = 1;"),
+		report("a.php", 40, "unused", "$z = 1;"),
+		report("old.php", 5, "arraySyntax", "$a = array();"),
+	}
+	newList := []*Report{
+		// Moved and re-indented.
+		report("a.php", 15, "undefined", "    echo $x;"),
+		report("a.php", 50, "unused", "$z = 1;"),
+		report("a.php", 60, "undefined", "echo $w;"),
+		// Renamed file.
+		report("new.php", 7, "arraySyntax", "$a = array();"),
+		// Same context in the other file.
+		report("b.php", 1, "undefined", "echo $y;"),
+	}
+
+	have := CompareReports(oldList, newList, map[string]string{"old.php": "new.php"})
+	// Lists are sorted by filename and line.
+	want := ReportsComparison{
+		New:        []*Report{newList[2], newList[4]},
+		Fixed:      []*Report{oldList[1], oldList[3]},
+		Persisting: []*Report{newList[0], newList[1], newList[3]},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("comparison mismatch:\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	wantCounts := []CheckCounts{
+		{CheckName: "arraySyntax", Persisting: 1},
+		{CheckName: "undefined", New: 2, Fixed: 1, Persisting: 1},
+		{CheckName: "unused", Fixed: 1, Persisting: 1},
+	}
+	if counts := have.CountByCheck(); !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("counts mismatch:\nhave: %+v\nwant: %+v", counts, wantCounts)
+	}
+}
@@ -10,12 +10,26 @@ import (
 	"github.com/client9/misspell"
 )
 
-var (
+// Config describes the linter settings.
+// Every Linter has its own Config, see NewLinter.
+//
+// Config should not be changed after the linter has started to parse files.
+type Config struct {
 	// LangServer represents whether or not we run in a language server mode.
 	LangServer bool
 
 	CacheDir string
 
+	// ReportCache enables the reports caching inside CacheDir.
+	// Reports of the file are reused if neither the file nor the symbols
+	// it depends on were changed since the previous run.
+	ReportCache bool
+
+	// ReportCacheSalt is mixed into the report cache keys.
+	// It should describe everything that affects the reports besides
+	// the analyzed code: the enabled checks, dynamic rules and so on.
+	ReportCacheSalt string
+
 	// TypoFixer is a rule set for English typos correction.
 	// If nil, no misspell checking is performed.
 	// See github.com/client9/misspell for details.
@@ -25,17 +39,24 @@ var (
 	AnalysisFiles []string
 
 	// SrcInput implements source code reading from files and buffers.
-	//
-	// TODO(quasilyte): avoid having it as a global variable?
-	SrcInput = inputs.NewDefaultSourceInput()
+	SrcInput inputs.SourceInput
 
 	// Rules is a set of dynamically loaded linter diagnostics.
-	Rules = &rules.Set{}
+	Rules *rules.Set
+
+	// RuleMatchHook is called for every dynamic rule match that passed the filters.
+	// It's called concurrently from several goroutines.
+	// If nil, no hook is called.
+	RuleMatchHook func(m *RuleMatch)
+
+	// RulesProfile enables the dynamic rules statistics collection.
+	// See Linter.GetRulesProfile.
+	RulesProfile bool
 
 	// settings
 	StubsDir        string
 	Debug           bool
-	MaxConcurrency  = runtime.NumCPU()
+	MaxConcurrency  int
 	MaxFileSize     int
 	DefaultEncoding string
 	PHPExtensions   []string
@@ -45,11 +66,17 @@ var (
 
 	CheckAutoGenerated bool
 
-	IsDiscardVar = isUnderscore
+	IsDiscardVar func(string) bool
 
 	ExcludeRegex *regexp.Regexp
+}
 
-	// actually time.Duration
-	initParseTime int64
-	initWalkTime  int64
-)
+// NewConfig returns the config with the default settings.
+func NewConfig() *Config {
+	return &Config{
+		SrcInput:       inputs.NewDefaultSourceInput(),
+		Rules:          &rules.Set{},
+		MaxConcurrency: runtime.NumCPU(),
+		IsDiscardVar:   isUnderscore,
+	}
+}
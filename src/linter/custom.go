@@ -9,6 +9,7 @@ import (
 	"github.com/VKCOM/noverify/src/meta"
 	"github.com/VKCOM/noverify/src/php/parser/node"
 	"github.com/VKCOM/noverify/src/php/parser/walker"
+	"github.com/VKCOM/noverify/src/rules"
 	"github.com/VKCOM/noverify/src/vscode"
 )
 
@@ -55,6 +56,34 @@ type CheckInfo struct {
 	// Comment is a short summary of what this diagnostic does.
 	// A single descriptive sentence is a perfect format for it.
 	Comment string
+
+	// Before is an optional PHP code example that triggers this diagnostic.
+	Before string
+
+	// After is an optional Before example rewritten in a way
+	// that doesn't trigger this diagnostic.
+	After string
+}
+
+// RuleMatch describes a dynamic rule match.
+//
+// See RuleMatchHook.
+type RuleMatch struct {
+	Rule     *rules.Rule
+	Filename string
+	Line     int
+
+	// Text is a matched node source text.
+	Text string
+
+	// Captures are named phpgrep matches, in order of appearance.
+	Captures []RuleCapture
+}
+
+// RuleCapture is a named phpgrep match.
+type RuleCapture struct {
+	Name string
+	Text string
 }
 
 // BlockChecker is a custom linter that is called on block level
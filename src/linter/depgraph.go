@@ -0,0 +1,426 @@
+package linter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/php/parser/freefloating"
+	"github.com/VKCOM/noverify/src/php/parser/node"
+	"github.com/VKCOM/noverify/src/php/parser/node/name"
+	"github.com/VKCOM/noverify/src/php/parser/node/stmt"
+	"github.com/VKCOM/noverify/src/php/parser/walker"
+	"github.com/VKCOM/noverify/src/solver"
+	"github.com/VKCOM/noverify/src/state"
+)
+
+// globalsRefName is a reference name for the global scope variables.
+const globalsRefName = "$globals"
+
+var (
+	// symbolNameRegexp matches the fully qualified names inside
+	// the formatted meta info, including the lazy type strings.
+	symbolNameRegexp = regexp.MustCompile(`\\[A-Za-z_][\w\\]*`)
+
+	// phpdocTypeRegexp matches the phpdoc tag type expressions.
+	phpdocTypeRegexp = regexp.MustCompile(`@[\w-]+\s+([^\s$]+)`)
+
+	// phpdocNameRegexp matches the class names inside phpdoc type expressions.
+	phpdocNameRegexp = regexp.MustCompile(`\\?[A-Za-z_][\w\\]*`)
+)
+
+// depGraph is a reverse dependency graph: it maps the symbol names
+// to the files that reference them.
+//
+// It's updated along with the meta info, so it covers all indexed files.
+// Names are lowercased as class and function names are case-insensitive.
+type depGraph struct {
+	sync.Mutex
+	fileRefs map[string][]string
+	users    map[string]map[string]struct{}
+}
+
+// setFileRefs replaces the file references in the dependency graph.
+func (l *Linter) setFileRefs(filename string, refs []string) {
+	l.depGraph.Lock()
+	defer l.depGraph.Unlock()
+
+	for _, nm := range l.depGraph.fileRefs[filename] {
+		delete(l.depGraph.users[nm], filename)
+	}
+	lowered := make([]string, len(refs))
+	for i, nm := range refs {
+		nm = strings.ToLower(nm)
+		lowered[i] = nm
+		users := l.depGraph.users[nm]
+		if users == nil {
+			users = make(map[string]struct{})
+			l.depGraph.users[nm] = users
+		}
+		users[filename] = struct{}{}
+	}
+	l.depGraph.fileRefs[filename] = lowered
+}
+
+// FileRefs returns the lowercased names of the classes, functions and constants
+// the file references or defines. Methods and properties are tracked through their classes.
+func (l *Linter) FileRefs(filename string) []string {
+	l.depGraph.Lock()
+	defer l.depGraph.Unlock()
+	return append([]string(nil), l.depGraph.fileRefs[filename]...)
+}
+
+// DependentFiles returns the sorted list of indexed files that can get
+// different reports after the given symbols change.
+//
+// These are the files that reference the symbols and, transitively, the files
+// that reference the symbols whose meta info mentions them, like child
+// classes or functions that return the changed class.
+// See ChangedSymbols for the way to get the changed symbols list.
+func (l *Linter) DependentFiles(symbols []string) []string {
+	l.info.Lock()
+	defer l.info.Unlock()
+	l.depGraph.Lock()
+	defer l.depGraph.Unlock()
+
+	visited := make(map[string]bool, len(symbols))
+	queue := make([]string, 0, len(symbols))
+	for _, nm := range symbols {
+		nm = strings.ToLower(nm)
+		if !visited[nm] {
+			visited[nm] = true
+			queue = append(queue, nm)
+		}
+	}
+
+	files := make(map[string]bool)
+	fileDefs := make(map[string]map[string][]string)
+	for len(queue) != 0 {
+		nm := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		for filename := range l.depGraph.users[nm] {
+			if !l.info.FileExists(filename) {
+				continue // Removed since the graph was updated
+			}
+			files[filename] = true
+
+			defs, ok := fileDefs[filename]
+			if !ok {
+				defs = symbolRefsByName(l.info.GetMetaForFile(filename))
+				fileDefs[filename] = defs
+			}
+			for def, refs := range defs {
+				if visited[def] {
+					continue
+				}
+				for _, ref := range refs {
+					if ref == nm {
+						visited[def] = true
+						queue = append(queue, def)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	list := make([]string, 0, len(files))
+	for filename := range files {
+		list = append(list, filename)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// ChangedSymbols returns the sorted lowercased names of the symbols that are added,
+// removed or changed between the old and new meta info of the files.
+//
+// Symbol positions are not compared, so the code that only moved
+// inside the file doesn't make its users dependent.
+func ChangedSymbols(old, new []meta.PerFile) []string {
+	oldSigs := symbolSignatures(old)
+	newSigs := symbolSignatures(new)
+
+	var changed []string
+	for nm, sig := range oldSigs {
+		if newSigs[nm] != sig {
+			changed = append(changed, nm)
+		}
+	}
+	for nm := range newSigs {
+		if _, ok := oldSigs[nm]; !ok {
+			changed = append(changed, nm)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// ParseFileMeta parses the file and returns its meta info without updating the linter meta info.
+// It's used to compare the meta info of the file versions with ChangedSymbols.
+// Must be called when the indexing is not complete.
+func (l *Linter) ParseFileMeta(filename string, contents []byte) (meta.PerFile, error) {
+	_, w, err := l.ParseContents(filename, contents, nil)
+	if w == nil {
+		return meta.PerFile{}, err
+	}
+	m := meta.PerFile{
+		Traits:            w.meta.Traits,
+		Classes:           w.meta.Classes,
+		Functions:         w.meta.Functions,
+		Constants:         w.meta.Constants,
+		FunctionOverrides: w.meta.FunctionOverrides,
+		Scope:             w.meta.Scope,
+	}
+	return m, err
+}
+
+// symbolSignatures formats the symbols meta info without their positions.
+func symbolSignatures(list []meta.PerFile) map[string]string {
+	sigs := make(map[string]string)
+	add := func(nm, sig string) {
+		nm = strings.ToLower(nm)
+		// The symbol can be defined in several files.
+		sigs[nm] += sig
+	}
+	for _, m := range list {
+		for _, class := range m.Classes.H {
+			add(class.Name, classSignature(class))
+		}
+		for _, trait := range m.Traits.H {
+			add(trait.Name, classSignature(trait))
+		}
+		for _, fn := range m.Functions.H {
+			add(fn.Name, funcSignature(fn))
+		}
+		for nm, c := range m.Constants {
+			c.Pos = meta.ElementPosition{}
+			add(nm, fmt.Sprintf("%v\n", c))
+		}
+		for nm, o := range m.FunctionOverrides {
+			add(nm, fmt.Sprintf("override %v\n", o))
+		}
+		if m.Scope != nil {
+			add(globalsRefName, scopeSignature(m.Scope))
+		}
+	}
+	return sigs
+}
+
+// scopeSignature formats the global scope variables, see reportDepInfo.
+func scopeSignature(sc *meta.Scope) string {
+	var vars []string
+	sc.Iterate(func(varName string, typ meta.TypesMap, flags meta.VarFlags) {
+		vars = append(vars, fmt.Sprintf("%s %v %v\n", varName, typ, flags))
+	})
+	sort.Strings(vars)
+	return strings.Join(vars, "")
+}
+
+func funcSignature(fn meta.FuncInfo) string {
+	fn.Pos = meta.ElementPosition{}
+	// Results of the inference are not a part of the signature,
+	// they are recomputed after the changes.
+	fn.Flags &^= meta.FuncImpureDeps
+	fn.Throws = nil
+	return fmt.Sprintf("%v\n", fn)
+}
+
+func classSignature(class meta.ClassInfo) string {
+	var members []string
+	for _, fn := range class.Methods.H {
+		members = append(members, "method "+funcSignature(fn))
+	}
+	for nm, p := range class.Properties {
+		p.Pos = meta.ElementPosition{}
+		members = append(members, fmt.Sprintf("property %s %v\n", nm, p))
+	}
+	for nm, c := range class.Constants {
+		c.Pos = meta.ElementPosition{}
+		members = append(members, fmt.Sprintf("constant %s %v\n", nm, c))
+	}
+	sort.Strings(members)
+
+	class.Pos = meta.ElementPosition{}
+	class.Methods = meta.FunctionsMap{}
+	class.Properties = nil
+	class.Constants = nil
+	return fmt.Sprintf("%v\n", class) + strings.Join(members, "")
+}
+
+// symbolRefsByName returns the lowercased names that are mentioned
+// in the meta info of every symbol defined in the file.
+func symbolRefsByName(m meta.PerFile) map[string][]string {
+	refs := make(map[string][]string)
+	add := func(nm string, info interface{}) {
+		names := symbolNameRegexp.FindAllString(fmt.Sprintf("%v", info), -1)
+		for i := range names {
+			names[i] = strings.ToLower(names[i])
+		}
+		nm = strings.ToLower(nm)
+		refs[nm] = append(refs[nm], names...)
+	}
+	for _, class := range m.Classes.H {
+		add(class.Name, class)
+	}
+	for _, trait := range m.Traits.H {
+		add(trait.Name, trait)
+	}
+	for _, fn := range m.Functions.H {
+		add(fn.Name, fn)
+	}
+	for nm, c := range m.Constants {
+		add(nm, c)
+	}
+	return refs
+}
+
+// collectFileRefs returns the sorted names of the symbols the file references or defines.
+//
+// These are the class, function and constant names that are used
+// in the file code and phpdoc comments. As the name resolution
+// depends on the meta info, every possible resolution is included.
+func collectFileRefs(filename string, rootNode node.Node, m *fileMeta) []string {
+	c := &fileRefsCollector{
+		st:    &meta.ClassParseState{CurrentFile: filename},
+		names: make(map[string]bool),
+	}
+	if rootNode != nil {
+		rootNode.Walk(c)
+	}
+
+	// The symbols defined in the file can conflict with the other definitions.
+	for _, class := range m.Classes.H {
+		c.addName(class.Name)
+	}
+	for _, trait := range m.Traits.H {
+		c.addName(trait.Name)
+	}
+	for _, fn := range m.Functions.H {
+		c.addName(fn.Name)
+	}
+	for nm := range m.Constants {
+		c.addName(nm)
+	}
+	for nm := range m.FunctionOverrides {
+		c.addName(nm)
+	}
+
+	refs := make([]string, 0, len(c.names))
+	for nm := range c.names {
+		refs = append(refs, nm)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// fileRefsCollector collects the names that can be resolved by the linter
+// during the file analysis.
+type fileRefsCollector struct {
+	st    *meta.ClassParseState
+	names map[string]bool
+}
+
+func (c *fileRefsCollector) addName(nm string) {
+	if nm != "" {
+		c.names[nm] = true
+	}
+}
+
+func (c *fileRefsCollector) EnterNode(w walker.Walkable) bool {
+	state.EnterNode(c.st, w)
+
+	n, ok := w.(node.Node)
+	if !ok {
+		return true
+	}
+
+	if ffs := n.GetFreeFloating(); ffs != nil {
+		for _, cs := range *ffs {
+			for _, comment := range cs {
+				if comment.StringType == freefloating.CommentType {
+					c.addPhpdocNames(comment.Value)
+				}
+			}
+		}
+	}
+
+	switch n := n.(type) {
+	case *node.Root:
+		for _, s := range n.Stmts {
+			if !isDeclarationStmt(s) {
+				// Root-level code can use the global variables from other files.
+				c.addName(globalsRefName)
+				break
+			}
+		}
+	case *name.FullyQualified:
+		c.addName(meta.FullyQualifiedToString(n))
+	case *name.Name:
+		if className, ok := solver.GetClassName(c.st, n); ok {
+			c.addName(className)
+		}
+		nameStr := meta.NameToString(n)
+		firstPart := n.Parts[0].(*name.NamePart).Value
+		if alias, ok := c.st.FunctionUses[firstPart]; ok {
+			if len(n.Parts) == 1 {
+				c.addName(alias)
+			} else {
+				c.addName(alias + `\` + meta.NamePartsToString(n.Parts[1:]))
+			}
+		}
+		c.addName(c.st.Namespace + `\` + nameStr)
+		c.addName(`\` + nameStr)
+	}
+
+	return true
+}
+
+func (c *fileRefsCollector) LeaveNode(w walker.Walkable) {
+	state.LeaveNode(c.st, w)
+}
+
+// addPhpdocNames adds the class names from the phpdoc tag types of the comment.
+func (c *fileRefsCollector) addPhpdocNames(comment string) {
+	if !strings.HasPrefix(comment, "/**") {
+		return
+	}
+	for _, m := range phpdocTypeRegexp.FindAllStringSubmatch(comment, -1) {
+		for _, typ := range phpdocNameRegexp.FindAllString(m[1], -1) {
+			if strings.HasPrefix(typ, `\`) {
+				c.addName(typ)
+				continue
+			}
+			parts := strings.Split(strings.TrimSuffix(typ, `\`), `\`)
+			nm := &name.Name{Parts: make([]node.Node, len(parts))}
+			for i, p := range parts {
+				nm.Parts[i] = &name.NamePart{Value: p}
+			}
+			if className, ok := solver.GetClassName(c.st, nm); ok {
+				c.addName(className)
+			}
+		}
+	}
+}
+
+// isDeclarationStmt reports whether s only declares the symbols and doesn't execute any code.
+func isDeclarationStmt(s node.Node) bool {
+	switch s := s.(type) {
+	case *stmt.Namespace:
+		for _, s := range s.Stmts {
+			if !isDeclarationStmt(s) {
+				return false
+			}
+		}
+		return true
+	case *stmt.UseList, *stmt.GroupUse, *stmt.Nop, *stmt.InlineHtml,
+		*stmt.Function, *stmt.Class, *stmt.Interface, *stmt.Trait, *stmt.ConstList:
+		return true
+	default:
+		return false
+	}
+}
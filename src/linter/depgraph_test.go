@@ -0,0 +1,154 @@
+package linter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+func TestDependentFiles(t *testing.T) {
+	l := NewLinter(nil)
+
+	files := map[string]string{
+		"/base.php": `<?php
+class Base {
+  public function foo() { return 1; }
+}`,
+		"/child.php": `<?php
+class Child extends Base {}`,
+		"/user.php": `<?php
+function useChild() {
+  $c = new Child();
+  return $c->foo();
+}`,
+		"/factory.php": `<?php
+namespace NS;
+/** @return \Base */
+function makeBase() { return null; }`,
+		"/factory_user.php": `<?php
+use function NS\makeBase;
+function useFactory() {
+  return makeBase()->foo();
+}`,
+		"/other.php": `<?php
+function other() { return 1; }`,
+	}
+
+	l.ParseFilenames(func(ch chan FileInfo) {
+		for filename, contents := range files {
+			ch <- FileInfo{Filename: filename, Contents: []byte(contents)}
+		}
+	})
+
+	if refs := l.FileRefs("/user.php"); !stringsContain(refs, `\child`) || !stringsContain(refs, `\usechild`) {
+		t.Errorf("user.php refs mismatch: %q", refs)
+	}
+
+	parseMeta := func(filename, contents string) meta.PerFile {
+		t.Helper()
+		m, err := l.ParseFileMeta(filename, []byte(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	info := l.MetaInfo()
+	info.Lock()
+	oldBase := info.GetMetaForFile("/base.php")
+	info.Unlock()
+
+	// Moved code is not a change.
+	moved := parseMeta("/base.php", `<?php
+
+class Base {
+
+  public function foo() { return 1; }
+}`)
+	if changed := ChangedSymbols([]meta.PerFile{oldBase}, []meta.PerFile{moved}); len(changed) != 0 {
+		t.Errorf("unexpected changed symbols: %q", changed)
+	}
+
+	renamed := parseMeta("/base.php", `<?php
+class Base {
+  public function bar() { return 1; }
+}
+function added() {}`)
+	changed := ChangedSymbols([]meta.PerFile{oldBase}, []meta.PerFile{renamed})
+	if want := []string{`\added`, `\base`}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed symbols mismatch:\nhave: %q\nwant: %q", changed, want)
+	}
+
+	have := l.DependentFiles(changed)
+	want := []string{"/base.php", "/child.php", "/factory.php", "/factory_user.php", "/user.php"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("dependent files mismatch:\nhave: %q\nwant: %q", have, want)
+	}
+
+	have = l.DependentFiles([]string{`\Other`})
+	want = []string{"/other.php"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("dependent files mismatch:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestChangedGlobalsAndOverrides(t *testing.T) {
+	l := NewLinter(nil)
+
+	files := map[string]string{
+		"/config.php": `<?php
+$config = 1;`,
+		"/script.php": `<?php
+echo $config;`,
+		"/meta.php": `<?php
+namespace PHPSTORM_META;
+override(\get(0), type(0));`,
+		"/lib.php": `<?php
+function get($x) { return $x; }`,
+	}
+
+	l.ParseFilenames(func(ch chan FileInfo) {
+		for filename, contents := range files {
+			ch <- FileInfo{Filename: filename, Contents: []byte(contents)}
+		}
+	})
+
+	changedSymbols := func(filename, contents string) []string {
+		t.Helper()
+		info := l.MetaInfo()
+		info.Lock()
+		old := info.GetMetaForFile(filename)
+		info.Unlock()
+		m, err := l.ParseFileMeta(filename, []byte(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ChangedSymbols([]meta.PerFile{old}, []meta.PerFile{m})
+	}
+
+	if changed := changedSymbols("/config.php", "<?php\n\n$config = 2;"); len(changed) != 0 {
+		t.Errorf("unexpected changed symbols: %q", changed)
+	}
+
+	changed := changedSymbols("/config.php", "<?php\n$config = 'a';")
+	if want := []string{globalsRefName}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed symbols mismatch:\nhave: %q\nwant: %q", changed, want)
+	}
+	if have := l.DependentFiles(changed); !stringsContain(have, "/script.php") {
+		t.Errorf("script.php is not dependent on the global variables: %q", have)
+	}
+
+	changed = changedSymbols("/meta.php", "<?php\nnamespace PHPSTORM_META;\noverride(\\get(0), elementType(0));")
+	if want := []string{`\get`}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed symbols mismatch:\nhave: %q\nwant: %q", changed, want)
+	}
+}
+
+func stringsContain(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,549 @@
+package linter
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// IndexCacheFilename is a name of the packed index cache file inside Config.CacheDir.
+//
+// The pack stores the encoded meta info of every indexed file,
+// keyed by the file name and its contents hash.
+//
+// Pack format (all integers are little-endian uint32):
+//
+//	"NVPK" magic
+//	cacheVersion
+//	number of entries
+//	entries: filename length, filename, md5 hash, data length, data
+//
+// The pack is never modified in place: it's rewritten into a temporary
+// file that replaces the old pack, so several linter processes can use it concurrently.
+// Writers hold the lock file while they merge their entries into the current pack.
+const IndexCacheFilename = "index.pack"
+
+// indexPackLockTimeout is how long a writer waits for the pack lock.
+// Locks that are older than indexPackLockStale are left by the crashed processes.
+const (
+	indexPackLockTimeout = 30 * time.Second
+	indexPackLockStale   = 5 * time.Minute
+)
+
+var indexPackMagic = [4]byte{'N', 'V', 'P', 'K'}
+
+var errIndexPackCorrupted = errors.New("index cache pack is corrupted")
+
+type indexPackRecord struct {
+	filename string
+	hash     [md5.Size]byte
+	data     []byte
+}
+
+// indexPack is a loaded pack file.
+// It's unmapped when it's replaced and no reader holds its data.
+type indexPack struct {
+	data  []byte
+	refs  int
+	stale bool
+}
+
+func (p *indexPack) unmapIfUnused() {
+	if p.stale && p.refs == 0 && p.data != nil {
+		munmapFile(p.data)
+		p.data = nil
+	}
+}
+
+// indexCacheEntry is a pack entry of the loaded index cache.
+// Entries added during this run are kept in the spool file until the pack is rewritten.
+type indexCacheEntry struct {
+	hash     [md5.Size]byte
+	data     []byte // Points into the mapped pack, nil for the spooled entries
+	spoolOff int64
+	size     int
+}
+
+type indexCache struct {
+	sync.Mutex
+
+	// dir is a CacheDir the entries were loaded from.
+	dir     string
+	loaded  bool
+	pack    *indexPack
+	entries map[string][]indexCacheEntry
+
+	// changed records the files which entries were added or removed since the load.
+	// Entries of the other files are taken from the current pack when it's rewritten.
+	changed map[string]bool
+
+	// seen records the contents hashes that were requested since the last flush.
+	// Other hashes of these files are stale and are removed when the pack is rewritten.
+	seen map[string]map[[md5.Size]byte]bool
+
+	dirty bool
+	spool *os.File
+}
+
+// indexCacheLoadLocked makes sure that the index cache is loaded from the current CacheDir.
+// Read errors are not fatal: the cache is treated as empty and then rewritten.
+func (l *Linter) indexCacheLoadLocked() {
+	if l.indexCache.loaded && l.indexCache.dir == l.config.CacheDir {
+		return
+	}
+	l.indexCacheResetLocked()
+	l.indexCache.dir = l.config.CacheDir
+	l.indexCache.loaded = true
+
+	pack, records, err := loadIndexPack(filepath.Join(l.config.CacheDir, IndexCacheFilename))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.DebugMessage("load index cache: %v", err)
+			l.indexCache.dirty = true
+		}
+		return
+	}
+	l.indexCache.pack = pack
+	for _, r := range records {
+		l.indexCache.entries[r.filename] = append(l.indexCache.entries[r.filename], indexCacheEntry{
+			hash: r.hash,
+			data: r.data,
+			size: len(r.data),
+		})
+	}
+}
+
+func (l *Linter) indexCacheResetLocked() {
+	if l.indexCache.spool != nil {
+		l.indexCache.spool.Close()
+		os.Remove(l.indexCache.spool.Name())
+	}
+	if l.indexCache.pack != nil {
+		l.indexCache.pack.stale = true
+		l.indexCache.pack.unmapIfUnused()
+	}
+	l.indexCache.dir = ""
+	l.indexCache.loaded = false
+	l.indexCache.pack = nil
+	l.indexCache.entries = make(map[string][]indexCacheEntry)
+	l.indexCache.changed = make(map[string]bool)
+	l.indexCache.seen = make(map[string]map[[md5.Size]byte]bool)
+	l.indexCache.dirty = false
+	l.indexCache.spool = nil
+}
+
+// indexCacheGet returns the cached meta info of the file with the given contents hash.
+// The data can point into the mapped pack, release should be called when it's not used anymore.
+func (l *Linter) indexCacheGet(filename string, hash [md5.Size]byte) (data []byte, release func(), ok bool) {
+	l.indexCache.Lock()
+	defer l.indexCache.Unlock()
+
+	l.indexCacheLoadLocked()
+
+	seen := l.indexCache.seen[filename]
+	if seen == nil {
+		seen = make(map[[md5.Size]byte]bool)
+		l.indexCache.seen[filename] = seen
+	}
+	seen[hash] = true
+
+	for _, e := range l.indexCache.entries[filename] {
+		if e.hash != hash {
+			continue
+		}
+		data, err := l.indexCacheReadLocked(e)
+		if err != nil {
+			l.DebugMessage("read index cache entry for %s: %v", filename, err)
+			return nil, nil, false
+		}
+		if e.data == nil {
+			return data, func() {}, true
+		}
+		pack := l.indexCache.pack
+		pack.refs++
+		release = func() {
+			l.indexCache.Lock()
+			defer l.indexCache.Unlock()
+			pack.refs--
+			pack.unmapIfUnused()
+		}
+		return data, release, true
+	}
+	return nil, nil, false
+}
+
+func (l *Linter) indexCacheReadLocked(e indexCacheEntry) ([]byte, error) {
+	if e.data != nil || e.size == 0 {
+		return e.data, nil
+	}
+	data := make([]byte, e.size)
+	_, err := l.indexCache.spool.ReadAt(data, e.spoolOff)
+	return data, err
+}
+
+// indexCachePut adds the file meta info to the index cache.
+// It replaces the entry with the same hash, if any.
+func (l *Linter) indexCachePut(filename string, hash [md5.Size]byte, data []byte) error {
+	l.indexCache.Lock()
+	defer l.indexCache.Unlock()
+
+	l.indexCacheLoadLocked()
+
+	if l.indexCache.spool == nil {
+		if err := os.MkdirAll(l.config.CacheDir, 0777); err != nil {
+			return err
+		}
+		spool, err := ioutil.TempFile(l.config.CacheDir, IndexCacheFilename+".spool")
+		if err != nil {
+			return err
+		}
+		l.indexCache.spool = spool
+	}
+	off, err := l.indexCache.spool.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := l.indexCache.spool.Write(data); err != nil {
+		return err
+	}
+
+	l.indexCacheDeleteLocked(filename, hash)
+	l.indexCache.entries[filename] = append(l.indexCache.entries[filename], indexCacheEntry{
+		hash:     hash,
+		spoolOff: off,
+		size:     len(data),
+	})
+	l.indexCache.changed[filename] = true
+	l.indexCache.dirty = true
+	return nil
+}
+
+// indexCacheDelete removes the broken entry from the index cache.
+func (l *Linter) indexCacheDelete(filename string, hash [md5.Size]byte) {
+	l.indexCache.Lock()
+	defer l.indexCache.Unlock()
+
+	l.indexCacheDeleteLocked(filename, hash)
+}
+
+func (l *Linter) indexCacheDeleteLocked(filename string, hash [md5.Size]byte) {
+	list := l.indexCache.entries[filename]
+	for i, e := range list {
+		if e.hash == hash {
+			l.indexCache.entries[filename] = append(list[:i:i], list[i+1:]...)
+			l.indexCache.changed[filename] = true
+			l.indexCache.dirty = true
+			return
+		}
+	}
+}
+
+// FlushIndexCache writes the index cache entries that were added since
+// the last flush to the pack inside CacheDir.
+//
+// The entries of the files that were indexed since the last flush
+// are removed unless their contents hash was requested.
+// It's called by ParseFilenames after the indexing.
+//
+// The entries are merged with the pack written by the other processes
+// since the load: the entries of the files that were changed by this
+// process replace the pack ones, the other files are left as is.
+func (l *Linter) FlushIndexCache() error {
+	l.indexCache.Lock()
+	defer l.indexCache.Unlock()
+
+	if !l.indexCache.loaded || l.indexCache.dir != l.config.CacheDir {
+		return nil
+	}
+
+	for filename, hashes := range l.indexCache.seen {
+		list := l.indexCache.entries[filename]
+		live := list[:0]
+		for _, e := range list {
+			if hashes[e.hash] {
+				live = append(live, e)
+			}
+		}
+		if len(live) != len(list) {
+			l.indexCache.entries[filename] = live
+			l.indexCache.changed[filename] = true
+			l.indexCache.dirty = true
+		}
+	}
+	l.indexCache.seen = make(map[string]map[[md5.Size]byte]bool)
+	if !l.indexCache.dirty {
+		return nil
+	}
+
+	packFile := filepath.Join(l.config.CacheDir, IndexCacheFilename)
+	unlock, err := lockIndexPack(l.config.CacheDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// A missing or invalid pack is replaced with the entries of this process.
+	current, records, err := loadIndexPack(packFile)
+	if err == nil {
+		defer func() {
+			current.stale = true
+			current.unmapIfUnused()
+		}()
+	}
+
+	w, err := createIndexPack(l.config.CacheDir)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if l.indexCache.changed[r.filename] {
+			continue
+		}
+		if err := w.add(r.filename, r.hash, r.data); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	for filename, list := range l.indexCache.entries {
+		if current != nil && !l.indexCache.changed[filename] {
+			// Taken from the current pack.
+			continue
+		}
+		for _, e := range list {
+			data, err := l.indexCacheReadLocked(e)
+			if err != nil {
+				w.abort()
+				return err
+			}
+			if err := w.add(filename, e.hash, data); err != nil {
+				w.abort()
+				return err
+			}
+		}
+	}
+	if err := w.commit(packFile); err != nil {
+		return err
+	}
+
+	// Reload the entries from the new pack to release the spool.
+	l.indexCacheResetLocked()
+	l.indexCacheLoadLocked()
+	return nil
+}
+
+// loadIndexPack maps the pack file into memory and decodes it.
+// Records data points into the returned pack.
+func loadIndexPack(packFile string) (*indexPack, []indexPackRecord, error) {
+	fp, err := os.Open(packFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fp.Close()
+
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := mmapFile(fp, int(info.Size()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version, records, err := decodeIndexPack(data)
+	if err == nil && version != cacheVersion {
+		err = errWrongVersion
+	}
+	if err != nil {
+		munmapFile(data)
+		return nil, nil, err
+	}
+	return &indexPack{data: data}, records, nil
+}
+
+// lockIndexPack creates the pack lock file inside the dir, waiting
+// for the other processes to remove it. The returned function removes it.
+func lockIndexPack(dir string) (unlock func(), err error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	lockFile := filepath.Join(dir, IndexCacheFilename+".lock")
+	start := time.Now()
+	for {
+		fp, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			fp.Close()
+			return func() { os.Remove(lockFile) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockFile); err == nil && time.Since(info.ModTime()) > indexPackLockStale {
+			os.Remove(lockFile)
+			continue
+		}
+		if time.Since(start) > indexPackLockTimeout {
+			return nil, fmt.Errorf("%s is held by another process", lockFile)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// decodeIndexPack returns the pack version and its records.
+// Records data points into the data slice.
+func decodeIndexPack(data []byte) (version uint32, records []indexPackRecord, err error) {
+	readUint32 := func() (uint32, bool) {
+		if len(data) < 4 {
+			return 0, false
+		}
+		v := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		return v, true
+	}
+	readBytes := func(n uint32) ([]byte, bool) {
+		if uint32(len(data)) < n {
+			return nil, false
+		}
+		b := data[:n:n]
+		data = data[n:]
+		return b, true
+	}
+
+	magic, ok := readBytes(uint32(len(indexPackMagic)))
+	if !ok || string(magic) != string(indexPackMagic[:]) {
+		return 0, nil, errIndexPackCorrupted
+	}
+	version, ok = readUint32()
+	if !ok {
+		return 0, nil, errIndexPackCorrupted
+	}
+	if version != cacheVersion {
+		// Don't try to decode the packs of other versions.
+		return version, nil, nil
+	}
+	count, ok := readUint32()
+	if !ok {
+		return 0, nil, errIndexPackCorrupted
+	}
+
+	records = make([]indexPackRecord, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var r indexPackRecord
+		n, ok := readUint32()
+		if !ok {
+			return 0, nil, errIndexPackCorrupted
+		}
+		filename, ok := readBytes(n)
+		if !ok {
+			return 0, nil, errIndexPackCorrupted
+		}
+		hash, ok := readBytes(md5.Size)
+		if !ok {
+			return 0, nil, errIndexPackCorrupted
+		}
+		n, ok = readUint32()
+		if !ok {
+			return 0, nil, errIndexPackCorrupted
+		}
+		r.data, ok = readBytes(n)
+		if !ok {
+			return 0, nil, errIndexPackCorrupted
+		}
+		r.filename = string(filename)
+		copy(r.hash[:], hash)
+		records = append(records, r)
+	}
+	if len(data) != 0 {
+		return 0, nil, errIndexPackCorrupted
+	}
+
+	return version, records, nil
+}
+
+// indexPackWriter writes a new pack into the temporary file
+// that replaces the pack on commit.
+type indexPackWriter struct {
+	fp    *os.File
+	wr    *bufio.Writer
+	count uint32
+	err   error
+}
+
+func createIndexPack(dir string) (*indexPackWriter, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	fp, err := ioutil.TempFile(dir, IndexCacheFilename+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := &indexPackWriter{fp: fp, wr: bufio.NewWriter(fp)}
+	w.write(indexPackMagic[:])
+	w.writeUint32(cacheVersion)
+	w.writeUint32(0) // Entries count, written on commit
+	return w, nil
+}
+
+func (w *indexPackWriter) write(b []byte) {
+	if w.err == nil {
+		_, w.err = w.wr.Write(b)
+	}
+}
+
+func (w *indexPackWriter) writeUint32(v uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	w.write(buf[:])
+}
+
+func (w *indexPackWriter) add(filename string, hash [md5.Size]byte, data []byte) error {
+	w.writeUint32(uint32(len(filename)))
+	w.write([]byte(filename))
+	w.write(hash[:])
+	w.writeUint32(uint32(len(data)))
+	w.write(data)
+	w.count++
+	return w.err
+}
+
+func (w *indexPackWriter) abort() {
+	w.fp.Close()
+	os.Remove(w.fp.Name())
+}
+
+func (w *indexPackWriter) commit(packFile string) error {
+	if w.err == nil {
+		w.err = w.wr.Flush()
+	}
+	if w.err == nil {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], w.count)
+		_, w.err = w.fp.WriteAt(buf[:], int64(len(indexPackMagic)+4))
+	}
+	if w.err != nil {
+		w.abort()
+		return fmt.Errorf("write %s: %v", w.fp.Name(), w.err)
+	}
+	if err := w.fp.Close(); err != nil {
+		os.Remove(w.fp.Name())
+		return err
+	}
+
+	// Windows clearly does not want to allow to replace existing files
+	if runtime.GOOS == "windows" {
+		os.Remove(packFile)
+	}
+	if err := os.Rename(w.fp.Name(), packFile); err != nil {
+		os.Remove(w.fp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package linter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexCache(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "noverify-index-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcDir := filepath.Join(tmpDir, "src")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	packFile := filepath.Join(cacheDir, IndexCacheFilename)
+	if err := os.Mkdir(srcDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewConfig()
+	config.CacheDir = cacheDir
+	config.PHPExtensions = []string{"php"}
+	l := NewLinter(config)
+
+	writeFile := func(name, contents string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(srcDir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := func(wantFunctions ...string) {
+		t.Helper()
+		l.MetaInfo().Reset()
+		l.ParseFilenames(l.ReadFilenames([]string{srcDir}, nil))
+		for _, fn := range wantFunctions {
+			if _, ok := l.MetaInfo().GetFunction(fn); !ok {
+				t.Errorf("function %s is not indexed", fn)
+			}
+		}
+	}
+	checkStats := func(wantEntries, wantStale int) {
+		t.Helper()
+		stats, err := GetCacheStats(cacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.IndexVersion != cacheVersion || stats.IndexEntries != wantEntries || stats.IndexStale != wantStale {
+			t.Errorf("stats mismatch: have version %d, %d entries, %d stale; want version %d, %d entries, %d stale",
+				stats.IndexVersion, stats.IndexEntries, stats.IndexStale, cacheVersion, wantEntries, wantStale)
+		}
+	}
+
+	writeFile("a.php", `<?php function f1() {}`)
+	index(`\f1`)
+	checkStats(1, 0)
+
+	// Nothing changed, so the pack is not rewritten.
+	pack, err := ioutil.ReadFile(packFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index(`\f1`)
+	if newPack, _ := ioutil.ReadFile(packFile); !bytes.Equal(pack, newPack) {
+		t.Errorf("unchanged pack was rewritten")
+	}
+
+	// The entry for the old file contents is replaced.
+	writeFile("a.php", `<?php function f2() {}`)
+	index(`\f2`)
+	checkStats(1, 0)
+
+	writeFile("b.php", `<?php function g() {}`)
+	index(`\f2`, `\g`)
+	checkStats(2, 0)
+
+	if err := os.Remove(filepath.Join(srcDir, "b.php")); err != nil {
+		t.Fatal(err)
+	}
+	checkStats(2, 1)
+	if _, err := PruneCache(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	checkStats(1, 0)
+
+	// Packs of the other versions are ignored and replaced.
+	pack, err = ioutil.ReadFile(packFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack[len(indexPackMagic)]++
+	if err := ioutil.WriteFile(packFile, pack, 0666); err != nil {
+		t.Fatal(err)
+	}
+	l.indexCache.Lock()
+	l.indexCache.loaded = false
+	l.indexCache.Unlock()
+	index(`\f2`)
+	checkStats(1, 0)
+
+	if err := ClearCache(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(packFile); !os.IsNotExist(err) {
+		t.Errorf("pack is not removed by ClearCache: %v", err)
+	}
+}
+
+func TestIndexCacheMerge(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "noverify-index-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cacheDir := filepath.Join(tmpDir, "cache")
+	newLinter := func(srcDir string, files map[string]string) (*Linter, []string) {
+		t.Helper()
+		dir := filepath.Join(tmpDir, srcDir)
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		config := NewConfig()
+		config.CacheDir = cacheDir
+		config.PHPExtensions = []string{"php"}
+		l := NewLinter(config)
+		// Both linters load the empty cache before the other one flushes.
+		l.indexCache.Lock()
+		l.indexCacheLoadLocked()
+		l.indexCache.Unlock()
+		return l, []string{dir}
+	}
+
+	l1, dirs1 := newLinter("src1", map[string]string{"a.php": `<?php function f() {}`})
+	l2, dirs2 := newLinter("src2", map[string]string{"b.php": `<?php function g() {}`})
+	l1.ParseFilenames(l1.ReadFilenames(dirs1, nil))
+	l2.ParseFilenames(l2.ReadFilenames(dirs2, nil))
+
+	stats, err := GetCacheStats(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.IndexEntries != 2 {
+		t.Errorf("expected the entries of both linters, have %d entries", stats.IndexEntries)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, IndexCacheFilename+".lock")); !os.IsNotExist(err) {
+		t.Errorf("pack lock is not removed: %v", err)
+	}
+}
+
+func TestIndexCacheUnmap(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "noverify-index-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := NewConfig()
+	config.CacheDir = tmpDir
+	l := NewLinter(config)
+
+	put := func(filename string) {
+		t.Helper()
+		if err := l.indexCachePut(filename, md5.Sum([]byte(filename)), []byte(filename)); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.FlushIndexCache(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put("a.php")
+	pack := l.indexCache.pack
+	data, release, ok := l.indexCacheGet("a.php", md5.Sum([]byte("a.php")))
+	if !ok {
+		t.Fatal("a.php entry is not found")
+	}
+
+	// The replaced pack is kept while its data is used.
+	put("b.php")
+	if pack.data == nil || string(data) != "a.php" {
+		t.Errorf("used pack is unmapped")
+	}
+	release()
+	if pack.data != nil {
+		t.Errorf("replaced pack is not unmapped after the release")
+	}
+
+	pack = l.indexCache.pack
+	put("c.php")
+	if pack.data != nil {
+		t.Errorf("unused replaced pack is not unmapped")
+	}
+}
@@ -0,0 +1,104 @@
+package linter
+
+import (
+	"sync"
+
+	"github.com/VKCOM/noverify/src/lintdebug"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// Linter holds the state of one linter instance: its config, meta info,
+// caches and statistics. Several linters can be used in one process.
+//
+// Custom checkers registered with RegisterBlockChecker, RegisterRootChecker
+// and DeclareCheck are shared between all linters.
+type Linter struct {
+	config *Config
+	info   *meta.Info
+
+	limiter memoryLimiter
+
+	indexCache   indexCache
+	depGraph     depGraph
+	reportDeps   reportDeps
+	rulesProfile rulesProfile
+	pathRules    pathRules
+
+	reportCacheHits   int64
+	reportCacheMisses int64
+
+	// actually time.Duration
+	initParseTime     int64
+	initWalkTime      int64
+	initFileReadTime  int64
+	initCacheReadTime int64
+}
+
+// NewLinter creates a linter with the given config and empty meta info.
+// If config is nil, the default config is used, see NewConfig.
+func NewLinter(config *Config) *Linter {
+	if config == nil {
+		config = NewConfig()
+	}
+	l := &Linter{
+		config: config,
+		info:   meta.NewInfo(),
+		depGraph: depGraph{
+			fileRefs: make(map[string][]string),
+			users:    make(map[string]map[string]struct{}),
+		},
+	}
+	l.limiter.cond = sync.NewCond(&l.limiter.mu)
+	l.info.OnIndexingComplete(func() { inferPurity(l.info) })
+	l.info.OnIndexingComplete(func() { inferThrows(l.info) })
+	return l
+}
+
+// Config returns the linter config.
+func (l *Linter) Config() *Config { return l.config }
+
+// MetaInfo returns the linter meta info.
+func (l *Linter) MetaInfo() *meta.Info { return l.info }
+
+// memoryLimiter disallows to parse files of more than MaxFileSize total bytes at once.
+type memoryLimiter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	used int
+}
+
+// ParseWaiter waits to allow parsing of a file.
+type ParseWaiter struct {
+	l    *memoryLimiter
+	size int
+}
+
+// BeforeParse must be called before parsing file, so that soft memory
+// limit can be applied.
+// Do not forget to call Finish()!
+func (l *Linter) BeforeParse(size int, filename string) *ParseWaiter {
+	lim := &l.limiter
+	lim.mu.Lock()
+	for lim.used > l.config.MaxFileSize {
+		lim.cond.Wait()
+	}
+	lim.used += size
+	if lim.used > l.config.MaxFileSize {
+		lintdebug.Send("Limiting concurrency to save memory: currently parsing %s, total file size %d KiB", filename, lim.used/1024)
+	}
+	lim.mu.Unlock()
+
+	return &ParseWaiter{
+		l:    lim,
+		size: size,
+	}
+}
+
+// Finish must be called after parsing is finished (e.g. using defer p.Finish()) to
+// allow other goroutines to parse files.
+func (p *ParseWaiter) Finish() {
+	p.l.mu.Lock()
+	p.l.used -= p.size
+	p.l.mu.Unlock()
+	p.l.cond.Broadcast()
+}
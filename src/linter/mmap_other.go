@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package linter
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the file contents into memory.
+// Memory mapping is not used as it doesn't allow to replace the mapped file on Windows.
+func mmapFile(fp *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(fp, data)
+	return data, err
+}
+
+// munmapFile does nothing as the data is garbage collected.
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,190 @@
+package linter
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+)
+
+// Ownership describes who introduced the report line and who owns the file.
+type Ownership struct {
+	Commit string    // Commit that last changed the line, git.Zero if it's not committed
+	Author string    // Commit author name
+	Email  string    // Commit author email
+	Date   time.Time // Commit author date
+	Owners []string  // File owners from CODEOWNERS
+}
+
+// OwnershipConfig describes where the report lines are blamed.
+type OwnershipConfig struct {
+	GitDir string
+
+	// WorkTree is the work tree root. If it's not empty, report filenames
+	// are either absolute or relative to the current directory, otherwise
+	// they are relative to the repository root.
+	WorkTree string
+
+	// Rev is the blamed revision. If it's empty, the WorkTree files are blamed.
+	Rev string
+
+	// CodeOwners resolves the file owners, it can be nil.
+	CodeOwners *git.CodeOwners
+}
+
+// AnnotateOwnership sets the Ownership of the reports, blaming only the report lines.
+//
+// Files that can't be blamed (e.g. untracked ones) are logged,
+// their reports get only the owners.
+func AnnotateOwnership(cfg OwnershipConfig, reports []*Report, maxConcurrency int) {
+	byFile := make(map[string][]*Report)
+	for _, r := range reports {
+		byFile[r.filename] = append(byFile[r.filename], r)
+	}
+
+	root := cfg.WorkTree
+	if root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+
+	var wg sync.WaitGroup
+	limitCh := make(chan struct{}, maxConcurrency)
+
+	for filename, list := range byFile {
+		wg.Add(1)
+		go func(filename string, list []*Report) {
+			limitCh <- struct{}{}
+			defer func() { <-limitCh }()
+			defer wg.Done()
+
+			name, ok := repoFilename(root, filename)
+			if !ok {
+				return
+			}
+			var owners []string
+			if cfg.CodeOwners != nil {
+				owners = cfg.CodeOwners.Owners(name)
+			}
+
+			var ranges []git.LineRange
+			seen := make(map[int]bool, len(list))
+			for _, r := range list {
+				if !seen[r.startLine] {
+					seen[r.startLine] = true
+					ranges = append(ranges, git.LineRange{From: r.startLine, To: r.startLine})
+				}
+			}
+			lines, err := git.BlameAuthors(cfg.GitDir, cfg.WorkTree, cfg.Rev, name, ranges)
+			if err != nil {
+				log.Printf("Could not blame %s: %v", filename, err)
+			}
+
+			for _, r := range list {
+				a := lines[r.startLine]
+				r.ownership = &Ownership{
+					Commit: a.Commit,
+					Author: a.Author,
+					Email:  a.Email,
+					Date:   a.Date,
+					Owners: owners,
+				}
+			}
+		}(filename, list)
+	}
+
+	wg.Wait()
+}
+
+// repoFilename returns the slash-separated filename relative to the work tree root.
+// If root is empty, the filename is already relative to it.
+func repoFilename(root, filename string) (string, bool) {
+	if root == "" {
+		return filepath.ToSlash(filename), true
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// OwnershipSummary is the number of reports per commit author and per owner.
+type OwnershipSummary struct {
+	Authors []AuthorReports `json:"authors"`
+	Owners  []OwnerReports  `json:"owners"`
+}
+
+// AuthorReports is the number of reports on the lines changed by the author.
+type AuthorReports struct {
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Reports int    `json:"reports"`
+}
+
+// OwnerReports is the number of reports in the files owned by the owner (e.g. @org/team).
+// Owner is empty for the files without owners.
+type OwnerReports struct {
+	Owner   string `json:"owner"`
+	Reports int    `json:"reports"`
+}
+
+// SummarizeOwnership counts the reports with Ownership by authors and owners.
+// Reports on the lines that could not be blamed are not counted by authors.
+// Reports of the files with several owners are counted for each of them.
+// Both lists are sorted by the number of reports, the largest first.
+func SummarizeOwnership(reports []*Report) OwnershipSummary {
+	type authorKey struct{ author, email string }
+	authors := make(map[authorKey]int)
+	owners := make(map[string]int)
+	for _, r := range reports {
+		o := r.ownership
+		if o == nil {
+			continue
+		}
+		if o.Commit != "" {
+			authors[authorKey{author: o.Author, email: o.Email}]++
+		}
+		if len(o.Owners) == 0 {
+			owners[""]++
+		}
+		for _, owner := range o.Owners {
+			owners[owner]++
+		}
+	}
+
+	var res OwnershipSummary
+	for k, n := range authors {
+		res.Authors = append(res.Authors, AuthorReports{Author: k.author, Email: k.email, Reports: n})
+	}
+	for owner, n := range owners {
+		res.Owners = append(res.Owners, OwnerReports{Owner: owner, Reports: n})
+	}
+	sort.Slice(res.Authors, func(i, j int) bool {
+		a, b := res.Authors[i], res.Authors[j]
+		if a.Reports != b.Reports {
+			return a.Reports > b.Reports
+		}
+		if a.Author != b.Author {
+			return a.Author < b.Author
+		}
+		return a.Email < b.Email
+	})
+	sort.Slice(res.Owners, func(i, j int) bool {
+		a, b := res.Owners[i], res.Owners[j]
+		if a.Reports != b.Reports {
+			return a.Reports > b.Reports
+		}
+		return a.Owner < b.Owner
+	})
+	return res
+}
@@ -0,0 +1,58 @@
+package linter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeOwnership(t *testing.T) {
+	alice := func(owners ...string) *Report {
+		return &Report{ownership: &Ownership{Commit: "a1", Author: "Alice", Email: "alice@example.com", Owners: owners}}
+	}
+	bob := func(owners ...string) *Report {
+		return &Report{ownership: &Ownership{Commit: "b1", Author: "Bob", Email: "bob@example.com", Owners: owners}}
+	}
+	reports := []*Report{
+		alice("@org/core"),
+		bob("@org/core", "@org/web"),
+		bob(),
+		bob("@org/web"),
+		{ownership: &Ownership{Owners: []string{"@org/web"}}}, // Not blamed
+		{}, // Not annotated
+	}
+
+	want := OwnershipSummary{
+		Authors: []AuthorReports{
+			{Author: "Bob", Email: "bob@example.com", Reports: 3},
+			{Author: "Alice", Email: "alice@example.com", Reports: 1},
+		},
+		Owners: []OwnerReports{
+			{Owner: "@org/web", Reports: 3},
+			{Owner: "@org/core", Reports: 2},
+			{Owner: "", Reports: 1},
+		},
+	}
+	if have := SummarizeOwnership(reports); !reflect.DeepEqual(have, want) {
+		t.Errorf("summary mismatch:\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestRepoFilename(t *testing.T) {
+	tests := []struct {
+		root, filename string
+		want           string
+		ok             bool
+	}{
+		{"", "dir/a.php", "dir/a.php", true},
+		{"/repo", "/repo/dir/a.php", "dir/a.php", true},
+		{"/repo", "/repo/../other/a.php", "", false},
+		{"/repo", "/repository/a.php", "", false},
+	}
+
+	for _, test := range tests {
+		have, ok := repoFilename(test.root, test.filename)
+		if have != test.want || ok != test.ok {
+			t.Errorf("repoFilename(%q, %q) = %q, %v, want %q, %v", test.root, test.filename, have, ok, test.want, test.ok)
+		}
+	}
+}
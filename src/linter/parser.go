@@ -2,6 +2,7 @@ package linter
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -32,7 +33,7 @@ type FileInfo struct {
 	LineRanges []git.LineRange
 }
 
-func isPHPExtension(filename string) bool {
+func (l *Linter) isPHPExtension(filename string) bool {
 	fileExt := filepath.Ext(filename)
 	if fileExt == "" {
 		return false
@@ -40,7 +41,7 @@ func isPHPExtension(filename string) bool {
 
 	fileExt = fileExt[1:] // cut "." in the beginning
 
-	for _, ext := range PHPExtensions {
+	for _, ext := range l.config.PHPExtensions {
 		if fileExt == ext {
 			return true
 		}
@@ -49,9 +50,9 @@ func isPHPExtension(filename string) bool {
 	return false
 }
 
-func makePHPExtensionSuffixes() [][]byte {
-	res := make([][]byte, 0, len(PHPExtensions))
-	for _, ext := range PHPExtensions {
+func (l *Linter) makePHPExtensionSuffixes() [][]byte {
+	res := make([][]byte, 0, len(l.config.PHPExtensions))
+	for _, ext := range l.config.PHPExtensions {
 		res = append(res, []byte("."+ext))
 	}
 	return res
@@ -70,8 +71,8 @@ func isPHPExtensionBytes(filename []byte, suffixes [][]byte) bool {
 type ReadCallback func(ch chan FileInfo)
 
 // ParseContents parses specified contents (or file) and returns *RootWalker.
-// Function does not update global meta.
-func ParseContents(filename string, contents []byte, lineRanges []git.LineRange) (rootNode node.Node, w *RootWalker, err error) {
+// Function does not update the linter meta info.
+func (l *Linter) ParseContents(filename string, contents []byte, lineRanges []git.LineRange) (rootNode node.Node, w *RootWalker, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			s := fmt.Sprintf("Panic while parsing %s: %s\n\nStack trace: %s", filename, r, dbg.Stack())
@@ -87,12 +88,12 @@ func ParseContents(filename string, contents []byte, lineRanges []git.LineRange)
 
 	var rd inputs.ReadCloseSizer
 	if contents == nil {
-		rd, err = SrcInput.NewReader(filename)
+		rd, err = l.config.SrcInput.NewReader(filename)
 	} else {
-		rd, err = SrcInput.NewBytesReader(filename, contents)
+		rd, err = l.config.SrcInput.NewBytesReader(filename, contents)
 	}
 	if err != nil {
-		log.Panicf("open source input: %v", err)
+		return nil, nil, fmt.Errorf("open source input: %v", err)
 	}
 	defer rd.Close()
 
@@ -103,23 +104,74 @@ func ParseContents(filename string, contents []byte, lineRanges []git.LineRange)
 	b.ReadFrom(rd)
 	contents = append(make([]byte, 0, b.Len()), b.Bytes()...)
 
-	waiter := BeforeParse(len(contents), filename)
+	waiter := l.BeforeParse(len(contents), filename)
 	defer waiter.Finish()
 
 	parser := php7.NewParser(contents)
 	parser.WithFreeFloating()
 	parser.Parse()
 
-	atomic.AddInt64(&initParseTime, int64(time.Since(start)))
+	atomic.AddInt64(&l.initParseTime, int64(time.Since(start)))
 
-	return analyzeFile(filename, contents, parser, lineRanges)
+	return l.analyzeFile(filename, contents, parser, lineRanges)
 }
 
-func cloneRulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedSet {
+// pathRules caches the rules sets without the @path rules
+// that don't apply to the file, so their index is built once
+// for every combination of the applied @path rules.
+type pathRules struct {
+	sync.Mutex
+	sets map[pathRulesKey]*rules.ScopedSet
+}
+
+type pathRulesKey struct {
+	set *rules.ScopedSet
+
+	// applied has a '1' for every applied @path rule
+	// and a '0' for every filtered out one, in the rules order.
+	applied string
+}
+
+func (l *Linter) rulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedSet {
 	if ruleSet == nil {
 		return nil
 	}
 
+	var applied []byte
+	filtered := false
+	for _, list := range &ruleSet.RulesByKind {
+		for _, rule := range list {
+			switch {
+			case rule.Path == "":
+			case strings.Contains(filename, rule.Path):
+				applied = append(applied, '1')
+			default:
+				applied = append(applied, '0')
+				filtered = true
+			}
+		}
+	}
+	if !filtered {
+		// Share the rules and their index between the files.
+		return ruleSet
+	}
+
+	key := pathRulesKey{set: ruleSet, applied: string(applied)}
+	l.pathRules.Lock()
+	defer l.pathRules.Unlock()
+	if clone, ok := l.pathRules.sets[key]; ok {
+		return clone
+	}
+	clone := cloneRulesForFile(filename, ruleSet)
+	clone.BuildIndex()
+	if l.pathRules.sets == nil {
+		l.pathRules.sets = make(map[pathRulesKey]*rules.ScopedSet)
+	}
+	l.pathRules.sets[key] = clone
+	return clone
+}
+
+func cloneRulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedSet {
 	var clone rules.ScopedSet
 	for i, list := range &ruleSet.RulesByKind {
 		res := make([]rules.Rule, 0, len(list))
@@ -134,7 +186,7 @@ func cloneRulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedS
 	return &clone
 }
 
-func analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRanges []git.LineRange) (*node.Root, *RootWalker, error) {
+func (l *Linter) analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRanges []git.LineRange) (*node.Root, *RootWalker, error) {
 	start := time.Now()
 	rootNode := parser.GetRootNode()
 
@@ -143,16 +195,18 @@ func analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRang
 		return nil, nil, errors.New("Empty root node")
 	}
 
-	st := &meta.ClassParseState{CurrentFile: filename}
+	st := &meta.ClassParseState{Info: l.info, CurrentFile: filename}
 	w := &RootWalker{
+		linter:     l,
+		info:       l.info,
 		lineRanges: lineRanges,
 		ctx:        newRootContext(st),
 
 		// We clone rules sets to remove all rules that
 		// should not be applied to this file because of the @path.
-		anyRset:   cloneRulesForFile(filename, Rules.Any),
-		rootRset:  cloneRulesForFile(filename, Rules.Root),
-		localRset: cloneRulesForFile(filename, Rules.Local),
+		anyRset:   l.rulesForFile(filename, l.config.Rules.Any),
+		rootRset:  l.rulesForFile(filename, l.config.Rules.Root),
+		localRset: l.rulesForFile(filename, l.config.Rules.Local),
 
 		reVet: &regexpVet{
 			parser: syntax.NewParser(&syntax.ParserOptions{
@@ -170,17 +224,28 @@ func analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRang
 	w.InitFromParser(contents, parser)
 	w.InitCustom()
 
+	if l.config.RulesProfile && l.info.IsIndexingComplete() {
+		w.rulesProfile = make(map[ruleProfileKey]*RuleProfile)
+	}
+
 	rootNode.Walk(w)
-	if meta.IsIndexingComplete() {
+	if l.info.IsIndexingComplete() {
 		AnalyzeFileRootLevel(rootNode, w)
 	}
 	w.afterLeaveFile()
+	if !l.info.IsIndexingComplete() {
+		w.meta.Refs = collectFileRefs(filename, rootNode, &w.meta)
+	}
+
+	if w.rulesProfile != nil {
+		l.addRulesProfile(w.rulesProfile)
+	}
 
 	for _, e := range parser.GetErrors() {
 		w.Report(nil, LevelError, "syntax", "Syntax error: "+e.String())
 	}
 
-	atomic.AddInt64(&initWalkTime, int64(time.Since(start)))
+	atomic.AddInt64(&l.initWalkTime, int64(time.Since(start)))
 
 	return rootNode, w, nil
 }
@@ -213,81 +278,95 @@ var bytesBufPool = sync.Pool{
 }
 
 // DebugMessage is used to actually print debug messages.
-func DebugMessage(msg string, args ...interface{}) {
-	if Debug {
+func (l *Linter) DebugMessage(msg string, args ...interface{}) {
+	if l.config.Debug {
 		log.Printf(msg, args...)
 	}
 }
 
 // ReadFilenames returns callback that reads filenames into channel
-func ReadFilenames(filenames []string, ignoreRegex *regexp.Regexp) ReadCallback {
+func (l *Linter) ReadFilenames(filenames []string, ignoreRegex *regexp.Regexp) ReadCallback {
 	return func(ch chan FileInfo) {
-		for _, filename := range filenames {
-			absFilename, err := filepath.Abs(filename)
-			if err == nil {
-				filename = absFilename
-			}
+		err := l.WalkFilenames(filenames, ignoreRegex, func(filename string) {
+			ch <- FileInfo{Filename: filename}
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
 
-			// If we use stat here, it will return file info of an entry
-			// pointed by a symlink (if filename is a link).
-			// lstat is required for a symlink test below to succeed.
-			// If we ever want to permit top-level (CLI args) symlinks,
-			// caller should resolve them to a files that are pointed by them.
-			st, err := os.Lstat(filename)
-			if err != nil {
-				log.Fatalf("Could not stat file %s: %s", filename, err.Error())
-				continue
-			}
-			if st.Mode()&os.ModeSymlink != 0 {
-				// filepath.Walk does not follow symlinks, but it does
-				// accept it as a root argument without an error.
-				// godirwalk.Walk can traverse symlinks with FollowSymbolicLinks=true,
-				// but we don't use it. It will give an error if root is
-				// a symlink, so we avoid calling Walk() on them.
-				continue
-			}
+// WalkFilenames calls fn for every PHP file from filenames.
+// Directories are traversed recursively, symlinks are skipped.
+//
+// Files that match ignoreRegex are skipped too, ignoreRegex can be nil.
+func (l *Linter) WalkFilenames(filenames []string, ignoreRegex *regexp.Regexp, fn func(filename string)) error {
+	for _, filename := range filenames {
+		absFilename, err := filepath.Abs(filename)
+		if err == nil {
+			filename = absFilename
+		}
 
-			if !st.IsDir() {
-				if ignoreRegex != nil && ignoreRegex.MatchString(filename) {
-					continue
-				}
+		// If we use stat here, it will return file info of an entry
+		// pointed by a symlink (if filename is a link).
+		// lstat is required for a symlink test below to succeed.
+		// If we ever want to permit top-level (CLI args) symlinks,
+		// caller should resolve them to a files that are pointed by them.
+		st, err := os.Lstat(filename)
+		if err != nil {
+			return fmt.Errorf("Could not stat file %s: %s", filename, err.Error())
+		}
+		if st.Mode()&os.ModeSymlink != 0 {
+			// filepath.Walk does not follow symlinks, but it does
+			// accept it as a root argument without an error.
+			// godirwalk.Walk can traverse symlinks with FollowSymbolicLinks=true,
+			// but we don't use it. It will give an error if root is
+			// a symlink, so we avoid calling Walk() on them.
+			continue
+		}
 
-				ch <- FileInfo{Filename: filename}
+		if !st.IsDir() {
+			if ignoreRegex != nil && ignoreRegex.MatchString(filename) {
 				continue
 			}
 
-			err = godirwalk.Walk(filename, &godirwalk.Options{
-				Callback: func(path string, de *godirwalk.Dirent) error {
-					if de.IsDir() || !isPHPExtension(path) {
-						return nil
-					}
+			fn(filename)
+			continue
+		}
 
-					if ignoreRegex != nil && ignoreRegex.MatchString(path) {
-						return nil
-					}
+		err = godirwalk.Walk(filename, &godirwalk.Options{
+			Callback: func(path string, de *godirwalk.Dirent) error {
+				if de.IsDir() || !l.isPHPExtension(path) {
+					return nil
+				}
 
-					ch <- FileInfo{Filename: path}
+				if ignoreRegex != nil && ignoreRegex.MatchString(path) {
 					return nil
-				},
-				Unsorted: true,
-			})
+				}
 
-			if err != nil {
-				log.Fatalf("Could not walk filepath %s (%v)", filename, err)
-			}
+				fn(path)
+				return nil
+			},
+			Unsorted: true,
+		})
+
+		if err != nil {
+			return fmt.Errorf("Could not walk filepath %s (%v)", filename, err)
 		}
 	}
+
+	return nil
 }
 
 // ReadChangesFromWorkTree returns callback that reads files from workTree dir that are changed
-func ReadChangesFromWorkTree(dir string, changes []git.Change) ReadCallback {
+func (l *Linter) ReadChangesFromWorkTree(dir string, changes []git.Change) ReadCallback {
 	return func(ch chan FileInfo) {
 		for _, c := range changes {
 			if c.Type == git.Deleted {
 				continue
 			}
 
-			if !isPHPExtension(c.NewName) {
+			if !l.isPHPExtension(c.NewName) {
 				continue
 			}
 
@@ -307,7 +386,7 @@ func ReadChangesFromWorkTree(dir string, changes []git.Change) ReadCallback {
 }
 
 // ReadFilesFromGit parses file contents in the specified commit
-func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadCallback {
+func (l *Linter) ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadCallback {
 	catter, err := git.NewCatter(repo)
 	if err != nil {
 		log.Fatalf("Could not start catter: %s", err.Error())
@@ -318,7 +397,7 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 		log.Fatalf("Could not get tree sha1: %s", err.Error())
 	}
 
-	suffixes := makePHPExtensionSuffixes()
+	suffixes := l.makePHPExtensionSuffixes()
 
 	return func(ch chan FileInfo) {
 		start := time.Now()
@@ -335,7 +414,7 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 				if time.Since(start) >= 2*time.Second {
 					start = time.Now()
 					action := "Indexed"
-					if meta.IsIndexingComplete() {
+					if l.info.IsIndexingComplete() {
 						action = "Analyzed"
 					}
 					log.Printf("%s %d files from git", action, idx)
@@ -359,7 +438,7 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 }
 
 // ReadOldFilesFromGit parses file contents in the specified commit, the old version
-func ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCallback {
+func (l *Linter) ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCallback {
 	changedMap := make(map[string][]git.LineRange, len(changes))
 	for _, ch := range changes {
 		if ch.Type == git.Added {
@@ -378,7 +457,7 @@ func ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCall
 		log.Fatalf("Could not get tree sha1: %s", err.Error())
 	}
 
-	suffixes := makePHPExtensionSuffixes()
+	suffixes := l.makePHPExtensionSuffixes()
 
 	return func(ch chan FileInfo) {
 		err = catter.Walk(
@@ -408,7 +487,7 @@ func ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCall
 }
 
 // ReadFilesFromGitWithChanges parses file contents in the specified commit, but only specified ranges
-func ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change) ReadCallback {
+func (l *Linter) ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change) ReadCallback {
 	changedMap := make(map[string][]git.LineRange, len(changes))
 	for _, ch := range changes {
 		if ch.Type == git.Deleted {
@@ -429,7 +508,7 @@ func ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change)
 		log.Fatalf("Could not get tree sha1: %s", err.Error())
 	}
 
-	suffixes := makePHPExtensionSuffixes()
+	suffixes := l.makePHPExtensionSuffixes()
 
 	return func(ch chan FileInfo) {
 		err = catter.Walk(
@@ -458,21 +537,127 @@ func ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change)
 	}
 }
 
+// ReadStagedFilesFromGit parses the versions of the changed files that are staged in the index,
+// but only the specified ranges. Files that also have unstaged changes are read as they are staged.
+func (l *Linter) ReadStagedFilesFromGit(repo string, changes []git.Change) ReadCallback {
+	changedMap := make(map[string][]git.LineRange, len(changes))
+	for _, ch := range changes {
+		if ch.Type == git.Deleted {
+			continue
+		}
+
+		changedMap[ch.NewName] = append(changedMap[ch.NewName], ch.LineRanges...)
+	}
+
+	staged, err := git.StagedFiles(repo)
+	if err != nil {
+		log.Fatalf("Could not list staged files: %s", err.Error())
+	}
+
+	catter, err := git.NewCatter(repo)
+	if err != nil {
+		log.Fatalf("Could not start catter: %s", err.Error())
+	}
+
+	suffixes := l.makePHPExtensionSuffixes()
+
+	return func(ch chan FileInfo) {
+		for _, f := range staged {
+			ranges, ok := changedMap[f.Name]
+			if !ok || !isPHPExtensionBytes([]byte(f.Name), suffixes) {
+				continue
+			}
+
+			obj, err := catter.Get(f.Hash)
+			if err != nil {
+				log.Fatalf("Could not get staged %s: %s", f.Name, err.Error())
+			}
+
+			ch <- FileInfo{
+				Filename:   f.Name,
+				Contents:   obj.Contents,
+				LineRanges: ranges,
+			}
+		}
+	}
+}
+
+// ReadSelectedFilesFromGit parses contents of the specified files in the commit
+func (l *Linter) ReadSelectedFilesFromGit(repo, commitSHA1 string, filenames []string) ReadCallback {
+	selected := make(map[string]bool, len(filenames))
+	for _, filename := range filenames {
+		selected[filename] = true
+	}
+
+	catter, err := git.NewCatter(repo)
+	if err != nil {
+		log.Fatalf("Could not start catter: %s", err.Error())
+	}
+
+	tree, err := git.GetTreeSHA1(catter, commitSHA1)
+	if err != nil {
+		log.Fatalf("Could not get tree sha1: %s", err.Error())
+	}
+
+	suffixes := l.makePHPExtensionSuffixes()
+
+	return func(ch chan FileInfo) {
+		err = catter.Walk(
+			"",
+			tree,
+			func(filename []byte) bool {
+				return isPHPExtensionBytes(filename, suffixes) && selected[string(filename)]
+			},
+			func(filename string, contents []byte) {
+				ch <- FileInfo{
+					Filename: filename,
+					Contents: contents,
+				}
+			},
+		)
+
+		if err != nil {
+			log.Fatalf("Could not walk: %s", err.Error())
+		}
+	}
+}
+
 // ParseFilenames is used to do initial parsing of files.
-func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
+//
+// Files that can't be parsed are logged and skipped.
+func (l *Linter) ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
+	reports, _ := l.parseFilenames(context.Background(), readFileNamesFunc, true)
+	return reports
+}
+
+// ParseFilenamesContext is like ParseFilenames, but it returns the
+// first file parsing error instead of logging it.
+//
+// If ctx is done before all files are processed, ctx.Err() is returned.
+func (l *Linter) ParseFilenamesContext(ctx context.Context, readFileNamesFunc ReadCallback) ([]*Report, error) {
+	return l.parseFilenames(ctx, readFileNamesFunc, false)
+}
+
+func (l *Linter) parseFilenames(ctx context.Context, readFileNamesFunc ReadCallback, logErrors bool) ([]*Report, error) {
 	start := time.Now()
 	defer func() {
 		lintdebug.Send("Processing time: %s", time.Since(start))
 
-		meta.Info.Lock()
-		defer meta.Info.Unlock()
+		l.info.Lock()
+		defer l.info.Unlock()
 
-		lintdebug.Send("Funcs: %d, consts: %d, files: %d", meta.Info.NumFunctions(), meta.Info.NumConstants(), meta.Info.NumFilesWithFunctions())
+		lintdebug.Send("Funcs: %d, consts: %d, files: %d", l.info.NumFunctions(), l.info.NumConstants(), l.info.NumFilesWithFunctions())
+		if hits, misses := atomic.LoadInt64(&l.reportCacheHits), atomic.LoadInt64(&l.reportCacheMisses); hits+misses != 0 {
+			lintdebug.Send("Report cache: %d hits, %d misses", hits, misses)
+		}
 	}()
 
-	needReports := meta.IsIndexingComplete()
+	needReports := l.info.IsIndexingComplete()
+	if needReports {
+		l.resetReportDeps()
+	}
 
-	lintdebug.Send("Parsing using %d cores", MaxConcurrency)
+	lintdebug.Send("Parsing using %d cores", l.config.MaxConcurrency)
 
 	filenamesCh := make(chan FileInfo, 512)
 
@@ -482,14 +667,30 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 	}()
 
 	var wg sync.WaitGroup
-	reportsCh := make(chan []*Report, MaxConcurrency)
+	reportsCh := make(chan []*Report, l.config.MaxConcurrency)
+
+	var errOnce sync.Once
+	var firstErr error
 
-	for i := 0; i < MaxConcurrency; i++ {
+	for i := 0; i < l.config.MaxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
 			var rep []*Report
 			for f := range filenamesCh {
-				rep = append(rep, doParseFile(f, needReports)...)
+				// The channel is drained even after the cancellation,
+				// so the reader can finish.
+				if ctx.Err() != nil {
+					continue
+				}
+				fileReports, err := l.doParseFile(f, needReports)
+				rep = append(rep, fileReports...)
+				if err == nil {
+					continue
+				}
+				if logErrors {
+					log.Printf("Failed parsing %s: %s", f.Filename, err.Error())
+				}
+				errOnce.Do(func() { firstErr = fmt.Errorf("%s: %v", f.Filename, err) })
 			}
 			reportsCh <- rep
 			wg.Done()
@@ -497,46 +698,56 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 	}
 	wg.Wait()
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !needReports && l.config.CacheDir != "" {
+		if err := l.FlushIndexCache(); err != nil {
+			log.Printf("Failed writing index cache: %v", err)
+		}
+	}
+
 	var allReports []*Report
-	for i := 0; i < MaxConcurrency; i++ {
+	for i := 0; i < l.config.MaxConcurrency; i++ {
 		allReports = append(allReports, (<-reportsCh)...)
 	}
 
-	return allReports
+	return allReports, firstErr
 }
 
-func doParseFile(f FileInfo, needReports bool) (reports []*Report) {
-	var err error
+func (l *Linter) doParseFile(f FileInfo, needReports bool) (reports []*Report, err error) {
 
-	if DebugParseDuration > 0 {
+	if l.config.DebugParseDuration > 0 {
 		start := time.Now()
 		defer func() {
-			if dur := time.Since(start); dur > DebugParseDuration {
+			if dur := time.Since(start); dur > l.config.DebugParseDuration {
 				log.Printf("Parsing of %s took %s", f.Filename, dur)
 			}
 		}()
 	}
 
-	if needReports {
+	if needReports && l.canUseReportCache(f) {
+		reports, err = l.lintFileCached(f)
+	} else if needReports {
 		var w *RootWalker
-		_, w, err = ParseContents(f.Filename, f.Contents, f.LineRanges)
+		_, w, err = l.ParseContents(f.Filename, f.Contents, f.LineRanges)
 		if err == nil {
 			reports = w.GetReports()
 		}
 	} else {
-		err = IndexFile(f.Filename, f.Contents)
+		err = l.IndexFile(f.Filename, f.Contents)
 	}
 
 	if err != nil {
-		log.Printf("Failed parsing %s: %s", f.Filename, err.Error())
 		lintdebug.Send("Failed parsing %s: %s", f.Filename, err.Error())
 	}
 
-	return reports
+	return reports, err
 }
 
 // InitStubs parses directory with PHPStorm stubs which has all internal PHP classes and functions declared.
-func InitStubs() {
-	ParseFilenames(ReadFilenames([]string{StubsDir}, nil))
-	meta.Info.InitStubs()
+func (l *Linter) InitStubs() {
+	l.ParseFilenames(l.ReadFilenames([]string{l.config.StubsDir}, nil))
+	l.info.InitStubs()
 }
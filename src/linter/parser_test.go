@@ -0,0 +1,64 @@
+package linter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/rules"
+)
+
+func TestRulesForFile(t *testing.T) {
+	rset, err := rules.NewParser().Parse("<test>", strings.NewReader(`<?php
+/** @warning f */
+f();
+
+/**
+ * @warning g
+ * @path ads_
+ */
+g();
+
+/**
+ * @warning h
+ * @path ban
+ */
+h();
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := rset.Any
+	set.BuildIndex()
+	l := NewLinter(nil)
+
+	ruleNames := func(set *rules.ScopedSet) []string {
+		var names []string
+		for _, list := range &set.RulesByKind {
+			for _, rule := range list {
+				names = append(names, rule.Message)
+			}
+		}
+		return names
+	}
+
+	if got := l.rulesForFile("ads_ban.php", set); got != set {
+		t.Errorf("ads_ban.php: expected the shared rules set, got %v", ruleNames(got))
+	}
+
+	ads1 := l.rulesForFile("ads_1.php", set)
+	ads2 := l.rulesForFile("ads_2.php", set)
+	if ads1 != ads2 {
+		t.Errorf("ads_1.php and ads_2.php: expected the same rules set")
+	}
+	if got := strings.Join(ruleNames(ads1), ","); got != "f,g" {
+		t.Errorf("ads_1.php: expected f,g rules, got %s", got)
+	}
+
+	other := l.rulesForFile("other.php", set)
+	if other == ads1 {
+		t.Errorf("other.php: expected a separate rules set")
+	}
+	if got := strings.Join(ruleNames(other), ","); got != "f" {
+		t.Errorf("other.php: expected f rule, got %s", got)
+	}
+}
@@ -58,8 +58,9 @@ func TestParseClassPHPDoc(t *testing.T) {
 		},
 	}
 
-	st := &meta.ClassParseState{}
-	walker := RootWalker{ctx: newRootContext(st)}
+	info := meta.NewInfo()
+	st := &meta.ClassParseState{Info: info}
+	walker := RootWalker{info: info, ctx: newRootContext(st)}
 	for _, test := range tests {
 		doc := fmt.Sprintf(`/** %s */`, test.line)
 		result := walker.parseClassPHPDoc(nil, doc)
@@ -118,6 +119,7 @@ func TestTypeFilter(t *testing.T) {
 		{`array`, `mixed[]`},
 		{`array`, `int[]`},
 		{`array`, `\Foo[]`},
+		{`array`, `array{id:int,name:string}`},
 
 		{`object`, `object`},
 		{`object`, `\Foo`},
@@ -166,6 +168,7 @@ func TestTypeFilter(t *testing.T) {
 		{`!int`, `int`},
 		{`!array`, `mixed[]`},
 		{`!array`, `int[]`},
+		{`!array`, `array{id:int}`},
 
 		{`int[]`, `float[]`},
 		{`int[]`, `mixed[]`},
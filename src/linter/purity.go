@@ -0,0 +1,91 @@
+package linter
+
+import (
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/solver"
+)
+
+// inferPurity propagates the functions purity over the call graph.
+//
+// During the indexing, functions are marked as FuncPure if their own
+// bodies have no side effects. The calls they make are recorded as PureDeps.
+// Here we compute the greatest fixed point: a function stays pure only
+// if all of its deps are pure. This way recursive functions can be pure too.
+//
+// The FuncPure flags are not modified, so the purity is recomputed from
+// scratch when the indexing is complete again after the files are changed
+// (e.g. in the language server).
+func inferPurity(info *meta.Info) {
+	var funcs []meta.FunctionsMap
+	funcs = append(funcs, info.AllFunctions())
+	for _, classes := range []meta.ClassesMap{info.AllClasses(), info.AllTraits()} {
+		for _, class := range classes.H {
+			funcs = append(funcs, class.Methods)
+		}
+	}
+
+	for _, m := range funcs {
+		for key, fn := range m.H {
+			if fn.Flags&meta.FuncImpureDeps != 0 {
+				fn.Flags &^= meta.FuncImpureDeps
+				m.H[key] = fn
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, m := range funcs {
+			for key, fn := range m.H {
+				if !fn.IsPure() || len(fn.PureDeps) == 0 {
+					continue
+				}
+				for _, dep := range fn.PureDeps {
+					if !funcRefIsPure(info, dep) {
+						fn.Flags |= meta.FuncImpureDeps
+						m.H[key] = fn
+						changed = true
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func funcRefIsPure(info *meta.Info, ref meta.FuncRef) bool {
+	if ref.Class == "" {
+		funcName := ref.Name
+		fn, ok := info.GetFunction(funcName)
+		if !ok && ref.Fallback != "" {
+			funcName = ref.Fallback
+			fn, ok = info.GetFunction(funcName)
+		}
+		if !ok {
+			return false
+		}
+		if _, ok := info.GetInternalFunctionInfo(funcName); ok {
+			_, ok := pureBuiltins[funcName]
+			return ok
+		}
+		return fn.IsPure() && fn.ExitFlags == 0
+	}
+
+	m, ok := solver.FindMethod(info, ref.Class, ref.Name)
+	if !ok || info.IsInternalClass(m.ClassName) {
+		return false
+	}
+	if ref.Virtual && !methodIsFinal(info, m) {
+		return false
+	}
+	return m.Info.IsPure() && m.Info.ExitFlags == 0
+}
+
+// methodIsFinal reports whether m can't be overridden in a child class.
+func methodIsFinal(info *meta.Info, m solver.FindMethodResult) bool {
+	if m.Info.AccessLevel == meta.Private || m.Info.Flags&meta.FuncFinal != 0 {
+		return true
+	}
+	class, ok := info.GetClass(m.ClassName)
+	return ok && class.Flags&meta.ClassFinal != 0
+}
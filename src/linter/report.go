@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/VKCOM/noverify/src/git"
 )
@@ -22,12 +24,16 @@ func init() {
 			Name:    "discardExpr",
 			Default: true,
 			Comment: `Report expressions that are evaluated but not used.`,
+			Before:  `$a == $b;`,
+			After:   `$equal = $a == $b;`,
 		},
 
 		{
 			Name:    "precedence",
 			Default: true,
 			Comment: `Report potential operation precedence issues.`,
+			Before:  `if ($x & $mask == 0) {}`,
+			After:   `if (($x & $mask) == 0) {}`,
 		},
 
 		{
@@ -40,6 +46,8 @@ func init() {
 			Name:    "keywordCase",
 			Default: true,
 			Comment: `Report keywords that are not in the lower case.`,
+			Before:  `IF ($x) {}`,
+			After:   `if ($x) {}`,
 		},
 
 		{
@@ -58,6 +66,7 @@ func init() {
 			Name:    "redundantGlobal",
 			Default: true,
 			Comment: `Report global statement over superglobal variables (which is redundant).`,
+			Before:  `global $_GET;`,
 		},
 
 		{
@@ -66,28 +75,42 @@ func init() {
 			Comment: `Report array access to non-array objects.`,
 		},
 
+		{
+			Name:    "undefinedArrayKey",
+			Default: false, // Experimental
+			Comment: `Report reads of array keys that are missing from the known array shape.`,
+		},
+
 		{
 			Name:    "bitwiseOps",
 			Default: true,
 			Comment: `Report suspicious usage of bitwise operations.`,
+			Before:  `if ($a & $b) {}`,
+			After:   `if ($a && $b) {}`,
 		},
 
 		{
 			Name:    "mixedArrayKeys",
 			Default: true,
 			Comment: `Report array literals that have both implicit and explicit keys.`,
+			Before:  `$a = [1, 'key' => 2];`,
+			After:   `$a = [0 => 1, 'key' => 2];`,
 		},
 
 		{
 			Name:    "dupArrayKeys",
 			Default: true,
 			Comment: `Report duplicated keys in array literals.`,
+			Before:  `$a = ['x' => 1, 'x' => 2];`,
+			After:   `$a = ['x' => 1, 'y' => 2];`,
 		},
 
 		{
 			Name:    "dupCond",
 			Default: true,
 			Comment: `Report duplicated conditions in switch and if/else statements.`,
+			Before:  `if ($x == 1) {} elseif ($x == 1) {}`,
+			After:   `if ($x == 1) {} elseif ($x == 2) {}`,
 		},
 
 		{
@@ -100,24 +123,32 @@ func init() {
 			Name:    "dupSubExpr",
 			Default: true,
 			Comment: `Report suspicious duplicated operands in expressions.`,
+			Before:  `$equal = $a == $a;`,
+			After:   `$equal = $a == $b;`,
 		},
 
 		{
 			Name:    "arraySyntax",
 			Default: true,
 			Comment: `Report usages of old array() syntax.`,
+			Before:  `$a = array(1, 2);`,
+			After:   `$a = [1, 2];`,
 		},
 
 		{
 			Name:    "bareTry",
 			Default: true,
 			Comment: `Report try blocks without catch/finally.`,
+			Before:  `try { f(); }`,
+			After:   `try { f(); } catch (Exception $e) {}`,
 		},
 
 		{
 			Name:    "caseBreak",
 			Default: true,
 			Comment: `Report switch cases without break.`,
+			Before:  `switch ($x) { case 1: f(); case 2: g(); }`,
+			After:   `switch ($x) { case 1: f(); break; case 2: g(); }`,
 		},
 
 		{
@@ -220,6 +251,8 @@ func init() {
 			Name:    "caseContinue",
 			Default: true,
 			Comment: `Report suspicious 'continue' usages inside switch cases.`,
+			Before:  `foreach ($xs as $x) { switch ($x) { case 1: continue; } }`,
+			After:   `foreach ($xs as $x) { switch ($x) { case 1: continue 2; } }`,
 		},
 
 		{
@@ -234,6 +267,12 @@ func init() {
 			Comment: `Report static calls of instance methods and vice versa.`,
 		},
 
+		{
+			Name:    "throws",
+			Default: false,
+			Comment: `Report undeclared checked exceptions, never thrown @throws entries and unreachable catch clauses.`,
+		},
+
 		{
 			Name:    "parentConstructor",
 			Default: true,
@@ -244,6 +283,8 @@ func init() {
 			Name:    "oldStyleConstructor",
 			Default: true,
 			Comment: `Report old-style (PHP4) class constructors.`,
+			Before:  `class Foo { public function Foo() {} }`,
+			After:   `class Foo { public function __construct() {} }`,
 		},
 
 		{
@@ -275,6 +316,7 @@ type Report struct {
 	msg        string
 	filename   string
 	isDisabled bool // user-defined flag that file should not be linted
+	ownership  *Ownership
 }
 
 // CheckName returns report associated check name.
@@ -295,18 +337,36 @@ func (r *Report) MarshalJSON() ([]byte, error) {
 		Line      int    `json:"line"`
 		StartChar int    `json:"start_char"`
 		EndChar   int    `json:"end_char"`
+
+		// Set if reports are annotated by AnnotateOwnership.
+		Commit      string   `json:"commit,omitempty"`
+		Author      string   `json:"author,omitempty"`
+		AuthorEmail string   `json:"author_email,omitempty"`
+		Date        string   `json:"date,omitempty"`
+		Owners      []string `json:"owners,omitempty"`
 	}
 
-	b, err := json.Marshal(jsonReport{
+	res := jsonReport{
 		CheckName: r.checkName,
-		Severity:  strings.TrimSpace(severityNames[r.level]),
+		Severity:  r.Severity(),
 		Context:   r.startLn,
 		Message:   r.msg,
 		Filename:  r.filename,
 		Line:      r.startLine,
 		StartChar: r.startChar,
 		EndChar:   r.endChar,
-	})
+	}
+	if o := r.ownership; o != nil {
+		res.Commit = o.Commit
+		res.Author = o.Author
+		res.AuthorEmail = o.Email
+		if !o.Date.IsZero() {
+			res.Date = o.Date.Format(time.RFC3339)
+		}
+		res.Owners = o.Owners
+	}
+
+	b, err := json.Marshal(res)
 	return b, err
 }
 
@@ -354,6 +414,47 @@ func (r *Report) GetFilename() string {
 	return r.filename
 }
 
+// Level returns report level, one of the Level* constants.
+func (r *Report) Level() int {
+	return r.level
+}
+
+// Severity returns report level name, e.g. "ERROR" or "WARNING".
+func (r *Report) Severity() string {
+	return strings.TrimSpace(severityNames[r.level])
+}
+
+// Message returns report message without the check name.
+func (r *Report) Message() string {
+	return r.msg
+}
+
+// Line returns 1-based report line number.
+func (r *Report) Line() int {
+	return r.startLine
+}
+
+// Context returns contents of the report line.
+func (r *Report) Context() string {
+	return r.startLn
+}
+
+// StartChar returns 0-based report start position inside the line.
+func (r *Report) StartChar() int {
+	return r.startChar
+}
+
+// EndChar returns 0-based report end position inside the line.
+func (r *Report) EndChar() int {
+	return r.endChar
+}
+
+// Ownership returns the report line origin and the file owners,
+// or nil if the report is not annotated by AnnotateOwnership.
+func (r *Report) Ownership() *Ownership {
+	return r.ownership
+}
+
 // DiffReports returns only reports that are new.
 // Pass diffArgs=nil if we are called from diff in working copy.
 func DiffReports(gitRepo string, diffArgs []string, changesList []git.Change, changeLog []git.Commit, oldList, newList []*Report, maxConcurrency int) (res []*Report, err error) {
@@ -414,24 +515,58 @@ func DiffReports(gitRepo string, diffArgs []string, changesList []git.Change, ch
 	return res, nil
 }
 
+// ChangedLinesReports returns only reports that are located on the added or changed lines.
+// Changes filenames are relative to the dir.
+//
+// Unlike DiffReports, it doesn't need the old reports and git blame,
+// so reports on unchanged lines are never returned.
+func ChangedLinesReports(dir string, changes []git.Change, list []*Report) []*Report {
+	changed := make(map[string][]git.LineRange, len(changes))
+	for _, c := range changes {
+		if c.Type == git.Deleted {
+			continue
+		}
+		filename := filepath.Join(dir, c.NewName)
+		for _, r := range c.LineRanges {
+			if r.HaveRange && r.Range == 0 {
+				continue // Just deletion, like in DiffReports
+			}
+			changed[filename] = append(changed[filename], r)
+		}
+	}
+
+	var res []*Report
+	for _, r := range list {
+		ranges, ok := changed[r.filename]
+		if !ok {
+			continue
+		}
+		if git.LineRangesIntersect(git.LineRange{From: r.startLine, To: r.startLine}, ranges) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
 type lineRangeChange struct {
 	old, new git.LineRange
 }
 
-// compute blame only if refspec is not nil
-func blameIfNeeded(gitDir string, refspec []string, filename string) (git.BlameResult, error) {
-	if refspec == nil {
+// compute blame only if refspec is not nil and there are commits to ignore.
+// Only the changed lines are blamed, reports on other lines are never ignored.
+func blameIfNeeded(gitDir string, refspec []string, ignoreCommits map[string]struct{}, filename string, ranges []git.LineRange) (git.BlameResult, error) {
+	if refspec == nil || len(ignoreCommits) == 0 {
 		return git.BlameResult{}, nil
 	}
 
-	return git.Blame(gitDir, refspec, filename)
+	return git.BlameRanges(gitDir, refspec, filename, ranges)
 }
 
 func diffReportsList(gitRepo string, ignoreCommits map[string]struct{}, diffArgs []string, filename string, c git.Change, oldList, newList []*Report) (res []*Report, err error) {
 	var blame git.BlameResult
 
 	if c.Valid {
-		blame, err = blameIfNeeded(gitRepo, diffArgs, filename)
+		blame, err = blameIfNeeded(gitRepo, diffArgs, ignoreCommits, filename, c.LineRanges)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,304 @@
+package linter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/php/parser/node"
+)
+
+// reportCacheVersion is a report cache format version.
+// Report cache entries are also invalidated by the cacheVersion change.
+// Version 2 added the source file name to the entries.
+const reportCacheVersion = 2
+
+// reportCacheDirname is a name of the report cache directory inside CacheDir.
+const reportCacheDirname = "reports"
+
+// reportDeps memoizes the dependency hashes for the current linting pass.
+// Meta info doesn't change during the linting, so every symbol is hashed once.
+type reportDeps struct {
+	sync.Mutex
+	symbols map[string]reportDepSymbol
+}
+
+type reportDepSymbol struct {
+	hash string
+	refs []string
+}
+
+type reportCacheEntry struct {
+	Version  int
+	Filename string
+	Config   string
+	Deps     []reportCacheDep
+	Reports  []reportCacheItem
+}
+
+type reportCacheDep struct {
+	Name string
+	Hash string
+}
+
+type reportCacheItem struct {
+	CheckName  string
+	StartLn    string
+	StartChar  int
+	StartLine  int
+	EndChar    int
+	Level      int
+	Msg        string
+	IsDisabled bool
+}
+
+// canUseReportCache reports whether the file reports can be taken from the report cache.
+//
+// Line ranges, rule match hooks and rules profiling need the file to be analyzed.
+func (l *Linter) canUseReportCache(f FileInfo) bool {
+	conf := l.config
+	return conf.ReportCache && conf.CacheDir != "" && !conf.LangServer &&
+		f.LineRanges == nil && conf.RuleMatchHook == nil && !conf.RulesProfile
+}
+
+// resetReportDeps discards the memoized dependency hashes.
+// It's called before every linting pass as meta info could be changed since the previous one.
+func (l *Linter) resetReportDeps() {
+	l.reportDeps.Lock()
+	l.reportDeps.symbols = make(map[string]reportDepSymbol)
+	l.reportDeps.Unlock()
+}
+
+// lintFileCached returns the cached file reports if the file and all symbols it depends on
+// are not changed since the reports were cached. Otherwise the file is analyzed
+// and its reports are cached.
+func (l *Linter) lintFileCached(f FileInfo) ([]*Report, error) {
+	contents := f.Contents
+	if contents == nil {
+		rd, err := l.config.SrcInput.NewReader(f.Filename)
+		if err != nil {
+			return nil, err
+		}
+		contents, err = ioutil.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cacheFile := filepath.Join(l.config.CacheDir, reportCacheDirname, fmt.Sprintf("%s.%x", cacheFilenamePart(f.Filename), md5.Sum(contents)))
+	config := l.reportCacheConfig()
+
+	if data, err := ioutil.ReadFile(cacheFile); err == nil {
+		var entry reportCacheEntry
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+		if err == nil && entry.Version == reportCacheVersion && entry.Config == config && l.reportDepsValid(entry.Deps) {
+			atomic.AddInt64(&l.reportCacheHits, 1)
+			return entry.reports(f.Filename), nil
+		}
+	}
+	atomic.AddInt64(&l.reportCacheMisses, 1)
+
+	rootNode, w, err := l.ParseContents(f.Filename, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	reports := w.GetReports()
+
+	entry := reportCacheEntry{
+		Version:  reportCacheVersion,
+		Filename: f.Filename,
+		Config:   config,
+		Deps:     l.collectReportDeps(f.Filename, rootNode, w),
+		Reports:  make([]reportCacheItem, len(reports)),
+	}
+	for i, r := range reports {
+		entry.Reports[i] = reportCacheItem{
+			CheckName:  r.checkName,
+			StartLn:    r.startLn,
+			StartChar:  r.startChar,
+			StartLine:  r.startLine,
+			EndChar:    r.endChar,
+			Level:      r.level,
+			Msg:        r.msg,
+			IsDisabled: r.isDisabled,
+		}
+	}
+	if err := writeReportCacheFile(cacheFile, &entry); err != nil {
+		// The reports are correct anyway, the file will be analyzed next time.
+		l.DebugMessage("write report cache for %s: %v", f.Filename, err)
+	}
+
+	return reports, nil
+}
+
+// reports converts the cached reports back for the given file.
+func (entry *reportCacheEntry) reports(filename string) []*Report {
+	reports := make([]*Report, len(entry.Reports))
+	for i, r := range entry.Reports {
+		reports[i] = &Report{
+			checkName:  r.CheckName,
+			startLn:    r.StartLn,
+			startChar:  r.StartChar,
+			startLine:  r.StartLine,
+			endChar:    r.EndChar,
+			level:      r.Level,
+			msg:        r.Msg,
+			filename:   filename,
+			isDisabled: r.IsDisabled,
+		}
+	}
+	return reports
+}
+
+// cacheFilenamePart returns a cache file path prefix for the given source file.
+func cacheFilenamePart(filename string) string {
+	// windows user supplied full path to directory to be analyzed,
+	// but windows paths does not support ":" in the middle
+	if len(filename) > 2 && filename[0] >= 'A' && filename[0] <= 'Z' && filename[1] == ':' {
+		return filename[0:1] + "_" + filename[2:]
+	}
+	return filename
+}
+
+func writeReportCacheFile(cacheFile string, entry *reportCacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0777); err != nil {
+		return err
+	}
+
+	// Several linter processes can share the cache, so the file
+	// is written under the unique name and then renamed.
+	fp, err := ioutil.TempFile(filepath.Dir(cacheFile), filepath.Base(cacheFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := fp.Name()
+	defer os.Remove(tmpPath)
+
+	wr := bufio.NewWriter(fp)
+	if err := gob.NewEncoder(wr).Encode(entry); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := wr.Flush(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		os.Remove(cacheFile)
+	}
+	return os.Rename(tmpPath, cacheFile)
+}
+
+// reportCacheConfig returns a fingerprint of the settings that affect the reports.
+func (l *Linter) reportCacheConfig() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%d\n%s", cacheVersion, l.config.ReportCacheSalt))))
+}
+
+// reportDepsValid reports whether all dependencies have the same hashes as recorded.
+func (l *Linter) reportDepsValid(deps []reportCacheDep) bool {
+	for _, dep := range deps {
+		if l.reportDepInfo(dep.Name).hash != dep.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// reportDepInfo returns the current hash and the referenced names of the named symbol.
+//
+// Functions, classes, traits and constants share the same name space here:
+// a name depends on every kind of symbol it can refer to.
+func (l *Linter) reportDepInfo(nm string) reportDepSymbol {
+	l.reportDeps.Lock()
+	sym, ok := l.reportDeps.symbols[nm]
+	l.reportDeps.Unlock()
+	if ok {
+		return sym
+	}
+
+	var buf strings.Builder
+	if nm == globalsRefName {
+		var vars []string
+		l.info.Scope.Iterate(func(varName string, typ meta.TypesMap, flags meta.VarFlags) {
+			vars = append(vars, fmt.Sprintf("%s %v %v", varName, typ, flags))
+		})
+		sort.Strings(vars)
+		buf.WriteString(strings.Join(vars, "\n"))
+	} else {
+		if fn, ok := l.info.GetFunction(nm); ok {
+			fmt.Fprintf(&buf, "function %v\n", fn)
+		}
+		if o, ok := l.info.GetFunctionOverride(nm); ok {
+			fmt.Fprintf(&buf, "override %v\n", o)
+		}
+		if class, ok := l.info.GetClass(nm); ok {
+			fmt.Fprintf(&buf, "class %v\n", class)
+		}
+		if trait, ok := l.info.GetTrait(nm); ok {
+			fmt.Fprintf(&buf, "trait %v\n", trait)
+		}
+		if c, ok := l.info.GetConstant(nm); ok {
+			fmt.Fprintf(&buf, "constant %v\n", c)
+		}
+	}
+
+	s := buf.String()
+	if s != "" {
+		sym.hash = fmt.Sprintf("%x", md5.Sum([]byte(s)))
+		sym.refs = symbolNameRegexp.FindAllString(s, -1)
+	}
+
+	l.reportDeps.Lock()
+	l.reportDeps.symbols[nm] = sym
+	l.reportDeps.Unlock()
+	return sym
+}
+
+// collectReportDeps returns the symbols the file reports can depend on.
+//
+// These are the symbols that are referenced from the file (see collectFileRefs) and,
+// transitively, all symbols that are mentioned in the meta info of those symbols,
+// like parent classes, traits and the parameter and return types.
+func (l *Linter) collectReportDeps(filename string, rootNode node.Node, w *RootWalker) []reportCacheDep {
+	refs := collectFileRefs(filename, rootNode, &w.meta)
+	names := make(map[string]bool, len(refs))
+	for _, nm := range refs {
+		names[nm] = true
+	}
+
+	deps := make([]reportCacheDep, 0, len(refs))
+	queue := append([]string(nil), refs...)
+	for len(queue) != 0 {
+		nm := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		sym := l.reportDepInfo(nm)
+		deps = append(deps, reportCacheDep{Name: nm, Hash: sym.hash})
+		for _, ref := range sym.refs {
+			if !names[ref] {
+				names[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Name < deps[j].Name
+	})
+	return deps
+}
@@ -0,0 +1,102 @@
+package linter
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReportCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "noverify-report-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	config := NewConfig()
+	config.CacheDir = cacheDir
+	config.ReportCache = true
+	l := NewLinter(config)
+
+	files := map[string]string{
+		"/a.php": `<?php
+function a() {
+  $f = new Foo();
+  return $f->bar(g(1));
+}`,
+		"/b.php": `<?php
+class Foo {
+  /** @return int */
+  public function bar($x) { return $x; }
+}`,
+		"/c.php": `<?php
+/** @return int */
+function g($x) { return $x; }`,
+	}
+
+	run := func() []string {
+		l.MetaInfo().Reset()
+		read := func(ch chan FileInfo) {
+			for filename, contents := range files {
+				ch <- FileInfo{Filename: filename, Contents: []byte(contents)}
+			}
+		}
+		l.ParseFilenames(read)
+		l.MetaInfo().SetIndexingComplete(true)
+
+		var list []string
+		for _, r := range l.ParseFilenames(read) {
+			// Only the first line, without the code snippet.
+			list = append(list, strings.SplitN(r.String(), "\n", 2)[0])
+		}
+		sort.Strings(list)
+		return list
+	}
+
+	runExpect := func(wantHits, wantMisses int64, want ...string) {
+		t.Helper()
+		hits, misses := atomic.LoadInt64(&l.reportCacheHits), atomic.LoadInt64(&l.reportCacheMisses)
+		have := run()
+		hits = atomic.LoadInt64(&l.reportCacheHits) - hits
+		misses = atomic.LoadInt64(&l.reportCacheMisses) - misses
+		if hits != wantHits || misses != wantMisses {
+			t.Errorf("cache stats mismatch:\nhave: %d hits, %d misses\nwant: %d hits, %d misses",
+				hits, misses, wantHits, wantMisses)
+		}
+		if len(have) != len(want) {
+			t.Fatalf("reports mismatch:\nhave: %q\nwant: %q", have, want)
+		}
+		for i := range have {
+			if have[i] != want[i] {
+				t.Fatalf("reports mismatch:\nhave: %q\nwant: %q", have, want)
+			}
+		}
+	}
+
+	runExpect(0, 3)
+	runExpect(3, 0)
+
+	// b.php changes invalidate a.php that uses the Foo class.
+	files["/b.php"] = `<?php
+class Foo {
+  /** @return int */
+  public function baz($x) { return $x; }
+}`
+	runExpect(1, 2,
+		"ERROR   undefined: Call to undefined method {\\Foo}->bar() at /a.php:4")
+
+	// c.php changes invalidate a.php that calls the g function.
+	files["/c.php"] = `<?php
+/** @return int */
+function g($x, $y) { return $x; }`
+	runExpect(1, 2,
+		"ERROR   undefined: Call to undefined method {\\Foo}->bar() at /a.php:4",
+		"WARNING argCount: Too few arguments for g at /a.php:4")
+
+	runExpect(3, 0,
+		"ERROR   undefined: Call to undefined method {\\Foo}->bar() at /a.php:4",
+		"WARNING argCount: Too few arguments for g at /a.php:4")
+}
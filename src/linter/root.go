@@ -6,6 +6,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/VKCOM/noverify/src/git"
 	"github.com/VKCOM/noverify/src/meta"
@@ -34,6 +35,11 @@ const (
 
 // RootWalker is used to analyze root scope. Mostly defines, function and class definitions are analyzed.
 type RootWalker struct {
+	linter *Linter
+
+	// info is the linter meta info.
+	info *meta.Info
+
 	// autoGenerated is set to true when visiting auto-generated files.
 	autoGenerated bool
 
@@ -47,6 +53,12 @@ type RootWalker struct {
 	localRset *rules.ScopedSet
 	anyRset   *rules.ScopedSet
 
+	// rulesProfile collects the file rules statistics if Config.RulesProfile is set.
+	rulesProfile map[ruleProfileKey]*RuleProfile
+
+	// ruleCandidates is a reusable buffer for the rule indexes.
+	ruleCandidates []int
+
 	ctx rootContext
 
 	// nodeSet is a reusable node set for both root and block walkers.
@@ -87,8 +99,10 @@ type phpDocParamsMap map[string]phpDocParamEl
 
 // NewWalkerForLangServer creates a copy of RootWalker to make full analysis of a file
 func NewWalkerForLangServer(prev *RootWalker) *RootWalker {
-	st := &meta.ClassParseState{CurrentFile: prev.ctx.st.CurrentFile}
+	st := &meta.ClassParseState{Info: prev.info, CurrentFile: prev.ctx.st.CurrentFile}
 	return &RootWalker{
+		linter:         prev.linter,
+		info:           prev.info,
 		fileContents:   prev.fileContents,
 		LinesPositions: prev.LinesPositions,
 		Lines:          prev.Lines,
@@ -100,9 +114,11 @@ func NewWalkerForLangServer(prev *RootWalker) *RootWalker {
 
 // NewWalkerForReferencesSearcher allows to access full context of a parser so that we can perform complex
 // searches if needed.
-func NewWalkerForReferencesSearcher(filename string, block BlockCheckerCreateFunc) *RootWalker {
-	st := &meta.ClassParseState{CurrentFile: filename}
+func (l *Linter) NewWalkerForReferencesSearcher(filename string, block BlockCheckerCreateFunc) *RootWalker {
+	st := &meta.ClassParseState{Info: l.info, CurrentFile: filename}
 	d := &RootWalker{
+		linter:      l,
+		info:        l.info,
 		ctx:         newRootContext(st),
 		customBlock: []BlockCheckerCreateFunc{block},
 	}
@@ -173,7 +189,7 @@ func (d *RootWalker) InitCustom() {
 
 // UpdateMetaInfo is intended to be used in tests. Do not use it directly!
 func (d *RootWalker) UpdateMetaInfo() {
-	updateMetaInfo(d.ctx.st.CurrentFile, &d.meta)
+	d.linter.updateMetaInfo(d.ctx.st.CurrentFile, &d.meta)
 }
 
 // scope returns root-level variable scope if applicable.
@@ -344,10 +360,13 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 		c.AfterEnterNode(w)
 	}
 
-	if meta.IsIndexingComplete() && d.rootRset != nil {
+	if d.info.IsIndexingComplete() && d.rootRset != nil {
 		n := w.(node.Node)
 		kind := rules.CategorizeNode(n)
-		d.runRules(n, d.scope(), d.rootRset.RulesByKind[kind])
+		d.runRules(n, d.scope(), d.rootRset, kind)
+		for _, list := range stmtBlocks(n) {
+			d.runRules(list, d.scope(), d.rootRset, rules.KindStmtList)
+		}
 	}
 
 	if !res {
@@ -374,10 +393,10 @@ func (d *RootWalker) parseStartPos(pos *position.Position) (startLn []byte, star
 
 // Report registers a single report message about some found problem.
 func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args ...interface{}) {
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		return
 	}
-	if d.autoGenerated && !CheckAutoGenerated {
+	if d.autoGenerated && !d.linter.config.CheckAutoGenerated {
 		return
 	}
 
@@ -387,7 +406,7 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 		// Hack to parse syntax error message from php-parser.
 		// When in language server mode, do not map syntax errors in order not to
 		// complain about unfinished piece of code that user is currently writing.
-		if strings.Contains(msg, "syntax error") && strings.Contains(msg, " at line ") && !LangServer {
+		if strings.Contains(msg, "syntax error") && strings.Contains(msg, " at line ") && !d.linter.config.LangServer {
 			// it is in form "Syntax error: syntax error: unexpected '*' at line 4"
 			if lastIdx := strings.LastIndexByte(msg, ' '); lastIdx > 0 {
 				lineNumStr := msg[lastIdx+1:]
@@ -423,7 +442,7 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 		endChar = len(endLn)
 	}
 
-	if LangServer {
+	if d.linter.config.LangServer {
 		severity, ok := vscodeLevelMap[level]
 		if ok {
 			diag := vscode.Diagnostic{
@@ -507,6 +526,7 @@ type handleFuncResult struct {
 	returnTypes            meta.TypesMap
 	prematureExitFlags     int
 	callsParentConstructor bool
+	throwSources           []meta.ThrowSource
 }
 
 func (d *RootWalker) handleFuncStmts(params []meta.FuncParam, uses, stmts []node.Node, sc *meta.Scope) handleFuncResult {
@@ -550,6 +570,14 @@ func (d *RootWalker) handleFuncStmts(params []meta.FuncParam, uses, stmts []node
 			b.nonLocalVars[p.Name] = struct{}{}
 		}
 	}
+	// Function body is walked statement by statement,
+	// so the statement list rules are applied here.
+	if d.info.IsIndexingComplete() && d.anyRset != nil {
+		if list := newStmtBlock(stmts); list != nil {
+			b.runRules(list, rules.KindStmtList)
+		}
+	}
+
 	for _, s := range stmts {
 		b.addStatement(s)
 		s.Walk(b)
@@ -577,11 +605,12 @@ func (d *RootWalker) handleFuncStmts(params []meta.FuncParam, uses, stmts []node
 		returnTypes:            b.returnTypes,
 		prematureExitFlags:     prematureExitFlags,
 		callsParentConstructor: b.callsParentConstructor,
+		throwSources:           b.throwSources,
 	}
 }
 
 func (d *RootWalker) checkParentConstructorCall(n node.Node, parentConstructorCalled bool) {
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		return
 	}
 
@@ -589,7 +618,7 @@ func (d *RootWalker) checkParentConstructorCall(n node.Node, parentConstructorCa
 	if !ok || class.Extends == nil {
 		return
 	}
-	m, ok := solver.FindMethod(d.ctx.st.CurrentParentClass, `__construct`)
+	m, ok := solver.FindMethod(d.info, d.ctx.st.CurrentParentClass, `__construct`)
 	if !ok || m.Info.AccessLevel == meta.Private || m.Info.IsAbstract() {
 		return
 	}
@@ -766,6 +795,7 @@ func (d *RootWalker) enterClassConstList(s *stmt.ClassConstList) bool {
 		cl.Constants[nm] = meta.ConstantInfo{
 			Pos:         d.getElementPos(c),
 			Typ:         typ.Immutable(),
+			Value:       solver.ExprValueLocal(d.ctx.st, cl.Constants, c.Expr),
 			AccessLevel: accessLevel,
 		}
 	}
@@ -889,8 +919,21 @@ func (d *RootWalker) enterClassMethod(meth *stmt.ClassMethod) bool {
 	if modif.final {
 		funcFlags |= meta.FuncFinal
 	}
-	if !insideInterface && !modif.abstract && sideEffectFreeFunc(d.scope(), d.ctx.st, nil, stmts) {
-		funcFlags |= meta.FuncPure
+	var pureDeps []meta.FuncRef
+	if !insideInterface && !modif.abstract {
+		var pure bool
+		pure, pureDeps = funcPurity(d.ctx.st, params, stmts)
+		if pure {
+			funcFlags |= meta.FuncPure
+		}
+	}
+	throwSources := funcInfo.throwSources
+	if stmts == nil {
+		// Methods without a body throw what they declare,
+		// so the implementations can be called via interfaces.
+		for _, typ := range doc.info.Throws {
+			throwSources = append(throwSources, meta.ThrowSource{Thrown: meta.NewTypesMap(typ)})
+		}
 	}
 	class.Methods.Set(nm, meta.FuncInfo{
 		Params:       params,
@@ -902,11 +945,21 @@ func (d *RootWalker) enterClassMethod(meth *stmt.ClassMethod) bool {
 		Flags:        funcFlags,
 		ExitFlags:    exitFlags,
 		Doc:          doc.info,
+		PureDeps:     pureDeps,
+		ThrowSources: throwSources,
 	})
 
-	if nm == "getIterator" && meta.IsIndexingComplete() && solver.Implements(d.ctx.st.CurrentClass, `\IteratorAggregate`) {
+	if !insideInterface && !modif.abstract {
+		if class, ok := d.info.GetClassOrTrait(d.ctx.st.CurrentClass); ok {
+			if fn, ok := class.Methods.Get(nm); ok {
+				d.checkFuncThrows(meth.MethodName, fn)
+			}
+		}
+	}
+
+	if nm == "getIterator" && d.info.IsIndexingComplete() && solver.Implements(d.info, d.ctx.st.CurrentClass, `\IteratorAggregate`) {
 		implementsTraversable := returnType.Find(func(typ string) bool {
-			return solver.Implements(typ, `\Traversable`)
+			return solver.Implements(d.info, typ, `\Traversable`)
 		})
 
 		if !implementsTraversable {
@@ -999,16 +1052,16 @@ func (d *RootWalker) isValidPHPDocRef(n node.Node, ref string) bool {
 		}
 		typeName, symbolName := expandName(parts[0]), parts[1]
 		if symbolName == "class" {
-			_, ok := meta.Info.GetClass(typeName)
+			_, ok := d.info.GetClass(typeName)
 			return ok
 		}
 		if strings.HasPrefix(symbolName, "$") {
-			return classHasProp(typeName, symbolName)
+			return classHasProp(d.info, typeName, symbolName)
 		}
-		if _, ok := solver.FindMethod(typeName, symbolName); ok {
+		if _, ok := solver.FindMethod(d.info, typeName, symbolName); ok {
 			return true
 		}
-		if _, _, ok := solver.FindConstant(typeName, symbolName); ok {
+		if _, _, ok := solver.FindConstant(d.info, typeName, symbolName); ok {
 			return true
 		}
 		return false
@@ -1017,10 +1070,10 @@ func (d *RootWalker) isValidPHPDocRef(n node.Node, ref string) bool {
 	isValidSymbol := func(ref string) bool {
 		if !strings.HasPrefix(ref, `\`) {
 			if d.currentClassNode != nil {
-				if _, ok := solver.FindMethod(d.ctx.st.CurrentClass, ref); ok {
+				if _, ok := solver.FindMethod(d.info, d.ctx.st.CurrentClass, ref); ok {
 					return true // OK: class method reference
 				}
-				if classHasProp(d.ctx.st.CurrentClass, ref) {
+				if classHasProp(d.info, d.ctx.st.CurrentClass, ref) {
 					return true // OK: class prop reference
 				}
 			}
@@ -1028,21 +1081,21 @@ func (d *RootWalker) isValidPHPDocRef(n node.Node, ref string) bool {
 			// Functions and constants fall back in global namespace resolving.
 			// See https://www.php.net/manual/en/language.namespaces.fallback.php
 			globalRef := `\` + ref
-			if _, ok := meta.Info.GetFunction(globalRef); ok {
+			if _, ok := d.info.GetFunction(globalRef); ok {
 				return true // OK: function reference
 			}
-			if _, ok := meta.Info.GetConstant(globalRef); ok {
+			if _, ok := d.info.GetConstant(globalRef); ok {
 				return true // OK: const reference
 			}
 		}
 		fqnRef := expandName(ref)
-		if _, ok := meta.Info.GetFunction(fqnRef); ok {
+		if _, ok := d.info.GetFunction(fqnRef); ok {
 			return true // OK: FQN function reference
 		}
-		if _, ok := meta.Info.GetClass(fqnRef); ok {
+		if _, ok := d.info.GetClass(fqnRef); ok {
 			return true // OK: FQN class reference
 		}
-		if _, ok := meta.Info.GetConstant(fqnRef); ok {
+		if _, ok := d.info.GetConstant(fqnRef); ok {
 			return true // OK: FQN const reference
 		}
 		return false
@@ -1059,7 +1112,7 @@ func (d *RootWalker) isValidPHPDocRef(n node.Node, ref string) bool {
 }
 
 func (d *RootWalker) checkPHPDocRef(n node.Node, part phpdoc.CommentPart) {
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		return
 	}
 
@@ -1118,6 +1171,18 @@ func (d *RootWalker) parsePHPDoc(n node.Node, doc string, actualParams []node.No
 			continue
 		}
 
+		if part.Name() == "throws" {
+			part := part.(*phpdoc.TypeCommentPart)
+			types, warning := typesFromPHPDoc(&d.ctx, part.Type)
+			if warning != "" {
+				result.errs.pushType("%s on line %d", warning, part.Line())
+			}
+			newTypesMap(&d.ctx, types).Iterate(func(typ string) {
+				result.info.Throws = append(result.info.Throws, typ)
+			})
+			continue
+		}
+
 		if part.Name() == "return" {
 			part := part.(*phpdoc.TypeCommentPart)
 			types, warning := typesFromPHPDoc(&d.ctx, part.Type)
@@ -1267,13 +1332,13 @@ func (d *RootWalker) checkIdentMisspellings(n *node.Identifier) {
 }
 
 func (d *RootWalker) checkMisspellings(n node.Node, s string, label string, skip func(string) bool) {
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		return
 	}
-	if TypoFixer == nil {
+	if d.linter.config.TypoFixer == nil {
 		return
 	}
-	_, changes := TypoFixer.Replace(s)
+	_, changes := d.linter.config.TypoFixer.Replace(s)
 	for _, c := range changes {
 		if skip(c.Corrected) || skip(c.Original) {
 			continue
@@ -1328,7 +1393,8 @@ func (d *RootWalker) enterFunction(fun *stmt.Function) bool {
 	}
 
 	var funcFlags meta.FuncFlags
-	if sideEffectFreeFunc(d.scope(), d.ctx.st, nil, fun.Stmts) {
+	pure, pureDeps := funcPurity(d.ctx.st, params, fun.Stmts)
+	if pure {
 		funcFlags |= meta.FuncPure
 	}
 	d.meta.Functions.Set(nm, meta.FuncInfo{
@@ -1340,8 +1406,14 @@ func (d *RootWalker) enterFunction(fun *stmt.Function) bool {
 		Flags:        funcFlags,
 		ExitFlags:    exitFlags,
 		Doc:          doc.info,
+		PureDeps:     pureDeps,
+		ThrowSources: funcInfo.throwSources,
 	})
 
+	if fn, ok := d.info.GetFunction(nm); ok {
+		d.checkFuncThrows(fun.FunctionName, fn)
+	}
+
 	return false
 }
 
@@ -1385,8 +1457,9 @@ func (d *RootWalker) enterFunctionCall(s *expr.FunctionCall) bool {
 	}
 
 	d.meta.Constants[`\`+strings.TrimFunc(str.Value, isQuote)] = meta.ConstantInfo{
-		Pos: d.getElementPos(s),
-		Typ: solver.ExprTypeLocal(d.scope(), d.ctx.st, valueArg.Expr),
+		Pos:   d.getElementPos(s),
+		Typ:   solver.ExprTypeLocal(d.scope(), d.ctx.st, valueArg.Expr),
+		Value: solver.ExprValueLocal(d.ctx.st, nil, valueArg.Expr),
 	}
 	return true
 }
@@ -1473,8 +1546,9 @@ func (d *RootWalker) enterConstList(lst *stmt.ConstList) bool {
 		nm := d.ctx.st.Namespace + `\` + id.Value
 
 		d.meta.Constants[nm] = meta.ConstantInfo{
-			Pos: d.getElementPos(s),
-			Typ: solver.ExprTypeLocal(d.scope(), d.ctx.st, s.Expr),
+			Pos:   d.getElementPos(s),
+			Typ:   solver.ExprTypeLocal(d.scope(), d.ctx.st, s.Expr),
+			Value: solver.ExprValueLocal(d.ctx.st, nil, s.Expr),
 		}
 	}
 
@@ -1501,13 +1575,97 @@ func (d *RootWalker) LeaveNode(n walker.Walkable) {
 	}
 }
 
-func (d *RootWalker) runRules(n node.Node, sc *meta.Scope, rlist []rules.Rule) {
-	for i := range rlist {
+// runRules runs the rules of the given kind that can match n.
+func (d *RootWalker) runRules(n node.Node, sc *meta.Scope, rset *rules.ScopedSet, kind rules.RuleKind) {
+	rlist := rset.RulesByKind[kind]
+	if len(rlist) == 0 {
+		return
+	}
+
+	// runRules is never called recursively, so the buffer can be reused.
+	d.ruleCandidates = rset.Candidates(kind, n, d.ruleCandidates[:0])
+	for _, i := range d.ruleCandidates {
 		rule := &rlist[i]
+		if d.rulesProfile == nil {
+			d.runRule(n, sc, rule)
+			continue
+		}
+		start := time.Now()
 		d.runRule(n, sc, rule)
+		p := d.ruleProfile(rule)
+		p.Attempts++
+		p.Time += time.Since(start)
+	}
+}
+
+// stmtBlocks returns the statement lists of n that are not
+// represented by the *stmt.StmtList nodes, like the switch case bodies.
+// They're matched by the statement list rules as if they were blocks.
+func stmtBlocks(n node.Node) []node.Node {
+	var lists [][]node.Node
+	switch n := n.(type) {
+	case *node.Root:
+		lists = append(lists, n.Stmts)
+	case *stmt.Switch:
+		if n.CaseList == nil {
+			return nil
+		}
+		for _, c := range n.CaseList.Cases {
+			switch c := c.(type) {
+			case *stmt.Case:
+				lists = append(lists, c.Stmts)
+			case *stmt.Default:
+				lists = append(lists, c.Stmts)
+			}
+		}
+	case *stmt.Try:
+		lists = append(lists, n.Stmts)
+		for _, c := range n.Catches {
+			lists = append(lists, c.(*stmt.Catch).Stmts)
+		}
+		if n.Finally != nil {
+			lists = append(lists, n.Finally.(*stmt.Finally).Stmts)
+		}
+	default:
+		return nil
+	}
+
+	var blocks []node.Node
+	for _, stmts := range lists {
+		if list := newStmtBlock(stmts); list != nil {
+			blocks = append(blocks, list)
+		}
+	}
+	return blocks
+}
+
+// newStmtBlock wraps stmts into a statement list that spans all of them.
+// Returns nil for the empty stmts.
+func newStmtBlock(stmts []node.Node) *stmt.StmtList {
+	if len(stmts) == 0 {
+		return nil
+	}
+	first := stmts[0].GetPosition()
+	last := stmts[len(stmts)-1].GetPosition()
+	if first == nil || last == nil {
+		return nil
+	}
+	return &stmt.StmtList{
+		Stmts:    stmts,
+		Position: position.NewPosition(first.StartLine, last.EndLine, first.StartPos, last.EndPos),
 	}
 }
 
+func (d *RootWalker) ruleProfile(rule *rules.Rule) *RuleProfile {
+	key := ruleProfileKey{filename: rule.Filename, line: rule.Line}
+	p := d.rulesProfile[key]
+	if p == nil {
+		p = &RuleProfile{Name: rule.Name, Filename: rule.Filename, Line: rule.Line}
+		d.rulesProfile[key] = p
+	}
+	return p
+}
+
 func (d *RootWalker) sourceNodeString(n node.Node) string {
 	pos := n.GetPosition()
 	from := pos.StartPos
@@ -1551,11 +1709,96 @@ func (d *RootWalker) renderRuleMessage(msg string, n node.Node, m phpgrep.MatchD
 }
 
 func (d *RootWalker) runRule(n node.Node, sc *meta.Scope, rule *rules.Rule) {
+	if rule.Decl != nil {
+		d.runDeclRule(n, sc, rule)
+		return
+	}
+
 	m, ok := rule.Matcher.Match(n)
 	if !ok {
 		return
 	}
+	d.reportRuleMatch(n, sc, rule, m)
+}
 
+// runDeclRule matches a declaration rule against the class, method or property list n.
+//
+// The class name is captured as $class and the declared name is captured as $name.
+func (d *RootWalker) runDeclRule(n node.Node, sc *meta.Scope, rule *rules.Rule) {
+	class, ok := d.currentClassNode.(*stmt.Class)
+	if !ok || class.ClassName == nil || !d.declClassMatches(rule.Decl, class) {
+		return
+	}
+
+	match := func(nameNode node.Node) {
+		m := phpgrep.MatchData{
+			Node: n,
+			Capture: []phpgrep.CapturedNode{
+				{Name: "class", Node: class.ClassName},
+				{Name: "name", Node: nameNode},
+			},
+		}
+		d.reportRuleMatch(n, sc, rule, m)
+	}
+
+	switch n := n.(type) {
+	case *stmt.Class:
+		match(n.ClassName)
+	case *stmt.ClassMethod:
+		if declMemberMatches(rule.Decl, n.MethodName.Value, n.Modifiers) {
+			match(n.MethodName)
+		}
+	case *stmt.PropertyList:
+		for _, p := range n.Properties {
+			p := p.(*stmt.Property)
+			if declMemberMatches(rule.Decl, p.Variable.Name, n.Modifiers) {
+				match(p.Variable)
+			}
+		}
+	}
+}
+
+func (d *RootWalker) declClassMatches(decl *rules.DeclPattern, class *stmt.Class) bool {
+	if decl.ClassName != "" && !strings.EqualFold(decl.ClassName, class.ClassName.Value) {
+		return false
+	}
+	if !hasModifiers(class.Modifiers, decl.ClassModifiers) {
+		return false
+	}
+	for _, typ := range decl.Extends {
+		if !solver.InstanceOf(d.info, d.ctx.st.CurrentClass, typ) {
+			return false
+		}
+	}
+	return true
+}
+
+func declMemberMatches(decl *rules.DeclPattern, name string, modifiers []*node.Identifier) bool {
+	if decl.MemberName != "" && !strings.EqualFold(decl.MemberName, name) {
+		return false
+	}
+	return hasModifiers(modifiers, decl.MemberModifiers)
+}
+
+// hasModifiers reports whether all wanted modifiers are present.
+// Declarations without a visibility modifier are public.
+func hasModifiers(modifiers []*node.Identifier, want []string) bool {
+	have := make(map[string]bool, len(modifiers)+1)
+	for _, m := range modifiers {
+		have[strings.ToLower(m.Value)] = true
+	}
+	if have["var"] || (!have["private"] && !have["protected"]) {
+		have["public"] = true
+	}
+	for _, w := range want {
+		if !have[w] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *RootWalker) reportRuleMatch(n node.Node, sc *meta.Scope, rule *rules.Rule, m phpgrep.MatchData) {
 	matched := false
 	if len(rule.Filters) == 0 {
 		matched = true
@@ -1567,6 +1810,13 @@ func (d *RootWalker) runRule(n node.Node, sc *meta.Scope, rule *rules.Rule) {
 			}
 		}
 	}
+	if d.rulesProfile != nil {
+		if matched {
+			d.ruleProfile(rule).Matches++
+		} else {
+			d.ruleProfile(rule).Rejected++
+		}
+	}
 
 	// If location is explicitly set, use named match set.
 	// Otherwise peek the root target node.
@@ -1583,10 +1833,30 @@ func (d *RootWalker) runRule(n node.Node, sc *meta.Scope, rule *rules.Rule) {
 		return
 	}
 
+	if d.linter.config.RuleMatchHook != nil && d.info.IsIndexingComplete() {
+		d.linter.config.RuleMatchHook(d.newRuleMatch(rule, n, m))
+	}
+
 	message := d.renderRuleMessage(rule.Message, n, m)
 	d.Report(location, rule.Level, rule.Name, message)
 }
 
+func (d *RootWalker) newRuleMatch(rule *rules.Rule, n node.Node, m phpgrep.MatchData) *RuleMatch {
+	res := &RuleMatch{
+		Rule:     rule,
+		Filename: d.ctx.st.CurrentFile,
+		Line:     n.GetPosition().StartLine,
+		Text:     d.sourceNodeString(n),
+	}
+	for _, c := range m.Capture {
+		res.Captures = append(res.Captures, RuleCapture{
+			Name: c.Name,
+			Text: d.sourceNodeString(c.Node),
+		})
+	}
+	return res
+}
+
 func (d *RootWalker) checkTypeFilter(wantType *phpdoc.Type, sc *meta.Scope, nn node.Node) bool {
 	if wantType == nil {
 		return true
@@ -1600,6 +1870,26 @@ func (d *RootWalker) checkTypeFilter(wantType *phpdoc.Type, sc *meta.Scope, nn n
 	return typeIsCompatible(wantType.Expr, haveType.Expr)
 }
 
+// checkInstanceOfFilter reports whether nn type includes a class
+// that extends or implements one of the classes.
+func (d *RootWalker) checkInstanceOfFilter(classes []string, sc *meta.Scope, nn node.Node) bool {
+	var typ meta.TypesMap
+	if class, ok := d.currentClassNode.(*stmt.Class); ok && class.ClassName != nil && nn == node.Node(class.ClassName) {
+		// $class capture of the declaration rules.
+		typ = meta.NewTypesMap(d.ctx.st.CurrentClass)
+	} else {
+		typ = solver.ExprType(sc, d.ctx.st, nn)
+	}
+	return typ.Find(func(typ string) bool {
+		for _, className := range classes {
+			if solver.InstanceOf(d.info, typ, className) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
 func (d *RootWalker) checkFilterSet(m *phpgrep.MatchData, sc *meta.Scope, filterSet map[string]rules.Filter) bool {
 	// TODO: pass custom types here, so both @type and @pure predicates can use it.
 
@@ -1612,19 +1902,102 @@ func (d *RootWalker) checkFilterSet(m *phpgrep.MatchData, sc *meta.Scope, filter
 		if !d.checkTypeFilter(filter.Type, sc, nn) {
 			return false
 		}
+		if filter.InstanceOf != nil && !d.checkInstanceOfFilter(filter.InstanceOf, sc, nn) {
+			return false
+		}
+		if filter.NotInstanceOf != nil && d.checkInstanceOfFilter(filter.NotInstanceOf, sc, nn) {
+			return false
+		}
 		if filter.Pure && !sideEffectFree(d.scope(), d.ctx.st, nil, nn) {
 			return false
 		}
+		if filter.Regexp != nil && !filter.Regexp.MatchString(d.sourceNodeString(nn)) {
+			return false
+		}
+		if filter.NotRegexp != nil && filter.NotRegexp.MatchString(d.sourceNodeString(nn)) {
+			return false
+		}
+		if filter.Values != nil && !d.checkValueFilter(filter.Values, nn) {
+			return false
+		}
+		if filter.NotValues != nil && d.checkValueFilter(filter.NotValues, nn) {
+			return false
+		}
 	}
 
 	return true
 }
 
+func (d *RootWalker) checkValueFilter(values []rules.FilterValue, nn node.Node) bool {
+	nodeName := filterNodeName(nn)
+	var value meta.ConstValue
+	valueComputed := false
+
+	for _, v := range values {
+		if v.Name != "" {
+			if nodeName != "" && strings.EqualFold(nodeName, v.Name) {
+				return true
+			}
+			continue
+		}
+		if !valueComputed {
+			value = solver.ExprValue(d.ctx.st, nn)
+			valueComputed = true
+		}
+		if sameFilterValue(value, v.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterNodeName returns a name of the identifier-like node n
+// that is compared with the @value filter names.
+func filterNodeName(n node.Node) string {
+	switch n := n.(type) {
+	case *node.Identifier:
+		return n.Value
+	case *node.SimpleVar:
+		return n.Name
+	case *expr.ConstFetch:
+		return filterNodeName(n.Constant)
+	case *name.Name:
+		return meta.NameToString(n)
+	case *name.FullyQualified:
+		return strings.TrimPrefix(meta.FullyQualifiedToString(n), `\`)
+	case *name.Relative:
+		return meta.NamePartsToString(n.Parts)
+	}
+	return ""
+}
+
+// sameFilterValue reports whether x is equal to the @value filter literal y.
+// Numbers are compared by their values, so 1 and 1.0 are equal.
+func sameFilterValue(x, y meta.ConstValue) bool {
+	switch x.Kind {
+	case meta.ConstInt, meta.ConstFloat:
+		if y.Kind != meta.ConstInt && y.Kind != meta.ConstFloat {
+			return false
+		}
+		a, _ := x.ToFloat()
+		b, _ := y.ToFloat()
+		return a == b
+	case meta.ConstString:
+		return y.Kind == meta.ConstString && x.Str == y.Str
+	case meta.ConstBool:
+		return y.Kind == meta.ConstBool && x.Bool == y.Bool
+	case meta.ConstNull:
+		return y.Kind == meta.ConstNull
+	}
+	return false
+}
+
 func (d *RootWalker) checkTraitImplemented(n node.Node, nameUsed string) {
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		return
 	}
-	trait, ok := meta.Info.GetTrait(nameUsed)
+	trait, ok := d.info.GetTrait(nameUsed)
 	if !ok {
 		d.reportUndefinedType(n, nameUsed)
 		return
@@ -1633,10 +2006,10 @@ func (d *RootWalker) checkTraitImplemented(n node.Node, nameUsed string) {
 }
 
 func (d *RootWalker) checkClassImplemented(n node.Node, nameUsed string) {
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		return
 	}
-	class, ok := meta.Info.GetClass(nameUsed)
+	class, ok := d.info.GetClass(nameUsed)
 	if !ok {
 		d.reportUndefinedType(n, nameUsed)
 		return
@@ -1665,7 +2038,7 @@ func (d *RootWalker) checkImplementedStep(n node.Node, className string, otherCl
 	}
 	visited[className] = struct{}{}
 	for _, ifaceMethod := range otherClass.Methods.H {
-		m, ok := solver.FindMethod(d.ctx.st.CurrentClass, ifaceMethod.Name)
+		m, ok := solver.FindMethod(d.info, d.ctx.st.CurrentClass, ifaceMethod.Name)
 		if !ok || !m.Implemented {
 			d.Report(n, LevelError, "unimplemented", "Class %s must implement %s::%s method",
 				d.ctx.st.CurrentClass, className, ifaceMethod.Name)
@@ -1677,13 +2050,13 @@ func (d *RootWalker) checkImplementedStep(n node.Node, className string, otherCl
 		}
 	}
 	for _, ifaceName := range otherClass.ParentInterfaces {
-		iface, ok := meta.Info.GetClass(ifaceName)
+		iface, ok := d.info.GetClass(ifaceName)
 		if ok {
 			d.checkImplementedStep(n, ifaceName, iface, visited)
 		}
 	}
 	if otherClass.Parent != "" {
-		class, ok := meta.Info.GetClass(otherClass.Parent)
+		class, ok := d.info.GetClass(otherClass.Parent)
 		if ok {
 			d.checkImplementedStep(n, otherClass.Parent, class, visited)
 		}
@@ -1738,7 +2111,7 @@ func (d *RootWalker) parseClassPHPDoc(n node.Node, doc string) classPhpDocParseR
 	for _, part := range phpdoc.Parse(d.ctx.phpdocTypeParser, doc) {
 		d.checkPHPDocRef(n, part)
 		switch part.Name() {
-		case "property":
+		case "property", "property-read", "property-write":
 			parseClassPHPDocProperty(&d.ctx, &result, part.(*phpdoc.TypeVarCommentPart))
 		case "method":
 			parseClassPHPDocMethod(&d.ctx, &result, part.(*phpdoc.RawCommentPart))
@@ -1753,7 +2126,7 @@ func (d *RootWalker) afterLeaveFile() {
 		c.AfterLeaveFile()
 	}
 
-	if !meta.IsIndexingComplete() {
+	if !d.info.IsIndexingComplete() {
 		for _, shape := range d.ctx.shapes {
 			props := make(meta.PropertiesMap)
 			for _, p := range shape.props {
@@ -0,0 +1,93 @@
+package linter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RuleProfile is an execution statistics of the dynamic rule.
+// Rules with the same name are accounted separately,
+// they're distinguished by their location.
+//
+// See Config.RulesProfile.
+type RuleProfile struct {
+	Name string `json:"name"`
+
+	// Filename and Line locate the rule definition in the rules file.
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+
+	// Attempts is a number of nodes the rule was tried on.
+	Attempts int64 `json:"attempts"`
+
+	// Matches is a number of the pattern matches that passed the filters.
+	Matches int64 `json:"matches"`
+
+	// Rejected is a number of the pattern matches that were rejected by the filters.
+	Rejected int64 `json:"rejected"`
+
+	// Time is a cumulative time spent in the rule matching and filtering.
+	Time time.Duration `json:"time_ns"`
+}
+
+// ruleProfileKey identifies the rule by its location,
+// since the rule names are not unique.
+type ruleProfileKey struct {
+	filename string
+	line     int
+}
+
+type rulesProfile struct {
+	sync.Mutex
+	byRule map[ruleProfileKey]*RuleProfile
+}
+
+// GetRulesProfile returns the collected rule statistics sorted by the time, slowest first.
+func (l *Linter) GetRulesProfile() []RuleProfile {
+	l.rulesProfile.Lock()
+	defer l.rulesProfile.Unlock()
+
+	list := make([]RuleProfile, 0, len(l.rulesProfile.byRule))
+	for _, p := range l.rulesProfile.byRule {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Time != list[j].Time {
+			return list[i].Time > list[j].Time
+		}
+		if list[i].Filename != list[j].Filename {
+			return list[i].Filename < list[j].Filename
+		}
+		return list[i].Line < list[j].Line
+	})
+	return list
+}
+
+// ResetRulesProfile discards the collected rule statistics.
+func (l *Linter) ResetRulesProfile() {
+	l.rulesProfile.Lock()
+	l.rulesProfile.byRule = nil
+	l.rulesProfile.Unlock()
+}
+
+// addRulesProfile merges the per-file statistics into the linter profile.
+func (l *Linter) addRulesProfile(profile map[ruleProfileKey]*RuleProfile) {
+	l.rulesProfile.Lock()
+	defer l.rulesProfile.Unlock()
+
+	if l.rulesProfile.byRule == nil {
+		l.rulesProfile.byRule = make(map[ruleProfileKey]*RuleProfile, len(profile))
+	}
+	for key, p := range profile {
+		dst := l.rulesProfile.byRule[key]
+		if dst == nil {
+			dst = &RuleProfile{Name: p.Name, Filename: p.Filename, Line: p.Line}
+			l.rulesProfile.byRule[key] = dst
+		}
+		dst.Attempts += p.Attempts
+		dst.Matches += p.Matches
+		dst.Rejected += p.Rejected
+		dst.Time += p.Time
+	}
+}
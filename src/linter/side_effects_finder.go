@@ -11,13 +11,26 @@ import (
 	"github.com/VKCOM/noverify/src/solver"
 )
 
-func sideEffectFreeFunc(sc *meta.Scope, st *meta.ClassParseState, customTypes []solver.CustomType, stmts []node.Node) bool {
-	// TODO: functions that call pure functions are also pure.
-	// TODO: allow local var assignments those RHS is pure.
-	f := sideEffectsFinder{sc: sc, st: st, customTypes: customTypes}
+// funcPurity reports whether the function body is free of side effects.
+//
+// Unlike sideEffectFree, it permits local variables modification
+// and assumes that the called user functions are pure.
+// Those calls are returned as deps, so the final result
+// can be computed later with inferPurity.
+func funcPurity(st *meta.ClassParseState, params []meta.FuncParam, stmts []node.Node) (pure bool, deps []meta.FuncRef) {
+	f := sideEffectsFinder{st: st, funcBody: true}
+	if len(params) != 0 {
+		f.params = make(map[string]bool, len(params))
+	}
+	for _, p := range params {
+		f.params[p.Name] = p.IsRef
+	}
 	n := &stmt.StmtList{Stmts: stmts}
 	n.Walk(&f)
-	return !f.sideEffects
+	if f.sideEffects {
+		return false, nil
+	}
+	return true, f.deps
 }
 
 func sideEffectFree(sc *meta.Scope, st *meta.ClassParseState, customTypes []solver.CustomType, n node.Node) bool {
@@ -31,6 +44,13 @@ type sideEffectsFinder struct {
 	st          *meta.ClassParseState
 	customTypes []solver.CustomType
 
+	// funcBody is set when the whole function body is analyzed.
+	// In this mode, user function calls are collected into deps
+	// and local variables can be modified.
+	funcBody bool
+	params   map[string]bool // Parameter names mapped to their IsRef
+	deps     []meta.FuncRef
+
 	sideEffects bool
 }
 
@@ -61,14 +81,18 @@ func (f *sideEffectsFinder) functionCallIsPure(n *expr.FunctionCall) bool {
 		}
 	}
 
-	if !meta.IsIndexingComplete() {
+	if f.funcBody {
+		return f.addFunctionDep(n.Function)
+	}
+
+	if !f.st.Info.IsIndexingComplete() {
 		return false
 	}
 	if funcName != "" {
 		// We can't properly annotate builtin funcs
 		// as pure during the indexing, since we don't have
 		// their PHP sources.
-		_, ok := meta.GetInternalFunctionInfo(funcName)
+		_, ok := f.st.Info.GetInternalFunctionInfo(funcName)
 		if ok {
 			return false
 		}
@@ -81,8 +105,33 @@ func (f *sideEffectsFinder) functionCallIsPure(n *expr.FunctionCall) bool {
 	return call.info.IsPure() && call.info.ExitFlags == 0
 }
 
+func (f *sideEffectsFinder) addFunctionDep(fn node.Node) bool {
+	switch nm := fn.(type) {
+	case *name.FullyQualified:
+		f.deps = append(f.deps, meta.FuncRef{Name: meta.FullyQualifiedToString(nm)})
+		return true
+	case *name.Name:
+		// See resolveFunctionCall.
+		nameStr := meta.NameToString(nm)
+		firstPart := nm.Parts[0].(*name.NamePart).Value
+		ref := meta.FuncRef{Name: f.st.Namespace + `\` + nameStr}
+		if alias, ok := f.st.FunctionUses[firstPart]; ok {
+			if len(nm.Parts) == 1 {
+				ref.Name = alias
+			} else {
+				ref.Name = alias + `\` + meta.NamePartsToString(nm.Parts[1:])
+			}
+		} else if f.st.Namespace != "" {
+			ref.Fallback = `\` + nameStr
+		}
+		f.deps = append(f.deps, ref)
+		return true
+	}
+	return false
+}
+
 func (f *sideEffectsFinder) staticCallIsPure(n *expr.StaticCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !f.st.Info.IsIndexingComplete() && !f.funcBody {
 		return false
 	}
 	methodName, ok := n.Call.(*node.Identifier)
@@ -93,25 +142,46 @@ func (f *sideEffectsFinder) staticCallIsPure(n *expr.StaticCall) bool {
 	if !ok {
 		return false
 	}
-	m, ok := solver.FindMethod(className, methodName.Value)
+	if f.funcBody {
+		f.deps = append(f.deps, meta.FuncRef{
+			Class:   className,
+			Name:    methodName.Value,
+			Virtual: meta.NameNodeEquals(n.Class, "static"),
+		})
+		return true
+	}
+	m, ok := solver.FindMethod(f.st.Info, className, methodName.Value)
 	return ok && m.Info.IsPure() && m.Info.ExitFlags == 0
 }
 
 func (f *sideEffectsFinder) methodCallIsPure(n *expr.MethodCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !f.st.Info.IsIndexingComplete() && !f.funcBody {
 		return false
 	}
 	methodName, ok := n.Method.(*node.Identifier)
 	if !ok {
 		return false
 	}
+	if f.funcBody {
+		// Only $this calls can be resolved without the type info.
+		v, ok := n.Variable.(*node.SimpleVar)
+		if !ok || v.Name != "this" || f.st.CurrentClass == "" {
+			return false
+		}
+		f.deps = append(f.deps, meta.FuncRef{
+			Class:   f.st.CurrentClass,
+			Name:    methodName.Value,
+			Virtual: true,
+		})
+		return true
+	}
 	typ := solver.ExprTypeCustom(f.sc, f.st, n.Variable, f.customTypes)
 	if typ.Len() != 1 || typ.Is("mixed") {
 		return false
 	}
 	return typ.Find(func(typ string) bool {
-		m, ok := solver.FindMethod(typ, methodName.Value)
-		if meta.IsInternalClass(m.ClassName) {
+		m, ok := solver.FindMethod(f.st.Info, typ, methodName.Value)
+		if f.st.Info.IsInternalClass(m.ClassName) {
 			return false
 		}
 		return ok && m.Info.IsPure() && m.Info.ExitFlags == 0
@@ -149,14 +219,12 @@ func (f *sideEffectsFinder) EnterNode(w walker.Walkable) bool {
 		f.sideEffects = true
 		return false
 
-	case *expr.Print,
-		*stmt.Echo,
-		*stmt.Unset,
-		*stmt.Throw,
-		*stmt.Global,
-		*expr.Exit,
-		*assign.Assign,
-		*assign.Reference,
+	case *expr.Closure:
+		// Creating a closure has no side effects by itself.
+		// Calling it is an unresolved call that is impure.
+		return !f.funcBody
+
+	case *assign.Assign,
 		*assign.BitwiseAnd,
 		*assign.BitwiseOr,
 		*assign.BitwiseXor,
@@ -169,13 +237,32 @@ func (f *sideEffectsFinder) EnterNode(w walker.Walkable) bool {
 		*assign.Pow,
 		*assign.ShiftLeft,
 		*assign.ShiftRight,
-		*expr.Yield,
-		*expr.YieldFrom,
-		*expr.Eval,
 		*expr.PreInc,
 		*expr.PostInc,
 		*expr.PreDec,
-		*expr.PostDec,
+		*expr.PostDec:
+		if f.funcBody && f.isLocalVar(assignTarget(n.(node.Node))) {
+			return true
+		}
+		f.sideEffects = true
+		return false
+
+	case *expr.Reference:
+		// Foreach by reference, reference args and so on.
+		f.sideEffects = true
+		return false
+
+	case *expr.Print,
+		*stmt.Echo,
+		*stmt.Unset,
+		*stmt.Throw,
+		*stmt.Global,
+		*stmt.Static,
+		*expr.Exit,
+		*assign.Reference,
+		*expr.Yield,
+		*expr.YieldFrom,
+		*expr.Eval,
 		*expr.Require,
 		*expr.RequireOnce,
 		*expr.Include,
@@ -188,3 +275,75 @@ func (f *sideEffectsFinder) EnterNode(w walker.Walkable) bool {
 }
 
 func (f *sideEffectsFinder) LeaveNode(w walker.Walkable) {}
+
+// isLocalVar reports whether n is a local variable or
+// an element of the local array that can be modified
+// without the side effects outside of the function.
+//
+// Parameters can be reassigned, but their elements can't be modified,
+// since the parameter can be an ArrayAccess object.
+func (f *sideEffectsFinder) isLocalVar(n node.Node) bool {
+	isElem := false
+	for {
+		switch x := n.(type) {
+		case *expr.ArrayDimFetch:
+			n = x.Variable
+			isElem = true
+		case *node.SimpleVar:
+			if x.Name == "this" {
+				return false
+			}
+			if _, ok := superGlobals[x.Name]; ok {
+				return false
+			}
+			if isRef, ok := f.params[x.Name]; ok {
+				return !isElem && !isRef
+			}
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// assignTarget returns a node that is modified by the assignment
+// or increment/decrement operation n.
+func assignTarget(n node.Node) node.Node {
+	switch n := n.(type) {
+	case *assign.Assign:
+		return n.Variable
+	case *assign.BitwiseAnd:
+		return n.Variable
+	case *assign.BitwiseOr:
+		return n.Variable
+	case *assign.BitwiseXor:
+		return n.Variable
+	case *assign.Concat:
+		return n.Variable
+	case *assign.Div:
+		return n.Variable
+	case *assign.Minus:
+		return n.Variable
+	case *assign.Mod:
+		return n.Variable
+	case *assign.Mul:
+		return n.Variable
+	case *assign.Plus:
+		return n.Variable
+	case *assign.Pow:
+		return n.Variable
+	case *assign.ShiftLeft:
+		return n.Variable
+	case *assign.ShiftRight:
+		return n.Variable
+	case *expr.PreInc:
+		return n.Variable
+	case *expr.PostInc:
+		return n.Variable
+	case *expr.PreDec:
+		return n.Variable
+	case *expr.PostDec:
+		return n.Variable
+	}
+	return nil
+}
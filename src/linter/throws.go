@@ -0,0 +1,432 @@
+package linter
+
+import (
+	"sort"
+
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/php/parser/node"
+	"github.com/VKCOM/noverify/src/php/parser/node/expr"
+	"github.com/VKCOM/noverify/src/php/parser/node/name"
+	"github.com/VKCOM/noverify/src/php/parser/node/stmt"
+	"github.com/VKCOM/noverify/src/solver"
+)
+
+// uncheckedExceptions are exception classes that don't need to be
+// declared in @throws, as well as all their subclasses.
+var uncheckedExceptions = []string{
+	`\Error`,
+	`\LogicException`,
+	`\RuntimeException`,
+}
+
+// uncheckedBases are classes that are extended by the unchecked exceptions.
+var uncheckedBases = []string{
+	`\Exception`,
+	`\Throwable`,
+}
+
+// trackThrowSource records n if it's a throw or a call that can throw.
+func (b *BlockWalker) trackThrowSource(n node.Node) {
+	var src meta.ThrowSource
+
+	switch n := n.(type) {
+	case *stmt.Throw:
+		src.Thrown = solver.ExprTypeLocal(b.ctx.sc, b.r.ctx.st, n.Expr)
+		if v, ok := n.Expr.(*node.SimpleVar); ok && b.catchVar != "" && v.Name == b.catchVar {
+			b.rethrows = append(b.rethrows, len(b.throwSources))
+		}
+
+	case *expr.FunctionCall:
+		ref, ok := b.funcRef(n.Function)
+		if !ok {
+			src.Thrown = meta.MixedType
+			break
+		}
+		src.Call = ref
+
+	case *expr.StaticCall:
+		methodName, ok := n.Call.(*node.Identifier)
+		className, ok2 := solver.GetClassName(b.r.ctx.st, n.Class)
+		if !ok || !ok2 {
+			src.Thrown = meta.MixedType
+			break
+		}
+		src.Call = meta.FuncRef{Class: className, Name: methodName.Value}
+
+	case *expr.MethodCall:
+		methodName, ok := n.Method.(*node.Identifier)
+		if !ok {
+			src.Thrown = meta.MixedType
+			break
+		}
+		src.Receiver = solver.ExprTypeLocal(b.ctx.sc, b.r.ctx.st, n.Variable)
+		src.Call = meta.FuncRef{Name: methodName.Value}
+
+	case *expr.New:
+		if _, ok := n.Class.(*stmt.Class); ok {
+			return // Anonymous class
+		}
+		className, ok := solver.GetClassName(b.r.ctx.st, n.Class)
+		if !ok {
+			src.Thrown = meta.MixedType
+			break
+		}
+		src.Call = meta.FuncRef{Class: className, Name: "__construct"}
+
+	default:
+		return
+	}
+
+	if len(b.caught) != 0 {
+		src.Caught = append([]string(nil), b.caught...)
+	}
+	b.throwSources = append(b.throwSources, src)
+}
+
+// completeRethrows makes the rethrows of the caught exceptions
+// throw only the exceptions that can be thrown from the try block.
+//
+// rethrows are the rethrow source indexes for every catch clause,
+// sources and skipCaught are the same as for checkCatchReachable.
+func (b *BlockWalker) completeRethrows(s *stmt.Try, rethrows [][]int, sources []meta.ThrowSource, skipCaught int) {
+	var prevCaught []string
+	for i, c := range s.Catches {
+		if len(rethrows[i]) != 0 {
+			rethrown := make([]meta.ThrowSource, 0, len(sources))
+			for _, src := range sources {
+				// Exceptions caught by the previous catch clauses don't get here.
+				src.Caught = append(append([]string(nil), prevCaught...), src.Caught[skipCaught:]...)
+				rethrown = append(rethrown, src)
+			}
+			for _, idx := range rethrows[i] {
+				b.throwSources[idx].Rethrown = rethrown
+				if len(rethrown) == 0 {
+					b.throwSources[idx].Thrown = meta.TypesMap{}
+				}
+			}
+		}
+		prevCaught = append(prevCaught, b.catchTypes([]node.Node{c})...)
+	}
+}
+
+// funcRef returns a reference to the called function.
+// See resolveFunctionCall.
+func (b *BlockWalker) funcRef(fn node.Node) (meta.FuncRef, bool) {
+	st := b.r.ctx.st
+	switch nm := fn.(type) {
+	case *name.FullyQualified:
+		return meta.FuncRef{Name: meta.FullyQualifiedToString(nm)}, true
+	case *name.Name:
+		nameStr := meta.NameToString(nm)
+		firstPart := nm.Parts[0].(*name.NamePart).Value
+		ref := meta.FuncRef{Name: st.Namespace + `\` + nameStr}
+		if alias, ok := st.FunctionUses[firstPart]; ok {
+			if len(nm.Parts) == 1 {
+				ref.Name = alias
+			} else {
+				ref.Name = alias + `\` + meta.NamePartsToString(nm.Parts[1:])
+			}
+		} else if st.Namespace != "" {
+			ref.Fallback = `\` + nameStr
+		}
+		return ref, true
+	}
+	return meta.FuncRef{}, false
+}
+
+// catchTypes returns exception classes that are caught by the catch clauses.
+func (b *BlockWalker) catchTypes(catches []node.Node) []string {
+	var types []string
+	for _, c := range catches {
+		c, ok := c.(*stmt.Catch)
+		if !ok {
+			continue
+		}
+		for _, t := range c.Types {
+			typ, ok := solver.GetClassName(b.r.ctx.st, t)
+			if ok {
+				types = append(types, typ)
+			}
+		}
+	}
+	return types
+}
+
+// checkCatchReachable reports catch clauses that can't catch
+// anything that is thrown from the try block.
+//
+// sources are the throw sources of the try block and
+// the skipCaught is a number of the catch types that
+// enclose the whole try statement (including its own catches).
+func (b *BlockWalker) checkCatchReachable(s *stmt.Try, sources []meta.ThrowSource, skipCaught int) {
+	if !b.r.info.IsIndexingComplete() {
+		return
+	}
+
+	var thrown []string
+	for _, src := range sources {
+		thrown = addExceptions(thrown, sourceExceptions(b.r.info, src, skipCaught, b.r.ctx.st.CurrentClass))
+	}
+	if containsString(thrown, "mixed") {
+		return
+	}
+
+	for _, c := range s.Catches {
+		c, ok := c.(*stmt.Catch)
+		if !ok {
+			continue
+		}
+		for _, t := range c.Types {
+			typ, ok := solver.GetClassName(b.r.ctx.st, t)
+			if !ok {
+				continue
+			}
+			if _, ok := b.r.info.GetClass(typ); !ok {
+				continue // Reported as undefined class
+			}
+			if !isCheckedException(b.r.info, typ) || containsString(uncheckedBases, typ) {
+				continue // Unchecked exceptions can be thrown from anywhere
+			}
+			reachable := false
+			for _, x := range thrown {
+				if solver.InstanceOf(b.r.info, x, typ) || solver.InstanceOf(b.r.info, typ, x) {
+					reachable = true
+					break
+				}
+			}
+			if !reachable {
+				b.r.Report(t, LevelWarning, "throws", "Catch of %s is unreachable: try block doesn't throw it", typ)
+			}
+		}
+	}
+}
+
+// checkFuncThrows compares the exceptions that can escape
+// the function with the ones declared in @throws.
+func (d *RootWalker) checkFuncThrows(n node.Node, fn meta.FuncInfo) {
+	if !d.info.IsIndexingComplete() {
+		return
+	}
+
+	declared := fn.Doc.Throws
+
+	for _, x := range fn.Throws {
+		if x == "mixed" || !isCheckedException(d.info, x) {
+			continue
+		}
+		covered := false
+		for _, typ := range declared {
+			if solver.InstanceOf(d.info, x, typ) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			d.Report(n, LevelWarning, "throws", "Exception %s is not declared in @throws", x)
+		}
+	}
+
+	if containsString(fn.Throws, "mixed") {
+		return
+	}
+	for _, typ := range declared {
+		thrown := false
+		for _, x := range fn.Throws {
+			if solver.InstanceOf(d.info, x, typ) || solver.InstanceOf(d.info, typ, x) {
+				thrown = true
+				break
+			}
+		}
+		if !thrown {
+			d.Report(n, LevelWarning, "throws", "@throws %s is never thrown", typ)
+		}
+	}
+}
+
+func isCheckedException(info *meta.Info, className string) bool {
+	for _, typ := range uncheckedExceptions {
+		if solver.InstanceOf(info, className, typ) {
+			return false
+		}
+	}
+	return true
+}
+
+// inferThrows computes FuncInfo.Throws for all functions.
+//
+// The exceptions that are thrown by the called functions are
+// propagated until the fixed point is reached.
+func inferThrows(info *meta.Info) {
+	type funcEntry struct {
+		m         meta.FunctionsMap
+		className string
+	}
+	var funcs []funcEntry
+	funcs = append(funcs, funcEntry{m: info.AllFunctions()})
+	for _, classes := range []meta.ClassesMap{info.AllClasses(), info.AllTraits()} {
+		for _, class := range classes.H {
+			funcs = append(funcs, funcEntry{m: class.Methods, className: class.Name})
+		}
+	}
+
+	for _, e := range funcs {
+		for key, fn := range e.m.H {
+			if fn.Throws != nil {
+				fn.Throws = nil
+				e.m.H[key] = fn
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, e := range funcs {
+			for key, fn := range e.m.H {
+				throws := append([]string(nil), fn.Throws...)
+				for _, src := range fn.ThrowSources {
+					throws = addExceptions(throws, sourceExceptions(info, src, 0, e.className))
+				}
+				if len(throws) != len(fn.Throws) {
+					fn.Throws = throws
+					e.m.H[key] = fn
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// sourceExceptions returns exceptions that can escape the source.
+// First skipCaught catch types are ignored.
+func sourceExceptions(info *meta.Info, src meta.ThrowSource, skipCaught int, className string) []string {
+	var thrown []string
+	switch {
+	case len(src.Rethrown) != 0:
+		thrown = rethrownExceptions(info, src, className)
+	case !src.Thrown.IsEmpty():
+		for typ := range solver.ResolveTypes(info, className, src.Thrown, make(map[string]struct{})) {
+			if len(typ) != 0 && typ[0] == '\\' {
+				thrown = append(thrown, typ)
+			} else {
+				thrown = append(thrown, "mixed")
+			}
+		}
+	case !src.Receiver.IsEmpty():
+		types := solver.ResolveTypes(info, className, src.Receiver, make(map[string]struct{}))
+		for typ := range types {
+			m, ok := solver.FindMethod(info, typ, src.Call.Name)
+			if !ok {
+				thrown = append(thrown, "mixed")
+				continue
+			}
+			thrown = append(thrown, methodThrows(info, m)...)
+		}
+	case src.Call.Class != "":
+		m, ok := solver.FindMethod(info, src.Call.Class, src.Call.Name)
+		if !ok {
+			if src.Call.Name == "__construct" {
+				return nil // Default constructor
+			}
+			return []string{"mixed"}
+		}
+		thrown = methodThrows(info, m)
+	case src.Call.Name != "":
+		funcName := src.Call.Name
+		fn, ok := info.GetFunction(funcName)
+		if !ok && src.Call.Fallback != "" {
+			funcName = src.Call.Fallback
+			fn, ok = info.GetFunction(funcName)
+		}
+		if !ok {
+			return []string{"mixed"}
+		}
+		if _, ok := info.GetInternalFunctionInfo(funcName); ok {
+			thrown = fn.Doc.Throws
+		} else {
+			thrown = fn.Throws
+		}
+	}
+
+	if len(src.Caught) <= skipCaught {
+		return thrown
+	}
+	caught := src.Caught[skipCaught:]
+	var escaped []string
+	for _, x := range thrown {
+		if !isCaught(info, x, caught) {
+			escaped = append(escaped, x)
+		}
+	}
+	return escaped
+}
+
+// rethrownExceptions returns exceptions of the try block
+// that are caught and rethrown by the catch clause.
+func rethrownExceptions(info *meta.Info, src meta.ThrowSource, className string) []string {
+	var caught []string
+	for typ := range solver.ResolveTypes(info, className, src.Thrown, make(map[string]struct{})) {
+		caught = append(caught, typ)
+	}
+
+	var thrown []string
+	for _, r := range src.Rethrown {
+		for _, x := range sourceExceptions(info, r, 0, className) {
+			switch {
+			case x == "mixed":
+				thrown = addExceptions(thrown, caught)
+			case isCaught(info, x, caught):
+				thrown = addExceptions(thrown, []string{x})
+			default:
+				// The thrown exception can be an instance of the caught subclass.
+				for _, typ := range caught {
+					if solver.InstanceOf(info, typ, x) {
+						thrown = addExceptions(thrown, []string{typ})
+					}
+				}
+			}
+		}
+	}
+	return thrown
+}
+
+func methodThrows(info *meta.Info, m solver.FindMethodResult) []string {
+	if info.IsInternalClass(m.ClassName) {
+		return m.Info.Doc.Throws
+	}
+	return m.Info.Throws
+}
+
+func isCaught(info *meta.Info, exception string, caught []string) bool {
+	for _, typ := range caught {
+		if exception == "mixed" {
+			if typ == `\Throwable` {
+				return true
+			}
+			continue
+		}
+		if solver.InstanceOf(info, exception, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// addExceptions returns a sorted union of the dst and src lists.
+func addExceptions(dst, src []string) []string {
+	for _, x := range src {
+		if !containsString(dst, x) {
+			dst = append(dst, x)
+		}
+	}
+	sort.Strings(dst)
+	return dst
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
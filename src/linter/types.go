@@ -58,11 +58,43 @@ func (conv *phpdocTypeConverter) mapType(e phpdoc.TypeExpr) []meta.Type {
 		if suggest, ok := typeAliases[e.Value]; ok {
 			conv.warn(fmt.Sprintf("use %s type instead of %s", suggest, e.Value))
 		}
+		if types, ok := pseudoTypes[e.Value]; ok {
+			return append([]meta.Type(nil), types...)
+		}
 		return []meta.Type{{Elem: e.Value}}
 
+	case phpdoc.ExprInt:
+		return []meta.Type{{Elem: "int"}}
+
+	case phpdoc.ExprString:
+		return []meta.Type{{Elem: "string"}}
+
+	case phpdoc.ExprCallable:
+		// Signature details are not tracked, only the callable type itself.
+		return conv.mapType(e.Args[0])
+
 	case phpdoc.ExprGeneric:
 		typ := e.Args[0]
 		params := e.Args[1:]
+		switch typ.Value {
+		case "list", "non-empty-list":
+			if e.Shape == phpdoc.ShapeGenericBrace {
+				return conv.mapTupleType(params)
+			}
+			if len(params) == 1 {
+				return conv.mapArrayType(params[0])
+			}
+		case "non-empty-array":
+			if e.Shape == phpdoc.ShapeGenericBrace {
+				return conv.mapShapeType(params)
+			}
+			switch len(params) {
+			case 1:
+				return conv.mapArrayType(params[0])
+			case 2:
+				return conv.mapArrayType(params[1])
+			}
+		}
 		if typ.Value == "array" {
 			if e.Shape == phpdoc.ShapeGenericBrace {
 				return conv.mapShapeType(params)
@@ -273,12 +305,55 @@ var trivialTypes = map[string]bool{
 	"string":   true,
 	"void":     true,
 	"iterable": true,
+	"never":    true,
 
 	"null":  true,
 	"true":  true,
 	"false": true,
 }
 
+// pseudoTypes maps Psalm and PHPStan specific types
+// to the closest types we can express.
+var pseudoTypes = map[string][]meta.Type{
+	"positive-int":     {{Elem: "int"}},
+	"negative-int":     {{Elem: "int"}},
+	"non-positive-int": {{Elem: "int"}},
+	"non-negative-int": {{Elem: "int"}},
+	"non-zero-int":     {{Elem: "int"}},
+
+	"class-string":             {{Elem: "string"}},
+	"interface-string":         {{Elem: "string"}},
+	"trait-string":             {{Elem: "string"}},
+	"callable-string":          {{Elem: "string"}},
+	"numeric-string":           {{Elem: "string"}},
+	"non-empty-string":         {{Elem: "string"}},
+	"non-falsy-string":         {{Elem: "string"}},
+	"truthy-string":            {{Elem: "string"}},
+	"literal-string":           {{Elem: "string"}},
+	"lowercase-string":         {{Elem: "string"}},
+	"non-empty-literal-string": {{Elem: "string"}},
+
+	"list":            {{Elem: "mixed", Dims: 1}},
+	"non-empty-list":  {{Elem: "mixed", Dims: 1}},
+	"non-empty-array": {{Elem: "mixed", Dims: 1}},
+	"callable-array":  {{Elem: "mixed", Dims: 1}},
+
+	"array-key": {{Elem: "int"}, {Elem: "string"}},
+	"key-of":    {{Elem: "int"}, {Elem: "string"}},
+	"value-of":  {{Elem: "mixed"}},
+	"numeric":   {{Elem: "int"}, {Elem: "float"}, {Elem: "string"}},
+	"scalar":    {{Elem: "int"}, {Elem: "float"}, {Elem: "string"}, {Elem: "bool"}},
+
+	// Functions that never return are not void, their
+	// calls can be used in expressions, e.g. `$x ?? fail()`.
+	"never-return":  {{Elem: "never"}},
+	"never-returns": {{Elem: "never"}},
+	"no-return":     {{Elem: "never"}},
+
+	"empty":           {{Elem: "mixed"}},
+	"non-empty-mixed": {{Elem: "mixed"}},
+}
+
 var typeAliases = map[string]string{
 	"integer": "int",
 	"long":    "int",
@@ -41,8 +41,8 @@ func FlagsToString(f int) string {
 	return "Exit flags: [" + strings.Join(res, ", ") + "], digits: " + fmt.Sprintf("%d", f)
 }
 
-func haveMagicMethod(class string, methodName string) bool {
-	_, ok := solver.FindMethod(class, methodName)
+func haveMagicMethod(info *meta.Info, class string, methodName string) bool {
+	_, ok := solver.FindMethod(info, class, methodName)
 	return ok
 }
 
@@ -123,7 +123,9 @@ func typeIsCompatible(dst, val phpdoc.TypeExpr) bool {
 			// https://wiki.php.net/rfc/object-typehint
 			return val.Kind == dst.Kind && (val.Value == "object" || strings.HasPrefix(val.Value, `\`))
 		case "array":
-			return val.Kind == phpdoc.ExprArray
+			// Array shapes are formatted as `array{k:T,...}`.
+			isShape := val.Kind == phpdoc.ExprGeneric && val.Args[0].Value == "array"
+			return val.Kind == phpdoc.ExprArray || isShape
 		}
 		return val.Kind == dst.Kind && dst.Value == val.Value
 
@@ -164,7 +166,7 @@ type funcCallInfo struct {
 func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes []solver.CustomType, call *expr.FunctionCall) funcCallInfo {
 	var res funcCallInfo
 	res.canAnalyze = true
-	if !meta.IsIndexingComplete() {
+	if !st.Info.IsIndexingComplete() {
 		return res
 	}
 
@@ -180,19 +182,19 @@ func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes [
 				nameStr = alias + `\` + meta.NamePartsToString(nm.Parts[1:])
 			}
 			res.fqName = nameStr
-			res.info, res.defined = meta.Info.GetFunction(res.fqName)
+			res.info, res.defined = st.Info.GetFunction(res.fqName)
 		} else {
 			res.fqName = st.Namespace + `\` + nameStr
-			res.info, res.defined = meta.Info.GetFunction(res.fqName)
+			res.info, res.defined = st.Info.GetFunction(res.fqName)
 			if !res.defined && st.Namespace != "" {
 				res.fqName = `\` + nameStr
-				res.info, res.defined = meta.Info.GetFunction(res.fqName)
+				res.info, res.defined = st.Info.GetFunction(res.fqName)
 			}
 		}
 
 	case *name.FullyQualified:
 		res.fqName = meta.FullyQualifiedToString(nm)
-		res.info, res.defined = meta.Info.GetFunction(res.fqName)
+		res.info, res.defined = st.Info.GetFunction(res.fqName)
 	default:
 		res.defined = false
 
@@ -200,7 +202,7 @@ func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes [
 			if res.defined {
 				return
 			}
-			m, ok := solver.FindMethod(typ, `__invoke`)
+			m, ok := solver.FindMethod(st.Info, typ, `__invoke`)
 			res.info = m.Info
 			res.defined = ok
 		})
@@ -234,7 +236,7 @@ func findVarNode(n node.Node) node.Node {
 	}
 }
 
-func classHasProp(className, propName string) bool {
+func classHasProp(info *meta.Info, className, propName string) bool {
 	var nameWithDollar string
 	var nameWithoutDollar string
 	if strings.HasPrefix(propName, "$") {
@@ -246,10 +248,10 @@ func classHasProp(className, propName string) bool {
 	}
 
 	// Static props stored with leading "$".
-	if _, ok := solver.FindProperty(className, nameWithDollar); ok {
+	if _, ok := solver.FindProperty(info, className, nameWithDollar); ok {
 		return true
 	}
-	_, ok := solver.FindProperty(className, nameWithoutDollar)
+	_, ok := solver.FindProperty(info, className, nameWithoutDollar)
 	return ok
 }
 
@@ -390,3 +392,14 @@ var phpKeywords = map[string]bool{
 	"self":         true,
 	"parent":       true,
 }
+
+// containsConstValue reports whether values contain a scalar
+// identical (in terms of `===`) to v.
+func containsConstValue(values []meta.ConstValue, v meta.ConstValue) bool {
+	for _, x := range values {
+		if x.Kind == v.Kind && x.Bool == v.Bool && x.Int == v.Int && x.Float == v.Float && x.Str == v.Str {
+			return true
+		}
+	}
+	return false
+}
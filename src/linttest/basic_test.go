@@ -699,15 +699,12 @@ for ($i = 0; $i == 0; $i = $i++) {}
 }
 
 func TestCustomUnusedVarRegex(t *testing.T) {
-	defer func(isDiscardVar func(string) bool) {
-		linter.IsDiscardVar = isDiscardVar
-	}(linter.IsDiscardVar)
-
-	linter.IsDiscardVar = func(s string) bool {
+	test := linttest.NewSuite(t)
+	test.Config().IsDiscardVar = func(s string) bool {
 		return strings.HasPrefix(s, "_")
 	}
 
-	linttest.SimpleNegativeTest(t, `<?php
+	test.AddFile(`<?php
 $_unused = 10;
 
 function f() {
@@ -716,6 +713,7 @@ function f() {
   foreach ([1] as $_ => $_user) {}
 }
 `)
+	test.RunAndMatch()
 }
 
 func TestClosureCapture(t *testing.T) {
@@ -1250,14 +1248,16 @@ func TestUnused(t *testing.T) {
 
 func TestAtVar(t *testing.T) {
 	// variables declared using @var should not be overridden
-	_ = linttest.GetFileReports(t, `<?php
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
 	function test() {
 		/** @var string $a */
 		$a = true;
 		return $a;
 	}`)
+	test.RunLinter()
 
-	fi, ok := meta.Info.GetFunction(`\test`)
+	fi, ok := test.MetaInfo().GetFunction(`\test`)
 	if !ok {
 		t.Errorf("Could not get function test")
 	}
@@ -1371,7 +1371,8 @@ func TestSwitchFallthrough(t *testing.T) {
 }
 
 func TestFunctionThrowsExceptionsAndReturns(t *testing.T) {
-	reports := linttest.GetFileReports(t, `<?php
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
 	class Exception {}
 
 	function handle($b) {
@@ -1392,12 +1393,13 @@ func TestFunctionThrowsExceptionsAndReturns(t *testing.T) {
 		handle(1);
 		echo "This code is reachable\n";
 	}`)
+	reports := test.RunLinter()
 
 	if len(reports) != 0 {
 		t.Errorf("Unexpected number of reports: expected 0, got %d", len(reports))
 	}
 
-	fi, ok := meta.Info.GetFunction(`\handle`)
+	fi, ok := test.MetaInfo().GetFunction(`\handle`)
 
 	if ok {
 		log.Printf("handle exitFlags: %d (%s)", fi.ExitFlags, linter.FlagsToString(fi.ExitFlags))
@@ -1531,7 +1533,7 @@ func TestCorrectArrayTypes(t *testing.T) {
 	`)
 	test.RunLinter()
 
-	fn, ok := meta.Info.GetFunction(`\test`)
+	fn, ok := test.MetaInfo().GetFunction(`\test`)
 	if !ok {
 		t.Errorf("Could not find function test")
 		t.Fail()
@@ -1561,7 +1563,7 @@ func TestArrayUnion(t *testing.T) {
 	`)
 	test.RunLinter()
 
-	fnInt, ok := meta.Info.GetFunction(`\testInt`)
+	fnInt, ok := test.MetaInfo().GetFunction(`\testInt`)
 	if !ok {
 		t.Errorf("Could not find function testInt")
 		t.Fail()
@@ -1575,7 +1577,7 @@ func TestArrayUnion(t *testing.T) {
 		t.Errorf("Wrong type: %s, expected int", fnInt.Typ)
 	}
 
-	fnIntArr, ok := meta.Info.GetFunction(`\testIntArr`)
+	fnIntArr, ok := test.MetaInfo().GetFunction(`\testIntArr`)
 	if !ok {
 		t.Errorf("Could not find function testIntArr")
 		t.Fail()
@@ -1589,7 +1591,7 @@ func TestArrayUnion(t *testing.T) {
 		t.Errorf("Wrong type: %s, expected int[]", fnIntArr.Typ)
 	}
 
-	fnMixedArr, ok := meta.Info.GetFunction(`\testMixedArr`)
+	fnMixedArr, ok := test.MetaInfo().GetFunction(`\testMixedArr`)
 	if !ok {
 		t.Errorf("Could not find function testMixedArr")
 		t.Fail()
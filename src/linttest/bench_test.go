@@ -1,14 +1,17 @@
 package linttest_test
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
+	"github.com/VKCOM/noverify/src/linter"
 	"github.com/VKCOM/noverify/src/linttest"
 	"github.com/VKCOM/noverify/src/meta"
 	"github.com/VKCOM/noverify/src/php/parser/node"
 	"github.com/VKCOM/noverify/src/php/parser/node/expr"
 	"github.com/VKCOM/noverify/src/php/parser/node/name"
+	"github.com/VKCOM/noverify/src/rules"
 	"github.com/VKCOM/noverify/src/solver"
 )
 
@@ -35,7 +38,6 @@ class Foo {
 }
 `)
 	test.RunLinter()
-	meta.SetIndexingComplete(true)
 
 	newName := func(nm string) *name.Name {
 		stringParts := strings.Split(nm, `\`)
@@ -57,7 +59,7 @@ class Foo {
 		Property: &node.Identifier{Value: "i"},
 	}
 
-	st := &meta.ClassParseState{}
+	st := &meta.ClassParseState{Info: test.MetaInfo()}
 	sc := meta.NewScope()
 
 	sc.AddVarName("foo", meta.NewTypesMap(`\Foo|int|null`), "test", meta.VarAlwaysDefined)
@@ -88,3 +90,56 @@ class Foo {
 		}
 	})
 }
+
+func BenchmarkRules(b *testing.B) {
+	// A lot of function and method call rules, like in the big rule files.
+	var rfile strings.Builder
+	rfile.WriteString("<?php\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&rfile, "/** @warning don't call f%d */\nf%d($x, ${\"*\"});\n", i, i)
+		fmt.Fprintf(&rfile, "/** @warning don't call m%d */\n$x->m%d(${\"*\"});\n", i, i)
+	}
+	rset, err := rules.NewParser().Parse("<bench>", strings.NewReader(rfile.String()))
+	if err != nil {
+		b.Fatalf("parse rules: %v", err)
+	}
+	rset.Any.BuildIndex()
+	rset.Root.BuildIndex()
+	rset.Local.BuildIndex()
+
+	var code strings.Builder
+	code.WriteString("<?php\nfunction f($x) {\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&code, "  f%d($x, 1);\n  $x->m%d();\n  g%d($x);\n", i*3, i*3, i)
+	}
+	code.WriteString("}\n")
+	contents := []byte(code.String())
+
+	// unindexed returns a copy of the set that runs all rules of the kind.
+	unindexed := func(set *rules.ScopedSet) *rules.ScopedSet {
+		return &rules.ScopedSet{RulesByKind: set.RulesByKind}
+	}
+
+	run := func(b *testing.B, set *rules.Set) {
+		config := linter.NewConfig()
+		config.Rules = set
+		l := linter.NewLinter(config)
+		l.MetaInfo().SetIndexingComplete(true)
+		for i := 0; i < b.N; i++ {
+			if _, _, err := l.ParseContents("bench.php", contents, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("prefilter", func(b *testing.B) {
+		run(b, rset)
+	})
+	b.Run("sequential", func(b *testing.B) {
+		run(b, &rules.Set{
+			Any:   unindexed(rset.Any),
+			Root:  unindexed(rset.Root),
+			Local: unindexed(rset.Local),
+		})
+	})
+}
@@ -0,0 +1,238 @@
+package linttest_test
+
+import (
+	"testing"
+
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/linttest"
+	"github.com/VKCOM/noverify/src/solver"
+)
+
+func TestConstValue(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{`INT`, `10`},
+		{`HEX`, `255`},
+		{`NEG`, `-1`},
+		{`FLOAT`, `1.5`},
+		{`STR`, `"id"`},
+		{`DQ_STR`, `"a\n"`},
+		{`SQ_STR`, `"a\\'b"`},
+		{`BOOL`, `true`},
+		{`NULL`, `null`},
+		{`CONCAT`, `"prefix_id"`},
+		{`SELF_REF`, `"id"`},
+		{`MATH`, `21`},
+		{`DIV`, `2.5`},
+		{`FLAGS`, `7`},
+		{`NOT`, `false`},
+		{`CLASS_NAME`, `"Foo\\Bar"`},
+		{`ARR`, `[0 => 1, 1 => 2, "k" => "id", 2 => 3]`},
+		{`ARR_OVERRIDE`, `[1 => "b"]`},
+		{`ARR_UNION`, `[0 => 1, 1 => 20]`},
+		{`BIG_FLOAT`, `"1.0E+20"`},
+		{`SMALL_FLOAT`, `"1.5E-5"`},
+
+		{`FORWARD`, `1`},
+		{`OTHER_CLASS`, `1`},
+		{`OTHER_CLASS_EXPR`, `"x_1"`},
+		{`OTHER_CLASS_ARR`, `[1 => 1, 2 => "a"]`},
+		{`PARENT`, `2`},
+		{`GLOBAL`, `"global_y"`},
+		{`GLOBAL_NS`, `"ns"`},
+		{`DEFINED`, `"global_y_z"`},
+		{`CYCLE`, `<undefined>`},
+		{`UNKNOWN`, `<undefined>`},
+		{`STATIC`, `<undefined>`},
+		{`VAR`, `<undefined>`},
+		{`HEX_ESCAPE`, `<undefined>`},
+	}
+
+	l := linter.NewLinter(nil)
+	linttest.ParseTestFile(t, l, "global.php", `<?php
+const GLOBAL_Y = 'global_y';
+const NS_NAME = 'root';
+define('DEFINED_Z', GLOBAL_Y . '_z');
+`)
+	linttest.ParseTestFile(t, l, "constvalue.php", `<?php
+namespace Foo;
+
+const NS_NAME = 'ns';
+
+class Baz {
+  const X = 1;
+  const Y = 2;
+}
+
+class Bar extends Baz {
+  const INT = 10;
+  const HEX = 0xff;
+  const NEG = -1;
+  const FLOAT = 1.5;
+  const STR = 'id';
+  const DQ_STR = "a\n";
+  const SQ_STR = 'a\\\'b';
+  const BOOL = TRUE;
+  const NULL = null;
+  const CONCAT = 'prefix_' . self::STR;
+  const SELF_REF = Bar::STR;
+  const MATH = (1 + 2) * 7;
+  const DIV = 5 / 2;
+  const FLAGS = 1 | 2 | 4;
+  const NOT = !self::BOOL;
+  const CLASS_NAME = self::class;
+  const ARR = [1, 2, 'k' => self::STR, 3];
+  const ARR_OVERRIDE = [1 => 'a', '1' => 'b'];
+  const ARR_UNION = [1, 20] + [10, 20, ];
+  const BIG_FLOAT = 1e20 . '';
+  const SMALL_FLOAT = 1.5e-5 . '';
+
+  const FORWARD = self::LATER;
+  const LATER = 1;
+  const OTHER_CLASS = Baz::X;
+  const OTHER_CLASS_EXPR = 'x_' . Baz::X;
+  const OTHER_CLASS_ARR = [Baz::X => 1, 'a'];
+  const PARENT = parent::Y;
+  const GLOBAL = GLOBAL_Y;
+  const GLOBAL_NS = NS_NAME;
+  const DEFINED = \DEFINED_Z;
+  const CYCLE = self::CYCLE2;
+  const CYCLE2 = self::CYCLE;
+  const UNKNOWN = Unknown::X;
+  const STATIC = static::INT;
+  const VAR = $x;
+  const HEX_ESCAPE = "\x41";
+}
+`)
+
+	for _, test := range tests {
+		ci, _, ok := solver.FindConstant(l.MetaInfo(), `\Foo\Bar`, test.name)
+		if !ok {
+			t.Errorf("%s: constant not found", test.name)
+			continue
+		}
+		have := solver.ResolveValue(l.MetaInfo(), ci.Value).String()
+		if have != test.want {
+			t.Errorf("%s value mismatch:\nhave: %s\nwant: %s", test.name, have, test.want)
+		}
+	}
+}
+
+func TestConstValueDupArrayKeys(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+class Keys {
+  const ID = 'id';
+  const ONE = 1;
+}
+
+function f() {
+  $_ = [
+    'id' => 1,
+    Keys::ID => 2,
+  ];
+  $_ = [
+    Keys::ONE => 1,
+    '1' => 2,
+    1.5 => 3,
+    1.0 => 4,
+  ];
+  $_ = [
+    Keys::ID => 1,
+    Keys::ONE => 2,
+    '01' => 3,
+  ];
+}
+`)
+	test.Expect = []string{
+		`Duplicate array key 'id'`,
+		`Duplicate array key '1'`,
+		`Duplicate array key '1'`,
+		`Duplicate array key '1'`,
+	}
+	test.RunAndMatch()
+}
+
+func TestConstValueDupSwitchCase(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+class Mode {
+  const READ = 1;
+  const WRITE = 2;
+  const DEFAULT_MODE = self::READ;
+}
+
+function f($mode) {
+  switch ($mode) {
+  case Mode::READ:
+    return 'r';
+  case Mode::WRITE:
+    return 'w';
+  case Mode::DEFAULT_MODE:
+    return 'd';
+  case '1':
+    return 's';
+  }
+  return '';
+}
+`)
+	test.Expect = []string{
+		`duplicated switch case #3`,
+	}
+	test.RunAndMatch()
+}
+
+func TestConstValueRegexpVet(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.LoadStubs = []string{`stubs/phpstorm-stubs/pcre/pcre.php`}
+	test.AddFile(`<?php
+class Patterns {
+  const DIGITS = '/[\d\d]/';
+  const GOOD = '/\d+/';
+}
+
+function f($s) {
+  preg_match(Patterns::DIGITS, $s);
+  preg_match(Patterns::GOOD, $s);
+}
+`)
+	test.Expect = []string{
+		`'\\d' is duplicated`,
+	}
+	test.RunAndMatch()
+}
+
+func TestConstValueDupSwitchCaseCrossClass(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+const MODE_READ = Mode::READ;
+
+class Alias {
+  const KEY = Mode::READ;
+}
+
+function f($mode) {
+  switch ($mode) {
+  case Mode::READ:
+    return 'r';
+  case Alias::KEY:
+    return 'a';
+  case MODE_READ:
+    return 'm';
+  }
+  return '';
+}
+`)
+	test.AddFile(`<?php
+class Mode {
+  const READ = 1;
+}
+`)
+	test.Expect = []string{
+		`duplicated switch case #2`,
+		`duplicated switch case #3`,
+	}
+	test.RunAndMatch()
+}
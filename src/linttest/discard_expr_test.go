@@ -3,6 +3,7 @@ package linttest_test
 import (
 	"testing"
 
+	"github.com/VKCOM/noverify/src/linter"
 	"github.com/VKCOM/noverify/src/linttest"
 )
 
@@ -160,6 +161,186 @@ pure_fn1(1, 2); // warn 4
 	runFilterMatch(test, "discardExpr")
 }
 
+func TestDiscardExprInferredPurity(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function add($x, $y) {
+  $sum = $x;
+  $sum += $y;
+  return $sum;
+}
+
+function add3($x, $y, $z) {
+  return add(add($x, $y), $z);
+}
+
+function fact($n) {
+  if ($n <= 1) {
+    return 1;
+  }
+  return $n * fact($n - 1);
+}
+
+function sum_list($xs) {
+  $res = [];
+  foreach ($xs as $k => $x) {
+    $res[$k] = add($x, 1);
+  }
+  return $res;
+}
+
+function log_value($x) {
+  echo $x;
+  return $x;
+}
+
+function add_logged($x, $y) {
+  return log_value(add($x, $y));
+}
+
+function inc_ref(&$x) {
+  $x++;
+  return $x;
+}
+
+function call_inc_ref($x) {
+  return inc_ref($x);
+}
+
+function write_global($x) {
+  $GLOBALS['x'] = $x;
+  return $x;
+}
+
+function foreach_ref($xs) {
+  foreach ($xs as &$x) {
+    $x = 0;
+  }
+  return $xs;
+}
+
+function call_closure($x) {
+  $f = function() use ($x) { return $x; };
+  return $f();
+}
+
+function counter() {
+  static $n = 0;
+  return ++$n;
+}
+
+function push($c) {
+  $c['x'] = 1;
+  return $c;
+}
+
+function push_local($c) {
+  $d = [];
+  $d['x'] = $c;
+  return $d;
+}
+
+class Calc {
+  private $total = 0;
+
+  private function double($x) {
+    return $x * 2;
+  }
+
+  public function quad($x) {
+    return $this->double($this->double($x));
+  }
+
+  public function twice($x) {
+    return $this->overridable($x) * 2;
+  }
+
+  public function overridable($x) {
+    return $x;
+  }
+
+  public static function half($x) {
+    return self::div($x, 2);
+  }
+
+  public static function div($x, $y) {
+    return $x / $y;
+  }
+
+  public function addTotal($x) {
+    $this->total += $x;
+    return $this->total;
+  }
+
+  public function addTwice($x) {
+    $this->addTotal($x);
+    return $this->addTotal($x);
+  }
+}
+
+function f() {
+  $c = new Calc();
+
+  add3(1, 2, 3); // warn 1
+  fact(10); // warn 2
+  sum_list([1, 2]); // warn 3
+  $c->quad(1); // warn 4
+  Calc::half(10); // warn 5
+  push_local([]); // warn 6
+
+  add_logged(1, 2);
+  call_inc_ref(1);
+  write_global(1);
+  foreach_ref([1]);
+  call_closure(1);
+  $c->twice(1);
+  $c->addTwice(1);
+  counter();
+  push(new ArrayObject());
+}
+`)
+	test.Expect = []string{
+		`expression evaluated but not used`,
+		`expression evaluated but not used`,
+		`expression evaluated but not used`,
+		`expression evaluated but not used`,
+		`expression evaluated but not used`,
+		`expression evaluated but not used`,
+	}
+	runFilterMatch(test, "discardExpr")
+}
+
+func TestInferredPurityRecompute(t *testing.T) {
+	l := linter.NewLinter(nil)
+	linttest.ParseTestFile(t, l, "dep.php", `<?php
+function dep($x) {
+  echo $x;
+  return $x;
+}
+`)
+	linttest.ParseTestFile(t, l, "user.php", `<?php
+function user($x) {
+  return dep($x);
+}
+`)
+	l.MetaInfo().SetIndexingComplete(true)
+	if fn, _ := l.MetaInfo().GetFunction(`\user`); fn.IsPure() {
+		t.Errorf("user() is pure, but it calls impure dep()")
+	}
+
+	// Only dep.php is changed, like in the language server.
+	l.MetaInfo().SetIndexingComplete(false)
+	linttest.ParseTestFile(t, l, "dep.php", `<?php
+function dep($x) {
+  return $x;
+}
+`)
+	l.MetaInfo().SetIndexingComplete(true)
+	if fn, _ := l.MetaInfo().GetFunction(`\user`); !fn.IsPure() {
+		t.Errorf("user() is not pure after dep() became pure")
+	}
+}
+
 func TestDiscardExpr(t *testing.T) {
 	test := linttest.NewSuite(t)
 	test.AddFile(`<?php
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/VKCOM/noverify/src/linter"
 	"github.com/VKCOM/noverify/src/linttest"
 	"github.com/VKCOM/noverify/src/meta"
 	"github.com/VKCOM/noverify/src/php/parser/node"
@@ -219,6 +220,76 @@ $t1 = tuple_self1(tuple([]));
 	runExprTypeTest(t, &exprTypeTestContext{global: global, local: local}, tests)
 }
 
+func TestExprTypeArrayShape(t *testing.T) {
+	tests := []exprTypeTest{
+		{`["k1" => 123, "k2" => 345]["k1"]`, `int`},
+		{`$row['id']`, `int`},
+		{`$row['name']`, `string`},
+		{`$row['tags']`, `string[]`},
+		{`$row['foo']`, `\Foo`},
+		{`$row['foo']->x`, `float`},
+		{`$row['missing']`, `mixed`},
+		{`$row[$key]`, `int|string|string[]|\Foo`},
+
+		{`$nested['inner']['flag']`, `bool`},
+		{`$int_keys['a']`, `int`},
+		{`$int_keys[10]`, `string`},
+		{`$int_keys['10']`, `string`},
+
+		{`$built['id']`, `int`},
+		{`$built['name']`, `string`},
+		{`$built['id2']`, `float`},
+		{`$redefined['id']`, `string`},
+
+		{`new_row()['id']`, `int`},
+		{`new_row()['foo']`, `\Foo`},
+		{`built_row()['name']`, `string`},
+
+		{`$branches['x']`, `int|string`},
+		{`$branches['y']`, `float`},
+
+		{`$list`, `int[]`},
+		{`$appended['k']`, `string`},
+		{`$appended[0]`, `string`},
+	}
+
+	global := `<?php
+class Foo { public $x = 1.5; }
+
+function new_row() {
+  return ['id' => 1, 'foo' => new Foo()];
+}
+
+function built_row() {
+  $row = [];
+  $row['name'] = 'x';
+  return $row;
+}
+`
+	local := `
+$key = 'id';
+$row = ['id' => 1, 'name' => 'x', 'tags' => ['a', 'b'], 'foo' => new Foo()];
+$nested = ['inner' => ['flag' => true]];
+$int_keys = ['a' => 1, 10 => 'x'];
+$built = [];
+$built['id'] = 1;
+$built['name'] = 'x';
+$built['id2'] = 1.5;
+$redefined = ['id' => 1];
+$redefined['id'] = 'x';
+$branches = ['x' => 1];
+if ($key) {
+  $branches = ['x' => 'str', 'y' => 1.5];
+}
+$list = [];
+$list[0] = 1;
+$list[1] = 2;
+$appended = ['k' => 'v'];
+$appended[] = 'v2';
+`
+	runExprTypeTest(t, &exprTypeTestContext{global: global, local: local}, tests)
+}
+
 func TestExprTypeMagicCall(t *testing.T) {
 	tests := []exprTypeTest{
 		{`$m->magic()`, `\Magic`},
@@ -342,6 +413,74 @@ function alt_generic_intfloat() {}
 	runExprTypeTest(t, &exprTypeTestContext{global: global, local: local}, tests)
 }
 
+func TestExprTypePsalmTypes(t *testing.T) {
+	tests := []exprTypeTest{
+		{`psalm_int()`, `int`},
+		{`psalm_class_string()`, `string`},
+		{`psalm_list()`, `string[]`},
+		{`psalm_non_empty_array()`, `\A[]`},
+		{`psalm_literals()`, `string`},
+		{`psalm_int_literals()`, `int`},
+		{`psalm_key_of()`, `int|string`},
+		{`psalm_callable()`, `callable`},
+		{`psalm_closure()`, `\Closure`},
+		{`psalm_override(0)`, `int[]`},
+		{`phpstan_override()`, `float`},
+		{`$x`, `int`},
+	}
+
+	global := `<?php
+class A {}
+
+/** @return positive-int */
+function psalm_int() {}
+
+/** @return class-string<A> */
+function psalm_class_string() {}
+
+/** @return list<string> */
+function psalm_list() {}
+
+/** @return non-empty-array<string, A> */
+function psalm_non_empty_array() {}
+
+/** @return 'a'|'b' */
+function psalm_literals() {}
+
+/** @return 1|-1 */
+function psalm_int_literals() {}
+
+/** @return key-of<self::MAP> */
+function psalm_key_of() {}
+
+/** @return callable(int, string): bool */
+function psalm_callable() {}
+
+/** @return Closure(): void */
+function psalm_closure() {}
+
+/**
+ * @param int[] $x
+ * @psalm-param list<int> $x
+ * @return array
+ * @psalm-return list<int>
+ */
+function psalm_override($x) { return $x; }
+
+/**
+ * @phpstan-return float
+ * @return int
+ */
+function phpstan_override() {}
+`
+
+	local := `
+/** @psalm-var positive-int $x */
+$x = f();
+`
+	runExprTypeTest(t, &exprTypeTestContext{global: global, local: local}, tests)
+}
+
 func TestExprTypeFixes(t *testing.T) {
 	tests := []exprTypeTest{
 		{`alias_double()`, `float`},
@@ -1036,7 +1175,6 @@ func TestExprTypeArray(t *testing.T) {
 		{`[1.4, 3.5]`, "float[]"},
 		{`["1", "5"]`, "string[]"},
 
-		{`["k1" => 123, "k2" => 345]`, `int[]`},
 		{`[0 => "a", 1 => "b"]`, `string[]`},
 
 		{`[$int, $int]`, "mixed[]"}, // TODO: could be int[]
@@ -1485,10 +1623,11 @@ func runExprTypeTest(t *testing.T, ctx *exprTypeTestContext, tests []exprTypeTes
 		ctx = &exprTypeTestContext{}
 	}
 
-	meta.ResetInfo()
+	l := linter.NewLinter(nil)
+	info := l.MetaInfo()
 	if ctx.stubs != "" {
-		linttest.ParseTestFile(t, "stubs.php", ctx.stubs)
-		meta.Info.InitStubs()
+		linttest.ParseTestFile(t, l, "stubs.php", ctx.stubs)
+		info.InitStubs()
 	}
 	var gw globalsWalker
 	if ctx.global != "" {
@@ -1496,22 +1635,22 @@ func runExprTypeTest(t *testing.T, ctx *exprTypeTestContext, tests []exprTypeTes
 			t.Error("missing <?php tag in global PHP code snippet")
 			return
 		}
-		root, _ := linttest.ParseTestFile(t, "exprtype_global.php", ctx.global)
+		root, _ := linttest.ParseTestFile(t, l, "exprtype_global.php", ctx.global)
 		root.Walk(&gw)
 	}
 	sources := exprTypeSources(ctx, tests, gw.globals)
-	linttest.ParseTestFile(t, "exprtype.php", sources)
-	meta.SetIndexingComplete(true)
-	linttest.ParseTestFile(t, "exprtype.php", sources)
+	linttest.ParseTestFile(t, l, "exprtype.php", sources)
+	info.SetIndexingComplete(true)
+	linttest.ParseTestFile(t, l, "exprtype.php", sources)
 
 	for i, test := range tests {
-		fn, ok := meta.Info.GetFunction(fmt.Sprintf("\\f%d", i))
+		fn, ok := info.GetFunction(fmt.Sprintf("\\f%d", i))
 		if !ok {
 			t.Errorf("missing f%d info", i)
 			continue
 		}
 		have := testTypesMap{
-			Types:   solver.ResolveTypes("", fn.Typ, make(map[string]struct{})),
+			Types:   solver.ResolveTypes(info, "", fn.Typ, make(map[string]struct{})),
 			Precise: fn.Typ.IsPrecise(),
 		}
 		want := makeType(test.expectedType)
@@ -9,21 +9,16 @@ import (
 	"testing"
 
 	"github.com/VKCOM/noverify/src/cmd"
-	"github.com/VKCOM/noverify/src/linter"
 	"github.com/VKCOM/noverify/src/linttest"
 	"github.com/VKCOM/noverify/src/rules"
 	"github.com/google/go-cmp/cmp"
 )
 
 func TestGolden(t *testing.T) {
-	defer func(rset *rules.Set) {
-		linter.Rules = rset
-	}(linter.Rules)
-
 	enableAllRules := func(_ rules.Rule) bool { return true }
 	p := rules.NewParser()
-	linter.Rules = rules.NewSet()
-	if err := cmd.InitEmbeddedRules(p, enableAllRules); err != nil {
+	rset := rules.NewSet()
+	if err := cmd.InitEmbeddedRules(rset, p, enableAllRules); err != nil {
 		t.Fatalf("init embedded rules: %v", err)
 	}
 
@@ -163,6 +158,7 @@ func TestGolden(t *testing.T) {
 			}
 
 			test := linttest.NewSuite(t)
+			test.Config().Rules = rset
 			deps := target.deps
 			deps = append(deps, coreFiles...)
 			test.LoadStubs = deps
@@ -4,7 +4,6 @@ package linttest
 import (
 	"fmt"
 	"strings"
-	"sync"
 	"testing"
 
 	"github.com/VKCOM/noverify/src/cmd"
@@ -53,13 +52,42 @@ type Suite struct {
 	Expect []string
 
 	LoadStubs []string
+
+	// EnableChecks lists the opt-in checks that should be reported.
+	// See optInChecks.
+	EnableChecks []string
+
+	linter *linter.Linter
+}
+
+// optInChecks are the checks that are only reported when
+// they are listed in Suite.EnableChecks.
+//
+// These checks are disabled by default and they report
+// the code that is fine for other checks, so they would
+// require unrelated test fixtures to be changed.
+var optInChecks = map[string]bool{
+	"throws": true,
 }
 
 // NewSuite returns a new linter test suite for t.
 func NewSuite(t testing.TB) *Suite {
-	return &Suite{t: t}
+	return &Suite{
+		t:      t,
+		linter: linter.NewLinter(nil),
+	}
 }
 
+// Config returns the config of the suite linter.
+// It can be changed before RunLinter is called.
+func (s *Suite) Config() *linter.Config { return s.linter.Config() }
+
+// MetaInfo returns the meta info collected by the suite linter.
+func (s *Suite) MetaInfo() *meta.Info { return s.linter.MetaInfo() }
+
+// Linter returns the suite linter.
+func (s *Suite) Linter() *linter.Linter { return s.linter }
+
 // AddFile adds a file to a suite file list.
 // File gets an auto-generated name. If custom name is important,
 // append a properly initialized TestFile to a s Files slice directly.
@@ -143,18 +171,18 @@ func (s *Suite) Match(reports []*linter.Report) {
 // RunLinter executes linter over s Files and returns all issue reports
 // that were produced during that.
 func (s *Suite) RunLinter() []*linter.Report {
-	meta.ResetInfo()
+	s.linter.MetaInfo().Reset()
 
 	if len(s.LoadStubs) != 0 {
-		if err := cmd.LoadEmbeddedStubs(s.LoadStubs); err != nil {
+		if err := cmd.LoadEmbeddedStubs(s.linter, s.LoadStubs); err != nil {
 			s.t.Fatalf("load stubs: %v", err)
 		}
 	}
 	for _, f := range s.Files {
-		parseTestFile(s.t, f)
+		parseTestFile(s.t, s.linter, f)
 	}
 
-	meta.SetIndexingComplete(true)
+	s.linter.MetaInfo().SetIndexingComplete(true)
 
 	var reports []*linter.Report
 	for _, f := range s.Files {
@@ -165,9 +193,9 @@ func (s *Suite) RunLinter() []*linter.Report {
 			continue
 		}
 
-		_, w := parseTestFile(s.t, f)
+		_, w := parseTestFile(s.t, s.linter, f)
 		for _, r := range w.GetReports() {
-			if !r.IsDisabledByUser() {
+			if !r.IsDisabledByUser() && s.checkEnabled(r.CheckName()) {
 				reports = append(reports, r)
 			}
 		}
@@ -176,27 +204,34 @@ func (s *Suite) RunLinter() []*linter.Report {
 	return reports
 }
 
-// ParseTestFile parses given test file.
-func ParseTestFile(t *testing.T, filename, content string) (rootNode node.Node, w *linter.RootWalker) {
-	return parseTestFile(t, TestFile{
+func (s *Suite) checkEnabled(checkName string) bool {
+	if !optInChecks[checkName] {
+		return true
+	}
+	for _, name := range s.EnableChecks {
+		if name == checkName {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTestFile parses given test file with the l linter.
+func ParseTestFile(t *testing.T, l *linter.Linter, filename, content string) (rootNode node.Node, w *linter.RootWalker) {
+	return parseTestFile(t, l, TestFile{
 		Name: filename,
 		Data: []byte(content),
 	})
 }
 
-func init() {
-	var once sync.Once
-	once.Do(func() { go linter.MemoryLimiterThread() })
-}
-
-func parseTestFile(t testing.TB, f TestFile) (rootNode node.Node, w *linter.RootWalker) {
+func parseTestFile(t testing.TB, l *linter.Linter, f TestFile) (rootNode node.Node, w *linter.RootWalker) {
 	var err error
-	rootNode, w, err = linter.ParseContents(f.Name, f.Data, nil)
+	rootNode, w, err = l.ParseContents(f.Name, f.Data, nil)
 	if err != nil {
 		t.Fatalf("could not parse %s: %v", f.Name, err.Error())
 	}
 
-	if !meta.IsIndexingComplete() {
+	if !l.MetaInfo().IsIndexingComplete() {
 		w.UpdateMetaInfo()
 	}
 
@@ -3,17 +3,20 @@ package linttest_test
 import (
 	"testing"
 
-	"github.com/VKCOM/noverify/src/linter"
 	"github.com/VKCOM/noverify/src/linttest"
 	"github.com/client9/misspell"
 )
 
-func init() {
-	linter.TypoFixer = misspell.New()
+var typoFixer = misspell.New()
+
+func newMisspellSuite(t *testing.T) *linttest.Suite {
+	test := linttest.NewSuite(t)
+	test.Config().TypoFixer = typoFixer
+	return test
 }
 
 func TestMisspellPhpdocPositive(t *testing.T) {
-	test := linttest.NewSuite(t)
+	test := newMisspellSuite(t)
 	test.AddFile(`<?php
 /**
  * This function is a pure perfektion.
@@ -51,7 +54,8 @@ class c1 {
 }
 
 func TestMisspellPhpdocNegative(t *testing.T) {
-	linttest.SimpleNegativeTest(t, `<?php
+	test := newMisspellSuite(t)
+	test.AddFile(`<?php
 interface Responsable {}
 
 /**
@@ -79,10 +83,11 @@ class c1 {
   private static function secret() {}
 }
 `)
+	test.RunAndMatch()
 }
 
 func TestMisspellNamePositive(t *testing.T) {
-	test := linttest.NewSuite(t)
+	test := newMisspellSuite(t)
 	test.AddFile(`<?php
 function unconditionnally_rollback() {}
 
@@ -115,7 +120,8 @@ class c {
 }
 
 func TestMisspellNameNegative(t *testing.T) {
-	linttest.SimpleNegativeTest(t, `<?php
+	test := newMisspellSuite(t)
+	test.AddFile(`<?php
 function includ() {
 }
 
@@ -123,4 +129,5 @@ class impelments {}
 
 class PostRedirect {}
 `)
+	test.RunAndMatch()
 }
@@ -365,3 +365,58 @@ func TestPHPDocType(t *testing.T) {
 	}
 	test.RunAndMatch()
 }
+
+func TestPHPDocPsalmTypes(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+/**
+ * @property-read non-empty-string $name
+ */
+class Foo {
+  /** @psalm-var list<Foo> */
+  public $items;
+}
+
+/**
+ * @param array $xs
+ * @psalm-param non-empty-list<positive-int> $xs
+ * @phpstan-param class-string<Foo> $class
+ * @param 'asc'|'desc' $order
+ * @param callable(int, string): bool $pred
+ * @param array-key $key
+ * @return never
+ */
+function f($xs, $class, $order, $pred, $key) {
+  $_ = [$xs, $class, $order, $pred, $key];
+  exit(1);
+}
+
+function g(Foo $foo) {
+  return $foo->name;
+}
+`)
+	test.RunAndMatch()
+}
+
+func TestPHPDocNeverReturnUsed(t *testing.T) {
+	linttest.SimpleNegativeTest(t, `<?php
+/** @return never */
+function fail() { exit(1); }
+
+/** @return no-return */
+function fail2() { exit(1); }
+
+/** @param ?int $x */
+function f($x) {
+  return $x ?? fail();
+}
+
+function g($x) {
+  $_ = $x || fail2();
+}
+
+function h() {
+  fail();
+}
+`)
+}
@@ -1,9 +1,14 @@
 package linttest_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/VKCOM/noverify/src/cmd"
 	"github.com/VKCOM/noverify/src/linter"
 	"github.com/VKCOM/noverify/src/linttest"
 	"github.com/VKCOM/noverify/src/rules"
@@ -364,8 +369,7 @@ func runRulesTest(t *testing.T, test *linttest.Suite, rfile string) {
 	if err != nil {
 		t.Fatalf("parse rules: %v", err)
 	}
-	oldRules := linter.Rules
-	linter.Rules = rset
+	test.Config().Rules = rset
 
 	var filtered []*linter.Report
 	for _, r := range test.RunLinter() {
@@ -374,6 +378,746 @@ func runRulesTest(t *testing.T, test *linttest.Suite, rfile string) {
 		}
 	}
 	test.Match(filtered)
+}
+
+func TestRulesMatchesFilter(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning don't use deprecated $fn function
+ * @matches $fn ^(mysql_|ereg)
+ * @not-matches $fn _escape_string$
+ */
+$fn(${"*"});
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f() {
+  mysql_query('q');
+  mysql_connect();
+  eregi('x', 'y');
+  mysql_real_escape_string('s');
+  preg_match('/x/', 'x');
+  $mysql_fn = 'f';
+}
+`)
+	test.Expect = []string{
+		`don't use deprecated mysql_query function`,
+		`don't use deprecated mysql_connect function`,
+		`don't use deprecated eregi function`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRulesInstanceOfFilter(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning don't pass concatenated strings to PDO::query
+ * @instanceof \PDO|\Queryable $db
+ */
+$db->query($x . $y);
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+interface Queryable {}
+interface Connection extends Queryable {}
+class PDO {
+  public function query($q) { return $q; }
+}
+class MyPDO extends PDO {}
+class Db {
+  public function query($q) { return $q; }
+}
+class Conn implements Connection {
+  public function query($q) { return $q; }
+}
+
+/** @param PDO|Db $maybePDO */
+function f(PDO $pdo, MyPDO $myPDO, Db $db, Conn $conn, $maybePDO, $id) {
+  $pdo->query('SELECT ' . $id);
+  $myPDO->query('SELECT ' . $id);
+  $conn->query('SELECT ' . $id);
+  $maybePDO->query('SELECT ' . $id);
+  $db->query('SELECT ' . $id);
+  $pdo->query('SELECT 1');
+}
+`)
+	test.Expect = []string{
+		`don't pass concatenated strings to PDO::query`,
+		`don't pass concatenated strings to PDO::query`,
+		`don't pass concatenated strings to PDO::query`,
+		`don't pass concatenated strings to PDO::query`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRulesDeclarations(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning controller $name must extend BaseController
+ * @matches $name Controller$
+ * @not-instanceof \BaseController $class
+ */
+class _ {}
+
+/**
+ * @warning public property $name in $class entity
+ */
+class _ extends \Entity {
+  public $_;
+}
+
+/**
+ * @warning static method $class::$name in final class
+ * @matches $name ^get
+ */
+final class _ {
+  public static function _() {}
+}
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+class BaseController {}
+class UserController extends BaseController {}
+class AdminController extends UserController {}
+class NewsController {}
+class Helper {}
+
+abstract class Entity {}
+class User extends Entity {
+  public $name, $email;
+  private $password;
+  var $legacy;
+}
+class Post {
+  public $title;
+}
+
+final class Config {
+  public static function getInstance() {}
+  protected static function getDefaults() {}
+  public function getValue() {}
+  static function getEnv() {}
+}
+`)
+	test.Expect = []string{
+		`controller NewsController must extend BaseController`,
+		`public property $name in User entity`,
+		`public property $email in User entity`,
+		`public property $legacy in User entity`,
+		`static method Config::getInstance in final class`,
+		`static method Config::getEnv in final class`,
+	}
+	runRulesTest(t, test, rfile)
+}
 
-	linter.Rules = oldRules
+func TestRulesStmtList(t *testing.T) {
+	rfile := `<?php
+/**
+ * @maybe unset($x) and unset($y) can be merged
+ * @location $y
+ */
+{
+  ${"*"};
+  unset($x);
+  unset($y);
+  ${"*"};
+}
+
+/**
+ * @warning $f is not closed before return
+ * @location $f
+ * @not-matches $body fclose\(
+ */
+{
+  ${"*"};
+  $f = fopen(${"*"});
+  ${"body:*"};
+  return $_;
+  ${"*"};
+}
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+unset($g1);
+unset($g2);
+
+function f1() {
+  unset($a1);
+  unset($b1);
+  unset($c1);
+}
+
+function f2($cond) {
+  if ($cond) {
+    echo 1;
+    unset($a2);
+    unset($b2);
+  }
+}
+
+function f3() {
+  unset($a3);
+  echo 1;
+  unset($b3);
+}
+
+function f4($x) {
+  switch ($x) {
+  case 1:
+    unset($a4);
+    unset($b4);
+    break;
+  }
+  try {
+    unset($a5);
+    unset($b5);
+  } finally {
+    echo 1;
+  }
+}
+
+function read1() {
+  $fp1 = fopen('a', 'r');
+  $data = fread($fp1, 10);
+  return $data;
+}
+
+function read2() {
+  $fp2 = fopen('a', 'r');
+  $data = fread($fp2, 10);
+  fclose($fp2);
+  return $data;
+}
+
+function read3() {
+  $fp3 = fopen('a', 'r');
+  return $fp3;
+}
+`)
+	test.Expect = []string{
+		`unset($g1) and unset($g2) can be merged`,
+		`unset($a1) and unset($b1) can be merged`,
+		`unset($a2) and unset($b2) can be merged`,
+		`unset($a4) and unset($b4) can be merged`,
+		`unset($a5) and unset($b5) can be merged`,
+		`$fp1 is not closed before return`,
+		`$fp3 is not closed before return`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRulesValueFilter(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning suspicious mode $mode
+ * @value $mode 0777, 0666
+ */
+chmod($_, $mode);
+
+/**
+ * @warning don't use $key key
+ * @value $key "password", 'secret key', true
+ */
+$_[$key];
+
+/**
+ * @warning $fn is a debug function
+ * @value $fn var_dump, print_r
+ */
+$fn(${"*"});
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+const MODE = 0700 | 077;
+
+function f($xs, $mode) {
+  chmod('a', 0777);
+  chmod('a', 511.0);
+  chmod('a', MODE);
+  chmod('a', 0644);
+  chmod('a', $mode);
+  chmod('a', '0777');
+
+  $_ = $xs['password'];
+  $_ = $xs['secret' . ' key'];
+  $_ = $xs[true];
+  $_ = $xs['user'];
+  $_ = $xs[1];
+
+  var_dump($xs);
+  \print_r($xs);
+  Var_Dump($xs);
+  var_export($xs);
+}
+`)
+	test.Expect = []string{
+		`suspicious mode 0777`,
+		`suspicious mode 511.0`,
+		`suspicious mode MODE`,
+		`don't use 'password' key`,
+		`don't use 'secret' . ' key' key`,
+		`don't use true key`,
+		`var_dump is a debug function`,
+		`\print_r is a debug function`,
+		`Var_Dump is a debug function`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRulesNotValueFilter(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning suspicious mode $mode
+ * @not-value $mode 0644, 0755
+ */
+chmod($_, $mode);
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f($mode) {
+  chmod('a', 0777);
+  chmod('a', 0644);
+  chmod('a', 493);
+  chmod('a', $mode);
+}
+`)
+	test.Expect = []string{
+		`suspicious mode 0777`,
+		`suspicious mode $mode`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRulesValueFilterFormat(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning test
+ * @value $x "a\tb\n", 'it\'s', "\"q\"", \Foo\BAR, -1.5, null
+ * @not-value $y '\n', "\x00"
+ */
+f($x, $y);
+`
+	parse := func(rfile string) rules.Filter {
+		rset, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+		if err != nil {
+			t.Fatalf("parse rules: %v", err)
+		}
+		rule := rset.Any.RulesByKind[rules.KindFunctionCall][0]
+		filters := rule.Filters[0]
+		return rules.Filter{Values: filters["x"].Values, NotValues: filters["y"].NotValues}
+	}
+
+	want := parse(rfile)
+	wantStrings := []string{"\"a\\tb\\n\"", `"it's"`, `"\"q\""`, `Foo\BAR`, "-1.5", "null"}
+	for i, v := range want.Values {
+		if v.String() != wantStrings[i] {
+			t.Errorf("value %d: have %s, want %s", i, v.String(), wantStrings[i])
+		}
+	}
+	if want.NotValues[0].Value.Str != `\n` || want.NotValues[1].Value.Str != "\x00" {
+		t.Errorf("unexpected @not-value values: %v", want.NotValues)
+	}
+
+	rset, _ := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+	formatted := "<?php\n" + rset.Any.RulesByKind[rules.KindFunctionCall][0].String() + "\nf($x, $y);\n"
+	have := parse(formatted)
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("formatted rule doesn't round-trip:\n%s", formatted)
+	}
+}
+
+func TestRulesFilterErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{`@matches $x`, `@matches expects exactly 2 params, got 1`},
+		{`@matches x ^a`, `@matches 1st param must be a phpgrep variable`},
+		{`@matches $x (`, `$x: compile regexp: error parsing regexp`},
+		{"@matches $x a\n * @matches $x b", `$x: duplicate @matches constraint`},
+		{`@value $x`, `@value expects at least 2 params, got 1`},
+		{`@value $x 1,`, `$x: empty @value list element`},
+		{`@value $x "abc`, `$x: unterminated string literal`},
+		{`@value $x "a" "b"`, `$x: expected ',' after "a", found "b"`},
+		{`@value $x 1a`, `$x: invalid number literal: 1a`},
+		{`@value $x a-b`, `$x: invalid identifier: a-b`},
+		{`@value $x "\d"`, `$x: invalid string literal: "\d"`},
+		{`@not-value $x`, `@not-value expects at least 2 params, got 1`},
+		{"@not-value $x 1\n * @not-value $x 2", `$x: duplicate @not-value constraint`},
+		{`@test-match`, `@test-match expects a code snippet`},
+		{`@instanceof \PDO`, `@instanceof expects exactly 2 params, got 1`},
+		{`@instanceof \PDO x`, `@instanceof 2nd param must be a phpgrep variable`},
+		{`@instanceof PDO $x`, `$x: PDO is not a fully qualified class name`},
+		{"@instanceof \\A $x\n * @instanceof \\B $x", `$x: duplicate @instanceof constraint`},
+		{"@not-instanceof \\A $x\n * @not-instanceof \\B $x", `$x: duplicate @not-instanceof constraint`},
+		{`@include other.php`, `@include can't be used in a rule comment`},
+	}
+
+	for _, test := range tests {
+		rfile := "<?php\n/**\n * @warning test\n * " + test.rule + "\n */\nf($x);\n"
+		_, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+		if err == nil {
+			t.Errorf("%q: expected an error", test.rule)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: error mismatch:\nhave: %s\nwant: %s", test.rule, err, test.want)
+		}
+	}
+}
+
+func TestRulesIncludes(t *testing.T) {
+	rfile := `<?php
+/**
+ * @include common.php
+ * @include ../shared/strings.php
+ */
+
+/**
+ * @warning don't sleep
+ */
+sleep($_);
+
+/** @include /etc/noverify/rules.php */
+`
+	rset, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	want := []string{"common.php", "../shared/strings.php", "/etc/noverify/rules.php"}
+	if !reflect.DeepEqual(rset.Includes, want) {
+		t.Errorf("includes mismatch:\nhave: %q\nwant: %q", rset.Includes, want)
+	}
+
+	errorTests := []struct {
+		rfile string
+		want  string
+	}{
+		{"<?php\n/** @include */\n", `<test>:2: @include expects exactly 1 param, got 0`},
+		{"<?php\n/**\n * @include a.php b.php\n */\n", `<test>:3: @include expects exactly 1 param, got 2`},
+		{"<?php\n/** @include https://example.com/rules.php */\n", `only local files can be included`},
+	}
+	for _, test := range errorTests {
+		_, err := rules.NewParser().Parse("<test>", strings.NewReader(test.rfile))
+		if err == nil {
+			t.Errorf("%q: expected an error", test.rfile)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: error mismatch:\nhave: %s\nwant: %s", test.rfile, err, test.want)
+		}
+	}
+}
+
+func TestRulesDeclErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`class _ { function _() {} public $_; }`, `declaration pattern can contain at most 1 class member, found 2`},
+		{`class _ { public $a, $b; }`, `property pattern must declare exactly 1 property`},
+		{`class _ { const A = 1; }`, `unsupported declaration pattern member: *stmt.ClassConstList`},
+	}
+
+	for _, test := range tests {
+		rfile := "<?php\n/**\n * @warning test\n */\n" + test.pattern + "\n"
+		_, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+		if err == nil {
+			t.Errorf("%q: expected an error", test.pattern)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: error mismatch:\nhave: %s\nwant: %s", test.pattern, err, test.want)
+		}
+	}
+}
+
+func TestRulesTestAttributes(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning don't compare with null
+ * @test-match $x == null
+ * @test-nomatch $x === null
+ * @test-match if ($x == null) { return; }
+ */
+$x == null;
+`
+	rset, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	var list []rules.Rule
+	for _, kindRules := range rset.Any.RulesByKind {
+		list = append(list, kindRules...)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 rule, found %d", len(list))
+	}
+	want := []rules.RuleTest{
+		{Code: `$x == null`, Match: true},
+		{Code: `$x === null`, Match: false},
+		{Code: `if ($x == null) { return; }`, Match: true},
+	}
+	if !reflect.DeepEqual(list[0].Tests, want) {
+		t.Errorf("tests mismatch:\nhave: %+v\nwant: %+v", list[0].Tests, want)
+	}
+	if list[0].Filename != "<test>" || list[0].Line != 8 {
+		t.Errorf("source location mismatch: have %s:%d, want <test>:8", list[0].Filename, list[0].Line)
+	}
+}
+
+func TestRulesProfile(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning use isset
+ * @matches $arr ^\$cache
+ */
+array_key_exists($k, $arr);
+
+/**
+ * @warning don't sleep
+ */
+sleep(${"*"});
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f($cache, $data) {
+  array_key_exists('a', $cache);
+  array_key_exists('b', $data);
+  array_key_exists('c', $data);
+  strlen('x');
+}
+`)
+	test.Expect = []string{`use isset`}
+
+	test.Config().RulesProfile = true
+	runRulesTest(t, test, rfile)
+
+	profile := test.Linter().GetRulesProfile()
+	if len(profile) != 2 {
+		t.Fatalf("expected 2 profiled rules, found %d", len(profile))
+	}
+	for _, p := range profile {
+		var want [3]int64
+		have := [3]int64{p.Attempts, p.Matches, p.Rejected}
+		switch p.Name {
+		case "<test>:6": // array_key_exists
+			want = [3]int64{4, 1, 2}
+		case "<test>:11": // sleep
+			want = [3]int64{4, 0, 0}
+		default:
+			t.Fatalf("unexpected rule %s", p.Name)
+		}
+		if have != want {
+			t.Errorf("%s: {attempts, matches, rejected} mismatch:\nhave: %v\nwant: %v", p.Name, have, want)
+		}
+	}
+}
+
+func TestRulesPrefilter(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning use isset
+ * @matches $arr ^\$cache
+ */
+array_key_exists($k, $arr);
+
+/**
+ * @warning don't sleep
+ */
+sleep(${"*"});
+
+/**
+ * @warning $f call
+ */
+$f(1);
+`
+	rset, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	rset.Any.BuildIndex()
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f($cache, $data) {
+  array_key_exists('a', $cache);
+  array_key_exists('b', $data);
+  strlen('x');
+  sleep(1);
+}
+`)
+	test.Expect = []string{`use isset`, `don't sleep`, `sleep call`}
+	test.Config().Rules = rset
+	test.Config().RulesProfile = true
+	var filtered []*linter.Report
+	for _, r := range test.RunLinter() {
+		if strings.HasPrefix(r.CheckName(), "<test>") {
+			filtered = append(filtered, r)
+		}
+	}
+	test.Match(filtered)
+
+	// Rules with the literal function names are only tried on the calls
+	// of that function, $f rule is tried on every call.
+	want := map[string][3]int64{
+		"<test>:6":  {2, 1, 1},
+		"<test>:11": {1, 1, 0},
+		"<test>:16": {4, 1, 0},
+	}
+	profile := test.Linter().GetRulesProfile()
+	if len(profile) != len(want) {
+		t.Fatalf("expected %d profiled rules, found %d", len(want), len(profile))
+	}
+	for _, p := range profile {
+		have := [3]int64{p.Attempts, p.Matches, p.Rejected}
+		if have != want[p.Name] {
+			t.Errorf("%s: {attempts, matches, rejected} mismatch:\nhave: %v\nwant: %v", p.Name, have, want[p.Name])
+		}
+	}
+}
+
+func TestRulesProfileSameName(t *testing.T) {
+	rfile := `<?php
+/**
+ * @name sleep
+ * @warning don't sleep for 1 second
+ * @value $x 1
+ */
+sleep($x);
+
+/**
+ * @name sleep
+ * @warning don't sleep
+ */
+sleep($x);
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f() {
+  sleep(1);
+  sleep(2);
+}
+`)
+	test.Expect = []string{`don't sleep for 1 second`, `don't sleep`, `don't sleep`}
+
+	rset, err := rules.NewParser().Parse("<test>", strings.NewReader(rfile))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	test.Config().Rules = rset
+	test.Config().RulesProfile = true
+	runFilterMatch(test, "sleep")
+
+	profile := test.Linter().GetRulesProfile()
+	if len(profile) != 2 {
+		t.Fatalf("expected 2 profiled rules, found %d", len(profile))
+	}
+	for _, p := range profile {
+		var want [3]int64
+		have := [3]int64{p.Attempts, p.Matches, p.Rejected}
+		if p.Name != "sleep" || p.Filename != "<test>" {
+			t.Fatalf("unexpected rule %s at %s:%d", p.Name, p.Filename, p.Line)
+		}
+		switch p.Line {
+		case 7:
+			want = [3]int64{2, 1, 1}
+		case 13:
+			want = [3]int64{2, 2, 0}
+		default:
+			t.Fatalf("unexpected rule location %s:%d", p.Filename, p.Line)
+		}
+		if have != want {
+			t.Errorf("%s:%d: {attempts, matches, rejected} mismatch:\nhave: %v\nwant: %v", p.Filename, p.Line, have, want)
+		}
+	}
+}
+
+func TestRunRuleTests(t *testing.T) {
+	rfile := `<?php
+/**
+ * @name nullCmp
+ * @warning don't compare with null
+ * @test-match $x == null
+ * @test-nomatch $x === null
+ */
+$x == null;
+
+/**
+ * @name localSleep
+ * @warning don't sleep in functions
+ * @scope local
+ * @test-match sleep(1)
+ * @test-match if (true) { sleep(1); }
+ * @test-nomatch usleep(1)
+ */
+sleep($_);
+
+/**
+ * @name brokenTest
+ * @warning don't exit
+ * @test-nomatch exit(1)
+ */
+exit($_);
+`
+	dir, err := ioutil.TempDir("", "noverify-rule-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "rules.php")
+	if err := ioutil.WriteFile(filename, []byte(rfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	failed, total, err := cmd.RunRuleTests(linter.NewLinter(nil), &out, []string{filename})
+	if err != nil {
+		t.Fatalf("run rule tests: %v", err)
+	}
+	if failed != 1 || total != 6 {
+		t.Errorf("have %d/%d failed tests, want 1/6:\n%s", failed, total, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "brokenTest: @test-nomatch failed") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestRuleMatchHook(t *testing.T) {
+	rfile := `<?php
+/**
+ * @maybe $$
+ * @value $fn var_dump
+ */
+$fn($x, ${"*"});
+`
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f($a, $b) {
+  var_dump($a + 1, $b);
+  print_r($a);
+}
+`)
+
+	var matches []*linter.RuleMatch
+	test.Config().RuleMatchHook = func(m *linter.RuleMatch) {
+		matches = append(matches, m)
+	}
+	test.Expect = []string{`var_dump($a + 1, $b)`}
+	runRulesTest(t, test, rfile)
+
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	m := matches[0]
+	if m.Line != 3 || m.Text != `var_dump($a + 1, $b)` {
+		t.Errorf("unexpected match: line=%d text=%q", m.Line, m.Text)
+	}
+	var captures []string
+	for _, c := range m.Captures {
+		captures = append(captures, c.Name+"="+c.Text)
+	}
+	if have, want := strings.Join(captures, " "), "fn=var_dump x=$a + 1"; have != want {
+		t.Errorf("captures mismatch:\nhave: %s\nwant: %s", have, want)
+	}
 }
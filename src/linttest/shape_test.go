@@ -165,3 +165,97 @@ echo $t->good2[0]->value;
 echo $t->good3[1][0]->value;
 `)
 }
+
+func TestUndefinedArrayKey(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function row() {
+  return ['id' => 1, 'name' => 'x'];
+}
+
+function f($cond) {
+  $row = ['id' => 1, 'name' => 'x'];
+  $_ = $row['id'];
+  $_ = $row['title'];
+
+  $built = [];
+  $built['id'] = 1;
+  $_ = $built['id'];
+  $_ = $built['name'];
+
+  $_ = row()['name'];
+  $_ = row()['nam'];
+
+  $maybe = ['a' => 1];
+  if ($cond) {
+    $maybe = ['a' => 1, 'b' => 2];
+  }
+  $_ = $maybe['b']; // OK: may be defined
+  $_ = $maybe['c'];
+}
+`)
+	test.Expect = []string{
+		`Key 'title' is not defined in array{id:int,name:string}`,
+		`Key 'name' is not defined in array{id:int}`,
+		`Key 'nam' is not defined in array{id:int,name:string}`,
+		`Key 'c' is not defined in array{a:int,b:int}|array{a:int}`,
+	}
+	runFilterMatch(test, "undefinedArrayKey")
+}
+
+func TestUndefinedArrayKeyNegative(t *testing.T) {
+	linttest.SimpleNegativeTest(t, `<?php
+/** @param mixed[] $arr */
+function f($arr, $k) {
+  $row = ['id' => 1];
+  $_ = isset($row['name']);
+  $_ = empty($row['name']);
+  $_ = $row['name'] ?? 'default';
+  $row['name'] = 'x';
+  $_ = $row['name'];
+  $_ = $row[$k];
+
+  $list = [1, 2];
+  $_ = $list[10];
+
+  $_ = $arr['key'];
+
+  $dyn = ['id' => 1];
+  $dyn[$k] = 2;
+  $_ = $dyn['name'];
+}
+`)
+}
+
+func TestUndefinedArrayKeyGuarded(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f($cond) {
+  $a = ['id' => 1];
+  if (isset($a['zz'])) {
+    echo $a['zz'];
+  }
+  if (array_key_exists('yy', $a)) {
+    echo $a['yy'];
+  }
+  if (!empty($a['ee'])) {
+    echo $a['ee'];
+  }
+  if ($cond && isset($a['x1'], $a['x2'])) {
+    echo $a['x1'], $a['x2'];
+  }
+  echo isset($a['t']) ? $a['t'] : 0;
+
+  // Guards apply only to the guarded branch and key.
+  if (isset($a['zz'])) {
+    echo $a['yy'];
+  }
+  echo $a['zz'];
+}
+`)
+	test.Expect = []string{
+		`Key 'yy' is not defined in array{id:int}`,
+		`Key 'zz' is not defined in array{id:int}`,
+	}
+	runFilterMatch(test, "undefinedArrayKey")
+}
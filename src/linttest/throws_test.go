@@ -0,0 +1,267 @@
+package linttest_test
+
+import (
+	"testing"
+
+	"github.com/VKCOM/noverify/src/linttest"
+)
+
+const throwsTestClasses = `<?php
+class Exception {}
+class RuntimeException extends Exception {}
+class IOError extends Exception {}
+class NetError extends IOError {}
+class ParseError extends Exception {}
+`
+
+func TestThrowsUndeclared(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.EnableChecks = []string{"throws"}
+	test.AddFile(throwsTestClasses)
+	test.AddFile(`<?php
+function f1() {
+  throw new IOError();
+}
+
+/** @throws IOError */
+function f2() {
+  throw new NetError();
+}
+
+function f3() {
+  f2();
+}
+
+function f4() {
+  throw new RuntimeException();
+}
+
+/** @throws Exception */
+function f5() {
+  f3();
+  throw new ParseError();
+}
+
+function f6() {
+  try {
+    f2();
+  } catch (IOError $e) {
+  }
+}
+
+function f7() {
+  try {
+    f5();
+  } catch (IOError $e) {
+  }
+}
+`)
+	test.Expect = []string{
+		`Exception \IOError is not declared in @throws`,
+		`Exception \NetError is not declared in @throws`,
+		`Exception \ParseError is not declared in @throws`,
+	}
+	runFilterMatch(test, "throws")
+}
+
+func TestThrowsMethods(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.EnableChecks = []string{"throws"}
+	test.AddFile(throwsTestClasses)
+	test.AddFile(`<?php
+interface Reader {
+  /** @throws IOError */
+  public function read();
+}
+
+class FileReader implements Reader {
+  /** @throws IOError */
+  public function read() {
+    throw new IOError();
+  }
+
+  /** @throws ParseError */
+  public function __construct() {
+    $this->parse();
+  }
+
+  /** @throws ParseError */
+  private function parse() {
+    throw new ParseError();
+  }
+
+  public static function create() {
+    return new FileReader();
+  }
+}
+
+function readAll(Reader $r) {
+  $r->read();
+}
+
+/** @throws IOError */
+function readFile(FileReader $r) {
+  $r->read();
+}
+`)
+	test.Expect = []string{
+		`Exception \ParseError is not declared in @throws`,
+		`Exception \IOError is not declared in @throws`,
+	}
+	runFilterMatch(test, "throws")
+}
+
+func TestThrowsNeverThrown(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.EnableChecks = []string{"throws"}
+	test.AddFile(throwsTestClasses)
+	test.AddFile(`<?php
+/** @throws IOError */
+function f1() {
+  return 1;
+}
+
+/** @throws IOError */
+function f2() {
+  throw new NetError();
+}
+
+/** @throws NetError */
+function f3() {
+  f4();
+}
+
+/** @throws IOError */
+function f4() {
+  $f = 'f1';
+  $f();
+}
+
+/**
+ * @throws ParseError
+ * @throws IOError
+ */
+function f5() {
+  try {
+    f2();
+  } catch (IOError $e) {
+  }
+  throw new ParseError();
+}
+`)
+	test.Expect = []string{
+		`@throws \IOError is never thrown`,
+		`@throws \IOError is never thrown`,
+	}
+	runFilterMatch(test, "throws")
+}
+
+func TestThrowsUnreachableCatch(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.EnableChecks = []string{"throws"}
+	test.AddFile(throwsTestClasses)
+	test.AddFile(`<?php
+function pure() { return 1; }
+
+/** @throws NetError */
+function net() { throw new NetError(); }
+
+function f() {
+  try {
+    pure();
+  } catch (IOError $e) {
+  }
+
+  try {
+    net();
+  } catch (IOError $e) {
+  } catch (ParseError $e) {
+  }
+
+  try {
+    net();
+  } catch (Exception $e) {
+  }
+
+  try {
+    try {
+      net();
+    } catch (NetError $e) {
+    }
+  } catch (NetError $e) {
+  }
+
+  try {
+    $x = $GLOBALS['f'];
+    $x();
+  } catch (ParseError $e) {
+  }
+
+  try {
+    throw new RuntimeException();
+  } catch (RuntimeException $e) {
+  }
+}
+`)
+	test.Expect = []string{
+		`Catch of \IOError is unreachable: try block doesn't throw it`,
+		`Catch of \ParseError is unreachable: try block doesn't throw it`,
+		`Catch of \NetError is unreachable: try block doesn't throw it`,
+	}
+	runFilterMatch(test, "throws")
+}
+
+func TestThrowsRethrow(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.EnableChecks = []string{"throws"}
+	test.AddFile(throwsTestClasses)
+	test.AddFile(`<?php
+function pure() { return 1; }
+
+/** @throws NetError */
+function net() { throw new NetError(); }
+
+/** @throws ParseError */
+function parse() { throw new ParseError(); }
+
+/** @throws NetError */
+function f1() {
+  try {
+    net();
+  } catch (Exception $e) {
+    throw $e;
+  }
+}
+
+/** @throws IOError */
+function f2() {
+  try {
+    net();
+    parse();
+  } catch (ParseError $e) {
+  } catch (Exception $e) {
+    throw $e;
+  }
+}
+
+function f3() {
+  try {
+    pure();
+  } catch (Exception $e) {
+    throw $e;
+  }
+}
+
+function f4() {
+  try {
+    net();
+  } catch (IOError $e) {
+    throw $e;
+  }
+}
+`)
+	test.Expect = []string{
+		`Exception \NetError is not declared in @throws`,
+	}
+	runFilterMatch(test, "throws")
+}
@@ -0,0 +1,244 @@
+package meta
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ConstValueKind describes the type of a statically known value.
+type ConstValueKind uint8
+
+const (
+	// ConstUndefined is a value that can't be computed statically.
+	ConstUndefined ConstValueKind = iota
+	ConstNull
+	ConstBool
+	ConstInt
+	ConstFloat
+	ConstString
+	ConstArray
+
+	// ConstRef is a reference to a constant that is resolved after the indexing.
+	// Str is either a global constant name (`\NS\NAME`) or a class
+	// constant name (`\NS\Class::NAME`).
+	ConstRef
+	// ConstExpr is an operation over the values that depend on ConstRef values.
+	// Str is the operator, Items values are the operands.
+	// Array literals use the "[]" operator and keep their keys in Items,
+	// implicit keys are ConstUndefined.
+	ConstExpr
+)
+
+// ConstValue is a statically known value of the constant expression.
+//
+// Only scalars and arrays of such values are representable.
+// Zero value is ConstUndefined.
+type ConstValue struct {
+	Kind  ConstValueKind
+	Bool  bool
+	Int   int64
+	Float float64
+	Str   string
+	Items []ConstArrayItem
+}
+
+// ConstArrayItem is a key-value pair of the ConstArray value.
+type ConstArrayItem struct {
+	Key ConstValue
+	Val ConstValue
+}
+
+func NewIntValue(v int64) ConstValue     { return ConstValue{Kind: ConstInt, Int: v} }
+func NewFloatValue(v float64) ConstValue { return ConstValue{Kind: ConstFloat, Float: v} }
+func NewStringValue(v string) ConstValue { return ConstValue{Kind: ConstString, Str: v} }
+func NewBoolValue(v bool) ConstValue     { return ConstValue{Kind: ConstBool, Bool: v} }
+
+// IsDefined reports whether the value is statically known.
+// Values that are not resolved yet are not known.
+func (v ConstValue) IsDefined() bool { return v.Kind != ConstUndefined && !v.IsLazy() }
+
+// IsLazy reports whether the value depends on the constants
+// that are only resolved after the indexing.
+func (v ConstValue) IsLazy() bool { return v.Kind == ConstRef || v.Kind == ConstExpr }
+
+// IsScalar reports whether the value is known and it's not an array.
+func (v ConstValue) IsScalar() bool {
+	return v.IsDefined() && v.Kind != ConstArray
+}
+
+// ToString converts a scalar value to string the same way PHP does.
+func (v ConstValue) ToString() (string, bool) {
+	switch v.Kind {
+	case ConstNull:
+		return "", true
+	case ConstBool:
+		if v.Bool {
+			return "1", true
+		}
+		return "", true
+	case ConstInt:
+		return strconv.FormatInt(v.Int, 10), true
+	case ConstFloat:
+		return formatFloat(v.Float), true
+	case ConstString:
+		return v.Str, true
+	}
+	return "", false
+}
+
+// formatFloat converts float to string like PHP does with precision=14,
+// so 1e20 becomes "1.0E+20" and 1e-5 becomes "1.0E-5".
+func formatFloat(x float64) string {
+	switch {
+	case math.IsInf(x, 1):
+		return "INF"
+	case math.IsInf(x, -1):
+		return "-INF"
+	case math.IsNaN(x):
+		return "NAN"
+	}
+
+	s := strconv.FormatFloat(x, 'G', 14, 64)
+	i := strings.IndexByte(s, 'E')
+	if i == -1 {
+		return s
+	}
+	mantissa, exp := s[:i], s[i+1:]
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	// Go pads the exponent to 2 digits, PHP doesn't.
+	sign, digits := exp[:1], strings.TrimLeft(exp[1:], "0")
+	return mantissa + "E" + sign + digits
+}
+
+// ToInt converts a scalar value to int the same way PHP does
+// for the well-formed numbers. Non-numeric strings are not converted.
+func (v ConstValue) ToInt() (int64, bool) {
+	switch v.Kind {
+	case ConstNull:
+		return 0, true
+	case ConstBool:
+		if v.Bool {
+			return 1, true
+		}
+		return 0, true
+	case ConstInt:
+		return v.Int, true
+	case ConstFloat:
+		return int64(v.Float), true
+	case ConstString:
+		x, err := strconv.ParseInt(strings.TrimSpace(v.Str), 10, 64)
+		return x, err == nil
+	}
+	return 0, false
+}
+
+// ToFloat converts a scalar value to float.
+// Non-numeric strings are not converted.
+func (v ConstValue) ToFloat() (float64, bool) {
+	switch v.Kind {
+	case ConstFloat:
+		return v.Float, true
+	case ConstString:
+		x, err := strconv.ParseFloat(strings.TrimSpace(v.Str), 64)
+		return x, err == nil
+	}
+	x, ok := v.ToInt()
+	return float64(x), ok
+}
+
+// ToBool converts a value to bool the same way PHP does.
+func (v ConstValue) ToBool() (bool, bool) {
+	switch v.Kind {
+	case ConstNull:
+		return false, true
+	case ConstBool:
+		return v.Bool, true
+	case ConstInt:
+		return v.Int != 0, true
+	case ConstFloat:
+		return v.Float != 0, true
+	case ConstString:
+		return v.Str != "" && v.Str != "0", true
+	case ConstArray:
+		return len(v.Items) != 0, true
+	}
+	return false, false
+}
+
+// ArrayKey returns a normalized array key for the value.
+//
+// Like in PHP, int-like strings, floats and bools are converted to ints,
+// so `1`, `"1"`, `1.5` and `true` keys produce the same result.
+func (v ConstValue) ArrayKey() (ConstValue, bool) {
+	switch v.Kind {
+	case ConstString:
+		if isIntLikeKey(v.Str) {
+			x, err := strconv.ParseInt(v.Str, 10, 64)
+			if err == nil {
+				return NewIntValue(x), true
+			}
+		}
+		return v, true
+	case ConstNull:
+		return NewStringValue(""), true
+	case ConstInt, ConstBool, ConstFloat:
+		x, _ := v.ToInt()
+		return NewIntValue(x), true
+	}
+	return ConstValue{}, false
+}
+
+// String returns a human-readable PHP-like representation of the value.
+func (v ConstValue) String() string {
+	switch v.Kind {
+	case ConstNull:
+		return "null"
+	case ConstBool:
+		if v.Bool {
+			return "true"
+		}
+		return "false"
+	case ConstString:
+		return strconv.Quote(v.Str)
+	case ConstArray:
+		var sb strings.Builder
+		sb.WriteByte('[')
+		for i, item := range v.Items {
+			if i != 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(item.Key.String())
+			sb.WriteString(" => ")
+			sb.WriteString(item.Val.String())
+		}
+		sb.WriteByte(']')
+		return sb.String()
+	case ConstUndefined:
+		return "<undefined>"
+	case ConstRef, ConstExpr:
+		return "<unresolved>"
+	}
+	s, _ := v.ToString()
+	return s
+}
+
+func isIntLikeKey(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+		if s == "0" {
+			return false
+		}
+	}
+	if s == "" || (s[0] == '0' && len(s) > 1) {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -37,6 +37,20 @@ func TestTypeEncoding(t *testing.T) {
 			},
 		},
 
+		{
+			NewInlineShape([]ShapeProp{
+				{Key: `id`, Typ: NewTypesMap(`int`)},
+				{Key: `x`, Typ: NewTypesMap(WrapArrayOf(`\Foo`))},
+			}),
+			`array{id:int,x:\Foo[]}`,
+			func(typ string) bool {
+				props := InlineShapeProps(typ)
+				return len(props) == 2 &&
+					props[0].Key == `id` && props[0].Typ.Is(`int`) &&
+					props[1].Key == `x` && props[1].Typ.IsArrayOf(`\Foo`)
+			},
+		},
+
 		{
 			WrapArrayOf(strings.Repeat(`a`, '|')),
 			strings.Repeat(`a`, '|') + `[]`,
@@ -8,41 +8,10 @@ import (
 	"github.com/VKCOM/noverify/src/php/parser/node/name"
 )
 
-var (
-	internalFunctions         FunctionsMap
-	internalFunctionOverrides FunctionsOverrideMap
-	internalClasses           ClassesMap
-
-	indexingComplete bool
-
-	// Info contains global meta information for all classes, functions, etc.
-	Info info
-)
-
-func init() {
-	ResetInfo()
-}
-
-// ResetInfo creates empty meta info
-func ResetInfo() {
-	Info = info{
-		Scope:                 NewScope(),
-		allFiles:              make(map[string]bool),
-		allTraits:             NewClassesMap(),
-		allClasses:            NewClassesMap(),
-		allFunctions:          NewFunctionsMap(),
-		allConstants:          make(ConstantsMap),
-		allFunctionsOverrides: make(FunctionsOverrideMap),
-		perFileTraits:         make(map[string]ClassesMap),
-		perFileClasses:        make(map[string]ClassesMap),
-		perFileFunctions:      make(map[string]FunctionsMap),
-		perFileConstants:      make(map[string]ConstantsMap),
-	}
-
-	indexingComplete = false
-}
-
-type info struct {
+// Info contains meta information for all classes, functions, etc.
+//
+// Every linter instance has its own Info, see NewInfo.
+type Info struct {
 	sync.Mutex
 	*Scope
 	allFiles              map[string]bool
@@ -55,34 +24,76 @@ type info struct {
 	perFileClasses        map[string]ClassesMap
 	perFileFunctions      map[string]FunctionsMap
 	perFileConstants      map[string]ConstantsMap
+	perFileOverrides      map[string]FunctionsOverrideMap
+	perFileScopes         map[string]*Scope
+
+	// internal* describe the stubs, see InitStubs.
+	internalFunctions         FunctionsMap
+	internalFunctionOverrides FunctionsOverrideMap
+	internalClasses           ClassesMap
+
+	indexingComplete    bool
+	onCompleteCallbacks []func()
+}
+
+// NewInfo creates empty meta info.
+func NewInfo() *Info {
+	i := &Info{
+		internalFunctions:         NewFunctionsMap(),
+		internalFunctionOverrides: make(FunctionsOverrideMap),
+		internalClasses:           NewClassesMap(),
+	}
+	i.Reset()
+	return i
+}
+
+// Reset removes all meta info except the stubs info and the OnIndexingComplete callbacks.
+func (i *Info) Reset() {
+	i.Scope = NewScope()
+	i.allFiles = make(map[string]bool)
+	i.allTraits = NewClassesMap()
+	i.allClasses = NewClassesMap()
+	i.allFunctions = NewFunctionsMap()
+	i.allConstants = make(ConstantsMap)
+	i.allFunctionsOverrides = make(FunctionsOverrideMap)
+	i.perFileTraits = make(map[string]ClassesMap)
+	i.perFileClasses = make(map[string]ClassesMap)
+	i.perFileFunctions = make(map[string]FunctionsMap)
+	i.perFileConstants = make(map[string]ConstantsMap)
+	i.perFileOverrides = make(map[string]FunctionsOverrideMap)
+	i.perFileScopes = make(map[string]*Scope)
+
+	i.indexingComplete = false
 }
 
 // PerFile contains all meta information about the specified file
 type PerFile struct {
-	Traits    ClassesMap
-	Classes   ClassesMap
-	Functions FunctionsMap
-	Constants ConstantsMap
+	Traits            ClassesMap
+	Classes           ClassesMap
+	Functions         FunctionsMap
+	Constants         ConstantsMap
+	FunctionOverrides FunctionsOverrideMap
+	Scope             *Scope // Global scope variables defined in the file
 }
 
-func (i *info) GetConstant(nm string) (res ConstantInfo, ok bool) {
+func (i *Info) GetConstant(nm string) (res ConstantInfo, ok bool) {
 	res, ok = i.allConstants[nm]
 	return res, ok
 }
 
-func (i *info) NumConstants() int {
+func (i *Info) NumConstants() int {
 	return len(i.allConstants)
 }
 
-func (i *info) GetClass(nm string) (res ClassInfo, ok bool) {
+func (i *Info) GetClass(nm string) (res ClassInfo, ok bool) {
 	return i.allClasses.Get(nm)
 }
 
-func (i *info) GetTrait(nm string) (res ClassInfo, ok bool) {
+func (i *Info) GetTrait(nm string) (res ClassInfo, ok bool) {
 	return i.allTraits.Get(nm)
 }
 
-func (i *info) GetClassOrTrait(nm string) (res ClassInfo, ok bool) {
+func (i *Info) GetClassOrTrait(nm string) (res ClassInfo, ok bool) {
 	res, ok = i.allClasses.Get(nm)
 	if ok {
 		return res, true
@@ -91,29 +102,29 @@ func (i *info) GetClassOrTrait(nm string) (res ClassInfo, ok bool) {
 	return res, ok
 }
 
-func (i *info) NumClasses() int {
+func (i *Info) NumClasses() int {
 	return i.allClasses.Len()
 }
 
-func (i *info) GetFunction(nm string) (res FuncInfo, ok bool) {
+func (i *Info) GetFunction(nm string) (res FuncInfo, ok bool) {
 	res, ok = i.allFunctions.Get(nm)
 	return res, ok
 }
 
-func (i *info) GetFunctionOverride(nm string) (res FuncInfoOverride, ok bool) {
+func (i *Info) GetFunctionOverride(nm string) (res FuncInfoOverride, ok bool) {
 	res, ok = i.allFunctionsOverrides[nm]
 	return res, ok
 }
 
-func (i *info) NumFunctions() int {
+func (i *Info) NumFunctions() int {
 	return i.allFunctions.Len()
 }
 
-func (i *info) NumFilesWithFunctions() int {
+func (i *Info) NumFilesWithFunctions() int {
 	return len(i.perFileFunctions)
 }
 
-func (i *info) FindFunctions(substr string) (res []string) {
+func (i *Info) FindFunctions(substr string) (res []string) {
 	for _, fn := range i.allFunctions.H {
 		if strings.HasPrefix(fn.Name, substr) {
 			res = append(res, fn.Name)
@@ -122,7 +133,7 @@ func (i *info) FindFunctions(substr string) (res []string) {
 	return res
 }
 
-func (i *info) FindConstants(substr string) (res []string) {
+func (i *Info) FindConstants(substr string) (res []string) {
 	for c := range i.allConstants {
 		if strings.HasPrefix(c, substr) {
 			res = append(res, c)
@@ -131,43 +142,67 @@ func (i *info) FindConstants(substr string) (res []string) {
 	return res
 }
 
-func (i *info) InitStubs() {
+// AllFunctions returns all known functions.
+//
+// The returned map is shared, so it should only be
+// modified right after the indexing is complete.
+func (i *Info) AllFunctions() FunctionsMap {
+	return i.allFunctions
+}
+
+// AllClasses returns all known classes.
+//
+// The returned map is shared, so it should only be
+// modified right after the indexing is complete.
+func (i *Info) AllClasses() ClassesMap {
+	return i.allClasses
+}
+
+// AllTraits returns all known traits.
+//
+// The returned map is shared, so it should only be
+// modified right after the indexing is complete.
+func (i *Info) AllTraits() ClassesMap {
+	return i.allTraits
+}
+
+func (i *Info) InitStubs() {
 	i.Lock()
 	defer i.Unlock()
 
 	{
-		internalFunctions = NewFunctionsMap()
+		i.internalFunctions = NewFunctionsMap()
 		h := make(map[lowercaseString]FuncInfo, len(i.allFunctions.H))
 		for k, v := range i.allFunctions.H {
 			h[k] = v
 		}
-		internalFunctions.H = h
+		i.internalFunctions.H = h
 	}
 
 	{
-		internalClasses = NewClassesMap()
+		i.internalClasses = NewClassesMap()
 		h := make(map[lowercaseString]ClassInfo, len(i.allClasses.H))
 		for k, v := range i.allClasses.H {
 			h[k] = v
 		}
-		internalClasses.H = h
+		i.internalClasses.H = h
 	}
 
-	internalFunctionOverrides = make(FunctionsOverrideMap)
+	i.internalFunctionOverrides = make(FunctionsOverrideMap)
 	for k, v := range i.allFunctionsOverrides {
-		internalFunctionOverrides[k] = v
+		i.internalFunctionOverrides[k] = v
 	}
 }
 
-func (i *info) AddFilenameNonLocked(filename string) {
+func (i *Info) AddFilenameNonLocked(filename string) {
 	i.allFiles[filename] = true
 }
 
-func (i *info) FileExists(filename string) bool {
+func (i *Info) FileExists(filename string) bool {
 	return i.allFiles[filename]
 }
 
-func (i *info) GetMetaForFile(filename string) (res PerFile) {
+func (i *Info) GetMetaForFile(filename string) (res PerFile) {
 	if t, ok := i.perFileTraits[filename]; ok {
 		res.Traits = t
 	}
@@ -184,10 +219,18 @@ func (i *info) GetMetaForFile(filename string) (res PerFile) {
 		res.Classes = c
 	}
 
+	if o, ok := i.perFileOverrides[filename]; ok {
+		res.FunctionOverrides = o
+	}
+
+	if sc, ok := i.perFileScopes[filename]; ok {
+		res.Scope = sc
+	}
+
 	return res
 }
 
-func (i *info) DeleteMetaForFileNonLocked(filename string) {
+func (i *Info) DeleteMetaForFileNonLocked(filename string) {
 	oldClasses := i.perFileClasses[filename]
 	delete(i.allFiles, filename)
 	delete(i.perFileClasses, filename)
@@ -217,6 +260,9 @@ func (i *info) DeleteMetaForFileNonLocked(filename string) {
 		}
 	}
 
+	delete(i.perFileOverrides, filename)
+	delete(i.perFileScopes, filename)
+
 	oldConstants := i.perFileConstants[filename]
 	delete(i.perFileConstants, filename)
 
@@ -225,7 +271,7 @@ func (i *info) DeleteMetaForFileNonLocked(filename string) {
 	}
 }
 
-func (i *info) AddClassesNonLocked(filename string, m ClassesMap) {
+func (i *Info) AddClassesNonLocked(filename string, m ClassesMap) {
 	i.perFileClasses[filename] = m
 	for k, v := range m.H {
 		// TODO: resolve duplicate class conflicts
@@ -233,7 +279,7 @@ func (i *info) AddClassesNonLocked(filename string, m ClassesMap) {
 	}
 }
 
-func (i *info) AddTraitsNonLocked(filename string, m ClassesMap) {
+func (i *Info) AddTraitsNonLocked(filename string, m ClassesMap) {
 	i.perFileTraits[filename] = m
 	for k, v := range m.H {
 		// TODO: resolve duplicate trait conflicts
@@ -241,7 +287,7 @@ func (i *info) AddTraitsNonLocked(filename string, m ClassesMap) {
 	}
 }
 
-func (i *info) AddFunctionsNonLocked(filename string, m FunctionsMap) {
+func (i *Info) AddFunctionsNonLocked(filename string, m FunctionsMap) {
 	i.perFileFunctions[filename] = m
 
 	allFuncs := i.allFunctions.H
@@ -253,15 +299,15 @@ func (i *info) AddFunctionsNonLocked(filename string, m FunctionsMap) {
 	}
 }
 
-func (i *info) AddFunctionsOverridesNonLocked(filename string, m FunctionsOverrideMap) {
-	// TODO: support filename map
+func (i *Info) AddFunctionsOverridesNonLocked(filename string, m FunctionsOverrideMap) {
+	i.perFileOverrides[filename] = m
 
 	for k, v := range m {
 		i.allFunctionsOverrides[k] = v
 	}
 }
 
-func (i *info) AddConstantsNonLocked(filename string, m ConstantsMap) {
+func (i *Info) AddConstantsNonLocked(filename string, m ConstantsMap) {
 	i.perFileConstants[filename] = m
 
 	for k, v := range m {
@@ -269,7 +315,8 @@ func (i *info) AddConstantsNonLocked(filename string, m ConstantsMap) {
 	}
 }
 
-func (i *info) AddToGlobalScopeNonLocked(filename string, sc *Scope) {
+func (i *Info) AddToGlobalScopeNonLocked(filename string, sc *Scope) {
+	i.perFileScopes[filename] = sc
 	sc.Iterate(func(nm string, typ TypesMap, flags VarFlags) {
 		i.AddVarName(nm, typ, "global", flags)
 	})
@@ -284,6 +331,7 @@ type FuncParam struct {
 type PhpDocInfo struct {
 	Deprecated      bool
 	DeprecationNote string
+	Throws          []string // Exception classes from the @throws tags
 }
 
 type FuncFlags uint8
@@ -293,6 +341,10 @@ const (
 	FuncPure
 	FuncAbstract
 	FuncFinal
+
+	// FuncImpureDeps is set for the FuncPure functions that call impure
+	// functions, it's recomputed every time the indexing is complete.
+	FuncImpureDeps
 )
 
 type FuncInfo struct {
@@ -305,11 +357,43 @@ type FuncInfo struct {
 	Flags        FuncFlags
 	ExitFlags    int // if function has exit/die/throw, then ExitFlags will be <> 0
 	Doc          PhpDocInfo
+
+	// PureDeps are functions that are called from the FuncPure function.
+	// It remains pure only if all of them are pure as well, see FuncImpureDeps.
+	PureDeps []FuncRef
+
+	// ThrowSources are places inside the function body that can throw.
+	ThrowSources []ThrowSource
+
+	// Throws lists exception classes that can escape the function.
+	// It's computed from the ThrowSources after the indexing is complete.
+	// The "mixed" element means that any exception can be thrown.
+	Throws []string
+}
+
+// ThrowSource is a throw statement or a call that can throw an exception.
+type ThrowSource struct {
+	Thrown   TypesMap // Thrown value type, for the throw statements
+	Call     FuncRef  // Called function or method, for the calls
+	Receiver TypesMap // Receiver type, for the instance method calls
+	Caught   []string // Exception classes that are caught around the source
+
+	// Rethrown are the try block sources, for the rethrows of the caught exception.
+	// Thrown holds the catch clause types then.
+	Rethrown []ThrowSource
+}
+
+// FuncRef is a reference to the called function or method.
+type FuncRef struct {
+	Class    string // Empty for functions
+	Name     string // Function FQN or method name
+	Fallback string // Global function name to try if Name is not defined
+	Virtual  bool   // Whether the call can be dispatched to the overriding method
 }
 
 func (info *FuncInfo) IsStatic() bool   { return info.Flags&FuncStatic != 0 }
 func (info *FuncInfo) IsAbstract() bool { return info.Flags&FuncAbstract != 0 }
-func (info *FuncInfo) IsPure() bool     { return info.Flags&FuncPure != 0 }
+func (info *FuncInfo) IsPure() bool     { return info.Flags&(FuncPure|FuncImpureDeps) == FuncPure }
 
 type OverrideType int
 
@@ -357,6 +441,7 @@ type PropertyInfo struct {
 type ConstantInfo struct {
 	Pos         ElementPosition
 	Typ         TypesMap
+	Value       ConstValue // ConstUndefined if value can't be computed statically
 	AccessLevel AccessLevel
 }
 
@@ -385,6 +470,8 @@ func (info *ClassInfo) IsAbstract() bool { return info.Flags&ClassAbstract != 0
 func (info *ClassInfo) IsShape() bool    { return info.Flags&ClassShape != 0 }
 
 type ClassParseState struct {
+	Info *Info
+
 	IsTrait                 bool
 	Namespace               string
 	FunctionUses            map[string]string
@@ -408,42 +495,40 @@ type ElementPosition struct {
 	Length    int32 // body length
 }
 
-func IsInternalClass(className string) bool {
-	_, ok := internalClasses.Get(className)
+func (i *Info) IsInternalClass(className string) bool {
+	_, ok := i.internalClasses.Get(className)
 	return ok
 }
 
-func GetInternalFunctionInfo(fn string) (info FuncInfo, ok bool) {
-	return internalFunctions.Get(fn)
+func (i *Info) GetInternalFunctionInfo(fn string) (info FuncInfo, ok bool) {
+	return i.internalFunctions.Get(fn)
 }
 
-func GetInternalFunctionOverrideInfo(fn string) (info FuncInfoOverride, ok bool) {
-	info, ok = internalFunctionOverrides[fn]
+func (i *Info) GetInternalFunctionOverrideInfo(fn string) (info FuncInfoOverride, ok bool) {
+	info, ok = i.internalFunctionOverrides[fn]
 	return info, ok
 }
 
-var onCompleteCallbacks []func()
-
-func OnIndexingComplete(cb func()) {
-	if indexingComplete {
+func (i *Info) OnIndexingComplete(cb func()) {
+	if i.indexingComplete {
 		cb()
 	} else {
-		onCompleteCallbacks = append(onCompleteCallbacks, cb)
+		i.onCompleteCallbacks = append(i.onCompleteCallbacks, cb)
 	}
 }
 
-func SetIndexingComplete(complete bool) {
-	indexingComplete = complete
+func (i *Info) SetIndexingComplete(complete bool) {
+	i.indexingComplete = complete
 
 	if complete {
-		for _, cb := range onCompleteCallbacks {
+		for _, cb := range i.onCompleteCallbacks {
 			cb()
 		}
 	}
 }
 
-func IsIndexingComplete() bool {
-	return indexingComplete
+func (i *Info) IsIndexingComplete() bool {
+	return i.indexingComplete
 }
 
 func FullyQualifiedToString(n *name.FullyQualified) string {
@@ -160,6 +160,8 @@ func (m TypesMap) Len() int {
 
 // IsArray checks if map contains only array of any type
 //
+// Inline shapes are considered to be arrays as well.
+//
 // Warning: use only for *lazy* types!
 func (m TypesMap) IsArray() bool {
 	if len(m.m) != 1 {
@@ -170,6 +172,9 @@ func (m TypesMap) IsArray() bool {
 		if len(typ) > 0 && typ[0] == WArrayOf {
 			return true
 		}
+		if IsInlineShape(typ) {
+			return true
+		}
 	}
 	return false
 }
@@ -286,6 +291,9 @@ func (m TypesMap) Append(n TypesMap) TypesMap {
 func (m TypesMap) String() string {
 	if len(m.m) == 1 {
 		for k := range m.m {
+			if IsInlineShape(k) {
+				return formatInlineShape(k)
+			}
 			return k
 		}
 	}
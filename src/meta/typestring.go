@@ -274,7 +274,115 @@ func UnwrapConstant(s string) (constName string) {
 	return unwrap1(s)
 }
 
+// ShapeProp is a single key-type pair of an inline array shape.
+type ShapeProp struct {
+	Key string
+	Typ TypesMap
+}
+
+// inlineShapePrefix is a prefix of all inline shape types.
+//
+// It extends the `\shape$` prefix of phpdoc-declared shapes,
+// so code that checks for that prefix handles both kinds of shapes.
+const inlineShapePrefix = `\shape${`
+
+// NewInlineShape returns a shape type that carries its key-type pairs
+// inside the type string itself.
+//
+// Unlike shapes declared via phpdoc, inline shapes don't need
+// a ClassInfo to be registered, so they can be created during
+// the expression type inference (e.g. for array literals).
+//
+// Inline shape is resolved to itself. Prop types can be lazy,
+// they're resolved when an element is being fetched.
+//
+// Format: `\shape${` [Key <string>] [Types <string>] ... `}`
+// where Types is a sequence of <string>, one for every prop type.
+func NewInlineShape(props []ShapeProp) string {
+	var rawBuf [stringLenBytes / 2]byte
+	var b [stringLenBytes]byte
+
+	writeString := func(buf []byte, s string) []byte {
+		binary.LittleEndian.PutUint16(rawBuf[:], uint16(len(s)))
+		hex.Encode(b[:], rawBuf[:])
+		buf = append(buf, b[:]...)
+		return append(buf, s...)
+	}
+
+	buf := make([]byte, 0, len(inlineShapePrefix)+len(props)*16)
+	buf = append(buf, inlineShapePrefix...)
+	for _, p := range props {
+		buf = writeString(buf, p.Key)
+		var types []byte
+		p.Typ.Iterate(func(typ string) {
+			types = writeString(types, typ)
+		})
+		buf = writeString(buf, string(types))
+	}
+	buf = append(buf, '}')
+	return string(buf)
+}
+
+// IsInlineShape reports whether typ was created by NewInlineShape.
+func IsInlineShape(typ string) bool {
+	return strings.HasPrefix(typ, inlineShapePrefix)
+}
+
+// InlineShapeProps returns key-type pairs of the inline shape type.
+// Props are returned in the order they were passed to NewInlineShape.
+func InlineShapeProps(typ string) []ShapeProp {
+	readString := func(s string) (string, string) {
+		var rawBuf [stringLenBytes / 2]byte
+		hex.Decode(rawBuf[:], []byte(s[:stringLenBytes]))
+		l := int(binary.LittleEndian.Uint16(rawBuf[:]))
+		s = s[stringLenBytes:]
+		return s[:l], s[l:]
+	}
+
+	s := typ[len(inlineShapePrefix) : len(typ)-len("}")]
+	var props []ShapeProp
+	for s != "" {
+		var key, types string
+		key, s = readString(s)
+		types, s = readString(s)
+		m := make(map[string]struct{})
+		for types != "" {
+			var t string
+			t, types = readString(types)
+			m[t] = struct{}{}
+		}
+		props = append(props, ShapeProp{Key: key, Typ: NewTypesMapFromMap(m)})
+	}
+	return props
+}
+
+// FindInlineShapeProp returns the prop type for the specified key.
+func FindInlineShapeProp(typ, key string) (TypesMap, bool) {
+	for _, p := range InlineShapeProps(typ) {
+		if p.Key == key {
+			return p.Typ, true
+		}
+	}
+	return TypesMap{}, false
+}
+
+func formatInlineShape(s string) string {
+	props := InlineShapeProps(s)
+	parts := make([]string, len(props))
+	for i, p := range props {
+		types := make([]string, 0, p.Typ.Len())
+		p.Typ.Iterate(func(typ string) {
+			types = append(types, formatType(typ))
+		})
+		parts[i] = p.Key + ":" + strings.Join(types, "|")
+	}
+	return "array{" + strings.Join(parts, ",") + "}"
+}
+
 func formatType(s string) (res string) {
+	if IsInlineShape(s) {
+		return formatInlineShape(s)
+	}
 	if len(s) == 0 || s[0] >= WMax {
 		return s
 	}
@@ -61,6 +61,8 @@ func Parse(parser *TypeParser, doc string) (res []CommentPart) {
 		lines = strings.Split(doc, "\n")
 	}
 
+	var overrides map[partKey]CommentPart
+
 	for i, ln := range lines {
 		ln = strings.TrimSpace(ln)
 		if len(ln) == 0 {
@@ -88,21 +90,90 @@ func Parse(parser *TypeParser, doc string) (res []CommentPart) {
 		}
 		name = strings.TrimPrefix(name, "@")
 
+		// Psalm and PHPStan tags like @psalm-param are parsed
+		// as their plain counterparts, but they take precedence.
+		prefixed := false
+		if baseName := trimToolPrefix(name); typedTags[baseName] {
+			prefixed = baseName != name
+			name = baseName
+		}
+
 		line := i + 1
 		var part CommentPart
 		switch name {
-		case "param", "var", "property":
+		case "param", "var", "property", "property-read", "property-write":
 			part = parseTypeVarComment(parser, line, name, text)
-		case "return":
+		case "return", "throws":
 			part = parseTypeComment(parser, line, name, text)
 		default:
 			part = parseRawComment(line, name, text)
 		}
 
+		if prefixed {
+			if overrides == nil {
+				overrides = make(map[partKey]CommentPart)
+			}
+			key := newPartKey(part)
+			if _, ok := overrides[key]; !ok {
+				overrides[key] = part
+			}
+		}
+
 		res = append(res, part)
 	}
 
-	return res
+	if len(overrides) == 0 {
+		return res
+	}
+
+	// Remove plain tags that are overridden by the prefixed ones.
+	// For the duplicated prefixed tags the first one wins.
+	filtered := res[:0]
+	for _, part := range res {
+		winner, ok := overrides[newPartKey(part)]
+		if ok && winner != part {
+			continue
+		}
+		filtered = append(filtered, part)
+	}
+
+	return filtered
+}
+
+// typedTags is a set of tags that have a type (and optionally a variable) param.
+var typedTags = map[string]bool{
+	"param":          true,
+	"var":            true,
+	"property":       true,
+	"property-read":  true,
+	"property-write": true,
+	"return":         true,
+}
+
+// trimToolPrefix removes Psalm and PHPStan specific tag name prefix.
+func trimToolPrefix(name string) string {
+	switch {
+	case strings.HasPrefix(name, "psalm-"):
+		return strings.TrimPrefix(name, "psalm-")
+	case strings.HasPrefix(name, "phpstan-"):
+		return strings.TrimPrefix(name, "phpstan-")
+	}
+	return name
+}
+
+// partKey identifies the documented entity, so we can
+// find the comment parts that describe the same thing.
+type partKey struct {
+	name string
+	Var  string
+}
+
+func newPartKey(part CommentPart) partKey {
+	key := partKey{name: part.Name()}
+	if part, ok := part.(*TypeVarCommentPart); ok {
+		key.Var = part.Var
+	}
+	return key
 }
 
 func parseRawComment(line int, name, text string) *RawCommentPart {
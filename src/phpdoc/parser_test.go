@@ -112,3 +112,54 @@ func TestParseSimple(t *testing.T) {
 		}
 	}
 }
+
+func TestParseToolPrefixed(t *testing.T) {
+	p := NewTypeParser()
+	want := []CommentPart{
+		&TypeVarCommentPart{
+			line: 3,
+			name: "param",
+			Var:  "$x",
+			Type: p.Parse(`positive-int $x`),
+		},
+		&TypeVarCommentPart{
+			line: 4,
+			name: "param",
+			Var:  "$y",
+			Type: p.Parse(`int $y`),
+		},
+		&TypeCommentPart{
+			line: 6,
+			name: "return",
+			Type: p.Parse(`list<string>`),
+		},
+		&TypeVarCommentPart{
+			line: 7,
+			name: "property-read",
+			Var:  "$z",
+			Type: p.Parse(`string $z`),
+		},
+	}
+
+	got := Parse(p, `/**
+	 * @param int $x
+	 * @psalm-param positive-int $x
+	 * @param int $y
+	 * @return array
+	 * @phpstan-return list<string>
+	 * @property-read string $z
+	 * @psalm-return string[]
+	 */`)
+
+	if len(got) != len(want) {
+		t.Fatalf("len(got) != len(want): %d != %d", len(got), len(want))
+	}
+
+	for i, g := range got {
+		w := want[i]
+
+		if diff := cmp.Diff(g, w, cmp.Exporter(func(reflect.Type) bool { return true })); diff != "" {
+			t.Errorf("%d: (-have +want):\n%s", i, diff)
+		}
+	}
+}
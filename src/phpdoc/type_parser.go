@@ -46,7 +46,7 @@ const (
 	ExprUnknown
 
 	// ExprName is a type that is identified by its name.
-	// Examples: `int` `\Foo\Bar` `$this`
+	// Examples: `int` `\Foo\Bar` `$this` `non-empty-array`
 	ExprName
 
 	// ExprKeyword is a special name-like type node.
@@ -54,7 +54,7 @@ const (
 	ExprSpecialName
 
 	// ExprInt is a digit-only type expression.
-	// Examples: `0` `10`
+	// Examples: `0` `10` `-1`
 	ExprInt
 
 	// ExprKeyVal is `key:val` type.
@@ -113,6 +113,18 @@ const (
 	//
 	// Note: may miss closing `>`.
 	ExprGeneric
+
+	// ExprString is a quoted string literal type.
+	// Examples: `'foo'` `"bar"`
+	//
+	// Note: may miss closing quote.
+	ExprString
+
+	// ExprCallable is a callable signature with a return type.
+	// Examples: `callable(int): string` `Closure(): void`
+	// Args[0] - callable signature (params)
+	// Args[1] - return type
+	ExprCallable
 )
 
 const (
@@ -196,15 +208,33 @@ func (p *TypeParser) parseExpr(precedence byte) *TypeExpr {
 
 	switch {
 	case ch == '$' || ch == '\\' || p.isFirstIdentChar(ch):
-		for p.isNameChar(p.peek()) {
-			p.pos++
+		for {
+			ch := p.peek()
+			if p.isNameChar(ch) {
+				p.pos++
+				continue
+			}
+			// Dash-separated names like `non-empty-array`.
+			if ch == '-' && p.isFirstIdentChar(p.peekAt(p.pos+1)) {
+				p.pos += 2
+				continue
+			}
+			break
 		}
 		left = p.newExpr(ExprName, begin, uint16(p.pos))
-	case p.isDigit(ch):
+	case p.isDigit(ch) || (ch == '-' && p.isDigit(p.peek())):
 		for p.isDigit(p.peek()) {
 			p.pos++
 		}
 		left = p.newExpr(ExprInt, begin, uint16(p.pos))
+	case ch == '\'' || ch == '"':
+		for p.peek() != 0 && p.peek() != ch {
+			p.pos++
+		}
+		if p.peek() == ch {
+			p.pos++
+		}
+		left = p.newExpr(ExprString, begin, uint16(p.pos))
 	case ch == '[':
 		if p.peek() == ']' {
 			p.pos++
@@ -278,6 +308,13 @@ func (p *TypeParser) parseExpr(precedence byte) *TypeExpr {
 		case '?':
 			left = p.newExpr(ExprOptional, begin, uint16(p.pos), left)
 		case ':':
+			if left.Kind == ExprGeneric && left.Shape == ShapeGenericParen {
+				// `callable(T): R` signature; `R` is allowed to be separated by spaces.
+				p.skipWhitespace()
+				result := p.parseExpr(infixPrecedenceTab[':'])
+				left = p.newExpr(ExprCallable, begin, uint16(p.pos), left, result)
+				break
+			}
 			right := p.parseExpr(infixPrecedenceTab[':'])
 			left = p.newExpr(ExprKeyVal, begin, uint16(p.pos), left, right)
 		case '[':
@@ -19,10 +19,27 @@ func TestParser(t *testing.T) {
 		{`foo`, `Name="foo"`},
 		{`\A\B`, `Name="\A\B"`},
 		{`$this`, `Name="$this"`},
+		{`non-empty-array`, `Name="non-empty-array"`},
+		{`class-string`, `Name="class-string"`},
+		{`a-`, `Name="a"`},
+		{`a-1`, `Name="a"`},
 
 		// Ints.
 		{`0`, `Int="0"`},
 		{`1249`, `Int="1249"`},
+		{`-1`, `Int="-1"`},
+
+		// Strings.
+		{`'a'`, `String="'a'"`},
+		{`"foo bar"`, `String=""foo bar""`},
+		{`'a'|'b'`, `Union="'a'|'b'"{String="'a'" String="'b'"}`},
+		{`'a`, `String="'a"`},
+
+		// Callables.
+		{`callable(int): string`, `Callable="callable(int): string"{GenericParen="callable(int)"{Name="callable" Name="int"} Name="string"}`},
+		{`callable():int|false`, `Callable="callable():int|false"{GenericParen="callable()"{Name="callable"} Union="int|false"{Name="int" Name="false"}}`},
+		{`Closure(int, string): void $f`, `Callable="Closure(int, string): void"{GenericParen="Closure(int, string)"{Name="Closure" Name="int" Name="string"} Name="void"}`},
+		{`class-string<T>`, `Generic="class-string<T>"{Name="class-string" Name="T"}`},
 
 		// Special names.
 		{`*`, `SpecialName="*"`},
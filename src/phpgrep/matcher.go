@@ -120,45 +120,53 @@ func (m *matcher) eqArrayItemSlice(state *matcherState, xs, ys []*expr.ArrayItem
 }
 
 func (m *matcher) eqNodeSlice(state *matcherState, xs, ys []node.Node) bool {
-	if len(xs) == 0 && len(ys) != 0 {
-		return false
+	if len(xs) == 0 {
+		return len(ys) == 0
 	}
 
-	matchAny := false
+	if matchMetaVar(xs[0], "*") {
+		// Try the shortest match first and backtrack
+		// if the rest of the pattern doesn't match.
+		for i := 0; i <= len(ys); i++ {
+			numCaptured := len(state.capture)
+			if m.eqNodeSlice(state, xs[1:], ys[i:]) {
+				return true
+			}
+			state.capture = state.capture[:numCaptured]
+		}
+		return false
+	}
 
-	i := 0
-	for i < len(xs) {
-		x := xs[i]
+	return len(ys) != 0 &&
+		m.eqNode(state, xs[0], ys[0]) &&
+		m.eqNodeSlice(state, xs[1:], ys[1:])
+}
 
-		if matchMetaVar(x, "*") {
-			matchAny = true
-		}
+// eqStmtSlice is like eqNodeSlice, but it also handles named `${"name:*"}` gaps.
+// A named gap is captured as a statement list that contains the skipped statements.
+//
+// pos is an index of the first list statement that is not matched yet.
+func (m *matcher) eqStmtSlice(state *matcherState, xs []node.Node, list []node.Node, pos int) bool {
+	if len(xs) == 0 {
+		return pos == len(list)
+	}
 
-		if matchAny {
-			switch {
-			// "Nothing left to match" stop condition.
-			case len(ys) == 0:
-				matchAny = false
-				i++
-			// Lookahead for non-greedy matching.
-			case i+1 < len(xs) && m.eqNode(state, xs[i+1], ys[0]):
-				matchAny = false
-				i += 2
-				ys = ys[1:]
-			default:
-				ys = ys[1:]
-			}
-			continue
-		}
+	name, ok := metaGapName(xs[0])
+	if !ok {
+		return pos < len(list) &&
+			m.eqNode(state, xs[0], list[pos]) &&
+			m.eqStmtSlice(state, xs[1:], list, pos+1)
+	}
 
-		if len(ys) == 0 || !m.eqNode(state, x, ys[0]) {
-			return false
+	for end := pos; end <= len(list); end++ {
+		numCaptured := len(state.capture)
+		matched := name == "_" || m.matchNamed(state, name, stmtRange(list, pos, end))
+		if matched && m.eqStmtSlice(state, xs[1:], list, end) {
+			return true
 		}
-		i++
-		ys = ys[1:]
+		state.capture = state.capture[:numCaptured]
 	}
-
-	return len(ys) == 0
+	return false
 }
 
 func (m *matcher) eqEncapsedStringPartSlice(state *matcherState, xs, ys []node.Node) bool {
@@ -216,7 +224,7 @@ func (m *matcher) eqNode(state *matcherState, x, y node.Node) bool {
 
 	case *stmt.StmtList:
 		y, ok := y.(*stmt.StmtList)
-		return ok && m.eqNodeSlice(state, x.Stmts, y.Stmts)
+		return ok && m.eqStmtSlice(state, x.Stmts, y.Stmts, 0)
 
 	case *stmt.Function:
 		return false // FIXME #23
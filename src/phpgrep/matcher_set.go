@@ -0,0 +1,139 @@
+package phpgrep
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/php/parser/node"
+	"github.com/VKCOM/noverify/src/php/parser/node/expr"
+	"github.com/VKCOM/noverify/src/php/parser/node/name"
+	"github.com/VKCOM/noverify/src/php/parser/node/stmt"
+)
+
+// MatcherSet is a prefilter index for a list of matchers.
+//
+// Matchers are dispatched by the pattern root node type and,
+// for the function and method calls, by the called name.
+// Matchers that can't be dispatched this way (like `$x` pattern)
+// are tried on every node.
+type MatcherSet struct {
+	byType map[reflect.Type][]int
+	byName map[matcherSetKey][]int
+	any    []int
+}
+
+type matcherSetKey struct {
+	typ  reflect.Type
+	name string
+}
+
+// NewMatcherSet creates an index for the matchers list.
+// Nil matchers are tried on every node.
+func NewMatcherSet(matchers []*Matcher) *MatcherSet {
+	set := &MatcherSet{
+		byType: make(map[reflect.Type][]int),
+		byName: make(map[matcherSetKey][]int),
+	}
+
+	for i, m := range matchers {
+		if m == nil || isWildcardPattern(m.m.root) {
+			set.any = append(set.any, i)
+			continue
+		}
+		typ := reflect.TypeOf(m.m.root)
+		if name := dispatchName(m.m.root); name != "" {
+			key := matcherSetKey{typ: typ, name: name}
+			set.byName[key] = append(set.byName[key], i)
+			continue
+		}
+		set.byType[typ] = append(set.byType[typ], i)
+		if root, ok := m.m.root.(*expr.StaticPropertyFetch); ok && nodeIsVar(root.Property) {
+			// `$c::$x` pattern also matches class constant fetches.
+			typ := reflect.TypeOf(&expr.ClassConstFetch{})
+			set.byType[typ] = append(set.byType[typ], i)
+		}
+	}
+
+	return set
+}
+
+// Candidates appends indexes of the matchers that can match n to dst.
+// Indexes are appended in the ascending order.
+func (set *MatcherSet) Candidates(n node.Node, dst []int) []int {
+	typ := reflect.TypeOf(n)
+	var named []int
+	if name := dispatchName(n); name != "" {
+		named = set.byName[matcherSetKey{typ: typ, name: name}]
+	}
+	return mergeIndexes(dst, named, set.byType[typ], set.any)
+}
+
+// isWildcardPattern reports whether pattern root can match the nodes of different types.
+func isWildcardPattern(root node.Node) bool {
+	switch root := root.(type) {
+	case *node.SimpleVar, *node.Var:
+		return true
+	case *stmt.Expression:
+		return nodeIsVar(root.Expr)
+	default:
+		return false
+	}
+}
+
+// dispatchName returns a literal name of the called function or method.
+// Returns an empty string if the name is not a literal.
+func dispatchName(n node.Node) string {
+	switch n := n.(type) {
+	case *expr.FunctionCall:
+		switch nm := n.Function.(type) {
+		case *name.Name:
+			return namePartsKey("n:", nm.Parts)
+		case *name.FullyQualified:
+			return namePartsKey("fq:", nm.Parts)
+		}
+	case *expr.MethodCall:
+		if id, ok := n.Method.(*node.Identifier); ok {
+			return id.Value
+		}
+	case *expr.StaticCall:
+		if id, ok := n.Call.(*node.Identifier); ok {
+			return id.Value
+		}
+	}
+	return ""
+}
+
+func namePartsKey(prefix string, parts []node.Node) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for i, p := range parts {
+		if i != 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteString(p.(*name.NamePart).Value)
+	}
+	return sb.String()
+}
+
+// mergeIndexes appends a sorted union of the sorted lists a, b and c to dst.
+func mergeIndexes(dst, a, b, c []int) []int {
+	for len(a) != 0 || len(b) != 0 || len(c) != 0 {
+		min := -1
+		for _, list := range [...][]int{a, b, c} {
+			if len(list) != 0 && (min == -1 || list[0] < min) {
+				min = list[0]
+			}
+		}
+		dst = append(dst, min)
+		if len(a) != 0 && a[0] == min {
+			a = a[1:]
+		}
+		if len(b) != 0 && b[0] == min {
+			b = b[1:]
+		}
+		if len(c) != 0 && c[0] == min {
+			c = c[1:]
+		}
+	}
+	return dst
+}
@@ -0,0 +1,69 @@
+package phpgrep
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatcherSet(t *testing.T) {
+	patterns := []string{
+		`foo($x)`,
+		`$x`,
+		`\foo($x)`,
+		`$f($x)`,
+		`$x->query($q)`,
+		`$x->$m()`,
+		`A::create()`,
+		`$x::$y`,
+		`$x + $y`,
+		`foo(1)`,
+		`${"var"}`,
+		`Foo::$bar`,
+	}
+	matchers := make([]*Matcher, len(patterns))
+	for i, p := range patterns {
+		matchers[i] = mustCompile(t, p)
+	}
+	set := NewMatcherSet(append(matchers, nil))
+
+	inputs := []struct {
+		code string
+		want []int
+	}{
+		{`foo(1)`, []int{0, 1, 3, 9, 10, 12}},
+		{`bar(1)`, []int{1, 3, 10, 12}},
+		{`\foo(1)`, []int{1, 2, 3, 10, 12}},
+		{`$db->query('a')`, []int{1, 4, 5, 10, 12}},
+		{`$db->exec('a')`, []int{1, 5, 10, 12}},
+		{`A::create()`, []int{1, 6, 10, 12}},
+		{`A::B`, []int{1, 7, 10, 11, 12}},
+		{`A::$b`, []int{1, 7, 10, 11, 12}},
+		{`1 + 2`, []int{1, 8, 10, 12}},
+		{`$v`, []int{1, 10, 12}},
+	}
+
+	var buf []int
+	for _, input := range inputs {
+		n := mustParse(t, input.code)
+		buf = set.Candidates(n, buf[:0])
+		if !reflect.DeepEqual(buf, input.want) {
+			t.Errorf("%s: candidates mismatch:\nhave: %v\nwant: %v", input.code, buf, input.want)
+		}
+
+		// Every matching pattern must be a candidate.
+		for i, m := range matchers {
+			if _, ok := m.Match(n); ok && !containsIndex(buf, i) {
+				t.Errorf("%s: matching pattern %s is not a candidate", input.code, patterns[i])
+			}
+		}
+	}
+}
+
+func containsIndex(list []int, x int) bool {
+	for _, y := range list {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package phpgrep
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -83,6 +84,39 @@ func TestMatchCapture(t *testing.T) {
 	}
 }
 
+func TestMatchCaptureGap(t *testing.T) {
+	matcher := mustCompile(t, `{${'*'}; $f = fopen($_); ${"body:*"}; return $_;}`)
+	tests := []struct {
+		input string
+		body  []string
+	}{
+		{`{$f = fopen("a"); return 1;}`, nil},
+		{`{f(); $f = fopen("a"); g($f); h(); return 1;}`, []string{`g($f);`, `h();`}},
+	}
+	for _, test := range tests {
+		result, ok := matcher.Match(mustParse(t, test.input))
+		if !ok {
+			t.Errorf("%s: pattern not matched", test.input)
+			continue
+		}
+		body, ok := result.CapturedByName("body")
+		if !ok {
+			t.Errorf("%s: body not captured", test.input)
+			continue
+		}
+		var have []string
+		for _, st := range body.(*stmt.StmtList).Stmts {
+			have = append(have, astutil.FmtNode(st))
+		}
+		if !reflect.DeepEqual(have, test.body) {
+			t.Errorf("%s: body mismatched:\nhave: %q\nwant: %q", test.input, have, test.body)
+		}
+		if body.GetPosition() == nil {
+			t.Errorf("%s: body position is not set", test.input)
+		}
+	}
+}
+
 func TestMatchConcurrent(t *testing.T) {
 	matcher := mustCompile(t, `f($x, ${"*"}, $x)`)
 
@@ -260,6 +294,11 @@ func TestMatch(t *testing.T) {
 		{`{1; 2; ${'*'}; 3;}`, `{1; 2; 3;}`},
 		{`{${'*'}; 2; ${'*'};}`, `{1; 2; 3;}`},
 		{`{1; 2; 3; ${'*'};}`, `{1; 2; 3;}`},
+		{`{${'*'}; 1; 2; ${'*'};}`, `{1; 3; 1; 2; 4;}`},
+		{`{${'*'}; unset($x); unset($_); ${'*'};}`, `{f(); unset($a); unset($b);}`},
+		{`{${'*'}; $x = 1; ${'*'}; return $x;}`, `{$a = 1; $b = 1; f($a); return $b;}`},
+		{`{${'*'}; $x = 1; ${"body:*"}; return $x;}`, `{$a = 1; return $a;}`},
+		{`{${"a:*"}; 1; ${"a:*"};}`, `{f(); 1; f();}`},
 
 		{`f(${'*'})`, `f()`},
 		{`f(${'*'})`, `f(1)`},
@@ -269,6 +308,8 @@ func TestMatch(t *testing.T) {
 		{`f(${'*'}, $x, $y, $z)`, `f(1, 2, 3)`},
 		{`f($x, $y, $z, ${'*'})`, `f(1, 2, 3)`},
 		{`f(${'*'}, $x, ${'*'}, $y, ${'*'}, $z, ${'*'})`, `f(1, 2, 3)`},
+		{`f(${'*'}, 1)`, `f(1, 2, 1)`},
+		{`f(${'*'}, $x, ${'*'}, $x)`, `f(1, 2, 3, 2)`},
 
 		{`if ($cond) $_;`, `if (1 == 1) return 1;`},
 		{`if ($cond) $_;`, `if (1 == 1) f();`},
@@ -429,6 +470,10 @@ func TestMatchNegative(t *testing.T) {
 		{`{1;}`, `{1; 2;}`},
 		{`{1; 2;}`, `{1; 2; 3;}`},
 		{`{1; 2; 3;}`, `{1; 2;}`},
+		{`{${'*'}; 1; 2; ${'*'};}`, `{1; 3; 2;}`},
+		{`{${'*'}; unset($x); unset($x); ${'*'};}`, `{unset($a); unset($b);}`},
+		{`{${'*'}; $x = 1; ${'*'}; return $x;}`, `{$a = 1; return $b;}`},
+		{`{${"a:*"}; 1; ${"a:*"};}`, `{f(); 1; g();}`},
 
 		{`f(${'*'}, 4)`, `f(1, 2, 3)`},
 
@@ -3,6 +3,7 @@ package phpgrep
 import (
 	"bytes"
 	"errors"
+	"strings"
 
 	"github.com/VKCOM/noverify/src/php/parser/node"
 	"github.com/VKCOM/noverify/src/php/parser/node/expr"
@@ -166,6 +167,64 @@ func matchMetaVar(n node.Node, s string) bool {
 	}
 }
 
+// metaGapName reports whether n is a `${"*"}` or `${"name:*"}` statement.
+// Anonymous gaps get "_" name.
+func metaGapName(n node.Node) (string, bool) {
+	e, ok := n.(*stmt.Expression)
+	if !ok {
+		return "", false
+	}
+	v, ok := e.Expr.(*node.Var)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.Expr.(*scalar.String)
+	if !ok {
+		return "", false
+	}
+	value := unquoted(s.Value)
+	switch {
+	case value == "*":
+		return "_", true
+	case strings.HasSuffix(value, ":*"):
+		return strings.TrimSuffix(value, ":*"), true
+	default:
+		return "", false
+	}
+}
+
+// stmtRange returns a statement list that contains list[from:to].
+//
+// The list position spans the statements. Empty list gets
+// a zero-length position between the neighbouring statements.
+func stmtRange(list []node.Node, from, to int) *stmt.StmtList {
+	res := &stmt.StmtList{Stmts: list[from:to]}
+
+	switch {
+	case from < to:
+		first := list[from].GetPosition()
+		last := list[to-1].GetPosition()
+		if first != nil && last != nil {
+			res.Position = &position.Position{
+				StartLine: first.StartLine,
+				EndLine:   last.EndLine,
+				StartPos:  first.StartPos,
+				EndPos:    last.EndPos,
+			}
+		}
+	case from < len(list):
+		if next := list[from].GetPosition(); next != nil {
+			res.Position = position.NewPosition(next.StartLine, next.StartLine, next.StartPos, next.StartPos)
+		}
+	case from > 0:
+		if prev := list[from-1].GetPosition(); prev != nil {
+			res.Position = position.NewPosition(prev.EndLine, prev.EndLine, prev.EndPos, prev.EndPos)
+		}
+	}
+
+	return res
+}
+
 func parsePHP7(code []byte) (node.Node, []byte, error) {
 	if bytes.HasPrefix(code, []byte("<?")) || bytes.HasPrefix(code, []byte("<?php")) {
 		n, err := parsePHP7root(code)
@@ -7,9 +7,12 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/VKCOM/noverify/src/linter/lintapi"
+	"github.com/VKCOM/noverify/src/meta"
 	"github.com/VKCOM/noverify/src/php/parser/freefloating"
 	"github.com/VKCOM/noverify/src/php/parser/node"
 	"github.com/VKCOM/noverify/src/php/parser/node/stmt"
@@ -64,14 +67,56 @@ func (p *parser) parse(filename string, r io.Reader) (*Set, error) {
 	p.sources = sources
 	p.res = res
 	for _, st := range root.Stmts {
+		if err := p.parseIncludes((*st.GetFreeFloating())[freefloating.Start]); err != nil {
+			return p.res, err
+		}
 		if err := p.parseRule(st); err != nil {
 			return p.res, err
 		}
 	}
+	if err := p.parseIncludes(root.FreeFloating[freefloating.End]); err != nil {
+		return p.res, err
+	}
 
 	return p.res, nil
 }
 
+// parseIncludes collects @include attributes from the doc comments that don't describe rules.
+func (p *parser) parseIncludes(comments []freefloating.String) error {
+	for _, ff := range comments {
+		if ff.StringType != freefloating.CommentType || !strings.HasPrefix(ff.Value, "/**") {
+			continue
+		}
+		if magicComment.MatchString(ff.Value) {
+			continue
+		}
+		for _, part := range phpdoc.Parse(p.typeParser, ff.Value) {
+			part, ok := part.(*phpdoc.RawCommentPart)
+			if !ok || part.Name() != "include" {
+				continue
+			}
+			lineNum := ff.Position.StartLine + part.Line() - 1
+			if len(part.Params) != 1 {
+				return &parseError{
+					filename: p.filename,
+					lineNum:  lineNum,
+					msg:      fmt.Sprintf("@include expects exactly 1 param, got %d", len(part.Params)),
+				}
+			}
+			path := part.Params[0]
+			if strings.Contains(path, "://") {
+				return &parseError{
+					filename: p.filename,
+					lineNum:  lineNum,
+					msg:      fmt.Sprintf("@include %s: only local files can be included", path),
+				}
+			}
+			p.res.Includes = append(p.res.Includes, path)
+		}
+	}
+	return nil
+}
+
 func (p *parser) parseRule(st node.Node) error {
 	comment := ""
 	for _, ff := range (*st.GetFreeFloating())[freefloating.Start] {
@@ -88,7 +133,9 @@ func (p *parser) parseRule(st node.Node) error {
 	}
 
 	var rule Rule
-	rule.Name = fmt.Sprintf("%s:%d", filepath.Base(p.filename), st.GetPosition().StartLine)
+	rule.Filename = p.filename
+	rule.Line = st.GetPosition().StartLine
+	rule.Name = fmt.Sprintf("%s:%d", filepath.Base(p.filename), rule.Line)
 	critical := false
 	unnamed := true
 
@@ -199,6 +246,97 @@ func (p *parser) parseRule(st node.Node) error {
 			filter := filterSet[name]
 			filter.Pure = true
 			filterSet[name] = filter
+		case "instanceof", "not-instanceof":
+			if len(part.Params) != 2 {
+				return p.errorf(st, "@%s expects exactly 2 params, got %d", part.Name(), len(part.Params))
+			}
+			name := part.Params[1]
+			if !strings.HasPrefix(name, "$") {
+				return p.errorf(st, "@%s 2nd param must be a phpgrep variable", part.Name())
+			}
+			name = strings.TrimPrefix(name, "$")
+			if filterSet == nil {
+				filterSet = map[string]Filter{}
+			}
+			filter := filterSet[name]
+			dst := &filter.InstanceOf
+			if part.Name() == "not-instanceof" {
+				dst = &filter.NotInstanceOf
+			}
+			if *dst != nil {
+				return p.errorf(st, "$%s: duplicate @%s constraint", name, part.Name())
+			}
+			for _, className := range strings.Split(part.Params[0], "|") {
+				if !strings.HasPrefix(className, `\`) || len(className) == 1 {
+					return p.errorf(st, "$%s: %s is not a fully qualified class name", name, className)
+				}
+				*dst = append(*dst, className)
+			}
+			filterSet[name] = filter
+		case "matches", "not-matches":
+			if len(part.Params) < 2 {
+				return p.errorf(st, "@%s expects exactly 2 params, got %d", part.Name(), len(part.Params))
+			}
+			name := part.Params[0]
+			if !strings.HasPrefix(name, "$") {
+				return p.errorf(st, "@%s 1st param must be a phpgrep variable", part.Name())
+			}
+			name = strings.TrimPrefix(name, "$")
+			pattern := strings.TrimSpace(strings.TrimPrefix(part.ParamsText, part.Params[0]))
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return p.errorf(st, "$%s: compile regexp: %v", name, err)
+			}
+			if filterSet == nil {
+				filterSet = map[string]Filter{}
+			}
+			filter := filterSet[name]
+			dst := &filter.Regexp
+			if part.Name() == "not-matches" {
+				dst = &filter.NotRegexp
+			}
+			if *dst != nil {
+				return p.errorf(st, "$%s: duplicate @%s constraint", name, part.Name())
+			}
+			*dst = re
+			filterSet[name] = filter
+		case "value", "not-value":
+			if len(part.Params) < 2 {
+				return p.errorf(st, "@%s expects at least 2 params, got %d", part.Name(), len(part.Params))
+			}
+			name := part.Params[0]
+			if !strings.HasPrefix(name, "$") {
+				return p.errorf(st, "@%s 1st param must be a phpgrep variable", part.Name())
+			}
+			name = strings.TrimPrefix(name, "$")
+			values, err := parseFilterValues(strings.TrimPrefix(part.ParamsText, part.Params[0]))
+			if err != nil {
+				return p.errorf(st, "$%s: %v", name, err)
+			}
+			if filterSet == nil {
+				filterSet = map[string]Filter{}
+			}
+			filter := filterSet[name]
+			dst := &filter.Values
+			if part.Name() == "not-value" {
+				dst = &filter.NotValues
+			}
+			if *dst != nil {
+				return p.errorf(st, "$%s: duplicate @%s constraint", name, part.Name())
+			}
+			*dst = values
+			filterSet[name] = filter
+		case "test-match", "test-nomatch":
+			if len(part.Params) == 0 {
+				return p.errorf(st, "@%s expects a code snippet", part.Name())
+			}
+			rule.Tests = append(rule.Tests, RuleTest{
+				Code:  part.ParamsText,
+				Match: part.Name() == "test-match",
+			})
+
+		case "include":
+			return p.errorf(st, "@include can't be used in a rule comment")
 
 		default:
 			return p.errorf(st, "unknown attribute @%s on line %d", part.Name(), part.Line())
@@ -216,6 +354,24 @@ func (p *parser) parseRule(st node.Node) error {
 		rule.Filters = append(rule.Filters, filterSet)
 	}
 
+	if class, ok := st.(*stmt.Class); ok {
+		// Declarations are never nested into functions,
+		// so declaration rules are always in the root set.
+		if rule.scope != "" {
+			return p.errorf(st, "@scope can't be used with declaration patterns")
+		}
+		decl, err := p.parseDeclPattern(class)
+		if err != nil {
+			return err
+		}
+		rule.Decl = decl
+		if rule.Location == "" {
+			rule.Location = "name"
+		}
+		p.res.Root.RulesByKind[decl.Kind] = append(p.res.Root.RulesByKind[decl.Kind], rule)
+		return nil
+	}
+
 	pos := st.GetPosition()
 	m, err := p.compiler.Compile(p.sources[pos.StartPos-1 : pos.EndPos])
 	if err != nil {
@@ -235,6 +391,75 @@ func (p *parser) parseRule(st node.Node) error {
 	return nil
 }
 
+// parseDeclPattern converts a class declaration from the rules file into a pattern.
+// The class can contain at most one member: a method or a property.
+func (p *parser) parseDeclPattern(class *stmt.Class) (*DeclPattern, error) {
+	decl := &DeclPattern{
+		Kind:           KindClass,
+		ClassName:      declPatternName(class.ClassName.Value),
+		ClassModifiers: declModifiers(class.Modifiers),
+	}
+	if class.Extends != nil {
+		decl.Extends = append(decl.Extends, declClassName(class.Extends.ClassName))
+	}
+	if class.Implements != nil {
+		for _, iface := range class.Implements.InterfaceNames {
+			decl.Extends = append(decl.Extends, declClassName(iface))
+		}
+	}
+
+	if len(class.Stmts) > 1 {
+		return nil, p.errorf(class, "declaration pattern can contain at most 1 class member, found %d", len(class.Stmts))
+	}
+	for _, member := range class.Stmts {
+		switch member := member.(type) {
+		case *stmt.ClassMethod:
+			decl.Kind = KindClassMethod
+			decl.MemberName = declPatternName(member.MethodName.Value)
+			decl.MemberModifiers = declModifiers(member.Modifiers)
+		case *stmt.PropertyList:
+			if len(member.Properties) != 1 {
+				return nil, p.errorf(member, "property pattern must declare exactly 1 property")
+			}
+			decl.Kind = KindPropertyList
+			decl.MemberName = declPatternName(member.Properties[0].(*stmt.Property).Variable.Name)
+			decl.MemberModifiers = declModifiers(member.Modifiers)
+		default:
+			return nil, p.errorf(member, "unsupported declaration pattern member: %T", member)
+		}
+	}
+
+	return decl, nil
+}
+
+// declPatternName returns a name to match, "_" matches any name.
+func declPatternName(name string) string {
+	if name == "_" {
+		return ""
+	}
+	return name
+}
+
+func declClassName(n node.Node) string {
+	className := meta.NameNodeToString(n)
+	if !strings.HasPrefix(className, `\`) {
+		className = `\` + className
+	}
+	return className
+}
+
+func declModifiers(list []*node.Identifier) []string {
+	var modifiers []string
+	for _, m := range list {
+		modifier := strings.ToLower(m.Value)
+		if modifier == "var" {
+			modifier = "public"
+		}
+		modifiers = append(modifiers, modifier)
+	}
+	return modifiers
+}
+
 func (p *parser) errorf(n node.Node, format string, args ...interface{}) *parseError {
 	pos := n.GetPosition()
 	return &parseError{
@@ -243,3 +468,127 @@ func (p *parser) errorf(n node.Node, format string, args ...interface{}) *parseE
 		msg:      fmt.Sprintf(format, args...),
 	}
 }
+
+// parseFilterValues parses a comma-separated @value list.
+//
+// Every element is either a literal (number, quoted string, true, false or null)
+// or an identifier name. Whitespace around the elements is ignored.
+func parseFilterValues(s string) ([]FilterValue, error) {
+	var values []FilterValue
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, errors.New("empty @value list element")
+		}
+
+		var elem string
+		if s[0] == '"' || s[0] == '\'' {
+			end := closingQuote(s)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string literal: %s", s)
+			}
+			elem = s[:end+1]
+			s = s[end+1:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end == -1 {
+				end = len(s)
+			}
+			elem = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+
+		v, err := parseFilterValue(elem)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return values, nil
+		}
+		if s[0] != ',' {
+			return nil, fmt.Errorf("expected ',' after %s, found %s", elem, s)
+		}
+		s = s[1:]
+	}
+}
+
+func parseFilterValue(s string) (FilterValue, error) {
+	switch strings.ToLower(s) {
+	case "true":
+		return FilterValue{Value: meta.NewBoolValue(true)}, nil
+	case "false":
+		return FilterValue{Value: meta.NewBoolValue(false)}, nil
+	case "null":
+		return FilterValue{Value: meta.ConstValue{Kind: meta.ConstNull}}, nil
+	}
+
+	switch {
+	case s[0] == '"' || s[0] == '\'':
+		str, err := unquoteFilterString(s)
+		if err != nil {
+			return FilterValue{}, err
+		}
+		return FilterValue{Value: meta.NewStringValue(str)}, nil
+	case s[0] == '-' || s[0] == '.' || (s[0] >= '0' && s[0] <= '9'):
+		if x, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return FilterValue{Value: meta.NewIntValue(x)}, nil
+		}
+		if x, err := strconv.ParseFloat(s, 64); err == nil {
+			return FilterValue{Value: meta.NewFloatValue(x)}, nil
+		}
+		return FilterValue{}, fmt.Errorf("invalid number literal: %s", s)
+	}
+
+	name := strings.TrimPrefix(s, `\`)
+	for _, ch := range name {
+		if ch != '_' && ch != '\\' && !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
+			return FilterValue{}, fmt.Errorf("invalid identifier: %s", s)
+		}
+	}
+	return FilterValue{Name: name}, nil
+}
+
+// closingQuote returns the index of the quote that terminates
+// the string literal that starts at s[0].
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// unquoteFilterString removes quotes and backslash escaping.
+//
+// Double-quoted strings use the Go escaping, like "a\tb" or "\x00",
+// the same as FilterValue.String produces.
+// Single-quoted strings only recognize escaped quotes and backslashes, like in PHP.
+func unquoteFilterString(s string) (string, error) {
+	if s[0] == '"' {
+		str, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string literal: %s", s)
+		}
+		return str, nil
+	}
+	s = s[1 : len(s)-1]
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '\'' || s[i+1] == '\\') {
+			i++
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String(), nil
+}
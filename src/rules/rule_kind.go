@@ -37,9 +37,15 @@ const (
 	KindRequire
 	KindLoop
 	KindCast
+	KindStmtList      // Statement blocks and bodies
 	KindOther         // All remaining kinds that are not None
 	KindOtherUnlikely // Second Other category, even less priority
 
+	// Declaration kinds, only used by the DeclPattern rules.
+	KindClass
+	KindClassMethod
+	KindPropertyList
+
 	_KindCount // Should be always the last one
 )
 
@@ -186,6 +192,18 @@ func CategorizeNode(n node.Node) RuleKind {
 		*expr.ConstFetch:
 		return KindConst
 
+	case *stmt.StmtList:
+		return KindStmtList
+
+	case *stmt.Class:
+		return KindClass
+
+	case *stmt.ClassMethod:
+		return KindClassMethod
+
+	case *stmt.PropertyList:
+		return KindPropertyList
+
 	default:
 		return KindNone
 	}
@@ -2,7 +2,11 @@ package rules
 
 import (
 	"io"
+	"regexp"
+	"strconv"
 
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/php/parser/node"
 	"github.com/VKCOM/noverify/src/phpdoc"
 	"github.com/VKCOM/noverify/src/phpgrep"
 )
@@ -13,6 +17,10 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
+// Parse reads the rules file from r.
+//
+// The returned set has no prefilter index, since the sets of several files
+// are usually merged first. See ScopedSet.BuildIndex.
 func (*Parser) Parse(filename string, r io.Reader) (*Set, error) {
 	p := parser{typeParser: phpdoc.NewTypeParser()}
 	return p.parse(filename, r)
@@ -35,12 +43,55 @@ type Set struct {
 
 	AlwaysAllowed  []string // All unnamed rules
 	AlwaysCritical []string // Unnamed rules of warning or error level
+
+	// Includes are the @include paths, as written in the rule file.
+	// Relative paths are relative to the rule file directory.
+	Includes []string
 }
 
 // ScopedSet is a categorized rules collection.
 // Categories help to assign a better execution strategy for a rule.
 type ScopedSet struct {
 	RulesByKind [_KindCount][]Rule
+
+	// index is a per-kind prefilter for the rules, see BuildIndex.
+	index [_KindCount]*phpgrep.MatcherSet
+}
+
+// BuildIndex compiles the rules of every kind into a combined matcher,
+// so Candidates can skip the rules that can't match a node.
+//
+// It should be called again after RulesByKind modification.
+// It's a no-op for a nil set.
+func (set *ScopedSet) BuildIndex() {
+	if set == nil {
+		return
+	}
+	for kind, list := range &set.RulesByKind {
+		if len(list) == 0 {
+			set.index[kind] = nil
+			continue
+		}
+		matchers := make([]*phpgrep.Matcher, len(list))
+		for i := range list {
+			matchers[i] = list[i].Matcher
+		}
+		set.index[kind] = phpgrep.NewMatcherSet(matchers)
+	}
+}
+
+// Candidates appends indexes of the RulesByKind[kind] rules that can match n to dst.
+// Indexes are appended in the rules order.
+//
+// If the index is not built, all rules of the kind are candidates.
+func (set *ScopedSet) Candidates(kind RuleKind, n node.Node, dst []int) []int {
+	if index := set.index[kind]; index != nil {
+		return index.Candidates(n, dst)
+	}
+	for i := range set.RulesByKind[kind] {
+		dst = append(dst, i)
+	}
+	return dst
 }
 
 // Rule is a dynamically-loaded linter rule.
@@ -74,9 +125,49 @@ type Rule struct {
 	// Every filter set is a mapping of phpgrep variable to a filter.
 	Filters []map[string]Filter
 
+	// Decl is a declaration pattern that is used instead of the Matcher
+	// for the rules that match classes, methods and properties.
+	Decl *DeclPattern
+
+	// Tests are code snippets from @test-match and @test-nomatch attributes.
+	// See `noverify test-rules` command.
+	Tests []RuleTest
+
+	// Filename and Line locate the rule definition in the rules file.
+	Filename string
+	Line     int
+
 	scope string
 }
 
+// DeclPattern is a class, method or property declaration pattern.
+//
+// Member patterns also constrain the class that contains the member.
+// Names are matched case-insensitively, empty name matches any name.
+type DeclPattern struct {
+	// Kind is KindClass, KindClassMethod or KindPropertyList.
+	Kind RuleKind
+
+	ClassName      string
+	ClassModifiers []string
+
+	// Extends lists the classes and interfaces that the class
+	// should extend or implement, directly or through its parents.
+	Extends []string
+
+	MemberName      string
+	MemberModifiers []string
+}
+
+// RuleTest is a code snippet that is used to verify the rule behavior.
+type RuleTest struct {
+	// Code is a PHP code without the opening <?php tag.
+	Code string
+
+	// Match tells whether the rule is expected to match the Code.
+	Match bool
+}
+
 // String returns a rule printer representation.
 func (r *Rule) String() string {
 	return formatRule(r)
@@ -86,4 +177,48 @@ func (r *Rule) String() string {
 type Filter struct {
 	Type *phpdoc.Type
 	Pure bool
+
+	// InstanceOf is an @instanceof constraint: node type must include
+	// one of the listed classes, their subclasses or implementations.
+	InstanceOf []string
+
+	// NotInstanceOf is a @not-instanceof constraint: node type must not
+	// include any of the listed classes, their subclasses or implementations.
+	NotInstanceOf []string
+
+	// Regexp is a @matches constraint: node source text must match it.
+	Regexp *regexp.Regexp
+
+	// NotRegexp is a @not-matches constraint: node source text must not match it.
+	NotRegexp *regexp.Regexp
+
+	// Values is a @value constraint: node must be equal to one of the listed
+	// constant values or have one of the listed names.
+	Values []FilterValue
+
+	// NotValues is a @not-value constraint: node must not be equal to any
+	// of the listed constant values and must not have any of the listed names.
+	NotValues []FilterValue
+}
+
+// FilterValue is a @value filter list element.
+//
+// If Name is not empty, it's an identifier that is compared with
+// the function, constant, class or variable name.
+// Otherwise it's a literal that is compared with the constant expression value.
+type FilterValue struct {
+	Name  string
+	Value meta.ConstValue
+}
+
+// String returns a value representation that can be parsed by @value.
+func (v FilterValue) String() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	if v.Value.Kind == meta.ConstString {
+		// See unquoteFilterString.
+		return strconv.Quote(v.Value.Str)
+	}
+	return v.Value.String()
 }
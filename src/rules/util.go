@@ -41,12 +41,46 @@ func formatRule(r *Rule) string {
 				buf.WriteString(filter.Type.String())
 				buf.WriteString(" $" + name + "\n")
 			}
+			if filter.InstanceOf != nil {
+				buf.WriteString(" * @instanceof " + strings.Join(filter.InstanceOf, "|") + " $" + name + "\n")
+			}
+			if filter.NotInstanceOf != nil {
+				buf.WriteString(" * @not-instanceof " + strings.Join(filter.NotInstanceOf, "|") + " $" + name + "\n")
+			}
+			if filter.Regexp != nil {
+				buf.WriteString(" * @matches $" + name + " " + filter.Regexp.String() + "\n")
+			}
+			if filter.NotRegexp != nil {
+				buf.WriteString(" * @not-matches $" + name + " " + filter.NotRegexp.String() + "\n")
+			}
+			if filter.Values != nil {
+				values := make([]string, len(filter.Values))
+				for i, v := range filter.Values {
+					values[i] = v.String()
+				}
+				buf.WriteString(" * @value $" + name + " " + strings.Join(values, ", ") + "\n")
+			}
+			if filter.NotValues != nil {
+				values := make([]string, len(filter.NotValues))
+				for i, v := range filter.NotValues {
+					values[i] = v.String()
+				}
+				buf.WriteString(" * @not-value $" + name + " " + strings.Join(values, ", ") + "\n")
+			}
 		}
 		if i != len(r.Filters)-1 {
 			buf.WriteString(" * @or\n")
 		}
 	}
 
+	for _, test := range r.Tests {
+		if test.Match {
+			buf.WriteString(" * @test-match " + test.Code + "\n")
+		} else {
+			buf.WriteString(" * @test-nomatch " + test.Code + "\n")
+		}
+	}
+
 	buf.WriteString(" */")
 
 	return buf.String()
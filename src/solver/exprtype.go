@@ -58,7 +58,7 @@ func ExprType(sc *meta.Scope, cs *meta.ClassParseState, n node.Node) meta.TypesM
 func ExprTypeCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node, custom []CustomType) meta.TypesMap {
 	m := ExprTypeLocalCustom(sc, cs, n, custom)
 
-	if !meta.IsIndexingComplete() {
+	if !cs.Info.IsIndexingComplete() {
 		return m
 	}
 	if m.IsResolved() {
@@ -77,7 +77,7 @@ func ExprTypeCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node, custo
 			}
 		}()
 
-		for kk := range resolveType(cs.CurrentClass, k, visitedMap) {
+		for kk := range resolveType(cs.Info, cs.CurrentClass, k, visitedMap) {
 			newMap[kk] = struct{}{}
 		}
 	})
@@ -89,12 +89,12 @@ func ExprTypeCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node, custo
 }
 
 func internalFuncType(nm string, sc *meta.Scope, cs *meta.ClassParseState, c *expr.FunctionCall, custom []CustomType) (typ meta.TypesMap, ok bool) {
-	fn, ok := meta.GetInternalFunctionInfo(nm)
+	fn, ok := cs.Info.GetInternalFunctionInfo(nm)
 	if !ok || fn.Typ.IsEmpty() {
 		return meta.TypesMap{}, false
 	}
 
-	override, ok := meta.GetInternalFunctionOverrideInfo(nm)
+	override, ok := cs.Info.GetInternalFunctionOverrideInfo(nm)
 	if !ok || len(c.ArgumentList.Arguments) <= override.ArgNum {
 		return fn.Typ, true
 	}
@@ -115,7 +115,7 @@ func internalFuncType(nm string, sc *meta.Scope, cs *meta.ClassParseState, c *ex
 	return meta.TypesMap{}, false
 }
 
-func arrayType(items []*expr.ArrayItem) meta.TypesMap {
+func arrayType(sc *meta.Scope, cs *meta.ClassParseState, items []*expr.ArrayItem, custom []CustomType) meta.TypesMap {
 	if len(items) == 0 {
 		// Used as a placeholder until more specific type is discovered.
 		//
@@ -129,6 +129,10 @@ func arrayType(items []*expr.ArrayItem) meta.TypesMap {
 		return meta.NewTypesMap("empty_array")
 	}
 
+	if shape, ok := arrayShapeType(sc, cs, items, custom); ok {
+		return shape
+	}
+
 	if len(items) > 0 {
 		switch {
 		case isConstantStringArray(items):
@@ -143,6 +147,93 @@ func arrayType(items []*expr.ArrayItem) meta.TypesMap {
 	return meta.NewTypesMap("mixed[]")
 }
 
+// arrayShapeType infers a shape type for array literals
+// that have only constant keys, at least one of them being a string.
+//
+// For example, `['id' => 1, 'name' => $name]` is inferred
+// as `array{id:int,name:<type of $name>}`.
+func arrayShapeType(sc *meta.Scope, cs *meta.ClassParseState, items []*expr.ArrayItem, custom []CustomType) (meta.TypesMap, bool) {
+	props := make([]meta.ShapeProp, 0, len(items))
+	haveStringKeys := false
+	for _, item := range items {
+		if item == nil || item.Val == nil {
+			return meta.TypesMap{}, false
+		}
+		key, isString, ok := ShapeKey(item.Key)
+		if !ok {
+			return meta.TypesMap{}, false
+		}
+		if isString {
+			haveStringKeys = true
+		}
+		props = SetShapeProp(props, key, ExprTypeLocalCustom(sc, cs, item.Val, custom))
+	}
+
+	if !haveStringKeys {
+		return meta.TypesMap{}, false
+	}
+
+	return meta.NewTypesMap(meta.NewInlineShape(props)), true
+}
+
+// ShapeKey returns a shape key for the array item key node.
+//
+// Only constant string and int keys can be used as shape keys.
+// String keys should be valid identifiers, so they can be
+// printed in a phpdoc-compatible way.
+// Int-like string keys are converted to int keys, like PHP does.
+func ShapeKey(n node.Node) (key string, isString, ok bool) {
+	switch n := n.(type) {
+	case *scalar.Lnumber:
+		return n.Value, false, true
+	case *scalar.String:
+		key = n.Value[len(`"`) : len(n.Value)-len(`"`)]
+		if isIntKey(key) {
+			return key, false, true
+		}
+		return key, true, isIdentKey(key)
+	}
+	return "", false, false
+}
+
+// SetShapeProp adds a key-type pair to shape props.
+// If the key is already present, its type is replaced.
+func SetShapeProp(props []meta.ShapeProp, key string, typ meta.TypesMap) []meta.ShapeProp {
+	for i := range props {
+		if props[i].Key == key {
+			props[i].Typ = typ
+			return props
+		}
+	}
+	return append(props, meta.ShapeProp{Key: key, Typ: typ})
+}
+
+func isIntKey(s string) bool {
+	if s == "" || (s[0] == '0' && len(s) > 1) {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, ch := range s {
+		isLetter := ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+		isDigit := ch >= '0' && ch <= '9'
+		if !isLetter && !(isDigit && i != 0) {
+			return false
+		}
+	}
+	return true
+}
+
 func isConstantStringArray(items []*expr.ArrayItem) bool {
 	for _, item := range items {
 		if _, ok := item.Val.(*scalar.String); !ok {
@@ -295,6 +386,16 @@ func exprTypeLocalCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node,
 		res := make(map[string]struct{}, m.Len())
 
 		m.Iterate(func(className string) {
+			if meta.IsInlineShape(className) {
+				// Like with ElemOf(ArrayOf(typ)), we can
+				// get the element type without resolving.
+				if key, _, ok := ShapeKey(n.Dim); ok {
+					if typ, ok := meta.FindInlineShapeProp(className, key); ok {
+						typ.Iterate(func(t string) { res[t] = struct{}{} })
+						return
+					}
+				}
+			}
 			switch dim := n.Dim.(type) {
 			case *scalar.String:
 				key := dim.Value[len(`"`) : len(dim.Value)-len(`"`)]
@@ -321,7 +422,7 @@ func exprTypeLocalCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node,
 	case *binary.Concat:
 		return meta.PreciseStringType
 	case *expr.Array:
-		return arrayType(n.Items)
+		return arrayType(sc, cs, n.Items, custom)
 	case *expr.BooleanNot, *binary.BooleanAnd, *binary.BooleanOr,
 		*binary.Equal, *binary.NotEqual, *binary.Identical, *binary.NotIdentical,
 		*binary.Greater, *binary.GreaterOrEqual,
@@ -0,0 +1,567 @@
+package solver
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/php/parser/node"
+	"github.com/VKCOM/noverify/src/php/parser/node/expr"
+	"github.com/VKCOM/noverify/src/php/parser/node/expr/binary"
+	"github.com/VKCOM/noverify/src/php/parser/node/name"
+	"github.com/VKCOM/noverify/src/php/parser/node/scalar"
+)
+
+// ExprValue returns a statically computed value of the constant expression.
+//
+// Constants are resolved using the global meta info, so it should only
+// be used after the indexing is complete.
+// If expression value can't be computed, ConstUndefined value is returned.
+func ExprValue(cs *meta.ClassParseState, n node.Node) meta.ConstValue {
+	ev := valueEvaluator{cs: cs}
+	return ev.eval(n)
+}
+
+// ExprValueLocal is like ExprValue, but it doesn't use the global meta info.
+//
+// It's intended to be used during the indexing: only the current
+// class constants from classConsts are resolved. References to other
+// constants are kept as ConstRef values, so the result can be resolved
+// with ResolveValue after the indexing is complete.
+func ExprValueLocal(cs *meta.ClassParseState, classConsts meta.ConstantsMap, n node.Node) meta.ConstValue {
+	ev := valueEvaluator{cs: cs, local: true, classConsts: classConsts}
+	return ev.eval(n)
+}
+
+// ResolveValue computes the value returned by ExprValueLocal
+// using the global meta info, see ConstRef.
+// If the value can't be resolved, ConstUndefined value is returned.
+func ResolveValue(info *meta.Info, v meta.ConstValue) meta.ConstValue {
+	r := valueResolver{info: info, visited: make(map[string]bool)}
+	return r.resolve(v)
+}
+
+type valueEvaluator struct {
+	cs          *meta.ClassParseState
+	local       bool
+	classConsts meta.ConstantsMap
+}
+
+func (ev *valueEvaluator) eval(n node.Node) meta.ConstValue {
+	switch n := n.(type) {
+	case *scalar.Lnumber:
+		x, err := strconv.ParseInt(strings.ReplaceAll(n.Value, "_", ""), 0, 64)
+		if err != nil {
+			return meta.ConstValue{}
+		}
+		return meta.NewIntValue(x)
+	case *scalar.Dnumber:
+		x, err := strconv.ParseFloat(strings.ReplaceAll(n.Value, "_", ""), 64)
+		if err != nil {
+			return meta.ConstValue{}
+		}
+		return meta.NewFloatValue(x)
+	case *scalar.String:
+		s, ok := InterpretString(n.Value)
+		if !ok {
+			return meta.ConstValue{}
+		}
+		return meta.NewStringValue(s)
+
+	case *expr.ConstFetch:
+		return ev.evalConstFetch(n)
+	case *expr.ClassConstFetch:
+		return ev.evalClassConstFetch(n)
+	case *expr.Array:
+		return ev.evalArray(n.Items)
+
+	case *expr.UnaryPlus:
+		return ev.apply("+x", n.Expr)
+	case *expr.UnaryMinus:
+		return ev.apply("-x", n.Expr)
+	case *expr.BooleanNot:
+		return ev.apply("!", n.Expr)
+	case *expr.BitwiseNot:
+		return ev.apply("~", n.Expr)
+
+	case *binary.Concat:
+		return ev.apply(".", n.Left, n.Right)
+	case *binary.Plus:
+		return ev.apply("+", n.Left, n.Right)
+	case *binary.Minus:
+		return ev.apply("-", n.Left, n.Right)
+	case *binary.Mul:
+		return ev.apply("*", n.Left, n.Right)
+	case *binary.Div:
+		return ev.apply("/", n.Left, n.Right)
+	case *binary.Mod:
+		return ev.apply("%", n.Left, n.Right)
+	case *binary.BitwiseOr:
+		return ev.apply("|", n.Left, n.Right)
+	case *binary.BitwiseAnd:
+		return ev.apply("&", n.Left, n.Right)
+	case *binary.BitwiseXor:
+		return ev.apply("^", n.Left, n.Right)
+	case *binary.ShiftLeft:
+		return ev.apply("<<", n.Left, n.Right)
+	case *binary.ShiftRight:
+		return ev.apply(">>", n.Left, n.Right)
+	}
+
+	return meta.ConstValue{}
+}
+
+// apply evaluates the operands and computes the operator result.
+// If some operands are not resolved yet, the ConstExpr value is returned.
+func (ev *valueEvaluator) apply(op string, operands ...node.Node) meta.ConstValue {
+	args := make([]meta.ConstArrayItem, len(operands))
+	for i, n := range operands {
+		args[i].Val = ev.eval(n)
+	}
+	return lazyOrApply(op, args)
+}
+
+func lazyOrApply(op string, args []meta.ConstArrayItem) meta.ConstValue {
+	lazy := false
+	for _, arg := range args {
+		if arg.Val.Kind == meta.ConstUndefined {
+			return meta.ConstValue{}
+		}
+		if arg.Key.IsLazy() || arg.Val.IsLazy() {
+			lazy = true
+		}
+	}
+	if lazy {
+		return meta.ConstValue{Kind: meta.ConstExpr, Str: op, Items: args}
+	}
+	return applyOp(op, args)
+}
+
+// applyOp computes the operator result for the known operands.
+func applyOp(op string, args []meta.ConstArrayItem) meta.ConstValue {
+	if op == "[]" {
+		return arrayValue(args)
+	}
+
+	x := args[0].Val
+	switch op {
+	case "+x":
+		if x.Kind == meta.ConstInt || x.Kind == meta.ConstFloat {
+			return x
+		}
+		return meta.ConstValue{}
+	case "-x":
+		switch x.Kind {
+		case meta.ConstInt:
+			if x.Int != math.MinInt64 {
+				return meta.NewIntValue(-x.Int)
+			}
+		case meta.ConstFloat:
+			return meta.NewFloatValue(-x.Float)
+		}
+		return meta.ConstValue{}
+	case "!":
+		if b, ok := x.ToBool(); ok {
+			return meta.NewBoolValue(!b)
+		}
+		return meta.ConstValue{}
+	case "~":
+		if x.Kind == meta.ConstInt {
+			return meta.NewIntValue(^x.Int)
+		}
+		return meta.ConstValue{}
+	}
+
+	y := args[1].Val
+	switch op {
+	case ".":
+		a, ok1 := scalarValue(x).ToString()
+		b, ok2 := scalarValue(y).ToString()
+		if ok1 && ok2 {
+			return meta.NewStringValue(a + b)
+		}
+	case "+":
+		if x.Kind == meta.ConstArray && y.Kind == meta.ConstArray {
+			return arrayUnionValue(x, y)
+		}
+		return arithValue('+', x, y)
+	case "-":
+		return arithValue('-', x, y)
+	case "*":
+		return arithValue('*', x, y)
+	case "/":
+		return arithValue('/', x, y)
+	case "%":
+		return intOpValue('%', x, y)
+	case "|":
+		return intOpValue('|', x, y)
+	case "&":
+		return intOpValue('&', x, y)
+	case "^":
+		return intOpValue('^', x, y)
+	case "<<":
+		return intOpValue('<', x, y)
+	case ">>":
+		return intOpValue('>', x, y)
+	}
+	return meta.ConstValue{}
+}
+
+func scalarValue(v meta.ConstValue) meta.ConstValue {
+	if !v.IsScalar() {
+		return meta.ConstValue{}
+	}
+	return v
+}
+
+func (ev *valueEvaluator) evalConstFetch(n *expr.ConstFetch) meta.ConstValue {
+	if nm, ok := n.Constant.(*name.Name); ok && len(nm.Parts) == 1 {
+		switch strings.ToLower(nm.Parts[0].(*name.NamePart).Value) {
+		case "true":
+			return meta.NewBoolValue(true)
+		case "false":
+			return meta.NewBoolValue(false)
+		case "null":
+			return meta.ConstValue{Kind: meta.ConstNull}
+		}
+	}
+
+	if ev.local {
+		// Names are resolved the same way GetConstant does.
+		switch nm := n.Constant.(type) {
+		case *name.Name:
+			nameStr := meta.NameToString(nm)
+			ref := meta.ConstValue{Kind: meta.ConstRef, Str: ev.cs.Namespace + `\` + nameStr}
+			if ev.cs.Namespace == "" {
+				return ref
+			}
+			fallback := meta.ConstValue{Kind: meta.ConstRef, Str: `\` + nameStr}
+			return meta.ConstValue{
+				Kind:  meta.ConstExpr,
+				Str:   "??",
+				Items: []meta.ConstArrayItem{{Val: ref}, {Val: fallback}},
+			}
+		case *name.FullyQualified:
+			return meta.ConstValue{Kind: meta.ConstRef, Str: meta.FullyQualifiedToString(nm)}
+		}
+		return meta.ConstValue{}
+	}
+
+	_, ci, ok := GetConstant(ev.cs, n.Constant)
+	if !ok {
+		return meta.ConstValue{}
+	}
+	return ResolveValue(ev.cs.Info, ci.Value)
+}
+
+func (ev *valueEvaluator) evalClassConstFetch(n *expr.ClassConstFetch) meta.ConstValue {
+	if ident, ok := n.Class.(*node.Identifier); ok && ident.Value == "static" {
+		// static:: depends on the late static binding.
+		return meta.ConstValue{}
+	}
+	className, ok := GetClassName(ev.cs, n.Class)
+	if !ok {
+		return meta.ConstValue{}
+	}
+	constName := n.ConstantName.Value
+	if constName == "class" {
+		return meta.NewStringValue(strings.TrimPrefix(className, `\`))
+	}
+
+	if ev.local {
+		if className == ev.cs.CurrentClass {
+			if ci, ok := ev.classConsts[constName]; ok {
+				return ci.Value
+			}
+		}
+		return meta.ConstValue{Kind: meta.ConstRef, Str: className + "::" + constName}
+	}
+
+	ci, _, ok := FindConstant(ev.cs.Info, className, constName)
+	if !ok {
+		return meta.ConstValue{}
+	}
+	return ResolveValue(ev.cs.Info, ci.Value)
+}
+
+func (ev *valueEvaluator) evalArray(items []*expr.ArrayItem) meta.ConstValue {
+	args := make([]meta.ConstArrayItem, 0, len(items))
+	for _, item := range items {
+		if item == nil || item.Val == nil {
+			// Trailing comma or a list() placeholder.
+			continue
+		}
+		var arg meta.ConstArrayItem
+		if item.Key != nil {
+			arg.Key = ev.eval(item.Key)
+			if arg.Key.Kind == meta.ConstUndefined {
+				return meta.ConstValue{}
+			}
+		}
+		arg.Val = ev.eval(item.Val)
+		args = append(args, arg)
+	}
+	return lazyOrApply("[]", args)
+}
+
+// arrayValue builds an array from the items with the known values,
+// items without keys are ConstUndefined.
+func arrayValue(items []meta.ConstArrayItem) meta.ConstValue {
+	result := meta.ConstValue{Kind: meta.ConstArray}
+	var nextIndex int64
+	for _, item := range items {
+		var key meta.ConstValue
+		if item.Key.Kind == meta.ConstUndefined {
+			key = meta.NewIntValue(nextIndex)
+		} else {
+			var ok bool
+			key, ok = item.Key.ArrayKey()
+			if !ok {
+				return meta.ConstValue{}
+			}
+		}
+		if key.Kind == meta.ConstInt && key.Int >= nextIndex {
+			nextIndex = key.Int + 1
+		}
+
+		result.Items = setArrayItemValue(result.Items, key, item.Val)
+	}
+	return result
+}
+
+// valueResolver resolves the lazy values, see ResolveValue.
+type valueResolver struct {
+	info *meta.Info
+
+	// visited are the constants that are being resolved,
+	// they are tracked to break the reference cycles.
+	visited map[string]bool
+}
+
+func (r *valueResolver) resolve(v meta.ConstValue) meta.ConstValue {
+	switch v.Kind {
+	case meta.ConstRef:
+		ci, ok := r.findConstant(v.Str)
+		if !ok || r.visited[v.Str] {
+			return meta.ConstValue{}
+		}
+		r.visited[v.Str] = true
+		res := r.resolve(ci.Value)
+		delete(r.visited, v.Str)
+		return res
+
+	case meta.ConstExpr:
+		if v.Str == "??" {
+			// The first existing constant is used.
+			for _, item := range v.Items {
+				if _, ok := r.findConstant(item.Val.Str); ok {
+					return r.resolve(item.Val)
+				}
+			}
+			return meta.ConstValue{}
+		}
+
+		args := make([]meta.ConstArrayItem, len(v.Items))
+		for i, item := range v.Items {
+			args[i].Key = r.resolve(item.Key)
+			args[i].Val = r.resolve(item.Val)
+			if args[i].Val.Kind == meta.ConstUndefined || (item.Key.Kind != meta.ConstUndefined && args[i].Key.Kind == meta.ConstUndefined) {
+				return meta.ConstValue{}
+			}
+		}
+		return applyOp(v.Str, args)
+	}
+	return v
+}
+
+// findConstant finds the constant by its ConstRef name.
+func (r *valueResolver) findConstant(ref string) (meta.ConstantInfo, bool) {
+	if i := strings.Index(ref, "::"); i != -1 {
+		ci, _, ok := FindConstant(r.info, ref[:i], ref[i+len("::"):])
+		return ci, ok
+	}
+	return r.info.GetConstant(ref)
+}
+
+func setArrayItemValue(items []meta.ConstArrayItem, key, val meta.ConstValue) []meta.ConstArrayItem {
+	for i := range items {
+		if sameArrayKey(items[i].Key, key) {
+			items[i].Val = val
+			return items
+		}
+	}
+	return append(items, meta.ConstArrayItem{Key: key, Val: val})
+}
+
+// sameArrayKey reports whether normalized array keys x and y are identical.
+func sameArrayKey(x, y meta.ConstValue) bool {
+	return x.Kind == y.Kind && x.Int == y.Int && x.Str == y.Str
+}
+
+func arrayUnionValue(x, y meta.ConstValue) meta.ConstValue {
+	result := meta.ConstValue{Kind: meta.ConstArray}
+	result.Items = append(result.Items, x.Items...)
+	for _, item := range y.Items {
+		found := false
+		for _, existing := range x.Items {
+			if sameArrayKey(existing.Key, item.Key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Items = append(result.Items, item)
+		}
+	}
+	return result
+}
+
+func arithValue(op byte, x, y meta.ConstValue) meta.ConstValue {
+	if !x.IsScalar() || !y.IsScalar() {
+		return meta.ConstValue{}
+	}
+
+	if x.Kind == meta.ConstInt && y.Kind == meta.ConstInt {
+		a, b := x.Int, y.Int
+		switch op {
+		case '+':
+			if r := a + b; (r > a) == (b > 0) {
+				return meta.NewIntValue(r)
+			}
+		case '-':
+			if r := a - b; (r < a) == (b > 0) {
+				return meta.NewIntValue(r)
+			}
+		case '*':
+			if a == 0 || b == 0 {
+				return meta.NewIntValue(0)
+			}
+			if r := a * b; r/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+				return meta.NewIntValue(r)
+			}
+		case '/':
+			if b != 0 && a%b == 0 && !(a == math.MinInt64 && b == -1) {
+				return meta.NewIntValue(a / b)
+			}
+		}
+	}
+
+	a, ok1 := x.ToFloat()
+	b, ok2 := y.ToFloat()
+	if !ok1 || !ok2 {
+		return meta.ConstValue{}
+	}
+	switch op {
+	case '+':
+		return meta.NewFloatValue(a + b)
+	case '-':
+		return meta.NewFloatValue(a - b)
+	case '*':
+		return meta.NewFloatValue(a * b)
+	case '/':
+		if b != 0 {
+			return meta.NewFloatValue(a / b)
+		}
+	}
+	return meta.ConstValue{}
+}
+
+func intOpValue(op byte, x, y meta.ConstValue) meta.ConstValue {
+	if !x.IsScalar() || !y.IsScalar() {
+		return meta.ConstValue{}
+	}
+	a, ok1 := x.ToInt()
+	b, ok2 := y.ToInt()
+	if !ok1 || !ok2 {
+		return meta.ConstValue{}
+	}
+	switch op {
+	case '%':
+		if b != 0 && b != -1 {
+			return meta.NewIntValue(a % b)
+		}
+		if b == -1 {
+			return meta.NewIntValue(0)
+		}
+	case '|':
+		return meta.NewIntValue(a | b)
+	case '&':
+		return meta.NewIntValue(a & b)
+	case '^':
+		return meta.NewIntValue(a ^ b)
+	case '<':
+		if b >= 0 && b < 64 {
+			return meta.NewIntValue(a << uint(b))
+		}
+	case '>':
+		if b >= 0 && b < 64 {
+			return meta.NewIntValue(a >> uint(b))
+		}
+	}
+	return meta.ConstValue{}
+}
+
+// InterpretString returns the string literal value the way PHP sees it.
+//
+// Double-quoted literals with escapes that are not trivial to
+// interpret (octal, hex and unicode sequences) are not supported.
+func InterpretString(lit string) (string, bool) {
+	if len(lit) < 2 {
+		return "", false
+	}
+	quote := lit[0]
+	s := lit[1 : len(lit)-1]
+	if quote == '\'' {
+		if !strings.Contains(s, `\`) {
+			return s, true
+		}
+		var sb strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '\\' || s[i+1] == '\'') {
+				i++
+			}
+			sb.WriteByte(s[i])
+		}
+		return sb.String(), true
+	}
+	if quote != '"' {
+		return "", false
+	}
+
+	if !strings.Contains(s, `\`) {
+		return s, true
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch != '\\' || i+1 == len(s) {
+			sb.WriteByte(ch)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'e':
+			sb.WriteByte(0x1b)
+		case '\\', '$', '"':
+			sb.WriteByte(s[i])
+		case 'x', 'u', '0', '1', '2', '3', '4', '5', '6', '7':
+			return "", false
+		default:
+			// Unknown escape sequences are left as is.
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), true
+}
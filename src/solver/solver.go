@@ -20,25 +20,26 @@ func mixedType() map[string]struct{} {
 
 // ResolveType resolves function calls, method calls and global variables.
 //   curStaticClass is current class name (if inside the class, otherwise "")
-func resolveType(curStaticClass, typ string, visitedMap map[string]struct{}) (result map[string]struct{}) {
-	r := resolver{visited: visitedMap}
+func resolveType(info *meta.Info, curStaticClass, typ string, visitedMap map[string]struct{}) (result map[string]struct{}) {
+	r := resolver{info: info, visited: visitedMap}
 	return r.resolveType(curStaticClass, typ)
 }
 
 // ResolveTypes resolves function calls, method calls and global variables.
 //   curStaticClass is current class name (if inside the class, otherwise "")
-func ResolveTypes(curStaticClass string, m meta.TypesMap, visitedMap map[string]struct{}) map[string]struct{} {
-	r := resolver{visited: visitedMap}
+func ResolveTypes(info *meta.Info, curStaticClass string, m meta.TypesMap, visitedMap map[string]struct{}) map[string]struct{} {
+	r := resolver{info: info, visited: visitedMap}
 	return r.resolveTypes(curStaticClass, m)
 }
 
 type resolver struct {
+	info    *meta.Info
 	visited map[string]struct{}
 }
 
 func (r *resolver) collectMethodCallTypes(out, possibleTypes map[string]struct{}, methodName string) map[string]struct{} {
 	for className := range possibleTypes {
-		m, ok := FindMethod(className, methodName)
+		m, ok := FindMethod(r.info, className, methodName)
 		if ok {
 			for tt := range r.resolveTypes(className, m.Info.Typ) {
 				out[tt] = struct{}{}
@@ -75,14 +76,14 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 
 	switch typ[0] {
 	case meta.WGlobal:
-		varTyp, ok := meta.Info.GetVarNameType(meta.UnwrapGlobal(typ))
+		varTyp, ok := r.info.GetVarNameType(meta.UnwrapGlobal(typ))
 		if ok {
 			for tt := range r.resolveTypes(class, varTyp) {
 				res[tt] = struct{}{}
 			}
 		}
 	case meta.WConstant:
-		ci, ok := meta.Info.GetConstant(meta.UnwrapConstant(typ))
+		ci, ok := r.info.GetConstant(meta.UnwrapConstant(typ))
 		if ok {
 			for tt := range r.resolveTypes(class, ci.Typ) {
 				res[tt] = struct{}{}
@@ -98,19 +99,19 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 			if strings.HasPrefix(tt, `\shape$`) {
 				res = r.solveElemOfShape(class, tt, key, res)
 			} else {
-				res = r.solveElemOf(tt, res)
+				res = r.solveElemOf(class, tt, res)
 			}
 		}
 	case meta.WElemOf:
 		for tt := range r.resolveType(class, meta.UnwrapElemOf(typ)) {
-			res = r.solveElemOf(tt, res)
+			res = r.solveElemOf(class, tt, res)
 		}
 	case meta.WFunctionCall:
 		nm := meta.UnwrapFunctionCall(typ)
-		fn, ok := meta.Info.GetFunction(nm)
+		fn, ok := r.info.GetFunction(nm)
 		// functions can fall back to root namespace
 		if !ok && strings.Count(nm, `\`) > 1 {
-			fn, ok = meta.Info.GetFunction(nm[strings.LastIndex(nm, `\`):])
+			fn, ok = r.info.GetFunction(nm[strings.LastIndex(nm, `\`):])
 		}
 
 		if ok {
@@ -129,7 +130,7 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 		expr, propertyName := meta.UnwrapInstancePropertyFetch(typ)
 
 		for className := range r.resolveType(class, expr) {
-			p, ok := FindProperty(className, propertyName)
+			p, ok := FindProperty(r.info, className, propertyName)
 			if ok {
 				for tt := range r.resolveTypes(class, p.Info.Typ) {
 					res[tt] = struct{}{}
@@ -138,36 +139,36 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 				// If there is a __get method, it might have
 				// a @return annotation that will help to
 				// get appropriate type for dynamic property lookup.
-				m, ok := FindMethod(className, "__get")
+				m, ok := FindMethod(r.info, className, "__get")
 				if ok {
 					return r.resolveTypes(class, m.Info.Typ)
 				}
 			}
 		}
 	case meta.WBaseMethodParam:
-		return solveBaseMethodParam(class, typ, visitedMap, res)
+		return solveBaseMethodParam(r.info, class, typ, visitedMap, res)
 	case meta.WStaticMethodCall:
 		className, methodName := meta.UnwrapStaticMethodCall(typ)
-		m, ok := FindMethod(className, methodName)
+		m, ok := FindMethod(r.info, className, methodName)
 		if ok {
 			return r.resolveTypes(className, m.Info.Typ)
 		}
-		m, ok = FindMethod(className, "__callStatic")
+		m, ok = FindMethod(r.info, className, "__callStatic")
 		if ok {
 			return r.resolveTypes(className, m.Info.Typ)
 		}
 
 	case meta.WStaticPropertyFetch:
 		className, propertyName := meta.UnwrapStaticPropertyFetch(typ)
-		p, ok := FindProperty(className, propertyName)
+		p, ok := FindProperty(r.info, className, propertyName)
 		if ok {
 			return r.resolveTypes(class, p.Info.Typ)
 		}
 	case meta.WClassConstFetch:
 		className, constName := meta.UnwrapClassConstFetch(typ)
-		info, _, ok := FindConstant(className, constName)
+		ci, _, ok := FindConstant(r.info, className, constName)
 		if ok {
-			return r.resolveTypes(class, info.Typ)
+			return r.resolveTypes(class, ci.Typ)
 		}
 	default:
 		panic(fmt.Sprintf("Unexpected type: %d", typ[0]))
@@ -176,13 +177,13 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 	return res
 }
 
-func solveBaseMethodParam(curStaticClass, typ string, visitedMap, res map[string]struct{}) map[string]struct{} {
+func solveBaseMethodParam(info *meta.Info, curStaticClass, typ string, visitedMap, res map[string]struct{}) map[string]struct{} {
 	index, className, methodName := meta.UnwrapBaseMethodParam(typ)
-	class, ok := meta.Info.GetClass(className)
+	class, ok := info.GetClass(className)
 	if ok {
 		// TODO(quasilyte): walk parent interfaces as well?
 		for ifaceName := range class.Interfaces {
-			iface, ok := meta.Info.GetClass(ifaceName)
+			iface, ok := info.GetClass(ifaceName)
 			if !ok {
 				continue
 			}
@@ -191,7 +192,7 @@ func solveBaseMethodParam(curStaticClass, typ string, visitedMap, res map[string
 				continue
 			}
 			if len(fn.Params) > int(index) {
-				return ResolveTypes(curStaticClass, fn.Params[index].Typ, visitedMap)
+				return ResolveTypes(info, curStaticClass, fn.Params[index].Typ, visitedMap)
 			}
 		}
 	}
@@ -199,7 +200,17 @@ func solveBaseMethodParam(curStaticClass, typ string, visitedMap, res map[string
 }
 
 func (r *resolver) solveElemOfShape(class, shapeName, key string, res map[string]struct{}) map[string]struct{} {
-	shape, ok := meta.Info.GetClass(shapeName)
+	if meta.IsInlineShape(shapeName) {
+		typ, ok := meta.FindInlineShapeProp(shapeName, key)
+		if ok {
+			for tt := range r.resolveTypes(class, typ) {
+				res[tt] = struct{}{}
+			}
+		}
+		return res
+	}
+
+	shape, ok := r.info.GetClass(shapeName)
 	if !ok {
 		return res
 	}
@@ -212,21 +223,28 @@ func (r *resolver) solveElemOfShape(class, shapeName, key string, res map[string
 	return res
 }
 
-func (r *resolver) solveElemOf(tt string, res map[string]struct{}) map[string]struct{} {
+func (r *resolver) solveElemOf(class, tt string, res map[string]struct{}) map[string]struct{} {
 	switch {
 	case strings.HasSuffix(tt, "[]"):
 		res[strings.TrimSuffix(tt, "[]")] = struct{}{}
 	case tt == "mixed":
 		res["mixed"] = struct{}{}
-	case Implements(tt, `\ArrayAccess`):
-		m, ok := FindMethod(tt, "offsetGet")
+	case meta.IsInlineShape(tt):
+		// Element of unknown key can be any of the shape elements.
+		for _, p := range meta.InlineShapeProps(tt) {
+			for tt := range r.resolveTypes(class, p.Typ) {
+				res[tt] = struct{}{}
+			}
+		}
+	case Implements(r.info, tt, `\ArrayAccess`):
+		m, ok := FindMethod(r.info, tt, "offsetGet")
 		if ok {
 			for tt := range r.resolveTypes(tt, m.Info.Typ) {
 				res[tt] = struct{}{}
 			}
 		}
-	case Implements(tt, `\Traversable`):
-		m, ok := FindMethod(tt, "current")
+	case Implements(r.info, tt, `\Traversable`):
+		m, ok := FindMethod(r.info, tt, "current")
 		if ok {
 			for tt := range r.resolveTypes(tt, m.Info.Typ) {
 				res[tt] = struct{}{}
@@ -260,7 +278,7 @@ func (r *resolver) resolveTypes(class string, m meta.TypesMap) map[string]struct
 		delete(res, "empty_array")
 		specialized := false
 		for tt := range res {
-			if strings.HasSuffix(tt, "[]") {
+			if strings.HasSuffix(tt, "[]") || meta.IsInlineShape(tt) {
 				specialized = true
 				break
 			}
@@ -288,7 +306,7 @@ func (m FindMethodResult) ImplName() string {
 }
 
 // FindMethod searches for a method in specified class
-func FindMethod(className string, methodName string) (FindMethodResult, bool) {
+func FindMethod(info *meta.Info, className string, methodName string) (FindMethodResult, bool) {
 	// We do 2 lookup attemps.
 	//
 	// The first round ignores interfaces inside hierarchy tree.
@@ -306,7 +324,7 @@ func FindMethod(className string, methodName string) (FindMethodResult, bool) {
 	// If we would process interfaces right away, a() would be returned
 	// from the A interface, but we want to get Base1.
 
-	return findMethod(className, methodName, make(map[string]struct{}))
+	return findMethod(info, className, methodName, make(map[string]struct{}))
 }
 
 func peekImplemented(a, b FindMethodResult) FindMethodResult {
@@ -316,7 +334,7 @@ func peekImplemented(a, b FindMethodResult) FindMethodResult {
 	return b
 }
 
-func findMethod(className string, methodName string, visitedMap map[string]struct{}) (FindMethodResult, bool) {
+func findMethod(info *meta.Info, className string, methodName string, visitedMap map[string]struct{}) (FindMethodResult, bool) {
 	var result FindMethodResult
 	found := false
 
@@ -326,18 +344,18 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 		}
 		visitedMap[className] = struct{}{}
 
-		class, ok := getClassOrTrait(className)
+		class, ok := getClassOrTrait(info, className)
 		if !ok {
 			break
 		}
 
-		info, ok := class.Methods.Get(methodName)
+		fn, ok := class.Methods.Get(methodName)
 		if ok {
 			found = true
 			result = peekImplemented(result, FindMethodResult{
-				Info:        info,
+				Info:        fn,
 				ClassName:   className,
-				Implemented: !info.IsAbstract(),
+				Implemented: !fn.IsAbstract(),
 			})
 			if result.Implemented {
 				return result, true
@@ -345,7 +363,7 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 		}
 
 		for trait := range class.Traits {
-			m, ok := findMethod(trait, methodName, visitedMap)
+			m, ok := findMethod(info, trait, methodName, visitedMap)
 			if ok {
 				found = true
 				result = peekImplemented(result, FindMethodResult{
@@ -364,7 +382,7 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 		// This loop is executed *only* when we're searching a method with interface
 		// as a root, so we don't need to check whether a method is implemented.
 		for _, parentIfaceName := range class.ParentInterfaces {
-			m, ok := findMethod(parentIfaceName, methodName, visitedMap)
+			m, ok := findMethod(info, parentIfaceName, methodName, visitedMap)
 			if ok {
 				m.Implemented = false
 				return m, true
@@ -372,7 +390,7 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 		}
 
 		for ifaceName := range class.Interfaces {
-			m, ok := findMethod(ifaceName, methodName, visitedMap)
+			m, ok := findMethod(info, ifaceName, methodName, visitedMap)
 			if ok {
 				found = true
 				m.Implemented = false
@@ -405,11 +423,11 @@ func (p FindPropertyResult) ImplName() string {
 }
 
 // FindProperty searches for a property in specified class (both static and instance properties)
-func FindProperty(className string, propertyName string) (FindPropertyResult, bool) {
-	return findProperty(className, propertyName, make(map[string]struct{}))
+func FindProperty(info *meta.Info, className string, propertyName string) (FindPropertyResult, bool) {
+	return findProperty(info, className, propertyName, make(map[string]struct{}))
 }
 
-func findProperty(className string, propertyName string, visitedMap map[string]struct{}) (FindPropertyResult, bool) {
+func findProperty(info *meta.Info, className string, propertyName string, visitedMap map[string]struct{}) (FindPropertyResult, bool) {
 	var result FindPropertyResult
 	for {
 		if _, ok := visitedMap[className]; ok {
@@ -417,20 +435,20 @@ func findProperty(className string, propertyName string, visitedMap map[string]s
 		}
 		visitedMap[className] = struct{}{}
 
-		class, ok := getClassOrTrait(className)
+		class, ok := getClassOrTrait(info, className)
 		if !ok || class.IsShape() {
 			return result, false
 		}
 
-		info, ok := class.Properties[propertyName]
+		p, ok := class.Properties[propertyName]
 		if ok {
-			result.Info = info
+			result.Info = p
 			result.ClassName = className
 			return result, true
 		}
 
 		for trait := range class.Traits {
-			p, ok := findProperty(trait, propertyName, visitedMap)
+			p, ok := findProperty(info, trait, propertyName, visitedMap)
 			if ok {
 				result.Info = p.Info
 				result.ClassName = className
@@ -450,11 +468,11 @@ func findProperty(className string, propertyName string, visitedMap map[string]s
 // Implements checks if className implements interfaceName
 //
 // Does not perform the actual method set comparison.
-func Implements(className string, interfaceName string) bool {
+func Implements(info *meta.Info, className string, interfaceName string) bool {
 	visited := make(map[string]struct{}, 8)
 
 	for {
-		class, ok := meta.Info.GetClass(className)
+		class, ok := info.GetClass(className)
 		if !ok {
 			return false
 		}
@@ -465,7 +483,7 @@ func Implements(className string, interfaceName string) bool {
 		}
 
 		for iface := range class.Interfaces {
-			if interfaceExtends(iface, interfaceName, visited) {
+			if interfaceExtends(info, iface, interfaceName, visited) {
 				return true
 			}
 		}
@@ -478,15 +496,35 @@ func Implements(className string, interfaceName string) bool {
 	}
 }
 
+// InstanceOf checks if className is typeName or its subtype.
+func InstanceOf(info *meta.Info, className, typeName string) bool {
+	visited := make(map[string]struct{}, 8)
+	for name := className; name != ""; {
+		if strings.EqualFold(name, typeName) {
+			return true
+		}
+		if _, ok := visited[name]; ok {
+			break
+		}
+		visited[name] = struct{}{}
+		class, ok := info.GetClass(name)
+		if !ok {
+			break
+		}
+		name = class.Parent
+	}
+	return Implements(info, className, typeName)
+}
+
 // interfaceExtends checks if interface orig extends interface parent
-func interfaceExtends(orig string, parent string, visited map[string]struct{}) bool {
+func interfaceExtends(info *meta.Info, orig string, parent string, visited map[string]struct{}) bool {
 	if _, ok := visited[orig]; ok {
 		return false
 	}
 
 	visited[orig] = struct{}{}
 
-	class, ok := meta.Info.GetClass(orig)
+	class, ok := info.GetClass(orig)
 	if !ok {
 		return false
 	}
@@ -496,7 +534,7 @@ func interfaceExtends(orig string, parent string, visited map[string]struct{}) b
 			return true
 		}
 
-		if interfaceExtends(iface, parent, visited) {
+		if interfaceExtends(info, iface, parent, visited) {
 			return true
 		}
 	}
@@ -505,12 +543,12 @@ func interfaceExtends(orig string, parent string, visited map[string]struct{}) b
 }
 
 // FindConstant searches for a costant in specified class and returns actual class that contains the constant.
-func FindConstant(className string, constName string) (res meta.ConstantInfo, implClassName string, ok bool) {
+func FindConstant(info *meta.Info, className string, constName string) (res meta.ConstantInfo, implClassName string, ok bool) {
 	visitedClasses := make(map[string]struct{}, 8) // expecting to be not so many inheritance levels
-	return findConstant(className, constName, visitedClasses)
+	return findConstant(info, className, constName, visitedClasses)
 }
 
-func findConstant(className string, constName string, visitedClasses map[string]struct{}) (res meta.ConstantInfo, implClassName string, ok bool) {
+func findConstant(info *meta.Info, className string, constName string, visitedClasses map[string]struct{}) (res meta.ConstantInfo, implClassName string, ok bool) {
 	for {
 		// check for inheritance loops
 		if _, ok := visitedClasses[className]; ok {
@@ -519,14 +557,14 @@ func findConstant(className string, constName string, visitedClasses map[string]
 
 		visitedClasses[className] = struct{}{}
 
-		class, ok := meta.Info.GetClass(className)
+		class, ok := info.GetClass(className)
 		if !ok {
 			return res, "", false
 		}
 
 		// inferfaces can have constants...
 		for ifaceName := range class.Interfaces {
-			res, implClassName, ok = findConstant(ifaceName, constName, visitedClasses)
+			res, implClassName, ok = findConstant(info, ifaceName, constName, visitedClasses)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -539,7 +577,7 @@ func findConstant(className string, constName string, visitedClasses map[string]
 
 		// interfaces support multiple inheritance and I use a separate property for that for now
 		for _, parentIfaceName := range class.ParentInterfaces {
-			res, implClassName, ok = findConstant(parentIfaceName, constName, visitedClasses)
+			res, implClassName, ok = findConstant(info, parentIfaceName, constName, visitedClasses)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -559,12 +597,12 @@ func identityType(typ string) map[string]struct{} {
 	return res
 }
 
-func getClassOrTrait(typeName string) (meta.ClassInfo, bool) {
-	class, ok := meta.Info.GetClass(typeName)
+func getClassOrTrait(info *meta.Info, typeName string) (meta.ClassInfo, bool) {
+	class, ok := info.GetClass(typeName)
 	if ok {
 		return class, true
 	}
-	trait, ok := meta.Info.GetTrait(typeName)
+	trait, ok := info.GetTrait(typeName)
 	if ok {
 		return trait, true
 	}
@@ -8,8 +8,8 @@ import (
 	"github.com/VKCOM/noverify/src/meta"
 )
 
-func resolve(typ string) map[string]struct{} {
-	return resolveType("", typ, make(map[string]struct{}))
+func resolve(info *meta.Info, typ string) map[string]struct{} {
+	return resolveType(info, "", typ, make(map[string]struct{}))
 }
 
 func makeTyp(typ string) map[string]struct{} {
@@ -45,23 +45,24 @@ func TestSolver(t *testing.T) {
 		},
 	})
 
-	meta.Info.AddToGlobalScopeNonLocked("test", sc)
-	meta.Info.AddFunctionsNonLocked("test", fm)
-	meta.Info.AddClassesNonLocked("test", cm)
+	info := meta.NewInfo()
+	info.AddToGlobalScopeNonLocked("test", sc)
+	info.AddFunctionsNonLocked("test", fm)
+	info.AddClassesNonLocked("test", cm)
 
-	if typ := resolve(meta.WrapFunctionCall(`\my_func`)); !typesEqual(typ, `array|bool|float`) {
+	if typ := resolve(info, meta.WrapFunctionCall(`\my_func`)); !typesEqual(typ, `array|bool|float`) {
 		t.Errorf("My func wrong type: %+v", typ)
 	}
 
-	if typ := resolve(meta.WrapGlobal(`MC`)); !typesEqual(typ, `Memcache`) {
+	if typ := resolve(info, meta.WrapGlobal(`MC`)); !typesEqual(typ, `Memcache`) {
 		t.Errorf("Global $MC wrong: %+v", typ)
 	}
 
-	if typ := resolve(meta.WrapStaticPropertyFetch(`\Test`, `$instance`)); !typesEqual(typ, `\Test`) {
+	if typ := resolve(info, meta.WrapStaticPropertyFetch(`\Test`, `$instance`)); !typesEqual(typ, `\Test`) {
 		t.Errorf(`\Test::$instance wrong: %+v`, typ)
 	}
 
-	if typ := resolve(meta.WrapInstanceMethodCall(meta.WrapStaticPropertyFetch(`\Test`, `$instance`), `do_something`)); !typesEqual(typ, `string`) {
+	if typ := resolve(info, meta.WrapInstanceMethodCall(meta.WrapStaticPropertyFetch(`\Test`, `$instance`), `do_something`)); !typesEqual(typ, `string`) {
 		t.Errorf(`\Test::$instance::do_something() wrong: %+v`, typ)
 	}
 }